@@ -7,6 +7,12 @@
 
 package conf
 
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+	"net"
+)
+
 // Contains Database config params
 type Database struct {
 	Name     string
@@ -14,4 +20,27 @@ type Database struct {
 	Password string
 	Address  string
 	Port     string
+	// Path to the embedded database file used when Postgres is not
+	// configured
+	Path string
+}
+
+// NewDatabase reads the database connection parameters from the viper object
+func NewDatabase(vip *viper.Viper) (Database, error) {
+	var db Database
+
+	rawAddr := vip.GetString("database.address")
+	if rawAddr != "" {
+		var err error
+		db.Address, db.Port, err = net.SplitHostPort(rawAddr)
+		if err != nil {
+			return db, errors.Errorf("Unable to get database port from %s: %+v", rawAddr, err)
+		}
+	}
+	db.Name = vip.GetString("database.name")
+	db.Username = vip.GetString("database.username")
+	db.Password = vip.GetString("database.password")
+	db.Path = vip.GetString("database.path")
+
+	return db, nil
 }
@@ -20,6 +20,7 @@ var ExpectedDatabase = Database{
 	Password: "password",
 	Address:  "127.0.0.1",
 	Port:     "80",
+	Path:     "~/.elixxir/node.db",
 }
 
 // This test checks that unmarshalling the params.yaml file
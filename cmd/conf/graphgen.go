@@ -7,10 +7,18 @@
 
 package conf
 
+import "time"
+
 // Contains graph generator config params
 type GraphGen struct {
 	minInputSize    uint32
 	defaultNumTh    uint8
 	outputSize      uint32
 	outputThreshold float32
+	moduleTimeout   time.Duration
+	poolSize        int
+	numWorkers      uint8
+	// Files describing graphs to run in place of the graphs of the same name
+	// in devMode
+	devGraphs []string
 }
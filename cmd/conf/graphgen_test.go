@@ -7,11 +7,17 @@
 
 package conf
 
-import "runtime"
+import (
+	"gitlab.com/elixxir/server/services"
+	"runtime"
+)
 
 var ExpectedGraphGen = GraphGen{
 	minInputSize:    4,
 	defaultNumTh:    uint8(runtime.NumCPU()),
 	outputSize:      4,
 	outputThreshold: 0.0,
+	moduleTimeout:   services.DefaultModuleTimeout,
+	poolSize:        defaultGraphPoolSize,
+	numWorkers:      0,
 }
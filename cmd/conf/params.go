@@ -9,6 +9,7 @@ package conf
 
 import (
 	gorsa "crypto/rsa"
+	"math"
 	"net"
 	"runtime"
 	"strconv"
@@ -21,7 +22,9 @@ import (
 	"gitlab.com/elixxir/comms/publicAddress"
 	"gitlab.com/elixxir/crypto/cmix"
 	"gitlab.com/elixxir/server/internal"
+	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/crypto/signature/rsa"
 	"gitlab.com/xx_network/crypto/tls"
@@ -35,10 +38,31 @@ import (
 // The default path to save the list of node IP addresses
 const defaultIpListPath = "/opt/xxnetwork/node-logs/ipList.txt"
 
+// The default number of idle graphs of each kind kept for reuse by later rounds
+const defaultGraphPoolSize = 2
+
+// The default number of released round buffers of each size kept for reuse by
+// later rounds
+const defaultBufferPoolSize = 2
+
+// The default size a recording of a phase may grow to
+const defaultRecordingMaxSize = "256MB"
+
+// The default number of recordings kept in the recording directory
+const defaultRecordingMaxCount = 100
+
+// The default time a round is kept after it finishes, so that it can be used
+// by post round handlers
+const defaultRetentionMaxAge = time.Minute
+
+// The default period at which finished rounds are checked for eviction
+const defaultRetentionCheckPeriod = 10 * time.Second
+
 // This object is used by the server instance.
 // It should be constructed using a viper object
 type Params struct {
 	KeepBuffers           bool
+	BufferPoolSize        int
 	UseGPU                bool
 	OverrideInternalIP    string
 	RngScalingFactor      uint `yaml:"rngScalingFactor"`
@@ -52,6 +76,9 @@ type Params struct {
 	Permissioning Permissioning `yaml:"scheduling"`
 	Metrics       Metrics
 	GraphGen      GraphGen
+	Secrets       Secrets
+	Recording     Recording
+	Retention     Retention
 
 	PhaseOverrides   []int
 	OverrideRound    int
@@ -160,6 +187,14 @@ func NewParams(vip *viper.Viper) (*Params, error) {
 		params.Node.Paths.Log = "log/cmix.log"
 	}
 
+	params.Node.Paths.SecretsKey = SecretsKeyPath(vip)
+
+	if vip.IsSet("cmix.paths.precannedUsers") {
+		params.Node.Paths.PrecannedUsers = vip.GetString("cmix.paths.precannedUsers")
+	} else if vip.IsSet("node.paths.precannedUsers") {
+		params.Node.Paths.PrecannedUsers = vip.GetString("node.paths.precannedUsers")
+	}
+
 	if vip.IsSet("cmix.paths.errOutput") {
 		params.RecoveredErrPath = vip.GetString("cmix.paths.errOutput")
 	} else if vip.IsSet("node.paths.errOutput") {
@@ -178,19 +213,10 @@ func NewParams(vip *viper.Viper) (*Params, error) {
 	}
 
 	// Obtain database connection info
-	rawAddr := vip.GetString("database.address")
-	var addr, port string
-	if rawAddr != "" {
-		addr, port, err = net.SplitHostPort(rawAddr)
-		if err != nil {
-			jww.FATAL.Panicf("Unable to get database port from %s: %+v", rawAddr, err)
-		}
+	params.Database, err = NewDatabase(vip)
+	if err != nil {
+		jww.FATAL.Panicf("%+v", err)
 	}
-	params.Database.Name = vip.GetString("database.name")
-	params.Database.Username = vip.GetString("database.username")
-	params.Database.Password = vip.GetString("database.password")
-	params.Database.Address = addr
-	params.Database.Port = port
 
 	params.Gateway.Paths.Cert = vip.GetString("gateway.paths.cert")
 	require(params.Gateway.Paths.Cert, "gateway.paths.cert")
@@ -225,8 +251,37 @@ func NewParams(vip *viper.Viper) (*Params, error) {
 	}
 	// This (outputThreshold) already defaulted to 0.0
 	params.GraphGen.outputThreshold = float32(vip.GetFloat64("graphgen.outputthreshold"))
+	params.GraphGen.moduleTimeout = vip.GetDuration("graphgen.moduleTimeout")
+	if params.GraphGen.moduleTimeout <= 0 {
+		params.GraphGen.moduleTimeout = services.DefaultModuleTimeout
+	}
+	params.GraphGen.poolSize = defaultGraphPoolSize
+	if vip.IsSet("graphgen.poolSize") {
+		params.GraphGen.poolSize = vip.GetInt("graphgen.poolSize")
+		if params.GraphGen.poolSize < 0 {
+			return nil, errors.Errorf("graphgen.poolSize must not be "+
+				"negative: received %d", params.GraphGen.poolSize)
+		}
+	}
+	numWorkers := vip.GetInt("graphgen.workers")
+	if numWorkers < 0 || numWorkers > math.MaxUint8 {
+		return nil, errors.Errorf("graphgen.workers must be between 0 and "+
+			"%d: received %d", math.MaxUint8, numWorkers)
+	}
+	params.GraphGen.numWorkers = uint8(numWorkers)
+	if vip.IsSet("graphgen.devGraphs") {
+		params.GraphGen.devGraphs = vip.GetStringSlice("graphgen.devGraphs")
+	}
 
 	params.KeepBuffers = vip.GetBool("keepBuffers")
+	params.BufferPoolSize = defaultBufferPoolSize
+	if vip.IsSet("bufferPoolSize") {
+		params.BufferPoolSize = vip.GetInt("bufferPoolSize")
+		if params.BufferPoolSize < 0 {
+			return nil, errors.Errorf("bufferPoolSize must not be "+
+				"negative: received %d", params.BufferPoolSize)
+		}
+	}
 	params.UseGPU = vip.GetBool("useGPU")
 	params.RngScalingFactor = vip.GetUint("rngScalingFactor")
 	// If RngScalingFactor is not set, then set default value
@@ -241,6 +296,75 @@ func NewParams(vip *viper.Viper) (*Params, error) {
 
 	params.Metrics.Log = vip.GetString("metrics.log")
 
+	// Finished rounds are kept for a minute unless buffers are kept, in which
+	// case they are only bounded by the count and memory set
+	params.Retention.MaxAge = defaultRetentionMaxAge
+	if params.KeepBuffers {
+		params.Retention.MaxAge = 0
+	}
+	if vip.IsSet("retention.maxAge") {
+		params.Retention.MaxAge = vip.GetDuration("retention.maxAge")
+		if params.Retention.MaxAge < 0 {
+			return nil, errors.Errorf("retention.maxAge must not be "+
+				"negative: received %s", params.Retention.MaxAge)
+		}
+	}
+	params.Retention.MaxCount = vip.GetInt("retention.maxCount")
+	if params.Retention.MaxCount < 0 {
+		return nil, errors.Errorf("retention.maxCount must not be negative: "+
+			"received %d", params.Retention.MaxCount)
+	}
+	params.Retention.MaxMemory = uint64(vip.GetSizeInBytes("retention.maxMemory"))
+	params.Retention.CheckPeriod = defaultRetentionCheckPeriod
+	if vip.IsSet("retention.checkPeriod") {
+		params.Retention.CheckPeriod = vip.GetDuration("retention.checkPeriod")
+		if params.Retention.CheckPeriod <= 0 {
+			return nil, errors.Errorf("retention.checkPeriod must be "+
+				"positive: received %s", params.Retention.CheckPeriod)
+		}
+	}
+
+	// Recording defaults to the realtime phases
+	params.Recording.Path = vip.GetString("recording.path")
+	if params.Recording.Path != "" {
+		phases := vip.GetStringSlice("recording.phases")
+		if len(phases) == 0 {
+			params.Recording.Phases = []phase.Type{phase.RealDecrypt,
+				phase.RealPermute}
+		}
+		for _, name := range phases {
+			p, err := phase.ParseType(name)
+			if err != nil {
+				return nil, errors.WithMessage(err,
+					"Invalid recording.phases")
+			}
+			params.Recording.Phases = append(params.Recording.Phases, p)
+		}
+
+		vip.SetDefault("recording.maxSize", defaultRecordingMaxSize)
+		params.Recording.MaxSize = uint64(vip.GetSizeInBytes(
+			"recording.maxSize"))
+		vip.SetDefault("recording.maxCount", defaultRecordingMaxCount)
+		params.Recording.MaxCount = vip.GetInt("recording.maxCount")
+		if params.Recording.MaxCount < 0 {
+			return nil, errors.Errorf("recording.maxCount must not be "+
+				"negative: received %d", params.Recording.MaxCount)
+		}
+	}
+
+	// Secret rotation is disabled unless a rotation period is set. Secrets
+	// default to remaining valid for a week
+	params.Secrets.RotationPeriod = vip.GetDuration("secrets.rotationPeriod")
+	params.Secrets.ValidityPeriod = vip.GetDuration("secrets.validityPeriod")
+	if params.Secrets.ValidityPeriod == 0 {
+		params.Secrets.ValidityPeriod = 7 * 24 * time.Hour
+	}
+	if params.Secrets.RotationPeriod > params.Secrets.ValidityPeriod {
+		return nil, errors.Errorf("secrets.validityPeriod (%s) must be at "+
+			"least secrets.rotationPeriod (%s)",
+			params.Secrets.ValidityPeriod, params.Secrets.RotationPeriod)
+	}
+
 	params.DevMode = viper.GetBool("devMode")
 	params.RawPermAddr = viper.GetBool("rawPermAddr")
 
@@ -289,6 +413,10 @@ func (p *Params) ConvertToDefinition() (*internal.Definition, error) {
 	def.DbName = p.Database.Name
 	def.DbAddress = p.Database.Address
 	def.DbPort = p.Database.Port
+	def.DbPath = p.Database.Path
+	def.PrecannedUsersPath = p.Node.Paths.PrecannedUsers
+	def.SecretRotation.RotationPeriod = p.Secrets.RotationPeriod
+	def.SecretRotation.ValidityPeriod = p.Secrets.ValidityPeriod
 
 	if def.Flags.OverrideInternalIP != "" && !strings.Contains(def.Flags.OverrideInternalIP, ":") {
 		def.Flags.OverrideInternalIP = net.JoinHostPort(def.Flags.OverrideInternalIP, strconv.Itoa(p.Node.Port))
@@ -351,6 +479,19 @@ func (p *Params) ConvertToDefinition() (*internal.Definition, error) {
 	def.PublicKey = publicKey
 	def.PrivateKey = privateKey
 
+	// Set the key used to encrypt node secrets at rest
+	if p.Node.Paths.SecretsKey != "" {
+		def.SecretWrapper, err = storage.NewSecretWrapperFromFile(p.Node.Paths.SecretsKey)
+		if err != nil {
+			return nil, err
+		}
+	} else if privateKey != nil {
+		def.SecretWrapper, err = storage.NewSecretWrapperFromRSA(privateKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if the IDF exists
 	if p.Node.Paths.Idf != "" && utils.Exists(p.Node.Paths.Idf) {
 		// If the IDF exists, then get the ID and save it
@@ -414,8 +555,47 @@ func (p *Params) ConvertToDefinition() (*internal.Definition, error) {
 	def.FullNDF = ourNdf
 	def.PartialNDF = ourNdf
 
-	def.GraphGenerator = services.NewGraphGenerator(p.GraphGen.minInputSize,
+	def.GraphGenerator, err = services.NewGraphGenerator(p.GraphGen.minInputSize,
 		p.GraphGen.defaultNumTh, p.GraphGen.outputSize, p.GraphGen.outputThreshold)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid graphgen parameters")
+	}
+	err = def.GraphGenerator.SetModuleTimeout(p.GraphGen.moduleTimeout)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Invalid graphgen parameters")
+	}
+	def.GraphGenerator.SetNumWorkers(p.GraphGen.numWorkers)
+	if len(p.GraphGen.devGraphs) > 0 && !p.DevMode {
+		jww.WARN.Printf("Ignoring graphgen.devGraphs outside of devMode")
+	} else if len(p.GraphGen.devGraphs) > 0 {
+		def.GraphDefinitions = make(map[string]services.GraphDefinition,
+			len(p.GraphGen.devGraphs))
+		for _, path := range p.GraphGen.devGraphs {
+			graphDef, err := services.LoadGraphDefinition(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := def.GraphDefinitions[graphDef.Name]; exists {
+				return nil, errors.Errorf("Duplicate definition of graph "+
+					"%s in %s", graphDef.Name, path)
+			}
+			def.GraphDefinitions[graphDef.Name] = graphDef
+		}
+	}
+	def.GraphPoolSize = p.GraphGen.poolSize
+	def.BufferPoolSize = p.BufferPoolSize
+	def.RoundRetention.MaxCount = p.Retention.MaxCount
+	def.RoundRetention.MaxAge = p.Retention.MaxAge
+	def.RoundRetention.MaxMemory = p.Retention.MaxMemory
+	def.RoundRetention.CheckPeriod = p.Retention.CheckPeriod
+	if p.Recording.Path != "" && !p.DevMode {
+		jww.WARN.Printf("Ignoring recording.path outside of devMode")
+	} else {
+		def.RecordingPath = p.Recording.Path
+		def.RecordedPhases = p.Recording.Phases
+		def.RecordingLimits.MaxSize = p.Recording.MaxSize
+		def.RecordingLimits.MaxCount = p.Recording.MaxCount
+	}
 
 	def.DevMode = p.DevMode
 	def.RawPermAddr = p.RawPermAddr
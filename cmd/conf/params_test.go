@@ -12,12 +12,14 @@ import (
 	"github.com/spf13/viper"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewParams_ReturnsParamsWhenGivenValidViper(t *testing.T) {
 
 	expectedParams := Params{
 		KeepBuffers:      true,
+		BufferPoolSize:   defaultBufferPoolSize,
 		RngScalingFactor: 10000,
 
 		Node:             ExpectedNode,
@@ -28,6 +30,15 @@ func TestNewParams_ReturnsParamsWhenGivenValidViper(t *testing.T) {
 		RegistrationCode: "123abc",
 
 		Metrics: Metrics{Log: "~/.elixxir/metrics.log"},
+		Secrets: Secrets{
+			RotationPeriod: 24 * time.Hour,
+			ValidityPeriod: 72 * time.Hour,
+		},
+		Retention: Retention{
+			MaxCount:    100,
+			MaxMemory:   512 << 20,
+			CheckPeriod: 5 * time.Second,
+		},
 	}
 
 	vip := viper.New()
@@ -60,6 +71,12 @@ func TestNewParams_ReturnsParamsWhenGivenValidViper(t *testing.T) {
 		t.Errorf("Params keepbuffers value does not match expected value")
 	}
 
+	if expectedParams.BufferPoolSize != params.BufferPoolSize {
+		t.Errorf("Params bufferPoolSize value does not match expected value"+
+			"\n\treceived:\t%v\n\texpected:\t%v",
+			params.BufferPoolSize, expectedParams.BufferPoolSize)
+	}
+
 	if !reflect.DeepEqual(expectedParams.Gateway, params.Gateway) {
 		t.Errorf("Params gateways value does not match expected value")
 	}
@@ -79,4 +96,16 @@ func TestNewParams_ReturnsParamsWhenGivenValidViper(t *testing.T) {
 	if !reflect.DeepEqual(expectedParams.GraphGen, params.GraphGen) {
 		t.Errorf("Graph generator values do not match expected values")
 	}
+
+	if !reflect.DeepEqual(expectedParams.Secrets, params.Secrets) {
+		t.Errorf("Secrets values do not match expected values"+
+			"\n\treceived:\t%+v\n\texpected:\t%+v",
+			params.Secrets, expectedParams.Secrets)
+	}
+
+	if !reflect.DeepEqual(expectedParams.Retention, params.Retention) {
+		t.Errorf("Retention values do not match expected values"+
+			"\n\treceived:\t%+v\n\texpected:\t%+v",
+			params.Retention, expectedParams.Retention)
+	}
 }
@@ -10,9 +10,15 @@ package conf
 // Paths contains the config params for
 // required file paths used by the system
 type Paths struct {
-	Idf          string
-	Cert         string
-	Key          string
-	Log          string
-	ipListOutput string
+	Idf  string
+	Cert string
+	Key  string
+	Log  string
+	// Key file used to encrypt node secrets at rest. If not set, the
+	// encryption key is derived from the node's private key
+	SecretsKey string
+	// File listing the precanned users loaded in devMode. If not set, the
+	// hardcoded precanned users are used
+	PrecannedUsers string
+	ipListOutput   string
 }
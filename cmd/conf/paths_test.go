@@ -8,9 +8,11 @@
 package conf
 
 var ExpectedPaths = Paths{
-	Idf:          "nodeID.json",
-	Cert:         "~/.elixxir/cert.crt",
-	Key:          "~/.elixxir/key.pem",
-	Log:          "~/.elixxir/server.log",
-	ipListOutput: "/opt/xxnetwork/node-logs/ipList.txt",
+	Idf:            "nodeID.json",
+	Cert:           "~/.elixxir/cert.crt",
+	Key:            "~/.elixxir/key.pem",
+	Log:            "~/.elixxir/server.log",
+	SecretsKey:     "~/.elixxir/secrets.key",
+	PrecannedUsers: "~/.elixxir/precanned.json",
+	ipListOutput:   "/opt/xxnetwork/node-logs/ipList.txt",
 }
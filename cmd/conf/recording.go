@@ -0,0 +1,20 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package conf
+
+import "gitlab.com/elixxir/server/internal/phase"
+
+// Recording contains the phases whose inputs are recorded for replay, the
+// directory the recordings are written to and the limits on the disk space
+// they use. Recording is disabled if Path is empty.
+type Recording struct {
+	Path     string
+	Phases   []phase.Type
+	MaxSize  uint64
+	MaxCount int
+}
@@ -0,0 +1,19 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package conf
+
+import "time"
+
+// Retention contains the bounds on the finished rounds kept by the node. Each
+// bound is unlimited if zero.
+type Retention struct {
+	MaxCount    int
+	MaxAge      time.Duration
+	MaxMemory   uint64
+	CheckPeriod time.Duration
+}
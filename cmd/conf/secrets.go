@@ -0,0 +1,31 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package conf
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+// Secrets contains the node secret rotation schedule. Rotation is disabled
+// if RotationPeriod is zero.
+type Secrets struct {
+	RotationPeriod time.Duration
+	ValidityPeriod time.Duration
+}
+
+// SecretsKeyPath returns the path of the key file used to encrypt node
+// secrets at rest, or an empty string if it is not set
+func SecretsKeyPath(vip *viper.Viper) string {
+	if vip.IsSet("cmix.paths.secretsKey") {
+		return vip.GetString("cmix.paths.secretsKey")
+	} else if vip.IsSet("node.paths.secretsKey") {
+		return vip.GetString("node.paths.secretsKey")
+	}
+	return ""
+}
@@ -0,0 +1,186 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles command-line database schema management
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/server/cmd/conf"
+	"gitlab.com/elixxir/server/storage"
+	"time"
+)
+
+var oldSecretsKey string
+
+func init() {
+	dbCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "",
+		"Path to load the Node configuration file from. Database "+
+			"connection information is read from this file.")
+
+	dbReencryptCmd.Flags().StringVar(&oldSecretsKey, "oldKey", "",
+		"Path to the key previously used to encrypt node secrets. This is "+
+			"either the previous secrets key file or the previous node "+
+			"private key.")
+	err := dbReencryptCmd.MarkFlagRequired("oldKey")
+	handleBindingError(err, "oldKey")
+
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbReencryptCmd)
+	rootCmd.AddCommand(dbCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the node database",
+	Long: `Inspect and apply migrations to the node database schema and
+re-encrypt stored node secrets. The server applies pending migrations on
+startup; these commands allow operators to do so ahead of time.`,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply all pending database schema migrations",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		schema := openSchema()
+		defer closeSchema(schema)
+
+		applied, err := schema.Migrate()
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+		}
+		if err != nil {
+			jww.FATAL.Panicf("Failed to migrate database: %+v", err)
+		}
+
+		if len(applied) == 0 {
+			fmt.Printf("Database schema is up to date at version %d\n",
+				storage.LatestSchemaVersion())
+		} else {
+			fmt.Printf("Database schema migrated to version %d\n",
+				applied[len(applied)-1].Version)
+		}
+	},
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the database schema version and migration status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		schema := openSchema()
+		defer closeSchema(schema)
+
+		version, err := schema.Version()
+		if err != nil {
+			jww.FATAL.Panicf("Failed to get database schema version: %+v", err)
+		}
+		status, err := schema.Status()
+		if err != nil {
+			jww.FATAL.Panicf("Failed to get migration status: %+v", err)
+		}
+
+		fmt.Printf("Database schema version: %d\n", version)
+		fmt.Printf("Server schema version:   %d\n\n",
+			storage.LatestSchemaVersion())
+		for _, m := range status {
+			applied := "pending"
+			if m.Applied {
+				applied = "applied " + m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-28s  %s\n", m.Version, applied, m.Description)
+		}
+		if version > storage.LatestSchemaVersion() {
+			fmt.Printf("\nDatabase schema is newer than this server; " +
+				"upgrade the server before starting it.\n")
+		}
+	},
+}
+
+var dbReencryptCmd = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "Re-encrypt stored node secrets with the current key",
+	Long: `Decrypts all stored node secrets and the ephemeral private key with the
+key given by --oldKey and encrypts them with the key in the config file. The key in the config file is
+cmix.paths.secretsKey if set, otherwise cmix.paths.key. Run this after changing
+either key and before starting the server.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		db := readDatabaseConfig()
+
+		oldWrapper, err := storage.NewSecretWrapperFromFile(oldSecretsKey)
+		if err != nil {
+			jww.FATAL.Panicf("Could not load old secrets key: %+v", err)
+		}
+
+		newKeyPath := conf.SecretsKeyPath(viper.GetViper())
+		if newKeyPath == "" {
+			if viper.IsSet("cmix.paths.key") {
+				newKeyPath = viper.GetString("cmix.paths.key")
+			} else {
+				newKeyPath = viper.GetString("node.paths.key")
+			}
+		}
+		newWrapper, err := storage.NewSecretWrapperFromFile(newKeyPath)
+		if err != nil {
+			jww.FATAL.Panicf("Could not load secrets key: %+v", err)
+		}
+
+		store, err := storage.NewStorage(db.Username, db.Password, db.Name,
+			db.Address, db.Port, db.Path, viper.GetBool("devMode"))
+		if err != nil {
+			jww.FATAL.Panicf("Could not initialize database: psql://%s@%s:%s/%s: %+v",
+				db.Username, db.Address, db.Port, db.Name, err)
+		}
+
+		count, err := storage.ReencryptSecrets(store, oldWrapper, newWrapper)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to re-encrypt node secrets after "+
+				"re-encrypting %d: %+v", count, err)
+		}
+		fmt.Printf("Re-encrypted %d node secrets with %s\n", count, newKeyPath)
+	},
+}
+
+// Reads the config file and returns the database connection information
+func readDatabaseConfig() conf.Database {
+	initConfig()
+	if !validConfig {
+		jww.FATAL.Panicf("Invalid Config File: %s", cfgFile)
+	}
+
+	db, err := conf.NewDatabase(viper.GetViper())
+	if err != nil {
+		jww.FATAL.Panicf("%+v", err)
+	}
+	return db
+}
+
+// Reads the config file and connects to the database it specifies
+func openSchema() *storage.Schema {
+	db := readDatabaseConfig()
+
+	schema, err := storage.OpenSchema(db.Username, db.Password, db.Name,
+		db.Address, db.Port)
+	if err != nil {
+		jww.FATAL.Panicf("Could not connect to database: psql://%s@%s:%s/%s: %+v",
+			db.Username, db.Address, db.Port, db.Name, err)
+	}
+	return schema
+}
+
+func closeSchema(schema *storage.Schema) {
+	if err := schema.Close(); err != nil {
+		jww.ERROR.Printf("Failed to close database connection: %+v", err)
+	}
+}
@@ -0,0 +1,124 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles printing the graphs executed by the phases of a round
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/node"
+	"gitlab.com/elixxir/server/services"
+	"runtime"
+	"time"
+)
+
+var (
+	graphsPosition     string
+	graphsUseGPU       bool
+	graphsFormat       string
+	graphsBatchSize    uint32
+	graphsMinInputSize uint32
+	graphsNumThreads   uint8
+	graphsOutputSize   uint32
+	graphsTimeout      time.Duration
+)
+
+func init() {
+	graphsDumpCmd.Flags().StringVarP(&graphsPosition, "position", "p", "middle",
+		"Position of the node in the team: first, middle or last.")
+	graphsDumpCmd.Flags().BoolVar(&graphsUseGPU, "gpu", false,
+		"Dump the GPU variant of the graphs.")
+	graphsDumpCmd.Flags().StringVarP(&graphsFormat, "format", "f", "dot",
+		"Output format: dot or json.")
+	graphsDumpCmd.Flags().Uint32VarP(&graphsBatchSize, "batch", "b", 32,
+		"Batch size to build the graphs with.")
+	graphsDumpCmd.Flags().Uint32Var(&graphsMinInputSize, "minInputSize", 4,
+		"Minimum module input size, as set by graphgen.mininputsize.")
+	graphsDumpCmd.Flags().Uint8Var(&graphsNumThreads, "defaultNumTh",
+		uint8(runtime.NumCPU()), "Default number of threads per module, as "+
+			"set by graphgen.defaultNumTh.")
+	graphsDumpCmd.Flags().Uint32Var(&graphsOutputSize, "outputSize", 4,
+		"Output size of the graphs, as set by graphgen.outputsize.")
+	graphsDumpCmd.Flags().DurationVar(&graphsTimeout, "moduleTimeout",
+		services.DefaultModuleTimeout, "Default module timeout, as set by "+
+			"graphgen.moduleTimeout.")
+
+	graphsCmd.AddCommand(graphsDumpCmd)
+	rootCmd.AddCommand(graphsCmd)
+}
+
+var graphsCmd = &cobra.Command{
+	Use:   "graphs",
+	Short: "Inspect the graphs executed by the phases of a round",
+}
+
+var graphsDumpCmd = &cobra.Command{
+	Use:   "dump",
+	Short: "Print the topology of every graph in a round",
+	Long: `Builds every graph used by the phases of a round for a node at the
+given position and prints their modules with input sizes, thread counts, start
+thresholds, timeouts and the expanded batch size. DOT output can be rendered
+with Graphviz, e.g. "server graphs dump | dot -Tsvg -O".`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var isLastNode bool
+		switch graphsPosition {
+		case "first", "middle":
+		case "last":
+			isLastNode = true
+		default:
+			jww.FATAL.Panicf("Invalid position %q, must be first, middle "+
+				"or last", graphsPosition)
+		}
+		if graphsFormat != "dot" && graphsFormat != "json" {
+			jww.FATAL.Panicf("Invalid format %q, must be dot or json",
+				graphsFormat)
+		}
+
+		// The CPU graph constructors refuse to run when useGPU is set
+		viper.Set("useGPU", graphsUseGPU)
+
+		gc := services.MustNewGraphGenerator(graphsMinInputSize, graphsNumThreads,
+			graphsOutputSize, 0)
+		if err := gc.SetModuleTimeout(graphsTimeout); err != nil {
+			jww.FATAL.Panicf("Invalid module timeout: %+v", err)
+		}
+		graphs := node.NewRoundGraphs(gc, isLastNode, graphsUseGPU)
+
+		exports := make([]services.GraphExport, 0, len(graphs))
+		for p := phase.PrecompGeneration; p <= phase.RealPermute; p++ {
+			g, ok := graphs[p]
+			if !ok {
+				continue
+			}
+			err := g.Build(graphsBatchSize, func(graph, module string, err error) {})
+			if err != nil {
+				jww.FATAL.Panicf("Failed to build graph: %+v", err)
+			}
+
+			if graphsFormat == "dot" {
+				fmt.Print(g.ExportDOT())
+			} else {
+				exports = append(exports, g.Export())
+			}
+		}
+
+		if graphsFormat == "json" {
+			data, err := json.MarshalIndent(exports, "", "  ")
+			if err != nil {
+				jww.FATAL.Panicf("Failed to encode graphs: %+v", err)
+			}
+			fmt.Println(string(data))
+		}
+	},
+}
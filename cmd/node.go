@@ -9,6 +9,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -74,6 +75,14 @@ func StartServer(vip *viper.Viper) (*internal.Instance, error) {
 	}
 	def.ResourceMonitor = resourceMonitor
 
+	if len(def.GraphDefinitions) > 0 {
+		err = node.CheckGraphDefinitions(def.GraphGenerator,
+			def.GraphDefinitions, def.UseGPU)
+		if err != nil {
+			return nil, errors.Errorf("Invalid graph definitions: %+v", err)
+		}
+	}
+
 	def.DisableStreaming = disableStreaming
 
 	err = node.ClearMetricsLogs(def.MetricLogPath)
@@ -148,10 +157,10 @@ func StartServer(vip *viper.Viper) (*internal.Instance, error) {
 
 	if params.PhaseOverrides != nil {
 		overrides := map[int]phase.Phase{}
-		gc := services.NewGraphGenerator(4,
+		gc := services.MustNewGraphGenerator(4,
 			uint8(runtime.NumCPU()), 1, 0)
 		g := graphs.InitErrorGraph(gc)
-		th := func(roundID id.Round, instance phase.GenericInstance,
+		th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance,
 			getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 			return errors.New("Failed intentionally")
 		}
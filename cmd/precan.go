@@ -0,0 +1,124 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles generating precanned user fixtures for development networks
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/server/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/utils"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	precanCount     int
+	precanStart     uint64
+	precanServerOut string
+	precanClientOut string
+)
+
+func init() {
+	precanGenerateCmd.Flags().IntVarP(&precanCount, "count", "n", 10,
+		"Number of precanned users to generate.")
+	precanGenerateCmd.Flags().Uint64Var(&precanStart, "start", 1,
+		"Index of the first precanned user. Users are numbered sequentially "+
+			"from this index.")
+	precanGenerateCmd.Flags().StringVar(&precanServerOut, "serverOut",
+		"precanned.json", "Path to write the server precanned users file "+
+			"to. Written as YAML if the path ends in .yaml or .yml.")
+	precanGenerateCmd.Flags().StringVar(&precanClientOut, "clientOut",
+		"precanned-client.json", "Path to write the client fixture file to. "+
+			"Written as YAML if the path ends in .yaml or .yml.")
+
+	precanCmd.AddCommand(precanGenerateCmd)
+	rootCmd.AddCommand(precanCmd)
+}
+
+// Client fixture entry for a precanned user. Index is the number the client
+// uses to select the precanned identity.
+type precanClientUser struct {
+	Index uint64 `json:"index" yaml:"index"`
+	Id    string `json:"id" yaml:"id"`
+	Key   string `json:"key" yaml:"key"`
+}
+
+// Contents of the client fixture file
+type precanClientFile struct {
+	Users []precanClientUser `json:"users" yaml:"users"`
+}
+
+var precanCmd = &cobra.Command{
+	Use:   "precan",
+	Short: "Manage precanned users for development networks",
+	Long: `Precanned users have fixed identities and keys known to both the node
+and clients. They are only used when the node runs in devMode.`,
+}
+
+var precanGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate matching server and client precanned user files",
+	Long: `Generates precanned users with sequential IDs and random keys. The
+server file is loaded by setting cmix.paths.precannedUsers in devMode; the
+client file lists the same users with their indices for client test fixtures.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if precanCount < 1 {
+			jww.FATAL.Panicf("Count must be at least 1, received %d", precanCount)
+		}
+
+		serverFile, err := storage.GeneratePrecannedUsers(precanStart,
+			precanCount, csprng.NewSystemRNG())
+		if err != nil {
+			jww.FATAL.Panicf("Failed to generate precanned users: %+v", err)
+		}
+
+		clientFile := precanClientFile{
+			Users: make([]precanClientUser, len(serverFile.Users)),
+		}
+		for i, user := range serverFile.Users {
+			clientFile.Users[i] = precanClientUser{
+				Index: precanStart + uint64(i),
+				Id:    user.Id,
+				Key:   user.Key,
+			}
+		}
+
+		writePrecanFile(precanServerOut, serverFile)
+		writePrecanFile(precanClientOut, clientFile)
+		fmt.Printf("Wrote %d precanned users to %s and %s\n", precanCount,
+			precanServerOut, precanClientOut)
+	},
+}
+
+// Writes the value to path, encoded as YAML if the path ends in .yaml or .yml
+// and as JSON otherwise
+func writePrecanFile(path string, value interface{}) {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(value)
+	default:
+		data, err = json.MarshalIndent(value, "", "  ")
+	}
+	if err != nil {
+		jww.FATAL.Panicf("Failed to encode %s: %+v", path, err)
+	}
+
+	err = utils.WriteFileDef(path, data)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to write %s: %+v", path, err)
+	}
+}
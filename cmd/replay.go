@@ -0,0 +1,102 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles replaying the recorded inputs of a phase through its graph
+
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/spf13/cobra"
+	jww "github.com/spf13/jwalterweatherman"
+	"github.com/spf13/viper"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/node"
+	"gitlab.com/elixxir/server/services"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+var (
+	replayGraph   string
+	replayOutPath string
+	replayTimeout time.Duration
+)
+
+func init() {
+	replayCmd.Flags().StringVarP(&replayGraph, "graph", "g", "",
+		"Name of the graph to replay the inputs through. Defaults to the "+
+			"recorded graph, or its CPU variant if it ran on the GPU.")
+	replayCmd.Flags().StringVarP(&replayOutPath, "out", "o", "",
+		"File to write the output slots to. Defaults to stdout.")
+	replayCmd.Flags().DurationVar(&replayTimeout, "moduleTimeout",
+		services.DefaultModuleTimeout, "Time a module waits for its next "+
+			"input before the replay fails.")
+
+	rootCmd.AddCommand(replayCmd)
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <recording>",
+	Short: "Replay the recorded inputs of a phase through its graph",
+	Long: `Rebuilds the graph of a phase recorded by a node with recording.path
+set and runs the recorded inputs through it. The graph is linked to a round
+buffer whose keys are all one and whose permutation is the identity, so the
+output is deterministic and can be diffed between builds. The output slots are
+written as JSON, one slot per line in slot order.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		rec, err := phase.LoadRecording(args[0])
+		if err != nil {
+			jww.FATAL.Panicf("%+v", err)
+		}
+
+		// The CPU graph constructors refuse to run when useGPU is set
+		viper.Set("useGPU", false)
+
+		gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 4, 0)
+		if err = gc.SetModuleTimeout(replayTimeout); err != nil {
+			jww.FATAL.Panicf("Invalid module timeout: %+v", err)
+		}
+
+		name := replayGraph
+		if name == "" {
+			name = strings.TrimSuffix(rec.Graph, "GPU")
+		}
+		initialize, ok := node.GetGraphInitializers(gc)[name]
+		if !ok {
+			jww.FATAL.Panicf("No CPU graph named %s to replay", name)
+		}
+
+		jww.INFO.Printf("Replaying %d inputs of phase %s of round %d "+
+			"through graph %s", len(rec.Inputs), rec.Phase, rec.RoundID, name)
+		output, err := node.ReplayRecording(gc, rec, initialize)
+		if err != nil {
+			jww.FATAL.Panicf("Failed to replay %s: %+v", args[0], err)
+		}
+
+		var out io.Writer = os.Stdout
+		if replayOutPath != "" {
+			f, err := os.Create(replayOutPath)
+			if err != nil {
+				jww.FATAL.Panicf("Failed to create %s: %+v", replayOutPath, err)
+			}
+			defer f.Close()
+			out = f
+		}
+
+		enc := json.NewEncoder(out)
+		for _, slot := range output {
+			if err = enc.Encode(slot); err != nil {
+				jww.FATAL.Panicf("Failed to write output: %+v", err)
+			}
+		}
+	},
+}
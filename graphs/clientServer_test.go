@@ -115,11 +115,15 @@ func TestClientServer(t *testing.T) {
 	keys := grp.NewIntBuffer(1, dhKey)
 	kmacs := make([][][]byte, 1)
 	ephKeys := make([][]bool, 1)
-	reporter := round.NewClientFailureReport(nid)
+	store, err := storage.NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %+v", err)
+	}
+	reporter := round.NewClientFailureReport(nid, store)
 	nsm := storage.NewNodeSecretManager()
 	precanStore := storage.NewPrecanStore(true, grp)
 	stream.LinkStream(grp, testSalts, kmacs, ephKeys, nil, usrs, keys, keys, reporter, 0, 32, nsm, precanStore)
-	err := Keygen.Adapt(&stream, cryptops.Keygen, chunk)
+	err = Keygen.Adapt(&stream, cryptops.Keygen, chunk)
 	if err != nil {
 		t.Error(err)
 	}
@@ -22,7 +22,7 @@ import (
 	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/primitives/id"
 	"golang.org/x/crypto/blake2b"
-	"strings"
+	"sync"
 )
 
 // Module that implements Keygen, along with helper methods
@@ -46,6 +46,11 @@ type KeygenSubStream struct {
 	userErrors *round.ClientReport
 	RoundId    id.Round
 	batchSize  uint32
+
+	// Clients of the round whose registration was not found in storage, so
+	// that storage is searched at most once for each client in a round
+	unregistered    map[id.ID]struct{}
+	unregisteredMux sync.Mutex
 }
 
 // LinkStream This Link doesn't conform to the Stream interface because KeygenSubStream
@@ -70,6 +75,33 @@ func (k *KeygenSubStream) LinkStream(grp *cyclic.Group, inSalts [][]byte,
 	k.NodeSecrets = nodeSecrets
 	k.Precanned = precanStore
 	k.ClientEphemeralEd = clEphemeralEd
+
+	k.unregisteredMux.Lock()
+	k.unregistered = make(map[id.ID]struct{})
+	k.unregisteredMux.Unlock()
+}
+
+// getClientSecret returns the secret the client registered with. The client's
+// registration is only searched for in storage the first time the client is
+// seen in the round.
+func (k *KeygenSubStream) getClientSecret(userId *id.ID) (*storage.NodeSecret, bool) {
+	k.unregisteredMux.Lock()
+	_, unregistered := k.unregistered[*userId]
+	k.unregisteredMux.Unlock()
+	if unregistered {
+		return k.NodeSecrets.GetKnownClientSecret(userId)
+	}
+
+	ns, ok := k.NodeSecrets.GetClientSecret(userId)
+	if !ok {
+		k.unregisteredMux.Lock()
+		if k.unregistered == nil {
+			k.unregistered = make(map[id.ID]struct{})
+		}
+		k.unregistered[*userId] = struct{}{}
+		k.unregisteredMux.Unlock()
+	}
+	return ns, ok
 }
 
 // Returns the substream, used to return an embedded struct off an interface
@@ -113,63 +145,83 @@ var Keygen = services.Module{
 			jww.FATAL.Panicf("Could not get node secret hash: %s", err.Error())
 		}
 
-		kss.userErrors.InitErrorChan(kss.RoundId, kss.batchSize)
+		// The secret a client registered with is looked up by its key ID. If
+		// it is not known, each valid secret is tried in turn until the
+		// client's KMAC verifies
+		nodeSecrets := kss.NodeSecrets.GetValidSecrets()
+
 		for i := chunk.Begin(); i < chunk.End() && i < kss.batchSize; i++ {
 			if kss.users[i].Cmp(&id.ID{}) {
 				continue
 			}
-			// Retrieve the node secret
-			// todo: KeyID will not be hardcoded once multiple rotating
-			//  secrets is supported.
-			var nodeSecretBytes []byte
-			nodeSecret, err := kss.NodeSecrets.GetSecret(0)
-			if err != nil {
-				if strings.HasSuffix(err.Error(), storage.NoSecretExistsError) {
-					jww.INFO.Printf("No secret for key ID %d with user %v found for slot %d",
-						0, kss.users[i], i)
-					kss.Grp.SetUint64(kss.KeysA.Get(i), 1)
-					kss.Grp.SetUint64(kss.KeysB.Get(i), 1)
-					errMsg := fmt.Sprintf("%s [%v] in storage:%v",
-						services.SecretNotFound, kss.users[i], err)
-					clientError := &pb.ClientError{
-						ClientId: kss.users[i].Bytes(),
-						Error:    errMsg,
-					}
-
-					err = kss.userErrors.Send(kss.RoundId, clientError)
-					if err != nil {
-						return err
-					}
+			if len(nodeSecrets) == 0 {
+				jww.INFO.Printf("No valid node secret with user %v found for slot %d",
+					kss.users[i], i)
+				kss.Grp.SetUint64(kss.KeysA.Get(i), 1)
+				kss.Grp.SetUint64(kss.KeysB.Get(i), 1)
+				errMsg := fmt.Sprintf("%s [%v] in storage:%s",
+					services.SecretNotFound, kss.users[i], storage.NoActiveSecretError)
+				clientError := &pb.ClientError{
+					ClientId: kss.users[i].Bytes(),
+					Error:    errMsg,
+				}
 
+				err = kss.userErrors.Send(kss.RoundId, clientError)
+				if err != nil {
+					return err
 				}
 				continue
 			}
-			nodeSecretBytes = nodeSecret.Bytes()
 
 			// If an unregistered client used an ephemeral ED key for this node,
 			// derive secret based on our ED priv key & the client ED pub key
+			var nodeSecretsBytes [][]byte
+			var keyIds []int
 			isEphemeral := kss.EphemeralKeys != nil && kss.EphemeralKeys[i] != nil && kss.EphemeralKeys[i][0]
+			knownKeyId := false
 			if isEphemeral {
 				_, ephemeralKey := kss.NodeSecrets.GetEphemeralEd()
-				nodeSecretBytes = ephemeralKey.DeriveSecret(kss.ClientEphemeralEd[i])
+				nodeSecretsBytes = [][]byte{ephemeralKey.DeriveSecret(kss.ClientEphemeralEd[i])}
+			} else if ns, ok := kss.getClientSecret(kss.users[i]); ok {
+				nodeSecretsBytes = [][]byte{ns.Secret.Bytes()}
+				keyIds = []int{ns.KeyId}
+				knownKeyId = true
+			} else {
+				nodeSecretsBytes = make([][]byte, len(nodeSecrets))
+				keyIds = make([]int, len(nodeSecrets))
+				for j, nodeSecret := range nodeSecrets {
+					nodeSecretsBytes[j] = nodeSecret.Secret.Bytes()
+					keyIds[j] = nodeSecret.KeyId
+				}
 			}
 
-			var clientKeyBytes []byte
+			var clientKeys []*cyclic.Int
 			if precanKey, isPrecan := kss.Precanned.Get(kss.users[i]); isPrecan {
-				clientKeyBytes = precanKey
+				clientKeys = []*cyclic.Int{kss.Grp.NewIntFromBytes(precanKey)}
+				keyIds = nil
 			} else {
-				// Generate node key
-				nodeSecretHash.Reset()
-				nodeSecretHash.Write(kss.users[i].Bytes())
-				nodeSecretHash.Write(nodeSecretBytes)
-				clientKeyBytes = nodeSecretHash.Sum(nil)
+				// Generate a node key for each candidate secret
+				clientKeys = make([]*cyclic.Int, len(nodeSecretsBytes))
+				for j, nodeSecretBytes := range nodeSecretsBytes {
+					nodeSecretHash.Reset()
+					nodeSecretHash.Write(kss.users[i].Bytes())
+					nodeSecretHash.Write(nodeSecretBytes)
+					clientKeys[j] = kss.Grp.NewIntFromBytes(nodeSecretHash.Sum(nil))
+				}
 			}
 
 			success := false
 
-			clientKey := kss.Grp.NewIntFromBytes(clientKeyBytes)
 			if len(kss.kmacs[i]) != 0 {
-				if cmix.VerifyKMAC(kss.kmacs[i][0], kss.salts[i], clientKey, kss.RoundId, kmacHash) {
+				for j, clientKey := range clientKeys {
+					if !cmix.VerifyKMAC(kss.kmacs[i][0], kss.salts[i], clientKey, kss.RoundId, kmacHash) {
+						continue
+					}
+					// Remember the secret found so that it is looked up
+					// directly for the client's later messages
+					if !knownKeyId && keyIds != nil {
+						kss.NodeSecrets.SetClientKeyId(kss.users[i], keyIds[j])
+					}
 					// If the client wasn't registered with this node, don't
 					// bother trying to verify the KMAC
 					if isEphemeral {
@@ -184,10 +236,13 @@ var Keygen = services.Module{
 					keygen(kss.Grp, saltHash.Sum(nil), kss.RoundId,
 						clientKey, kss.KeysB.Get(i))
 					success = true
-				} else {
-					jww.INFO.Printf("KMAC ERR with key %v\n: %v not the same as %v",
-						base64.StdEncoding.EncodeToString(clientKey.Bytes()), kss.kmacs[i][0], cmix.GenerateKMAC(kss.salts[i],
-							clientKey, kss.RoundId, kmacHash))
+					break
+				}
+				if !success {
+					jww.INFO.Printf("KMAC ERR with key %v\n: %v not the same as %v "+
+						"(tried %d node secrets)",
+						base64.StdEncoding.EncodeToString(clientKeys[0].Bytes()), kss.kmacs[i][0], cmix.GenerateKMAC(kss.salts[i],
+							clientKeys[0], kss.RoundId, kmacHash), len(clientKeys))
 				}
 			}
 
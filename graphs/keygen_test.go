@@ -9,6 +9,7 @@ package graphs
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"github.com/pkg/errors"
@@ -24,6 +25,7 @@ import (
 	"gitlab.com/elixxir/server/internal/round"
 	"gitlab.com/elixxir/server/internal/state"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/elixxir/server/testUtil"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
@@ -31,6 +33,7 @@ import (
 	"runtime"
 	"strconv"
 	"testing"
+	"time"
 )
 
 // Give compile error unless KeygenSubStream meets keygenSubStreamInterface
@@ -56,7 +59,7 @@ func (s *KeygenTestStream) Link(grp *cyclic.Group, batchSize uint32, source ...i
 		make([]*id.ID, batchSize),
 		grp.NewIntBuffer(batchSize, grp.NewInt(1)),
 		grp.NewIntBuffer(batchSize, grp.NewInt(1)),
-		round.NewClientFailureReport(instance.GetID()), 0,
+		round.NewClientFailureReport(instance.GetID(), instance.GetStorage()), 0,
 		batchSize, instance.GetSecretManager(), instance.GetPrecanStore())
 }
 
@@ -199,7 +202,7 @@ func TestKeygenStreamInGraph(t *testing.T) {
 
 	kmac := cmix.GenerateKMAC(testSalt, dhKey, rid, cmixHash)
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	// run the module in a graph
 	g := gc.NewGraph("test", &stream)
@@ -232,7 +235,7 @@ func TestKeygenStreamInGraph(t *testing.T) {
 	}
 	// Here's the actual data for the test
 
-	g.Run()
+	g.Run(context.Background())
 	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
 
 	ok := true
@@ -320,7 +323,7 @@ func TestKeygenStreamInGraphUnRegistered(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	// run the module in a graph
 	g := gc.NewGraph("test", &stream)
@@ -350,7 +353,7 @@ func TestKeygenStreamInGraphUnRegistered(t *testing.T) {
 	}
 	// Here's the actual data for the test
 
-	g.Run()
+	g.Run(context.Background())
 	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
 
 	ok := true
@@ -379,8 +382,9 @@ func TestKeygenStreamInGraphUnRegistered(t *testing.T) {
 		}
 	}
 
-	clientErrs, err := stream.userErrors.Receive(stream.RoundId)
-	if clientErrs == nil || err != nil {
+	stream.userErrors.Flush()
+	clientErrs, _, err := stream.userErrors.Receive()
+	if len(clientErrs) == 0 || err != nil {
 		t.Errorf("Expected to have errors in channel!"+
 			"\n\tError received: %v"+
 			"\n\tClient errors: %v", err, clientErrs)
@@ -432,7 +436,7 @@ func TestKeygenStreamInGraph_InvalidKMAC(t *testing.T) {
 
 	kmac := make([]byte, 32)
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	// run the module in a graph
 	g := gc.NewGraph("test", &stream)
@@ -461,7 +465,7 @@ func TestKeygenStreamInGraph_InvalidKMAC(t *testing.T) {
 	}
 	// Here's the actual data for the test
 
-	g.Run()
+	g.Run(context.Background())
 	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
 
 	ok := true
@@ -501,14 +505,144 @@ func TestKeygenStreamInGraph_InvalidKMAC(t *testing.T) {
 		}
 	}
 
-	clientErrs, err := stream.userErrors.Receive(stream.RoundId)
-	if clientErrs == nil || err != nil {
+	stream.userErrors.Flush()
+	clientErrs, _, err := stream.userErrors.Receive()
+	if len(clientErrs) == 0 || err != nil {
 		t.Errorf("Expected to have errors in channel!"+
 			"\n\tError received: %v"+
 			"\n\tClient errors: %v", err, clientErrs)
 	}
 }
 
+// High-level test of the reception keygen adapter when the client registered
+// with an older node secret which has since been rotated but is still valid
+func TestKeygenStreamInGraph_RotatedSecret(t *testing.T) {
+	instance, _ := mockServerInstance(t)
+	grp := instance.GetNetworkStatus().GetCmixGroup()
+	uid := id.NewIdFromString("test", id.User, t)
+	instance.SetPrecanStoreTesting(grp, t)
+	rid := id.Round(42)
+
+	// Derive the client key from the original secret, then rotate in a new one
+	h, _ := hash.NewCMixHash()
+	h.Write(uid.Bytes())
+	ns, _ := instance.GetSecretManager().GetSecret(0)
+	h.Write(ns.Bytes())
+	clientKey := grp.NewIntFromBytes(h.Sum(nil))
+
+	newKeyId, err := instance.GetSecretManager().RotateSecret(
+		csprng.NewSystemRNG(), time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSecret error: %+v", err)
+	}
+	active, err := instance.GetSecretManager().GetActiveSecret()
+	if err != nil || active.KeyId != newKeyId {
+		t.Fatalf("Rotated secret %d is not active: %+v", newKeyId, err)
+	}
+
+	var stream KeygenTestStream
+	batchSize := uint32(2)
+
+	// make a salt for testing
+	testSalt := []byte("sodium chloride")
+	// pad to length of the base key
+	testSalt = append(testSalt, make([]byte, 256/8-len(testSalt))...)
+
+	cmixHash, err := hash.NewCMixHash()
+	if err != nil {
+		t.Errorf("Could not get a hash for kmacs: %+v", err)
+	}
+
+	kmac := cmix.GenerateKMAC(testSalt, clientKey, rid, cmixHash)
+
+	PanicHandler := func(g, m string, err error) {
+		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
+	}
+
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+
+	// run the module in a graph
+	g := gc.NewGraph("test", &stream)
+	mod := Keygen.DeepCopy()
+	mod.Cryptop = MockKeygenOp
+	g.First(mod)
+	g.Last(mod)
+	g.Build(batchSize, PanicHandler)
+	g.Link(grp, instance)
+	stream.RoundId = rid
+
+	for i := 0; i < int(g.GetExpandedBatchSize()); i++ {
+		grp.SetUint64(stream.KeysA.Get(uint32(i)), uint64(i))
+		grp.SetUint64(stream.KeysB.Get(uint32(i)), uint64(1000+i))
+		stream.salts[i] = testSalt
+		stream.users[i] = uid
+		stream.kmacs[i] = [][]byte{kmac}
+		stream.EphemeralKeys[i] = make([]bool, len(stream.kmacs[i]))
+	}
+
+	g.Run(context.Background())
+	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
+
+	ok := true
+	var chunk services.Chunk
+
+	one := stream.Grp.NewInt(1)
+
+	for ok {
+		chunk, ok = g.GetOutput()
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			// The KMAC should verify against the older secret, so the
+			// keys must not be blanked
+			if stream.KeysA.Get(i).Cmp(one) == 0 {
+				t.Errorf("Keygen: Result key A blanked on slot %d when "+
+					"client used a valid rotated secret", i)
+			}
+
+			if stream.KeysB.Get(i).Cmp(one) == 0 {
+				t.Errorf("Keygen: Result key B blanked on slot %d when "+
+					"client used a valid rotated secret", i)
+			}
+		}
+	}
+
+	// The secret found is looked up directly for later messages
+	used, found := instance.GetSecretManager().GetClientSecret(uid)
+	if !found || used.KeyId != 0 {
+		t.Errorf("Secret the client used was not recorded: %+v", used)
+	}
+}
+
+// Tests that storage is searched at most once a round for the registration
+// of a client which is not registered
+func TestKeygenSubStream_getClientSecret(t *testing.T) {
+	instance, _ := mockServerInstance(t)
+	uid := id.NewIdFromString("test", id.User, t)
+
+	var kss KeygenSubStream
+	kss.LinkStream(nil, nil, nil, nil, nil, nil, nil, nil, nil, 1, 0,
+		instance.GetSecretManager(), nil)
+	if _, ok := kss.getClientSecret(uid); ok {
+		t.Fatalf("Secret found for a client which has not registered")
+	}
+
+	err := instance.GetStorage().UpsertClientRegistration(
+		&storage.ClientRegistration{UserId: uid.Marshal(), KeyId: 0})
+	if err != nil {
+		t.Fatalf("UpsertClientRegistration error: %+v", err)
+	}
+	if _, ok := kss.getClientSecret(uid); ok {
+		t.Errorf("Storage was searched again for the client in the round")
+	}
+
+	// The next round searches storage again
+	kss.LinkStream(nil, nil, nil, nil, nil, nil, nil, nil, nil, 2, 0,
+		instance.GetSecretManager(), nil)
+	if ns, ok := kss.getClientSecret(uid); !ok || ns.KeyId != 0 {
+		t.Errorf("Registration of the client not found in the next "+
+			"round: %+v", ns)
+	}
+}
+
 func mockServerInstance(i interface{}) (*internal.Instance, error) {
 
 	nid := internal.GenerateId(i)
@@ -39,10 +39,14 @@ func PrecanPermute(permutations []uint32, IOs ...PermuteIO) {
 // ModifyGraphGeneratorForPermute makes a copy of the graph generator
 // where the OutputThreshold=1.0
 func ModifyGraphGeneratorForPermute(gc services.GraphGenerator) services.GraphGenerator {
-	return services.NewGraphGenerator(
+	gcPermute := services.MustNewGraphGenerator(
 		gc.GetMinInputSize(),
 		gc.GetDefaultNumTh(),
 		gc.GetOutputSize(),
 		1.0,
 	)
+	// The module timeout of an existing generator is always valid
+	_ = gcPermute.SetModuleTimeout(gc.GetModuleTimeout())
+	gcPermute.SetNumWorkers(gc.GetNumWorkers())
+	return gcPermute
 }
@@ -48,7 +48,7 @@ func TestPermute_PrecanPermute(t *testing.T) {
 
 func TestModifyGraphGeneratorForPermute(t *testing.T) {
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 
 	gcPermute := ModifyGraphGeneratorForPermute(gc)
 
@@ -191,12 +191,18 @@ var DecryptElgamalChunk = services.Module{
 	NumThreads: 2,
 }
 
+// Names of the graphs created by InitDecryptGraph and InitDecryptGPUGraph
+const (
+	DecryptGraphName    = "PrecompDecrypt"
+	DecryptGPUGraphName = "PrecompDecryptGPU"
+)
+
 // InitDecryptGraph is called to initialize the CPU Graph. Conforms to Graph.Initialize function type
 func InitDecryptGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using precomp decrypt graph running on CPU instead of equivalent GPU graph")
 	}
-	g := gc.NewGraph("PrecompDecrypt", &DecryptStream{})
+	g := gc.NewGraph(DecryptGraphName, &DecryptStream{})
 
 	decryptElgamal := DecryptElgamal.DeepCopy()
 
@@ -211,7 +217,7 @@ func InitDecryptGPUGraph(gc services.GraphGenerator) *services.Graph {
 	if !viper.GetBool("useGPU") {
 		jww.WARN.Printf("Using precomp decrypt graph running on GPU instead of equivalent CPU graph")
 	}
-	g := gc.NewGraph("PrecompDecryptGPU", &DecryptStream{})
+	g := gc.NewGraph(DecryptGPUGraphName, &DecryptStream{})
 
 	decryptElgamalChunk := DecryptElgamalChunk.DeepCopy()
 
@@ -10,6 +10,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/gpumathsgo"
@@ -38,7 +39,7 @@ func TestDecryptGPUGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 1.0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -80,7 +81,7 @@ func TestDecryptGPUGraph(t *testing.T) {
 	CypherPayloadBExpected := grp.NewIntBuffer(g.GetExpandedBatchSize(), grp.NewInt(1))
 
 	//Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	//Send inputs into the graph
 	go func(g *services.Graph) {
@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -260,7 +261,7 @@ func TestDecryptGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 1.0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -297,7 +298,7 @@ func TestDecryptGraph(t *testing.T) {
 	CypherPayloadBExpected := grp.NewIntBuffer(g.GetExpandedBatchSize(), grp.NewInt(1))
 
 	//Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	//Send inputs into the graph
 	go func(g *services.Graph) {
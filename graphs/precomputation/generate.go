@@ -136,9 +136,12 @@ var Generate = services.Module{
 	Name:       "Generate",
 }
 
+// Name of the graph created by InitGenerateGraph
+const GenerateGraphName = "PrecompGenerate"
+
 // InitGenerateGraph is called to initialize the Generate Graph. Conforms to Graph.Initialize function type
 func InitGenerateGraph(gc services.GraphGenerator) *services.Graph {
-	g := gc.NewGraph("PrecompGenerate", &GenerateStream{})
+	g := gc.NewGraph(GenerateGraphName, &GenerateStream{})
 
 	generate := Generate.DeepCopy()
 
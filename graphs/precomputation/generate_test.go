@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -150,7 +151,7 @@ func TestGenerateGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -174,7 +175,7 @@ func TestGenerateGraph(t *testing.T) {
 	//stream := g.GetStream().(*GenerateStream)
 
 	//Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	//Send inputs into the graph
 	go func(g *services.Graph) {
@@ -246,13 +246,19 @@ var PermuteElgamalChunk = services.Module{
 	Name: "PermuteElgamalChunk",
 }
 
+// Names of the graphs created by InitPermuteGraph and InitPermuteGPUGraph
+const (
+	PermuteGraphName    = "PrecompPermute"
+	PermuteGPUGraphName = "PrecompPermuteGPU"
+)
+
 // InitPermuteGraph is called to initialize the CPU Graph. Conforms to graphs.Initialize function type
 func InitPermuteGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using precomp permute graph running on CPU instead of equivalent GPU graph")
 	}
 	gcPermute := graphs.ModifyGraphGeneratorForPermute(gc)
-	g := gcPermute.NewGraph("PrecompPermute", &PermuteStream{})
+	g := gcPermute.NewGraph(PermuteGraphName, &PermuteStream{})
 
 	permuteElgamal := PermuteElgamal.DeepCopy()
 
@@ -268,7 +274,7 @@ func InitPermuteGPUGraph(gc services.GraphGenerator) *services.Graph {
 		jww.WARN.Printf("Using precomp permute graph running on GPU instead of equivalent CPU graph")
 	}
 	gcPermute := graphs.ModifyGraphGeneratorForPermute(gc)
-	g := gcPermute.NewGraph("PrecompPermuteGPU", &PermuteStream{})
+	g := gcPermute.NewGraph(PermuteGPUGraphName, &PermuteStream{})
 
 	permuteElgamalChunk := PermuteElgamalChunk.DeepCopy()
 
@@ -10,6 +10,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/crypto/shuffle"
@@ -38,7 +39,7 @@ func TestPermuteGpuGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, 2, 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, 2, 1, 1.0)
 
 	// Initialize graph
 	g := graphInit(gc)
@@ -102,7 +103,7 @@ func TestPermuteGpuGraph(t *testing.T) {
 
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
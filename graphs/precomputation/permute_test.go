@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -256,7 +257,7 @@ func TestPermuteGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	// Initialize graph
 	g := graphInit(gc)
@@ -328,7 +329,7 @@ func TestPermuteGraph(t *testing.T) {
 
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
@@ -164,12 +164,18 @@ var RevealRootCoprimeChunk = services.Module{
 	NumThreads: 2,
 }
 
+// Names of the graphs created by InitRevealGraph and InitRevealGPUGraph
+const (
+	RevealGraphName    = "PrecompReveal"
+	RevealGPUGraphName = "PrecompRevealGPU"
+)
+
 // InitRevealGraph called to initialize the CPU Graph. Conforms to graphs.Initialize function type
 func InitRevealGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using precomp reveal graph running on CPU instead of equivalent GPU graph")
 	}
-	graph := gc.NewGraph("PrecompReveal", &RevealStream{})
+	graph := gc.NewGraph(RevealGraphName, &RevealStream{})
 
 	revealRootCoprime := RevealRootCoprime.DeepCopy()
 
@@ -184,7 +190,7 @@ func InitRevealGPUGraph(gc services.GraphGenerator) *services.Graph {
 	if !viper.GetBool("useGPU") {
 		jww.WARN.Printf("Using precomp reveal graph running on GPU instead of equivalent CPU graph")
 	}
-	g := gc.NewGraph("PrecompRevealGPU", &RevealStream{})
+	g := gc.NewGraph(RevealGPUGraphName, &RevealStream{})
 
 	revealRootCoprimeChunk := RevealRootCoprimeChunk.DeepCopy()
 
@@ -10,6 +10,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/gpumathsgo"
@@ -38,7 +39,7 @@ func TestRevealGpuGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, 2, 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, 2, 1, 1.0)
 
 	// Initialize graph
 	g := graphInit(gc)
@@ -87,7 +88,7 @@ func TestRevealGpuGraph(t *testing.T) {
 		cryptops.RootCoprime(grp, s.CypherPayloadB.Get(i), s.Z, CypherPayloadBExpected.Get(i))
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -233,7 +234,7 @@ func TestReveal_Graph(t *testing.T) {
 	PanicHandler := func(g, m string, err error) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -267,7 +268,7 @@ func TestReveal_Graph(t *testing.T) {
 	}
 
 	// Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	// Send inputs into the graph
 	go func(g *services.Graph) {
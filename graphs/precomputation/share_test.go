@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -174,7 +175,7 @@ func TestShare_Graph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(1, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc := services.MustNewGraphGenerator(1, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -198,7 +199,7 @@ func TestShare_Graph(t *testing.T) {
 	PubicCypherKeyExpected := grp.ExpG(roundBuffer.Z, grp.NewInt(1))
 
 	// Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	// Send inputs into the graph
 	go func(g *services.Graph) {
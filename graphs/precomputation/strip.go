@@ -192,12 +192,18 @@ var StripMul2 = services.Module{
 	Name:       "StripMul2",
 }
 
+// Names of the graphs created by InitStripGraph and InitStripGPUGraph
+const (
+	StripGraphName    = "PrecompStrip"
+	StripGPUGraphName = "PrecompStripGPU"
+)
+
 // InitStripGraph is called to initialize the CPU Graph. Conforms to Graph.Initialize function type
 func InitStripGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using precomp strip graph running on CPU instead of equivalent GPU graph")
 	}
-	graph := gc.NewGraph("PrecompStrip", &StripStream{})
+	graph := gc.NewGraph(StripGraphName, &StripStream{})
 
 	reveal := RevealRootCoprime.DeepCopy()
 	stripInverse := StripInverse.DeepCopy()
@@ -216,7 +222,7 @@ func InitStripGPUGraph(gc services.GraphGenerator) *services.Graph {
 	if !viper.GetBool("useGPU") {
 		jww.WARN.Printf("Using precomp strip graph running on GPU instead of equivalent CPU graph")
 	}
-	graph := gc.NewGraph("PrecompStripGPU", &StripStream{})
+	graph := gc.NewGraph(StripGPUGraphName, &StripStream{})
 
 	// GPU library can do all operations for Strip in one kernel,
 	// to avoid uploading and downloading excessively
@@ -10,6 +10,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/gpumathsgo"
@@ -37,7 +38,7 @@ func TestStripGPU_Graph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 
 	// Initialize graph
 	g := graphInit(gc)
@@ -97,7 +98,7 @@ func TestStripGPU_Graph(t *testing.T) {
 	PayloadBPrecomputationExpected := grp.NewIntBuffer(g.GetExpandedBatchSize(), grp.NewInt(1))
 
 	// Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	// Send inputs into the graph
 	go func(g *services.Graph) {
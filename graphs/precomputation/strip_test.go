@@ -8,6 +8,7 @@
 package precomputation
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -230,7 +231,7 @@ func TestStrip_Graph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 
 	// Initialize graph
 	g := graphInit(gc)
@@ -279,7 +280,7 @@ func TestStrip_Graph(t *testing.T) {
 	PayloadBPrecomputationExpected := grp.NewIntBuffer(g.GetExpandedBatchSize(), grp.NewInt(1))
 
 	// Run the graph
-	g.Run()
+	g.Run(context.Background())
 
 	// Send inputs into the graph
 	go func(g *services.Graph) {
@@ -283,12 +283,18 @@ var DecryptMul3Chunk = services.Module{
 	Name:       "DecryptMul3Chunk",
 }
 
+// Names of the graphs created by InitDecryptGraph and InitDecryptGPUGraph
+const (
+	DecryptGraphName    = "RealtimeDecrypt"
+	DecryptGPUGraphName = "RealtimeDecryptGPU"
+)
+
 // InitDecryptGraph is called to initialize the CPU Graph. Conforms to Graph.Initialize function type
 func InitDecryptGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using realtime decrypt graph running on CPU instead of equivalent GPU graph")
 	}
-	g := gc.NewGraph("RealtimeDecrypt", &KeygenDecryptStream{})
+	g := gc.NewGraph(DecryptGraphName, &KeygenDecryptStream{})
 
 	decryptKeygen := graphs.Keygen.DeepCopy()
 	decryptMul3 := DecryptMul3.DeepCopy()
@@ -305,7 +311,7 @@ func InitDecryptGPUGraph(gc services.GraphGenerator) *services.Graph {
 	if !viper.GetBool("useGPU") {
 		jww.WARN.Printf("Using realtime decrypt graph running on GPU instead of equivalent CPU graph")
 	}
-	g := gc.NewGraph("RealtimeDecryptGPU", &KeygenDecryptStream{})
+	g := gc.NewGraph(DecryptGPUGraphName, &KeygenDecryptStream{})
 
 	decryptKeygen := graphs.Keygen.DeepCopy()
 	decryptMul3Chunk := DecryptMul3Chunk.DeepCopy()
@@ -11,6 +11,7 @@
 package realtime
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"gitlab.com/elixxir/crypto/cmix"
@@ -58,7 +59,7 @@ func TestDecryptStreamInGraphGPU(t *testing.T) {
 	var graphInit graphs.Initializer
 	graphInit = InitDecryptGPUGraph
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -84,7 +85,7 @@ func TestDecryptStreamInGraphGPU(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	clientReport := round.NewClientFailureReport(instance.GetID())
+	clientReport := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	g.Link(grp, roundBuffer, clientReport,
 		streamPool, instance.GetSecretManager(), instance.GetPrecanStore())
 
@@ -120,7 +121,7 @@ func TestDecryptStreamInGraphGPU(t *testing.T) {
 	}
 	// Here's the actual data for the test
 
-	g.Run()
+	g.Run(context.Background())
 	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
 
 	ok := true
@@ -8,6 +8,7 @@
 package realtime
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	jww "github.com/spf13/jwalterweatherman"
@@ -67,7 +68,7 @@ func TestDecryptStream_Link(t *testing.T) {
 	batchSize := uint32(100)
 
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
-	testReporter := round.NewClientFailureReport(instance.GetID())
+	testReporter := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
 	stream.Link(grp, batchSize, roundBuffer, rng, streamPool, testReporter)
@@ -107,7 +108,7 @@ func TestDecryptStream_Input(t *testing.T) {
 	stream := &KeygenDecryptStream{}
 
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
-	testReporter := round.NewClientFailureReport(instance.GetID())
+	testReporter := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
 
@@ -166,7 +167,7 @@ func TestDecryptStream_Input_OutOfBatch(t *testing.T) {
 	stream := &KeygenDecryptStream{}
 
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
-	testReporter := round.NewClientFailureReport(instance.GetID())
+	testReporter := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
 
@@ -232,7 +233,7 @@ func TestDecryptStream_Input_OutOfGroup(t *testing.T) {
 	stream := &KeygenDecryptStream{}
 
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
-	testReport := round.NewClientFailureReport(instance.GetID())
+	testReport := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
 
@@ -263,7 +264,7 @@ func TestDecryptStream_Input_NonExistantUser(t *testing.T) {
 	stream := &KeygenDecryptStream{}
 
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
-	testReport := round.NewClientFailureReport(instance.GetID())
+	testReport := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
 
@@ -308,7 +309,7 @@ func TestDecryptStream_Input_SaltLength(t *testing.T) {
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
-	reporter := round.NewClientFailureReport(instance.GetID())
+	reporter := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	stream.Link(grp, batchSize, roundBuffer, nil, streamPool, rng, reporter)
 
 	msg := &mixmessages.Slot{
@@ -351,7 +352,7 @@ func TestDecryptStream_Output(t *testing.T) {
 	roundBuffer := round.NewBuffer(grp, batchSize, batchSize)
 	var streamPool *gpumaths.StreamPool
 	var rng *fastRNG.StreamGenerator
-	reporter := round.NewClientFailureReport(instance.GetID())
+	reporter := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 	stream.Link(grp, batchSize, roundBuffer, rng, streamPool, reporter)
 
 	for b := uint32(0); b < batchSize; b++ {
@@ -450,7 +451,7 @@ func TestDecryptStreamInGraph(t *testing.T) {
 	var graphInit graphs.Initializer
 	graphInit = InitDecryptGraph
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	//Initialize graph
 	g := graphInit(gc)
@@ -470,7 +471,7 @@ func TestDecryptStreamInGraph(t *testing.T) {
 
 	}
 
-	clientReport := round.NewClientFailureReport(instance.GetID())
+	clientReport := round.NewClientFailureReport(instance.GetID(), instance.GetStorage())
 
 	var streamPool *gpumaths.StreamPool
 	g.Link(grp, roundBuffer, clientReport, streamPool,
@@ -509,7 +510,7 @@ func TestDecryptStreamInGraph(t *testing.T) {
 	}
 	// Here's the actual data for the test
 
-	g.Run()
+	g.Run(context.Background())
 	go g.Send(services.NewChunk(0, g.GetExpandedBatchSize()), nil)
 
 	ok := true
@@ -186,12 +186,18 @@ var IdentifyMul2Chunk = services.Module{
 	Name:           "Identify",
 }
 
+// Names of the graphs created by InitIdentifyGraph and InitIdentifyGPUGraph
+const (
+	IdentifyGraphName    = "RealtimeIdentify"
+	IdentifyGPUGraphName = "RealtimeIdentifyGPU"
+)
+
 // InitIdentifyGraph is called to initialize the CPU Graph. Conforms to Graph.Initialize function type
 func InitIdentifyGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using realtime identify graph running on CPU instead of equivalent GPU graph")
 	}
-	g := gc.NewGraph("RealtimeIdentify", &IdentifyStream{})
+	g := gc.NewGraph(IdentifyGraphName, &IdentifyStream{})
 
 	permuteMul2 := PermuteMul2.DeepCopy()
 	identifyMul2 := IdentifyMul2.DeepCopy()
@@ -208,7 +214,7 @@ func InitIdentifyGPUGraph(gc services.GraphGenerator) *services.Graph {
 	if !viper.GetBool("useGPU") {
 		jww.WARN.Printf("Using realtime identify graph running on GPU instead of equivalent CPU graph")
 	}
-	g := gc.NewGraph("RealtimeIdentifyGPU", &IdentifyStream{})
+	g := gc.NewGraph(IdentifyGPUGraphName, &IdentifyStream{})
 
 	permuteMul2 := PermuteMul2Chunk.DeepCopy()
 	identifyMul2 := IdentifyMul2Chunk.DeepCopy()
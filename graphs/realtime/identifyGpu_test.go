@@ -10,6 +10,7 @@
 package realtime
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/elixxir/crypto/cyclic"
 	"gitlab.com/elixxir/crypto/shuffle"
@@ -46,7 +47,7 @@ func TestIdentifyStream_InGraphGPU(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	g := InitIdentifyGPUGraph(gc)
 
@@ -93,7 +94,7 @@ func TestIdentifyStream_InGraphGPU(t *testing.T) {
 		cryptops.Mul2(grp, is.V.Get(i), expectedPayloadB.Get(i))
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
@@ -8,6 +8,7 @@
 package realtime
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -279,7 +280,7 @@ func TestIdentifyStream_InGraph(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	g := InitIdentifyGraph(gc)
 
@@ -320,7 +321,7 @@ func TestIdentifyStream_InGraph(t *testing.T) {
 		cryptops.Mul2(grp, is.V.Get(i), expectedPayloadB.Get(i))
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
@@ -176,13 +176,19 @@ var PermuteMul2Chunk = services.Module{
 	NumThreads: 2,
 }
 
+// Names of the graphs created by InitPermuteGraph and InitPermuteGPUGraph
+const (
+	PermuteGraphName    = "RealtimePermute"
+	PermuteGPUGraphName = "RealtimePermuteGPU"
+)
+
 // InitPermuteGraph is called to initialize the CPU Graph. Conforms to Graph.Initialize function type
 func InitPermuteGraph(gc services.GraphGenerator) *services.Graph {
 	if viper.GetBool("useGPU") {
 		jww.FATAL.Panicf("Using realtime permute graph running on CPU instead of equivalent GPU graph")
 	}
 	gcPermute := graphs.ModifyGraphGeneratorForPermute(gc)
-	g := gcPermute.NewGraph("RealtimePermute", &PermuteStream{})
+	g := gcPermute.NewGraph(PermuteGraphName, &PermuteStream{})
 
 	mul2 := PermuteMul2.DeepCopy()
 
@@ -198,7 +204,7 @@ func InitPermuteGPUGraph(gc services.GraphGenerator) *services.Graph {
 		jww.WARN.Printf("Using realtime permute graph running on GPU instead of equivalent CPU graph")
 	}
 	gcPermute := graphs.ModifyGraphGeneratorForPermute(gc)
-	g := gcPermute.NewGraph("RealtimePermuteGPU", &PermuteStream{})
+	g := gcPermute.NewGraph(PermuteGPUGraphName, &PermuteStream{})
 
 	mul2 := PermuteMul2Chunk.DeepCopy()
 	mul2.InputSize = 32
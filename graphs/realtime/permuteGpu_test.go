@@ -10,6 +10,7 @@
 package realtime
 
 import (
+	"context"
 	"fmt"
 	"github.com/spf13/viper"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -49,7 +50,7 @@ func TestPermuteStream_InGraphGPU(t *testing.T) {
 		panic(fmt.Sprintf("Error in module %s of graph %s: %s", g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
+	gc := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 1.0)
 
 	g := InitPermuteGPUGraph(gc)
 
@@ -97,7 +98,7 @@ func TestPermuteStream_InGraphGPU(t *testing.T) {
 
 	}
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *services.Graph) {
 
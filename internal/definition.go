@@ -10,7 +10,10 @@ package internal
 import (
 	"gitlab.com/elixxir/crypto/fastRNG"
 	"gitlab.com/elixxir/server/internal/measure"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/internal/round"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/crypto/signature/rsa"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
@@ -72,6 +75,15 @@ type Definition struct {
 
 	//Defines the properties of graphs in the node
 	GraphGenerator services.GraphGenerator
+	// Number of idle graphs of each kind and batch size kept for reuse by
+	// later rounds. Graphs are built for every round if zero
+	GraphPoolSize int
+	// Number of released round buffers of each size kept for reuse by later
+	// rounds. Buffers are allocated for every round if zero
+	BufferPoolSize int
+	// Bounds the finished rounds kept by the node. Finished rounds are kept
+	// until shutdown if the check period is zero
+	RoundRetention round.RetentionPolicy
 	//Holds the ResourceMonitor object
 	ResourceMonitor *measure.ResourceMonitor
 	// Function to handle the wrapping-up of metrics for the first node
@@ -95,8 +107,31 @@ type Definition struct {
 	DbName      string
 	DbAddress   string
 	DbPort      string
+	DbPath      string
 	DevMode     bool
 	RawPermAddr bool
+
+	// File listing the precanned users to load in devMode in place of the
+	// hardcoded users. Ignored if empty or outside of devMode
+	PrecannedUsersPath string
+
+	// Graphs to run in devMode in place of the graphs of the same name, keyed
+	// by name
+	GraphDefinitions map[string]services.GraphDefinition
+
+	// Directory the inputs of the RecordedPhases of every round are recorded
+	// to for replay in devMode. Recording is disabled if empty
+	RecordingPath   string
+	RecordedPhases  []phase.Type
+	RecordingLimits phase.RecordingLimits
+
+	// Schedule for rotating node secrets. Rotation is disabled if the
+	// RotationPeriod is zero
+	SecretRotation storage.SecretRotationParams
+
+	// Encrypts node secrets before they are stored. If nil, secrets are
+	// stored in plaintext
+	SecretWrapper *storage.SecretWrapper
 }
 
 // Holds all input flags to the system.
@@ -109,7 +144,7 @@ type Flags struct {
 	OverrideInternalIP string
 }
 
-//Holds information about another node in the network
+// Holds information about another node in the network
 type Node struct {
 	// ID of the other node
 	ID *id.ID
@@ -63,11 +63,18 @@ type Instance struct {
 	resourceQueue     *ResourceQueue
 	network           *node.Comms
 	streamPool        *gpumaths.StreamPool
+	graphPool         *services.GraphPool
+	bufferPool        *round.BufferPool
+	roundRetention    *round.RetentionManager
 	machine           state.Machine
 	phaseStateMachine state.GenericMachine
 
-	// RAM storage of rotating node secrets
+	// Storage of rotating node secrets, backed by the persistent storage
 	nodeSecretManager *storage.NodeSecretManager
+	// Stops the node secret rotation thread, nil if rotation is disabled
+	secretRotationKill chan struct{}
+	// Stops the round retention thread, nil if it is not running
+	retentionKill chan struct{}
 
 	// RAM storage of precanned IDs and keys
 	precanStore *storage.PrecanStore
@@ -136,6 +143,8 @@ func CreateServerInstance(def *Definition, makeImplementation func(*Instance) *n
 		Online:               false,
 		definition:           def,
 		roundManager:         round.NewManager(),
+		graphPool:            services.NewGraphPool(def.GraphPoolSize),
+		bufferPool:           round.NewBufferPool(def.BufferPoolSize),
 		resourceQueue:        initQueue(),
 		machine:              machine,
 		isGatewayReady:       &isGwReady,
@@ -153,18 +162,25 @@ func CreateServerInstance(def *Definition, makeImplementation func(*Instance) *n
 		firstRun:             &firstRun,
 		firstPoll:            &firstPoll,
 		gatewayFirstPoll:     NewFirstTime(),
-		clientErrors:         round.NewClientFailureReport(def.ID),
 		phaseStateMachine:    state.NewGenericMachine(),
 		earliestRoundTracker: atomic.Value{},
 	}
+	instance.roundRetention = round.NewRetentionManager(def.RoundRetention,
+		instance.evictRound)
 
 	instance.storage, err = storage.NewStorage(
 		def.DbUsername, def.DbPassword, def.DbName,
-		def.DbAddress, def.DbPort, def.DevMode)
+		def.DbAddress, def.DbPort, def.DbPath, def.DevMode)
 	if err != nil {
 		eMsg := fmt.Sprintf("Could not initialize database: psql://%s@%s:%s/%s: %v",
 			def.DbUsername, def.DbAddress, def.DbPort, def.DbName, err)
 
+		// Never run against a schema this version does not understand, or
+		// without the database a node with a database file was configured for
+		if errors.Is(err, storage.ErrSchemaTooNew) || def.DbPath != "" {
+			return nil, errors.New(eMsg)
+		}
+
 		if def.DevMode {
 			jww.WARN.Printf(eMsg)
 		} else {
@@ -172,26 +188,49 @@ func CreateServerInstance(def *Definition, makeImplementation func(*Instance) *n
 		}
 	}
 
-	// Create node secret manager
-	instance.nodeSecretManager = storage.NewNodeSecretManager()
+	// Do not start new rounds while the database is unavailable
+	instance.machine.SetHealthCheck(instance.storage.Health)
 
-	ephPriv, ephPub := ecdh.ECDHNIKE.NewKeypair(instance.GetRngStreamGen().GetStream())
-	instance.nodeSecretManager.UpsertEphemerals(ephPub, ephPriv)
+	// Client errors are stored until they are reported to permissioning
+	instance.clientErrors = round.NewClientFailureReport(def.ID, instance.storage)
 
-	// Create hardcoded node secret
-	// todo: refactor this once a mechanism is implemented for
-	//  creating and rotating node secrets.
-	h, err := hash.NewCMixHash()
+	// Create node secret manager, loading any previously stored secrets
+	instance.nodeSecretManager, err = storage.LoadNodeSecretManager(
+		instance.storage, def.SecretWrapper)
 	if err != nil {
-		return nil, err
+		return nil, errors.WithMessage(err, "Could not load node secret manager")
 	}
 
-	h.Write(instance.definition.TlsKey)
-	nodeSecret := h.Sum(nil)
+	// Only generate ephemeral keys if none were stored by a previous run
+	if ephPub, _ := instance.nodeSecretManager.GetEphemeralEd(); ephPub == nil {
+		ephPriv, ephPub := ecdh.ECDHNIKE.NewKeypair(instance.GetRngStreamGen().GetStream())
+		err = instance.nodeSecretManager.UpsertEphemerals(ephPub, ephPriv)
+		if err != nil {
+			return nil, errors.Errorf("Could not insert ephemeral keys into node secret manager: %v", err)
+		}
+	}
 
-	err = instance.nodeSecretManager.UpsertSecret(0, nodeSecret)
-	if err != nil {
-		return nil, errors.Errorf("Could not insert into node secret manager: %v", err)
+	if def.SecretRotation.RotationPeriod > 0 {
+		// Start rotating node secrets
+		instance.secretRotationKill, err = instance.nodeSecretManager.StartRotation(
+			def.SecretRotation, instance.GetRngStreamGen())
+		if err != nil {
+			return nil, errors.WithMessage(err, "Could not start node secret rotation")
+		}
+	} else {
+		// Without rotation, a single secret derived from the TLS key is used
+		h, err := hash.NewCMixHash()
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write(instance.definition.TlsKey)
+		nodeSecret := h.Sum(nil)
+
+		err = instance.nodeSecretManager.UpsertSecret(0, nodeSecret)
+		if err != nil {
+			return nil, errors.Errorf("Could not insert into node secret manager: %v", err)
+		}
 	}
 
 	// Create stream pool if instructed to use GPU
@@ -302,14 +341,26 @@ func RecoverInstance(def *Definition, makeImplementation func(*Instance) *node.I
 	return i, nil
 }
 
-// Run starts the resource queue
+// Run starts the resource queue and the round retention thread
 func (i *Instance) Run() error {
 	go i.resourceQueue.run(i)
+	if i.definition.RoundRetention.CheckPeriod > 0 {
+		i.retentionKill = i.roundRetention.Start()
+	}
 	return i.machine.Start()
 }
 
-// Shutdown releases any reserved GPU resources
+// Shutdown stops secret rotation and round retention and releases any reserved
+// GPU resources
 func (i *Instance) Shutdown() {
+	if i.secretRotationKill != nil {
+		close(i.secretRotationKill)
+		i.secretRotationKill = nil
+	}
+	if i.retentionKill != nil {
+		close(i.retentionKill)
+		i.retentionKill = nil
+	}
 	if i.streamPool != nil {
 		err := i.streamPool.Destroy()
 		if err != nil {
@@ -344,6 +395,11 @@ func (i *Instance) GetGateway() *id.ID {
 	return i.definition.Gateway.ID
 }
 
+// GetStorage returns the persistent storage of the node
+func (i *Instance) GetStorage() *storage.Storage {
+	return i.storage
+}
+
 func (i *Instance) GetSecretManager() *storage.NodeSecretManager {
 	return i.nodeSecretManager
 }
@@ -352,8 +408,29 @@ func (i *Instance) GetPrecanStore() *storage.PrecanStore {
 	return i.precanStore
 }
 
-func (i *Instance) PopulateDummyUsers(allprecann bool, grp *cyclic.Group) {
-	i.precanStore = storage.NewPrecanStore(allprecann, grp)
+// PopulateDummyUsers builds the precanned user store. If allprecann is set and
+// a precanned users file is configured, the users are loaded from that file
+// instead of using the hardcoded users.
+func (i *Instance) PopulateDummyUsers(allprecann bool, grp *cyclic.Group) error {
+	path := i.definition.PrecannedUsersPath
+	if path == "" {
+		i.precanStore = storage.NewPrecanStore(allprecann, grp)
+		return nil
+	}
+
+	if !allprecann {
+		jww.WARN.Printf("Ignoring precanned users file %s outside of "+
+			"devMode", path)
+		i.precanStore = storage.NewPrecanStore(false, grp)
+		return nil
+	}
+
+	precanStore, err := storage.LoadPrecanStore(path, grp)
+	if err != nil {
+		return err
+	}
+	i.precanStore = precanStore
+	return nil
 }
 
 func (i *Instance) AddDummyUserTesting(userId *id.ID, key []byte, grp *cyclic.Group, face interface{}) {
@@ -710,9 +787,8 @@ func (i *Instance) reportFailure(roundErr *mixmessages.RoundError) {
 	sm := i.GetStateMachine()
 
 	currentActivity := sm.Get()
-	// TODO In the future, we should write code to clean up an in-progress round
-	//  that has an error. In that case, we should also reevaluate this logic,
-	//  as it probably won't work as intended anymore.
+	// Errors reported before the node recovers from an earlier error are
+	// ignored, as the ERROR state change has already aborted every round
 	if currentActivity == current.ERROR || currentActivity == current.CRASH {
 		// There's already an error, so there's no need to change to error state
 		jww.FATAL.Printf("Round failure reported, but the node is already in ERROR state. RoundID %v; nodeID %v; error text %v",
@@ -724,6 +800,14 @@ func (i *Instance) reportFailure(roundErr *mixmessages.RoundError) {
 	// an error or crash state
 	i.roundError = roundErr
 
+	// Record the failure in the round history if the round is known
+	if roundErr.Id != 0 {
+		i.roundRetention.Fail(id.Round(roundErr.Id))
+		if r, err := i.GetRoundManager().GetRound(id.Round(roundErr.Id)); err == nil {
+			i.RecordRoundHistory(r, roundErr.Error)
+		}
+	}
+
 	// Change instance state to ERROR
 	ok, err := sm.Update(current.ERROR)
 	if err != nil {
@@ -734,6 +818,89 @@ func (i *Instance) reportFailure(roundErr *mixmessages.RoundError) {
 	}
 }
 
+// AbortRound recovers from the failure of the round of the error without
+// restarting the node. The resource queue is killed to cancel the phase of the
+// round and is then restarted. The graphs of the round are stopped and its
+// buffer released. The signed error is held as the recovered error, which is
+// reported to permissioning on the next poll before the node returns to
+// WAITING.
+//
+// Must be called from the ERROR state change, which is run under the error
+// lock. Returns an error if the error is not associated with a round or the
+// round cannot be stopped, in which case the node must restart.
+func (i *Instance) AbortRound(roundErr *mixmessages.RoundError) error {
+	if roundErr.Id == 0 {
+		return errors.New("Cannot abort an error not associated with a round")
+	}
+
+	err := i.resourceQueue.Kill(i.resourceQueue.killTimeout())
+	if err != nil {
+		return errors.WithMessage(err, "Resource queue kill timed out")
+	}
+
+	err = i.abortRound(id.Round(roundErr.Id))
+	if err != nil {
+		return err
+	}
+
+	go i.resourceQueue.run(i)
+	i.recoveredError = roundErr
+	return nil
+}
+
+// abortRound stops the graphs of the round, releases its buffer and removes it
+// from the round manager. Anything else held for the round is evicted by the
+// round retention manager.
+func (i *Instance) abortRound(rid id.Round) error {
+	r, err := i.roundManager.GetRound(rid)
+	if err != nil {
+		// The round was never created or has already been cleaned up
+		return nil
+	}
+
+	jww.WARN.Printf("[%v]: RID %d aborting round", i, rid)
+	i.roundManager.DeleteRound(rid)
+	i.roundRetention.Fail(rid)
+
+	err = r.Abort(phaseKillTimeout, i.GetNetworkStatus().GetCmixGroup(),
+		i.bufferPool)
+	if err != nil {
+		return errors.WithMessagef(err, "Failed to abort round %d", rid)
+	}
+	r.ReleaseGraphs(i.graphPool)
+	return nil
+}
+
+// isRoundFailed returns true if the round has failed, in which case its phases
+// are no longer run
+func (i *Instance) isRoundFailed(rid id.Round) bool {
+	if i.roundRetention == nil {
+		return false
+	}
+	lifecycle, ok := i.roundRetention.GetLifecycle(rid)
+	return ok && lifecycle == round.Failed
+}
+
+// RecordRoundHistory stores the outcome and phase timings of a finished round
+// in the database. An empty roundErr denotes a round which completed
+// successfully.
+func (i *Instance) RecordRoundHistory(r *round.Round, roundErr string) {
+	record, phases := r.GetHistory(roundErr)
+	go func() {
+		err := i.storage.UpsertRound(record)
+		if err != nil {
+			jww.WARN.Printf("Failed to store history of round %d: %+v",
+				record.Id, err)
+			return
+		}
+		err = i.storage.UpsertRoundPhases(phases)
+		if err != nil {
+			jww.WARN.Printf("Failed to store phase timings of round %d: %+v",
+				record.Id, err)
+		}
+	}()
+}
+
 func (i *Instance) String() string {
 	nid := i.definition.ID
 	localServer := i.network.String()
@@ -746,6 +913,41 @@ func (i *Instance) GetStreamPool() *gpumaths.StreamPool {
 	return i.streamPool
 }
 
+// GetGraphPool returns the pool of built graphs kept for reuse by rounds
+func (i *Instance) GetGraphPool() *services.GraphPool {
+	return i.graphPool
+}
+
+// GetBufferPool returns the pool of zeroed round buffers kept for reuse by
+// rounds
+func (i *Instance) GetBufferPool() *round.BufferPool {
+	return i.bufferPool
+}
+
+// GetRoundRetention returns the manager which evicts finished rounds once
+// they are no longer retained
+func (i *Instance) GetRoundRetention() *round.RetentionManager {
+	return i.roundRetention
+}
+
+// evictRound releases everything held for a round evicted by the round
+// retention manager. Client errors reported in the round are kept until
+// permissioning acknowledges them.
+func (i *Instance) evictRound(rid id.Round, lifecycle round.Lifecycle) {
+	jww.INFO.Printf("[%v]: RID %d evicting %s round", i, rid, lifecycle)
+
+	if r, err := i.roundManager.GetRound(rid); err == nil {
+		i.roundManager.DeleteRound(rid)
+		r.StopRecording()
+		r.ReleaseGraphs(i.graphPool)
+		r.ReleaseBuffer(i.GetNetworkStatus().GetCmixGroup(), i.bufferPool)
+	}
+
+	i.completedBatchMux.Lock()
+	delete(i.completedBatch, rid)
+	i.completedBatchMux.Unlock()
+}
+
 // GetDisableStreaming returns the DisableStreaming boolean that determines if
 // streaming will be used.
 func (i *Instance) GetDisableStreaming() bool {
@@ -757,7 +959,9 @@ func (i *Instance) GetDisableStreaming() bool {
 // or duration time units have occurred, causing a timeout.
 // Round completion is monitored by sending a channel through another
 // channel (chan chan struct{}), and on round completion,
-// we send to that channel and receive here.
+// we send to that channel and receive here. Client errors reported by the
+// round are then given up to duration to be stored, so that they are reported
+// to permissioning after a restart.
 func (i *Instance) WaitUntilRoundCompletes(duration time.Duration) {
 	k := make(chan struct{})
 	jww.INFO.Printf("Waiting for round to complete before closing...")
@@ -769,6 +973,17 @@ func (i *Instance) WaitUntilRoundCompletes(duration time.Duration) {
 	case <-time.After(duration):
 		jww.ERROR.Print("Round took too long to complete, closing!")
 	}
+
+	stored := make(chan struct{})
+	go func() {
+		i.clientErrors.Flush()
+		close(stored)
+	}()
+	select {
+	case <-stored:
+	case <-time.After(duration):
+		jww.ERROR.Print("Client errors took too long to store, closing!")
+	}
 }
 
 func (i *Instance) AddCompletedBatch(cr *round.CompletedRound) error {
@@ -8,11 +8,14 @@
 package internal
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"github.com/golang/protobuf/proto"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/comms/node"
+	"gitlab.com/elixxir/crypto/cyclic"
 	"gitlab.com/elixxir/crypto/fastRNG"
 	"gitlab.com/elixxir/primitives/current"
 	"gitlab.com/elixxir/server/graphs"
@@ -20,13 +23,16 @@ import (
 	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/internal/state"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/elixxir/server/testUtil"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/large"
 	"gitlab.com/xx_network/crypto/signature/rsa"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/utils"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
@@ -299,6 +305,45 @@ func TestInstance_GetDisableStreaming(t *testing.T) {
 	}
 }
 
+// Tests that PopulateDummyUsers loads the precanned users file only in devMode
+func TestInstance_PopulateDummyUsers(t *testing.T) {
+	grp := cyclic.NewGroup(large.NewIntFromString(MODP768, 16), large.NewInt(2))
+	file, err := storage.GeneratePrecannedUsers(300, 1, rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate precanned users: %+v", err)
+	}
+	path := filepath.Join(t.TempDir(), "precanned.json")
+	users, _ := json.Marshal(file)
+	if err = os.WriteFile(path, users, 0600); err != nil {
+		t.Fatalf("Failed to write precanned users file: %+v", err)
+	}
+
+	instance := &Instance{definition: &Definition{PrecannedUsersPath: path}}
+	if err = instance.PopulateDummyUsers(true, grp); err != nil {
+		t.Fatalf("PopulateDummyUsers error: %+v", err)
+	}
+	if _, ok := instance.GetPrecanStore().Get(storage.PrecannedUserId(300)); !ok {
+		t.Errorf("User from the precanned users file was not loaded")
+	}
+	if _, ok := instance.GetPrecanStore().Get(storage.PrecannedUserId(1)); ok {
+		t.Errorf("Hardcoded users should not be loaded with a users file")
+	}
+
+	// Outside of devMode the file is ignored
+	if err = instance.PopulateDummyUsers(false, grp); err != nil {
+		t.Fatalf("PopulateDummyUsers error: %+v", err)
+	}
+	if _, ok := instance.GetPrecanStore().Get(storage.PrecannedUserId(300)); ok {
+		t.Errorf("Precanned users file should be ignored outside of devMode")
+	}
+
+	// Error path: an invalid file is reported in devMode
+	instance.definition.PrecannedUsersPath = filepath.Join(t.TempDir(), "missing.json")
+	if err = instance.PopulateDummyUsers(true, grp); err == nil {
+		t.Errorf("Expected an error for a missing precanned users file")
+	}
+}
+
 func TestInstance_ClearRecoveredError(t *testing.T) {
 	instance := Instance{
 		recoveredError: &mixmessages.RoundError{Id: 3},
@@ -309,6 +354,63 @@ func TestInstance_ClearRecoveredError(t *testing.T) {
 	}
 }
 
+// Happy path: aborting a round stops its phases and restarts the resource
+// queue
+func TestInstance_AbortRound(t *testing.T) {
+	instance, _ := createInstance(t)
+	go instance.resourceQueue.run(instance)
+
+	precomp, startedPrecomp, _ := makeBlockingPhase(t, instance,
+		phase.PrecompGeneration, 1)
+	precomp.AttemptToQueue(instance.resourceQueue.GetPhaseQueue())
+	waitForStart(t, startedPrecomp, "precomputation")
+
+	roundErr := &mixmessages.RoundError{Id: 1, Error: "test"}
+	if err := instance.AbortRound(roundErr); err != nil {
+		t.Fatalf("AbortRound returned an error: %+v", err)
+	}
+
+	if !precomp.GetGraph().IsKilled() {
+		t.Errorf("Graph of the aborted round was not killed")
+	}
+	if _, err := instance.GetRoundManager().GetRound(1); err == nil {
+		t.Errorf("Round is still in the round manager")
+	}
+	if !instance.isRoundFailed(1) {
+		t.Errorf("Round was not marked as failed")
+	}
+	metric := instance.GetBufferPool().GetMetric()
+	if metric.Idle+int(metric.Dropped) != 1 {
+		t.Errorf("Buffer of the aborted round was not released to the "+
+			"pool: %+v", metric)
+	}
+	if instance.GetRecoveredError() != roundErr {
+		t.Errorf("Error is not held to be reported to permissioning."+
+			"\n\tExpected: %v\n\tReceived: %v", roundErr,
+			instance.GetRecoveredError())
+	}
+
+	// The restarted queue runs the phases of later rounds
+	next, startedNext, _ := makeBlockingPhase(t, instance,
+		phase.PrecompGeneration, 2)
+	next.AttemptToQueue(instance.resourceQueue.GetPhaseQueue())
+	waitForStart(t, startedNext, "next round's")
+
+	if err := instance.resourceQueue.Kill(5 * time.Second); err != nil {
+		t.Errorf("Failed to kill the queue: %+v", err)
+	}
+}
+
+// Error path: an error which is not associated with a round cannot be aborted
+func TestInstance_AbortRound_NoRound(t *testing.T) {
+	instance, _ := createInstance(t)
+
+	err := instance.AbortRound(&mixmessages.RoundError{Id: 0})
+	if err == nil {
+		t.Errorf("AbortRound did not error on an error without a round")
+	}
+}
+
 func panicHandler(g, m string, err error) {
 	panic(g)
 }
@@ -316,10 +418,10 @@ func panicHandler(g, m string, err error) {
 func TestInstance_OverridePhases(t *testing.T) {
 
 	instance, _ := createInstance(t)
-	gc := services.NewGraphGenerator(4,
+	gc := services.MustNewGraphGenerator(4,
 		uint8(runtime.NumCPU()), 1, 0)
 	g := graphs.InitErrorGraph(gc)
-	th := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return errors.New("Failed intentionally")
 	}
 	p := phase.New(phase.Definition{
@@ -339,10 +441,10 @@ func TestInstance_OverridePhases(t *testing.T) {
 
 func TestInstance_OverridePhasesAtRound(t *testing.T) {
 	instance, _ := createInstance(t)
-	gc := services.NewGraphGenerator(4,
+	gc := services.MustNewGraphGenerator(4,
 		uint8(runtime.NumCPU()), 1, 0)
 	g := graphs.InitErrorGraph(gc)
-	th := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return errors.New("Failed intentionally")
 	}
 	p := phase.New(phase.Definition{
@@ -374,10 +476,10 @@ func TestInstance_GetOverrideRound(t *testing.T) {
 }
 
 func TestInstance_GetPhaseOverrides(t *testing.T) {
-	gc := services.NewGraphGenerator(4,
+	gc := services.MustNewGraphGenerator(4,
 		uint8(runtime.NumCPU()), 1, 0)
 	g := graphs.InitErrorGraph(gc)
-	th := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return errors.New("Failed intentionally")
 	}
 	p := phase.New(phase.Definition{
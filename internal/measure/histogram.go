@@ -0,0 +1,87 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package measure
+
+// measure/histogram.go contains the Histogram and ModuleMetrics objects used to
+// record the timings of the threads of graph modules
+
+import (
+	"time"
+)
+
+// HistogramBounds are the upper bounds of the buckets of a Histogram. Durations
+// above the last bound are counted in the final bucket.
+var HistogramBounds = [NumHistogramBuckets - 1]time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// NumHistogramBuckets is the number of buckets in a Histogram
+const NumHistogramBuckets = 14
+
+// Histogram counts durations in buckets bounded by HistogramBounds
+type Histogram struct {
+	Count   uint64
+	Sum     time.Duration
+	Min     time.Duration
+	Max     time.Duration
+	Buckets [NumHistogramBuckets]uint64
+}
+
+// Add records the duration in the histogram
+func (h *Histogram) Add(d time.Duration) {
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+
+	for i, bound := range HistogramBounds {
+		if d <= bound {
+			h.Buckets[i]++
+			return
+		}
+	}
+	h.Buckets[NumHistogramBuckets-1]++
+}
+
+// Mean returns the average of the recorded durations
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// ModuleMetrics holds the timings of a single thread of a graph module. Each
+// chunk the thread processes adds to every histogram.
+type ModuleMetrics struct {
+	Module string
+	Thread uint8
+
+	// Time spent waiting for the next chunk to arrive on the module's input
+	QueueWait Histogram
+	// Time spent inside the adapt function
+	Adapt Histogram
+	// Time spent priming and sending the chunk to the output modules
+	OutputPriming Histogram
+}
@@ -0,0 +1,68 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package measure
+
+import (
+	"testing"
+	"time"
+)
+
+// Tests that Add() counts durations in the correct buckets and tracks the
+// count, sum, minimum and maximum.
+func TestHistogram_Add(t *testing.T) {
+	h := Histogram{}
+	durations := []time.Duration{time.Microsecond, 10 * time.Microsecond,
+		2 * time.Millisecond, 3 * time.Millisecond, time.Minute}
+	for _, d := range durations {
+		h.Add(d)
+	}
+
+	expected := Histogram{
+		Count: 5,
+		Sum: time.Microsecond + 10*time.Microsecond + 5*time.Millisecond +
+			time.Minute,
+		Min: time.Microsecond,
+		Max: time.Minute,
+	}
+	expected.Buckets[0] = 2
+	expected.Buckets[5] = 2
+	expected.Buckets[NumHistogramBuckets-1] = 1
+
+	if h != expected {
+		t.Errorf("Add() recorded unexpected values"+
+			"\n\texpected: %+v\n\treceived: %+v", expected, h)
+	}
+}
+
+// Tests that Mean() returns the average duration and zero for an empty
+// histogram.
+func TestHistogram_Mean(t *testing.T) {
+	h := Histogram{}
+	if h.Mean() != 0 {
+		t.Errorf("Mean() of an empty histogram should be zero"+
+			"\n\texpected: %s\n\treceived: %s", time.Duration(0), h.Mean())
+	}
+
+	h.Add(time.Second)
+	h.Add(3 * time.Second)
+	if h.Mean() != 2*time.Second {
+		t.Errorf("Mean() returned an unexpected value"+
+			"\n\texpected: %s\n\treceived: %s", 2*time.Second, h.Mean())
+	}
+}
+
+// Tests that HistogramBounds are increasing so that every duration falls in
+// exactly one bucket.
+func TestHistogramBounds(t *testing.T) {
+	for i := 1; i < len(HistogramBounds); i++ {
+		if HistogramBounds[i] <= HistogramBounds[i-1] {
+			t.Errorf("HistogramBounds are not increasing at index %d: %s <= %s",
+				i, HistogramBounds[i], HistogramBounds[i-1])
+		}
+	}
+}
@@ -23,6 +23,17 @@ type ResourceMetric struct {
 	MemAvailable    uint64
 	NumThreads      int
 	CPUPercentage   float64
+	BufferPool      BufferPoolMetric
+	ClientErrors    map[string]uint64 // Client errors reported, keyed by type
+}
+
+// BufferPoolMetric stores usage metrics of the pool of round buffers.
+type BufferPoolMetric struct {
+	Idle      int    // Buffers held in the pool for reuse
+	IdleBytes uint64 // Estimated memory held by the idle buffers
+	Reused    uint64 // Buffers taken from the pool by rounds
+	Allocated uint64 // Buffers allocated because none in the pool fit
+	Dropped   uint64 // Released buffers erased because the pool was full
 }
 
 // ResourceMonitor structure contains a mutable resource metric.
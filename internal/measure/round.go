@@ -36,16 +36,21 @@ type RoundMetrics struct {
 
 	// Total dispatch Duration
 	DispatchDuration time.Duration
+
+	// Timings of every module thread in the graph of each phase, keyed on the
+	// phase name
+	ModuleMetrics map[string][]ModuleMetrics
 }
 
 // NewRoundMetrics initializes a new RoundMetrics object with the specified
 // round ID.
 func NewRoundMetrics(roundId id.Round, batchSize uint32) RoundMetrics {
 	return RoundMetrics{
-		RoundID:      roundId,
-		BatchSize:    batchSize,
-		StartTime:    time.Now().Round(0),
-		PhaseMetrics: PhaseMetrics{},
+		RoundID:       roundId,
+		BatchSize:     batchSize,
+		StartTime:     time.Now().Round(0),
+		PhaseMetrics:  PhaseMetrics{},
+		ModuleMetrics: map[string][]ModuleMetrics{},
 	}
 }
 
@@ -57,6 +62,15 @@ func (rm *RoundMetrics) AddPhase(name string, metrics Metrics) {
 	rm.PhaseMetrics = append(rm.PhaseMetrics, newPhaseMetric)
 }
 
+// AddModuleMetrics sets the module metrics of the graph of a phase. Any module
+// metrics previously set for the phase are replaced.
+func (rm *RoundMetrics) AddModuleMetrics(name string, modules []ModuleMetrics) {
+	if rm.ModuleMetrics == nil {
+		rm.ModuleMetrics = map[string][]ModuleMetrics{}
+	}
+	rm.ModuleMetrics[name] = modules
+}
+
 // SetNodeID sets the node ID for the round metrics.
 func (rm *RoundMetrics) SetNodeID(nodeID *id.ID) {
 	rm.NodeID = *nodeID.DeepCopy()
@@ -146,3 +146,28 @@ func TestRoundMetrics_SetResourceMetrics(t *testing.T) {
 			resourceMetric, rm.ResourceMetric)
 	}
 }
+
+// Tests AddModuleMetrics() by adding module metrics for a phase, replacing
+// them and checking the values.
+func TestRoundMetrics_AddModuleMetrics(t *testing.T) {
+	// Create new RoundMetrics
+	rm := NewRoundMetrics(42, 34)
+
+	modules := []ModuleMetrics{{Module: "Permute", Thread: 1}}
+	modules[0].Adapt.Add(time.Millisecond)
+	rm.AddModuleMetrics("RealPermute", modules)
+	rm.AddModuleMetrics("RealDecrypt", nil)
+
+	replacement := []ModuleMetrics{{Module: "Permute", Thread: 2}}
+	rm.AddModuleMetrics("RealPermute", replacement)
+
+	expected := map[string][]ModuleMetrics{
+		"RealPermute": replacement,
+		"RealDecrypt": nil,
+	}
+	if !reflect.DeepEqual(rm.ModuleMetrics, expected) {
+		t.Errorf("AddModuleMetrics() incorrectly set ModuleMetrics"+
+			"\n\texpected: %v\n\treceived: %v",
+			expected, rm.ModuleMetrics)
+	}
+}
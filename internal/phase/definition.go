@@ -22,4 +22,6 @@ type Definition struct {
 	TransmissionHandler Transmit
 	Timeout             time.Duration
 	DoVerification      bool
+	// Records the slots input into the phase if set
+	Recorder *Recorder
 }
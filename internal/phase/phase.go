@@ -11,11 +11,13 @@ package phase
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/server/internal/measure"
 	"gitlab.com/elixxir/server/services"
 	"gitlab.com/xx_network/primitives/id"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -31,6 +33,8 @@ type Phase interface {
 	GetTimeout() time.Duration
 	GetState() State
 	UpdateFinalStates()
+	StopRecording()
+	Detach()
 	GetAlternate() (bool, func())
 	AttemptToQueue(queue chan<- Phase) bool
 	IsQueued() bool
@@ -64,6 +68,13 @@ type phase struct {
 	metrics measure.Metrics
 
 	numSentChunks *uint32
+
+	recorder *Recorder
+
+	// Set once the graph and buffer of the round are released, after which
+	// late inputs must not reach them as they may be reused by another round
+	detached  bool
+	detachMux sync.RWMutex
 }
 
 // New makes a new phase with the given the phase definition structure
@@ -83,6 +94,7 @@ func New(def Definition) Phase {
 		connected:           &connected,
 		queued:              &queued,
 		numSentChunks:       &numSentChunks,
+		recorder:            def.Recorder,
 	}
 }
 
@@ -157,6 +169,8 @@ func (p *phase) IsQueued() bool {
 // finishing, but doesnt always finish, even when it returns false
 // It it cannot move, it panics
 func (p *phase) UpdateFinalStates() {
+	// No more slots are input once the phase has computed its output
+	p.StopRecording()
 
 	if !p.verification {
 		success := p.transitionToState(Active, Verified)
@@ -179,6 +193,23 @@ func (p *phase) UpdateFinalStates() {
 	}
 }
 
+// StopRecording stops recording the slots input into the phase, if it is
+// recorded. It is called when the phase finishes and when its round fails.
+func (p *phase) StopRecording() {
+	if p.recorder != nil {
+		p.recorder.Close()
+	}
+}
+
+// Detach stops the phase from passing input to its graph, waiting for inputs
+// already being passed. It is called before the graph and buffer of the round
+// are released so that late inputs cannot reach them once they are reused.
+func (p *phase) Detach() {
+	p.detachMux.Lock()
+	p.detached = true
+	p.detachMux.Unlock()
+}
+
 // GetTransmissionHandler returns the phase's transmission handling function
 func (p *phase) GetTransmissionHandler() Transmit {
 	return p.transmissionHandler
@@ -205,6 +236,13 @@ func (p *phase) String() string {
 // Send via the graph. This function allows for this graph function
 // to be accessed via the interface
 func (p *phase) Send(chunk services.Chunk) {
+	p.detachMux.RLock()
+	defer p.detachMux.RUnlock()
+	if p.detached {
+		jww.DEBUG.Printf("Dropping chunk sent to phase %s of round %v "+
+			"after its round was released", p.phaseType, p.roundID)
+		return
+	}
 	p.graph.Send(chunk, nil)
 
 	numChunksSent := atomic.AddUint32(p.numSentChunks, 1)
@@ -213,8 +251,20 @@ func (p *phase) Send(chunk services.Chunk) {
 	}
 }
 
-// Input updates the graph's stream with the passed data at the passed index
+// Input updates the graph's stream with the passed data at the passed index.
+// The slot is queued for recording first if the phase has a Recorder. Returns
+// an error once the phase is detached.
 func (p *phase) Input(index uint32, slot *mixmessages.Slot) error {
+	p.detachMux.RLock()
+	defer p.detachMux.RUnlock()
+	if p.detached {
+		return errors.Errorf("Phase %s of round %v no longer accepts input "+
+			"as its round was released", p.phaseType, p.roundID)
+	}
+
+	if p.recorder != nil {
+		p.recorder.Record(index, slot)
+	}
 	return p.GetGraph().GetStream().Input(index, slot)
 }
 
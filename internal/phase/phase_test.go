@@ -8,6 +8,7 @@
 package phase
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/elixxir/server/services"
 	"gitlab.com/xx_network/primitives/id"
@@ -49,7 +50,7 @@ func TestPhase_GetTimeout(t *testing.T) {
 
 func TestPhase_GetTransmissionHandler(t *testing.T) {
 	pass := false
-	handler := func(roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error {
+	handler := func(ctx context.Context, roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error {
 		pass = true
 		return nil
 	}
@@ -57,7 +58,7 @@ func TestPhase_GetTransmissionHandler(t *testing.T) {
 		transmissionHandler: handler,
 	}
 	// This call should set pass to true
-	err := p.GetTransmissionHandler()(0, nil, nil, nil)
+	err := p.GetTransmissionHandler()(context.Background(), 0, nil, nil, nil)
 
 	if err != nil {
 		t.Errorf("Transmission handler returned an error, how!? %+v", err)
@@ -203,11 +204,11 @@ func TestNew(t *testing.T) {
 	timeout := 50 * time.Second
 	// Testing whether the graph error handler is reachable is outside of the
 	// scope of this test
-	g := initMockGraph(services.NewGraphGenerator(1,
+	g := initMockGraph(services.MustNewGraphGenerator(1,
 		1, 1, 1))
 	pass := false
 
-	transmit := func(roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error {
+	transmit := func(ctx context.Context, roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error {
 		pass = true
 		return nil
 	}
@@ -218,7 +219,7 @@ func TestNew(t *testing.T) {
 		TransmissionHandler: transmit,
 		Timeout:             timeout,
 		DoVerification:      false})
-	err := phase.GetTransmissionHandler()(0, nil, nil, nil)
+	err := phase.GetTransmissionHandler()(context.Background(), 0, nil, nil, nil)
 
 	if err != nil {
 		t.Errorf("Transmission handler returned an error, how!? %+v", err)
@@ -0,0 +1,336 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package phase
+
+// recorder.go records the slots input into a phase so that they can be
+// replayed through its graph offline
+
+import (
+	"encoding/json"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Extension of recording files. Only files with it are deleted when old
+// recordings are pruned.
+const recordingExtension = ".jsonl"
+
+// RecordingHeader describes the phase a recording was taken from and the
+// round buffer its graph was linked to
+type RecordingHeader struct {
+	RoundID id.Round `json:"roundID"`
+	Phase   Type     `json:"phase"`
+	Graph   string   `json:"graph"`
+
+	BatchSize         uint32        `json:"batchSize"`
+	ExpandedBatchSize uint32        `json:"expandedBatchSize"`
+	Group             *cyclic.Group `json:"group"`
+}
+
+// RecordedInput is a single slot input into a phase, encoded as protobuf
+type RecordedInput struct {
+	Index uint32 `json:"index"`
+	Slot  []byte `json:"slot"`
+}
+
+// Recording holds the slots input into a phase in the order they were received
+type Recording struct {
+	RecordingHeader
+	Inputs []RecordedInput
+}
+
+// Number of recorded slots which may wait to be written before further slots
+// are discarded
+const recorderBufferSize = 1024
+
+// RecordingLimits bounds the disk space used by recordings
+type RecordingLimits struct {
+	// Size in bytes a recording may grow to. Slots which would take a
+	// recording past it stop the recording. Zero does not limit the size.
+	MaxSize uint64
+
+	// Number of recordings kept in the directory. The oldest recordings are
+	// deleted when a new one is created. Zero keeps every recording.
+	MaxCount int
+}
+
+// Recorder writes the slots input into a phase to a file. The file holds the
+// JSON encoded RecordingHeader on its first line followed by a RecordedInput
+// on each line. Slots are written on a separate goroutine so that recording
+// does not hold up the phase. The Recorder stops recording on the first
+// failure, which is logged once the recording is closed and returned by Wait.
+type Recorder struct {
+	path   string
+	header RecordingHeader
+	limits RecordingLimits
+
+	inputs   chan RecordedInput
+	start    sync.Once
+	done     chan struct{}
+	disabled uint32
+
+	mux    sync.RWMutex
+	closed bool
+
+	errMux sync.Mutex
+	err    error
+}
+
+// NewRecorder returns a Recorder which writes to the file at path within the
+// limits. The file is only created once the first slot is recorded.
+func NewRecorder(path string, header RecordingHeader,
+	limits RecordingLimits) *Recorder {
+	return &Recorder{
+		path:   path,
+		header: header,
+		limits: limits,
+		inputs: make(chan RecordedInput, recorderBufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Record queues the slot input at the index to be appended to the recording.
+// Slots received after the Recorder is closed or has stopped are discarded.
+func (r *Recorder) Record(index uint32, slot *mixmessages.Slot) {
+	if atomic.LoadUint32(&r.disabled) == 1 {
+		return
+	}
+
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	if r.closed {
+		return
+	}
+
+	// The slot is encoded before it is input, as streams may modify it
+	data, err := proto.Marshal(slot)
+	if err != nil {
+		r.fail(errors.Errorf("Failed to encode slot %d: %+v", index, err))
+		return
+	}
+
+	r.start.Do(func() { go r.write() })
+	select {
+	case r.inputs <- RecordedInput{Index: index, Slot: data}:
+	default:
+		r.fail(errors.Errorf("Failed to record slot %d to %s: %d slots "+
+			"are waiting to be written", index, r.path, recorderBufferSize))
+	}
+}
+
+// Close stops recording. The slots already queued are written and the
+// recording file closed without holding up the caller. Safe to call more than
+// once.
+func (r *Recorder) Close() {
+	r.mux.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.inputs)
+	}
+	r.mux.Unlock()
+
+	// Nothing is written if no slot was recorded
+	r.start.Do(r.finish)
+}
+
+// Wait blocks until the closed recording has been written, then returns the
+// failure which stopped the recording, if any
+func (r *Recorder) Wait() error {
+	<-r.done
+
+	r.errMux.Lock()
+	defer r.errMux.Unlock()
+	return r.err
+}
+
+// finish marks the recording as written and logs the failure which stopped
+// it, if any
+func (r *Recorder) finish() {
+	r.errMux.Lock()
+	err := r.err
+	r.errMux.Unlock()
+	if err != nil {
+		jww.WARN.Printf("Failed to record phase %s of round %v: %+v",
+			r.header.Phase, r.header.RoundID, err)
+	}
+
+	close(r.done)
+}
+
+// fail stops the recording, keeping the first failure
+func (r *Recorder) fail(err error) {
+	if !atomic.CompareAndSwapUint32(&r.disabled, 0, 1) {
+		return
+	}
+	r.errMux.Lock()
+	defer r.errMux.Unlock()
+	r.err = err
+}
+
+// write appends the queued slots to the recording file until the Recorder is
+// closed, then closes the file
+func (r *Recorder) write() {
+	defer r.finish()
+
+	file, err := r.create()
+	if err != nil {
+		r.fail(err)
+	}
+
+	var size uint64
+	for input := range r.inputs {
+		if atomic.LoadUint32(&r.disabled) == 1 {
+			continue
+		}
+
+		line, err := json.Marshal(input)
+		if err != nil {
+			r.fail(errors.Errorf("Failed to encode slot %d: %+v",
+				input.Index, err))
+			continue
+		}
+		line = append(line, '\n')
+
+		size += uint64(len(line))
+		if r.limits.MaxSize > 0 && size > r.limits.MaxSize {
+			r.fail(errors.Errorf("Stopped recording %s at slot %d: "+
+				"recording exceeds %d bytes", r.path, input.Index,
+				r.limits.MaxSize))
+			continue
+		}
+
+		if _, err = file.Write(line); err != nil {
+			r.fail(errors.Errorf("Failed to record slot %d to %s: %+v",
+				input.Index, r.path, err))
+		}
+	}
+
+	if file != nil {
+		if err = file.Close(); err != nil {
+			r.fail(errors.Errorf("Failed to close recording %s: %+v",
+				r.path, err))
+		}
+	}
+}
+
+// create deletes the oldest recordings in the directory past the limit and
+// creates the recording file with its header
+func (r *Recorder) create() (*os.File, error) {
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Errorf("Failed to create recording directory: %+v",
+			err)
+	}
+
+	if r.limits.MaxCount > 0 {
+		if err := pruneRecordings(dir, r.limits.MaxCount-1); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.Create(r.path)
+	if err != nil {
+		return nil, errors.Errorf("Failed to create recording %s: %+v",
+			r.path, err)
+	}
+	if err = json.NewEncoder(file).Encode(r.header); err != nil {
+		_ = file.Close()
+		return nil, errors.Errorf("Failed to write header of recording "+
+			"%s: %+v", r.path, err)
+	}
+	return file, nil
+}
+
+// pruneRecordings deletes the oldest recordings in the directory until at
+// most keep are left
+func pruneRecordings(dir string, keep int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+recordingExtension))
+	if err != nil {
+		return errors.Errorf("Failed to list recordings in %s: %+v", dir,
+			err)
+	}
+	if len(paths) <= keep {
+		return nil
+	}
+
+	modified := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		modified[path] = info.ModTime()
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return modified[paths[i]].Before(modified[paths[j]])
+	})
+
+	for _, path := range paths[:len(paths)-keep] {
+		// Recordings may be deleted concurrently by other recorders
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Errorf("Failed to delete recording %s: %+v",
+				path, err)
+		}
+	}
+	return nil
+}
+
+// LoadRecording reads the recording written by a Recorder to the file at path
+func LoadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Errorf("Failed to open recording %s: %+v", path,
+			err)
+	}
+	defer file.Close()
+
+	rec := &Recording{}
+	dec := json.NewDecoder(file)
+	if err = dec.Decode(&rec.RecordingHeader); err != nil {
+		return nil, errors.Errorf("Failed to read header of recording "+
+			"%s: %+v", path, err)
+	}
+	if rec.Group == nil {
+		return nil, errors.Errorf("Recording %s has no group", path)
+	}
+
+	for {
+		input := RecordedInput{}
+		err = dec.Decode(&input)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Errorf("Failed to read input %d of "+
+				"recording %s: %+v", len(rec.Inputs), path, err)
+		}
+		rec.Inputs = append(rec.Inputs, input)
+	}
+
+	return rec, nil
+}
+
+// GetSlot decodes the recorded slot
+func (ri RecordedInput) GetSlot() (*mixmessages.Slot, error) {
+	slot := &mixmessages.Slot{}
+	if err := proto.Unmarshal(ri.Slot, slot); err != nil {
+		return nil, errors.Errorf("Failed to decode recorded slot %d: %+v",
+			ri.Index, err)
+	}
+	return slot, nil
+}
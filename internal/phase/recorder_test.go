@@ -0,0 +1,268 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package phase
+
+import (
+	"encoding/json"
+	"github.com/golang/protobuf/proto"
+	"gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/server/services"
+	"gitlab.com/xx_network/crypto/large"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Stream which clears the slots input into it, to check that slots are
+// recorded as received
+type recorderTestStream struct {
+	inputs []uint32
+}
+
+func (s *recorderTestStream) GetName() string { return "recorderTestStream" }
+
+func (s *recorderTestStream) Link(*cyclic.Group, uint32, ...interface{}) {}
+
+func (s *recorderTestStream) Input(index uint32, slot *mixmessages.Slot) error {
+	s.inputs = append(s.inputs, index)
+	slot.PayloadA = nil
+	return nil
+}
+
+func (s *recorderTestStream) Output(uint32) *mixmessages.Slot { return nil }
+
+// Happy path: slots input into a phase are recorded as received and can be
+// loaded along with the header
+func TestPhase_Input_Recorder(t *testing.T) {
+	header := RecordingHeader{
+		RoundID:           42,
+		Phase:             RealDecrypt,
+		Graph:             "RealtimeDecrypt",
+		BatchSize:         4,
+		ExpandedBatchSize: 8,
+		Group:             cyclic.NewGroup(large.NewInt(107), large.NewInt(2)),
+	}
+	path := filepath.Join(t.TempDir(), "recordings", "round.jsonl")
+	stream := &recorderTestStream{}
+	gc := services.MustNewGraphGenerator(4, 1, 1, 0)
+
+	recorder := NewRecorder(path, header, RecordingLimits{})
+	p := New(Definition{
+		Graph:    gc.NewGraph("RealtimeDecrypt", stream),
+		Type:     RealDecrypt,
+		Recorder: recorder,
+	})
+	p.ConnectToRound(header.RoundID, func(from, to State) bool { return true },
+		func() State { return Active })
+
+	slots := []*mixmessages.Slot{
+		{Index: 3, PayloadA: []byte{1, 2}, SenderID: []byte{3}},
+		{Index: 1, PayloadA: []byte{4}, Salt: []byte{5, 6}},
+	}
+	expected := make([]*mixmessages.Slot, len(slots))
+	for i, slot := range slots {
+		expected[i] = proto.Clone(slot).(*mixmessages.Slot)
+		if err := p.Input(slot.Index, slot); err != nil {
+			t.Fatalf("Input returned an error: %+v", err)
+		}
+	}
+	if len(stream.inputs) != len(slots) {
+		t.Errorf("Slots were not input into the stream: %v", stream.inputs)
+	}
+
+	// Slots input once the phase is complete are not recorded
+	p.UpdateFinalStates()
+	if err := p.Input(0, &mixmessages.Slot{}); err != nil {
+		t.Fatalf("Input returned an error: %+v", err)
+	}
+	if err := recorder.Wait(); err != nil {
+		t.Fatalf("Wait returned an error: %+v", err)
+	}
+
+	rec, err := LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording returned an error: %+v", err)
+	}
+
+	if rec.RoundID != header.RoundID || rec.Phase != header.Phase ||
+		rec.Graph != header.Graph || rec.BatchSize != header.BatchSize ||
+		rec.ExpandedBatchSize != header.ExpandedBatchSize ||
+		rec.Group.GetFingerprint() != header.Group.GetFingerprint() {
+		t.Errorf("Unexpected recording header."+
+			"\n\tExpected: %+v\n\tReceived: %+v", header, rec.RecordingHeader)
+	}
+
+	if len(rec.Inputs) != len(expected) {
+		t.Fatalf("Unexpected number of recorded inputs."+
+			"\n\tExpected: %d\n\tReceived: %d", len(expected), len(rec.Inputs))
+	}
+	for i, input := range rec.Inputs {
+		slot, err := input.GetSlot()
+		if err != nil {
+			t.Fatalf("GetSlot returned an error: %+v", err)
+		}
+		if input.Index != expected[i].Index || !proto.Equal(slot, expected[i]) {
+			t.Errorf("Unexpected recorded input %d."+
+				"\n\tExpected: %d %v\n\tReceived: %d %v", i,
+				expected[i].Index, expected[i], input.Index, slot)
+		}
+	}
+}
+
+// Tests that StopRecording, called when the round of a phase fails, closes
+// the recording so that later slots are not recorded
+func TestPhase_StopRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "round.jsonl")
+	recorder := NewRecorder(path, RecordingHeader{
+		Group: cyclic.NewGroup(large.NewInt(107), large.NewInt(2)),
+	}, RecordingLimits{})
+	gc := services.MustNewGraphGenerator(4, 1, 1, 0)
+	p := New(Definition{
+		Graph:    gc.NewGraph("RealtimeDecrypt", &recorderTestStream{}),
+		Type:     RealDecrypt,
+		Recorder: recorder,
+	})
+	p.ConnectToRound(1, func(from, to State) bool { return true },
+		func() State { return Active })
+
+	if err := p.Input(1, &mixmessages.Slot{Index: 1}); err != nil {
+		t.Fatalf("Input returned an error: %+v", err)
+	}
+	p.StopRecording()
+	if err := p.Input(2, &mixmessages.Slot{Index: 2}); err != nil {
+		t.Fatalf("Input returned an error: %+v", err)
+	}
+	if err := recorder.Wait(); err != nil {
+		t.Fatalf("Wait returned an error: %+v", err)
+	}
+
+	rec, err := LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording returned an error: %+v", err)
+	}
+	if len(rec.Inputs) != 1 || rec.Inputs[0].Index != 1 {
+		t.Errorf("Unexpected recorded inputs."+
+			"\n\tExpected: %d\n\tReceived: %v", 1, rec.Inputs)
+	}
+}
+
+// Tests that no file is created by a Recorder which records no slots
+func TestRecorder_Close_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "round.jsonl")
+	r := NewRecorder(path, RecordingHeader{}, RecordingLimits{})
+	r.Close()
+	if err := r.Wait(); err != nil {
+		t.Errorf("Wait returned an error: %+v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Recording created without any slots: %v", err)
+	}
+}
+
+// Error path: a recording stops at the first slot which takes it past the
+// maximum size and the failure is returned by Wait
+func TestRecorder_MaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "round.jsonl")
+	slot := &mixmessages.Slot{PayloadA: make([]byte, 64)}
+	data, _ := proto.Marshal(slot)
+	line, _ := json.Marshal(RecordedInput{Index: 0, Slot: data})
+
+	r := NewRecorder(path, RecordingHeader{
+		Group: cyclic.NewGroup(large.NewInt(107), large.NewInt(2)),
+	}, RecordingLimits{MaxSize: uint64(2*len(line) + 2)})
+	for i := uint32(0); i < 4; i++ {
+		r.Record(0, slot)
+	}
+	r.Close()
+	if err := r.Wait(); err == nil {
+		t.Errorf("Wait did not return the failure of a recording past " +
+			"its maximum size")
+	}
+
+	rec, err := LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording returned an error: %+v", err)
+	}
+	if len(rec.Inputs) != 2 {
+		t.Errorf("Unexpected number of recorded inputs."+
+			"\n\tExpected: %d\n\tReceived: %d", 2, len(rec.Inputs))
+	}
+}
+
+// Error path: a recorder which cannot create its file stops recording
+func TestRecorder_CreateFailure(t *testing.T) {
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRecorder(filepath.Join(blocker, "round.jsonl"),
+		RecordingHeader{}, RecordingLimits{})
+	for i := uint32(0); i < 4; i++ {
+		r.Record(i, &mixmessages.Slot{})
+	}
+	r.Close()
+	if err := r.Wait(); err == nil {
+		t.Errorf("Wait did not return the failure to create the recording")
+	}
+	if atomic.LoadUint32(&r.disabled) != 1 {
+		t.Errorf("Recorder was not stopped by the failure")
+	}
+}
+
+// Tests that the oldest recordings in the directory are deleted so that at
+// most MaxCount are kept
+func TestRecorder_MaxCount(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"a.jsonl", "b.jsonl", "c.jsonl", "d.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := now.Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRecorder(filepath.Join(dir, "e.jsonl"), RecordingHeader{},
+		RecordingLimits{MaxCount: 2})
+	r.Record(0, &mixmessages.Slot{})
+	r.Close()
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Wait returned an error: %+v", err)
+	}
+
+	for name, kept := range map[string]bool{"a.jsonl": false,
+		"b.jsonl": false, "c.jsonl": true, "d.txt": true, "e.jsonl": true} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept != (err == nil) {
+			t.Errorf("Unexpected state of %s.\n\tExpected kept: %t"+
+				"\n\tReceived: %v", name, kept, err)
+		}
+	}
+}
+
+// Error path: recordings without a header cannot be loaded
+func TestLoadRecording_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "round.jsonl")
+	if err := os.WriteFile(path, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRecording(path); err == nil {
+		t.Errorf("LoadRecording did not error on a recording without a group")
+	}
+	if _, err := LoadRecording(path + ".missing"); err == nil {
+		t.Errorf("LoadRecording did not error on a missing file")
+	}
+}
@@ -10,6 +10,7 @@ package phase
 // transmission contains the interface for transmission functions
 
 import (
+	"context"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/server/services"
 	"gitlab.com/xx_network/primitives/id"
@@ -21,6 +22,8 @@ type Measure func(tag string)
 
 // Fixme: getmessage can be removed from the interface, but it makes testing difficult.
 //  A more general refactor is required to remove this while keeping testability
-type Transmit func(roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error
+// The context is cancelled if the phase times out or the round is killed, in
+// which case the handler should stop transmitting and return promptly.
+type Transmit func(ctx context.Context, roundID id.Round, instance GenericInstance, getChunk GetChunk, getMessage GetMessage) error
 
 type GenericInstance interface{}
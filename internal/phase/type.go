@@ -9,6 +9,8 @@ package phase
 
 // type.go contains the type a phase can be in
 
+import "github.com/pkg/errors"
+
 // Type the Name of a phase
 type Type uint32
 
@@ -61,3 +63,13 @@ var typeStrings = [NumPhases]string{"PrecompGeneration",
 func (p Type) String() string {
 	return typeStrings[p]
 }
+
+// ParseType returns the phase of a round with the name returned by String
+func ParseType(name string) (Type, error) {
+	for p := PrecompGeneration; p <= RealPermute; p++ {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return 0, errors.Errorf("Unknown phase %q", name)
+}
@@ -26,3 +26,19 @@ func TestPhase_String(t *testing.T) {
 		}
 	}
 }
+
+// Tests that ParseType returns the phase with the given name and rejects
+// unknown names
+func TestParseType(t *testing.T) {
+	for p := PrecompGeneration; p <= RealPermute; p++ {
+		received, err := ParseType(p.String())
+		if err != nil || received != p {
+			t.Errorf("ParseType did not return phase %s: %v, %+v", p,
+				received, err)
+		}
+	}
+
+	if _, err := ParseType("Complete"); err == nil {
+		t.Errorf("ParseType did not error on an unknown phase")
+	}
+}
@@ -11,16 +11,22 @@ package internal
 // and its interface
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/server/internal/measure"
 	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/xx_network/primitives/id"
 	"sync/atomic"
 	"testing"
 	"time"
 )
 
+// Time allowed for the graph and transmission handler of a cancelled phase to
+// stop before the queue moves on
+var phaseKillTimeout = 5 * time.Second
+
 type ResourceQueue struct {
 	activePhase phase.Phase
 	phaseQueue  chan phase.Phase
@@ -63,6 +69,14 @@ func (rq *ResourceQueue) GetQueue(t *testing.T) chan phase.Phase {
 	return rq.phaseQueue
 }
 
+// killTimeout returns the time allowed for Kill to stop the queue, which covers
+// stopping the active phase
+func (rq *ResourceQueue) killTimeout() time.Duration {
+	// The phase waits up to phaseKillTimeout for its graph and again for its
+	// transmission handler
+	return 3 * phaseKillTimeout
+}
+
 func (rq *ResourceQueue) Kill(t time.Duration) error {
 	wasRunning := atomic.SwapUint32(rq.running, 0)
 	if wasRunning == 1 {
@@ -86,26 +100,46 @@ func (rq *ResourceQueue) Kill(t time.Duration) error {
 
 func (rq *ResourceQueue) run(server *Instance) {
 	atomic.StoreUint32(rq.running, 1)
-	rq.internalRunner(server)
-	atomic.StoreUint32(rq.running, 0)
+	rid, err := rq.internalRunner(server)
+	if err != nil {
+		// The queue is marked as stopped before the failure is reported, as
+		// reporting aborts the round by killing and restarting the queue
+		atomic.StoreUint32(rq.running, 0)
+		server.ReportRoundFailure(err, server.GetID(), rid)
+	}
 }
 
-func (rq *ResourceQueue) internalRunner(server *Instance) {
-	for true {
+// internalRunner executes phases one at a time in the order they are queued.
+// Phases of failed rounds are dropped. Returns the failure which stopped the
+// queue, if it was not killed.
+func (rq *ResourceQueue) internalRunner(server *Instance) (id.Round, error) {
+	for {
 		//get the next phase to execute
 		select {
 		case why := <-rq.killChan:
 			go func() { why <- true }()
-			return
+			return 0, nil
 		case rq.activePhase = <-rq.phaseQueue:
-			rq.activePhase.Measure(measure.TagActive)
 		}
 
+		if server.isRoundFailed(rq.activePhase.GetRoundID()) {
+			jww.WARN.Printf("[%v]: RID %d Dropping phase %s of failed "+
+				"round", server.GetID(), rq.activePhase.GetRoundID(),
+				rq.activePhase.GetType())
+			continue
+		}
+		rq.activePhase.Measure(measure.TagActive)
+
 		jww.INFO.Printf("[%s]: RID %d Beginning execution of Phase \"%s\"", server,
 			rq.activePhase.GetRoundID(), rq.activePhase.GetType())
 
 		runningPhase := rq.activePhase
 
+		// Cancelled when the phase times out or the queue is killed to stop
+		// the phase's graph and transmission handler, and once the
+		// transmission handler returns to release the graph
+		ctx, cancel := context.WithCancel(context.Background())
+
 		numChunks := uint32(0)
 
 		//Build the chunk accessor which will also increment the queue when appropriate
@@ -118,8 +152,9 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 			}
 			chunk, ok := runningPhase.GetGraph().GetOutput()
 
-			//Fixme: add a method to killChan this directly
-			if !ok {
+			// Output also ends when the graph is killed, which does not
+			// complete the phase
+			if !ok && ctx.Err() == nil {
 				//send the phase into the channel to denote it is complete
 				runningPhase.UpdateFinalStates()
 				rq.DenotePhaseCompletion(runningPhase)
@@ -134,18 +169,30 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 
 		if err != nil {
 			rid := runningPhase.GetRoundID()
-			roundErr := errors.Errorf("Round %d does not exist!", rid)
-			server.ReportRoundFailure(roundErr, server.GetID(), rid)
-			break
+			cancel()
+			return rid, errors.Errorf("Round %d does not exist!", rid)
 		}
 
 		//start the phase's transmission handler
 		handler := rq.activePhase.GetTransmissionHandler
+		handlerDone := make(chan struct{})
 		go func() {
-			rq.activePhase.Measure(measure.TagTransmitter)
-			err := handler()(runningPhase.GetRoundID(), server, getChunk, runningPhase.GetGraph().GetStream().Output)
+			runningPhase.Measure(measure.TagTransmitter)
+			err := handler()(ctx, runningPhase.GetRoundID(), server, getChunk, runningPhase.GetGraph().GetStream().Output)
+			cancelled := ctx.Err() != nil
+
+			// The handler is marked as stopped before any failure is
+			// reported, as reporting aborts the round and so waits for the
+			// handler to stop
+			cancel()
+			close(handlerDone)
 
-			if err != nil {
+			if err != nil && cancelled {
+				// The failure of the phase has already been reported
+				jww.WARN.Printf("[%v]: RID %d Transmission Handler for "+
+					"phase %s stopped after cancellation: %+v", server.GetID(),
+					runningPhase.GetRoundID(), runningPhase.GetType(), err)
+			} else if err != nil {
 				// This error can be used to create a Byzantine Fault
 				rid := runningPhase.GetRoundID()
 				roundErr := errors.Errorf("Transmission Handler for phase %s of round %v errored: %+v",
@@ -155,20 +202,37 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 		}()
 
 		//start the phase's graphs
-		runningPhase.GetGraph().Run()
+		runningPhase.GetGraph().Run(ctx)
 		//start phases's the timeout timer
 		rq.timer = time.NewTimer(runningPhase.GetTimeout())
 
 		var rtnPhase phase.Phase
 		timeout := false
 
-		select {
-		case why := <-rq.killChan:
-			go func() { why <- true }()
-			return
-		case rtnPhase = <-rq.finishChan:
-		case <-rq.timer.C:
-			timeout = true
+	wait:
+		for {
+			select {
+			case why := <-rq.killChan:
+				cancel()
+				stopPhase(server, runningPhase, handlerDone)
+				rq.drainCompletion()
+				go func() { why <- true }()
+				return 0, nil
+			case rtnPhase = <-rq.finishChan:
+				// A phase stopped with its round can complete after the
+				// queue has moved on
+				if !rq.activePhase.Cmp(rtnPhase) &&
+					server.isRoundFailed(rtnPhase.GetRoundID()) {
+					jww.WARN.Printf("[%v]: RID %d Dropping completion of "+
+						"phase %s of failed round", server.GetID(),
+						rtnPhase.GetRoundID(), rtnPhase.GetType())
+					continue
+				}
+				break wait
+			case <-rq.timer.C:
+				timeout = true
+				break wait
+			}
 		}
 
 		//process timeout
@@ -179,22 +243,13 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 			rid := curRound.GetID()
 			roundErr := errors.Errorf("Resource Queue has timed out killing Round %v after %s", rid, runningPhase.GetTimeout())
 
-			server.ReportRoundFailure(roundErr, server.GetID(), rid)
-			break
-			//FIXME: also killChan the transmission handler
-			/*kill := rq.activePhase.GetGraph().Kill()
-			if kill {
-				jww.ERROR.Printf("[%s]: RID %d Graph %s of phase %s killed"+
-					" due to timeout",
-					server, rq.activePhase.GetRoundID(), rq.activePhase.GetGraph().GetName(),
-					rq.activePhase.GetType().String())
-				//FIXME: send killChan round message
-			} else {
-				jww.FATAL.Panicf("[%s]: RID %d Graph %s of phase %s could not"+
-					" be killed after timeout",
-					server, rq.activePhase.GetRoundID(), rq.activePhase.GetGraph().GetName(),
-					rq.activePhase.GetType().String())
-			}*/
+			// Stop the phase before reporting so that its goroutines do not
+			// outlive the round
+			cancel()
+			stopPhase(server, runningPhase, handlerDone)
+			rq.drainCompletion()
+
+			return rid, roundErr
 		}
 
 		//check that the correct phase is ending
@@ -204,15 +259,18 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 				"round %v is currently running, a completion signal of %s "+
 				" cannot be processed", rq.activePhase.GetType(),
 				rid, rtnPhase.GetType())
-			server.ReportRoundFailure(roundErr, server.GetID(), rid)
+			// Reported in a separate thread as reporting kills the queue
+			go server.ReportRoundFailure(roundErr, server.GetID(), rid)
 		}
 
 		// Aggregate the runtimes of the individual threads
 		adaptDur, outModsDur := runningPhase.GetGraph().GetMetrics()
 		// Add this to the round dispatch duration metric
-		r, _ := server.GetRoundManager().GetRound(
+		r, err := server.GetRoundManager().GetRound(
 			rq.activePhase.GetRoundID())
-		r.AddToDispatchDuration(adaptDur + outModsDur)
+		if err == nil {
+			r.AddToDispatchDuration(adaptDur + outModsDur)
+		}
 
 		jww.INFO.Printf("[%v]: RID %d Finishing execution of Phase "+
 			"\"%s\" -- Adapt: %fms, outMod: %fms", server.GetID(),
@@ -221,3 +279,36 @@ func (rq *ResourceQueue) internalRunner(server *Instance) {
 			float64(outModsDur.Nanoseconds()/1000000))
 	}
 }
+
+// drainCompletion discards the completion signal of a stopped phase which
+// finished as it was stopped, so that it is not taken for the completion of
+// the next phase
+func (rq *ResourceQueue) drainCompletion() {
+	select {
+	case <-rq.finishChan:
+	default:
+	}
+}
+
+// stopPhase waits for the graph and transmission handler of a cancelled phase
+// to stop, logging an error if either is still running after phaseKillTimeout
+func stopPhase(server *Instance, p phase.Phase, handlerDone <-chan struct{}) {
+	if p.GetGraph().Kill(phaseKillTimeout) {
+		jww.ERROR.Printf("[%v]: RID %d Graph %s of phase %s killed",
+			server.GetID(), p.GetRoundID(), p.GetGraph().GetName(), p.GetType())
+	} else {
+		jww.ERROR.Printf("[%v]: RID %d Graph %s of phase %s could not be "+
+			"killed within %s", server.GetID(), p.GetRoundID(),
+			p.GetGraph().GetName(), p.GetType(), phaseKillTimeout)
+	}
+
+	timer := time.NewTimer(phaseKillTimeout)
+	defer timer.Stop()
+	select {
+	case <-handlerDone:
+	case <-timer.C:
+		jww.ERROR.Printf("[%v]: RID %d Transmission Handler for phase %s "+
+			"did not stop within %s", server.GetID(), p.GetRoundID(),
+			p.GetType(), phaseKillTimeout)
+	}
+}
@@ -8,6 +8,7 @@
 package internal
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/comms/node"
@@ -90,6 +91,8 @@ func (*MockPhase) TransitionToRunning()                         { return }
 func (*MockPhase) AttemptToQueue(queue chan<- phase.Phase) bool { return false }
 func (*MockPhase) IsQueued() bool                               { return false }
 func (*MockPhase) UpdateFinalStates()                           { return }
+func (*MockPhase) StopRecording()                               { return }
+func (*MockPhase) Detach()                                      { return }
 func (*MockPhase) GetTransmissionHandler() phase.Transmit       { return nil }
 func (*MockPhase) GetTimeout() time.Duration                    { return 5 * time.Second }
 func (*MockPhase) Cmp(phase.Phase) bool                         { return false }
@@ -181,6 +184,205 @@ func TestResourceQueue_RunOne(t *testing.T) {
 	time.Sleep(20 * time.Millisecond)
 }
 
+// Tests that when a phase times out, its graph is killed and its transmission
+// handler is cancelled and returns before the queue moves on
+func TestResourceQueue_Timeout(t *testing.T) {
+	instance, _ := createInstance(t)
+	q := initQueue()
+	roundID := id.Round(1)
+
+	// The handler waits for output which never arrives because the graph
+	// receives no input
+	var handlerErr error
+	handlerReturned := make(chan struct{})
+	p := phase.New(phase.Definition{
+		Graph: makeTestGraph(instance, 1),
+		Type:  phase.PrecompGeneration,
+		TransmissionHandler: func(ctx context.Context, roundID id.Round,
+			instance phase.GenericInstance, getChunk phase.GetChunk,
+			getMessage phase.GetMessage) error {
+			defer close(handlerReturned)
+			for _, ok := getChunk(); ok; _, ok = getChunk() {
+			}
+			handlerErr = ctx.Err()
+			return handlerErr
+		},
+		Timeout: 50 * time.Millisecond,
+	})
+
+	responseMap := make(phase.ResponseMap)
+	responseMap[phase.PrecompGeneration.String()] =
+		phase.NewResponse(phase.ResponseDefinition{
+			PhaseAtSource:  phase.PrecompGeneration,
+			ExpectedStates: []phase.State{phase.Active},
+			PhaseToExecute: phase.PrecompGeneration,
+		})
+	topology := connect.NewCircuit([]*id.ID{instance.GetID()})
+	r, err := round.New(cyclic.NewGroup(pPrime, g), roundID, []phase.Phase{p},
+		responseMap, topology, instance.GetID(), 1, instance.GetRngStreamGen(),
+		nil, "0.0.0.0", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create new round: %+v", err)
+	}
+	instance.GetRoundManager().AddRound(r)
+	p.AttemptToQueue(q.GetPhaseQueue())
+
+	done := make(chan struct{})
+	go func() {
+		q.run(instance)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Queue did not stop after the phase timed out")
+	}
+
+	// The handler must have returned before the queue moved on
+	select {
+	case <-handlerReturned:
+	default:
+		t.Fatalf("Transmission handler was still running after the timeout")
+	}
+	if handlerErr != context.Canceled {
+		t.Errorf("Unexpected handler context error."+
+			"\n\tExpected: %v\n\tReceived: %v", context.Canceled, handlerErr)
+	}
+	if !p.GetGraph().IsKilled() {
+		t.Errorf("Graph of the timed out phase was not killed")
+	}
+	if len(q.finishChan) != 0 {
+		t.Errorf("A killed phase should not be denoted as complete")
+	}
+}
+
+// Tests that phases of failed rounds are dropped rather than run
+func TestResourceQueue_FailedRound(t *testing.T) {
+	instance, _ := createInstance(t)
+	q := initQueue()
+
+	failed, startedFailed, _ := makeBlockingPhase(t, instance,
+		phase.PrecompGeneration, 1)
+	other, startedOther, _ := makeBlockingPhase(t, instance,
+		phase.PrecompGeneration, 2)
+	instance.GetRoundRetention().Fail(1)
+
+	failed.AttemptToQueue(q.GetPhaseQueue())
+	other.AttemptToQueue(q.GetPhaseQueue())
+
+	go q.run(instance)
+
+	waitForStart(t, startedOther, "other round's")
+	select {
+	case <-startedFailed:
+		t.Errorf("Phase of the failed round was started")
+	default:
+	}
+
+	if err := q.Kill(5 * time.Second); err != nil {
+		t.Errorf("Failed to kill the queue: %+v", err)
+	}
+}
+
+// Tests that a completion signal left by a phase of a failed round is dropped
+// rather than taken for the completion of the running phase
+func TestResourceQueue_FailedRoundCompletion(t *testing.T) {
+	instance, _ := createInstance(t)
+	q := initQueue()
+
+	failed, _, _ := makeBlockingPhase(t, instance, phase.PrecompGeneration, 1)
+	running, started, release := makeBlockingPhase(t, instance,
+		phase.PrecompGeneration, 2)
+	defer close(release)
+	instance.GetRoundRetention().Fail(1)
+	running.AttemptToQueue(q.GetPhaseQueue())
+
+	go q.run(instance)
+	waitForStart(t, started, "running")
+
+	// The stale completion is dropped, so the queue is still waiting for the
+	// running phase to complete and takes its completion
+	q.DenotePhaseCompletion(failed)
+	q.DenotePhaseCompletion(running)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(q.finishChan) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if len(q.finishChan) != 0 {
+		t.Errorf("Completion of the running phase was not received")
+	}
+	if instance.isRoundFailed(2) {
+		t.Errorf("Stale completion failed the running round")
+	}
+
+	if err := q.Kill(5 * time.Second); err != nil {
+		t.Errorf("Failed to kill the queue: %+v", err)
+	}
+}
+
+// Tests that the time allowed to kill the queue covers stopping the graph and
+// transmission handler of the active phase
+func TestResourceQueue_killTimeout(t *testing.T) {
+	q := initQueue()
+
+	if minimum := 2 * phaseKillTimeout; q.killTimeout() <= minimum {
+		t.Errorf("Kill timeout does not cover stopping the active phase."+
+			"\n\tExpected: more than %s\n\tReceived: %s", minimum,
+			q.killTimeout())
+	}
+}
+
+// makeBlockingPhase adds a round to the instance holding a single phase whose
+// transmission handler closes the returned started channel and blocks until
+// the release channel is closed or the phase is cancelled
+func makeBlockingPhase(t *testing.T, instance *Instance, phaseType phase.Type,
+	roundID id.Round) (phase.Phase, chan struct{}, chan struct{}) {
+	started, release := make(chan struct{}), make(chan struct{})
+	p := phase.New(phase.Definition{
+		Graph: makeTestGraph(instance, 1),
+		Type:  phaseType,
+		TransmissionHandler: func(ctx context.Context, roundID id.Round,
+			instance phase.GenericInstance, getChunk phase.GetChunk,
+			getMessage phase.GetMessage) error {
+			close(started)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return nil
+		},
+		Timeout: time.Minute,
+	})
+
+	responseMap := make(phase.ResponseMap)
+	responseMap[phaseType.String()] =
+		phase.NewResponse(phase.ResponseDefinition{
+			PhaseAtSource:  phaseType,
+			ExpectedStates: []phase.State{phase.Active},
+			PhaseToExecute: phaseType,
+		})
+	topology := connect.NewCircuit([]*id.ID{instance.GetID()})
+	r, err := round.New(cyclic.NewGroup(pPrime, g), roundID, []phase.Phase{p},
+		responseMap, topology, instance.GetID(), 1, instance.GetRngStreamGen(),
+		nil, "0.0.0.0", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create new round: %+v", err)
+	}
+	instance.GetRoundManager().AddRound(r)
+
+	return p, started, release
+}
+
+// waitForStart fails the test if the started channel is not closed in time
+func waitForStart(t *testing.T, started chan struct{}, name string) {
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("The %s phase did not start", name)
+	}
+}
+
 type mockStream struct{}
 
 func (*mockStream) Input(uint32, *mixmessages.Slot) error { return nil }
@@ -205,11 +407,7 @@ var iWasCalledLck sync.Mutex
 func makeTestPhase(instance *Instance, name phase.Type,
 	roundID id.Round) phase.Phase {
 
-	// FIXME We need to be able to killChan this,
-	//  or tell whether something was killed before calling DenotePhaseComplete.
-	//  It could be done by changing the way that GetChunk works/the GetChunk
-	//  header.
-	transmissionHandler := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk,
+	transmissionHandler := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk,
 		getMessage phase.GetMessage) error {
 		iWasCalledLck.Lock()
 		defer iWasCalledLck.Unlock()
@@ -227,7 +425,7 @@ func makeTestPhase(instance *Instance, name phase.Type,
 }
 
 func makeTestGraph(instance *Instance, batchSize uint32) *services.Graph {
-	graphGen := services.NewGraphGenerator(4,
+	graphGen := services.MustNewGraphGenerator(4,
 		uint8(runtime.NumCPU()), 1, 1)
 	graph := graphGen.NewGraph("TestGraph", &mockStream{})
 
@@ -111,6 +111,68 @@ func (r *Buffer) GetExpandedBatchSize() uint32 {
 	return r.expandedBatchSize
 }
 
+// EstimateSize returns an estimate of the memory, in bytes, used by the keys
+// and permutation held in the buffer for the group
+func (r *Buffer) EstimateSize(g *cyclic.Group) uint64 {
+	// The cypher keys and the eleven buffers of keys
+	numInts := 2 + 11*uint64(r.expandedBatchSize)
+	numInts += uint64(len(r.PermutedPayloadAKeys) + len(r.PermutedPayloadBKeys))
+
+	return numInts*uint64(g.GetP().ByteLen()) + 4*uint64(len(r.Permutations))
+}
+
+// Reset overwrites the keys held in the buffer with zeroes and returns it to
+// the state of a new buffer of the same size, so that it can be reused by
+// another round without reallocating its keys
+func (r *Buffer) Reset(g *cyclic.Group) {
+	resetInt(g, r.CypherPublicKey)
+	g.SetMaxInt(r.CypherPublicKey)
+	resetInt(g, r.Z)
+	g.SetMaxInt(r.Z)
+
+	intBuffers := []*cyclic.IntBuffer{r.R, r.S, r.U, r.V, r.Y_R, r.Y_S, r.Y_T,
+		r.Y_V, r.Y_U, r.PayloadAPrecomputation, r.PayloadBPrecomputation}
+	for _, ib := range intBuffers {
+		for i := uint32(0); i < uint32(ib.Len()); i++ {
+			resetInt(g, ib.Get(i))
+		}
+	}
+
+	for i := range r.Permutations {
+		r.Permutations[i] = uint32(i)
+	}
+
+	for _, keys := range [][]*cyclic.Int{r.PermutedPayloadAKeys,
+		r.PermutedPayloadBKeys, r.FinalKeys} {
+		for _, key := range keys {
+			if key != nil {
+				resetInt(g, key)
+			}
+		}
+	}
+	r.PermutedPayloadAKeys = nil
+	r.PermutedPayloadBKeys = nil
+
+	r.SharePhaseMux.Lock()
+	atomic.SwapUint32(r.SharesReceived, 0)
+	r.FinalKeys = make([]*cyclic.Int, 0)
+	for key := range r.FinalShareMessages {
+		delete(r.FinalShareMessages, key)
+	}
+	r.SharePhaseMux.Unlock()
+}
+
+// resetInt zeroes every word allocated to the int, including those beyond its
+// current value, and sets it to one
+func resetInt(g *cyclic.Group, x *cyclic.Int) {
+	words := x.Bits()
+	words = words[:cap(words)]
+	for i := range words {
+		words[i] = 0
+	}
+	g.SetUint64(x, 1)
+}
+
 // Erase clears all data contained in the buffer. All elements are set to zero
 // and all arrays are set to nil. All underlying released data will be removed
 // by the garbage collector.
@@ -0,0 +1,129 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package round
+
+// bufferPool.go handles keeping released round buffers so that they can be
+// reused by later rounds
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/server/internal/measure"
+	"sync"
+)
+
+// BufferPool holds round buffers released by finished rounds so that later
+// rounds can reuse them instead of allocating new ones. Buffers are zeroed
+// when released and kept by group, batch size and expanded batch size.
+type BufferPool struct {
+	maxIdle int
+	buffers map[bufferPoolKey][]*Buffer
+	metric  measure.BufferPoolMetric
+	sync.Mutex
+}
+
+type bufferPoolKey struct {
+	grpFingerprint    uint64
+	batchSize         uint32
+	expandedBatchSize uint32
+}
+
+// NewBufferPool returns a BufferPool which keeps up to maxIdle buffers of each
+// size. A pool with a maxIdle of zero keeps no buffers.
+func NewBufferPool(maxIdle int) *BufferPool {
+	if maxIdle < 0 {
+		jww.FATAL.Panicf("Buffer pool size must not be negative: "+
+			"received %d", maxIdle)
+	}
+	return &BufferPool{
+		maxIdle: maxIdle,
+		buffers: make(map[bufferPoolKey][]*Buffer),
+	}
+}
+
+// Get removes and returns an idle buffer of the group and sizes, or allocates
+// a new one if the pool has no such buffer or is nil
+func (bp *BufferPool) Get(g *cyclic.Group, batchSize,
+	expandedBatchSize uint32) *Buffer {
+	if bp == nil {
+		return NewBuffer(g, batchSize, expandedBatchSize)
+	}
+
+	key := bufferPoolKey{g.GetFingerprint(), batchSize, expandedBatchSize}
+	bp.Lock()
+	idle := bp.buffers[key]
+	if len(idle) == 0 {
+		bp.metric.Allocated++
+		bp.Unlock()
+		return NewBuffer(g, batchSize, expandedBatchSize)
+	}
+
+	b := idle[len(idle)-1]
+	idle[len(idle)-1] = nil
+	bp.buffers[key] = idle[:len(idle)-1]
+	bp.metric.Reused++
+	bp.metric.Idle--
+	bp.metric.IdleBytes -= b.EstimateSize(g)
+	bp.Unlock()
+	return b
+}
+
+// Put zeroes the buffer and adds it to the pool. The buffer is erased instead
+// if the pool already holds maxIdle buffers of its size or is nil. Returns
+// true if the buffer was added. The buffer must not be used afterwards.
+func (bp *BufferPool) Put(g *cyclic.Group, b *Buffer) bool {
+	if b == nil || b.R == nil || b.R.Len() == 0 {
+		return false
+	}
+	if bp == nil {
+		b.Erase()
+		return false
+	}
+
+	key := bufferPoolKey{g.GetFingerprint(), b.batchSize, b.expandedBatchSize}
+	bp.Lock()
+	full := len(bp.buffers[key]) >= bp.maxIdle
+	bp.Unlock()
+	if full || b.R.GetFingerprint() != key.grpFingerprint {
+		bp.drop(b)
+		return false
+	}
+
+	b.Reset(g)
+
+	bp.Lock()
+	defer bp.Unlock()
+	if len(bp.buffers[key]) >= bp.maxIdle {
+		bp.metric.Dropped++
+		b.Erase()
+		return false
+	}
+	bp.buffers[key] = append(bp.buffers[key], b)
+	bp.metric.Idle++
+	bp.metric.IdleBytes += b.EstimateSize(g)
+	return true
+}
+
+// GetMetric returns the usage metrics of the pool
+func (bp *BufferPool) GetMetric() measure.BufferPoolMetric {
+	if bp == nil {
+		return measure.BufferPoolMetric{}
+	}
+
+	bp.Lock()
+	defer bp.Unlock()
+	return bp.metric
+}
+
+// drop erases a buffer which is not kept by the pool
+func (bp *BufferPool) drop(b *Buffer) {
+	b.Erase()
+	bp.Lock()
+	bp.metric.Dropped++
+	bp.Unlock()
+}
@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package round
+
+import (
+	"gitlab.com/elixxir/server/internal/measure"
+	"testing"
+)
+
+// Happy path: a released buffer is zeroed and reused by the next round of the
+// same size
+func TestBufferPool_GetPut(t *testing.T) {
+	bp := NewBufferPool(1)
+
+	b := bp.Get(grp, 4, 8)
+	b.InitLastNode()
+	grp.SetUint64(b.R.Get(3), 42)
+	grp.SetUint64(b.Z, 42)
+	b.Permutations[0], b.Permutations[1] = 1, 0
+	b.FinalKeys = append(b.FinalKeys, grp.NewInt(42))
+	key := b.FinalKeys[0]
+
+	if !bp.Put(grp, b) {
+		t.Fatalf("Buffer was not added to the pool")
+	}
+	if key.GetLargeInt().Uint64() != 1 {
+		t.Errorf("Final key was not overwritten: %s", key.Text(10))
+	}
+
+	// Buffers of other sizes are allocated
+	if other := bp.Get(grp, 4, 4); other == b {
+		t.Errorf("Buffer of a different size was reused")
+	}
+
+	reused := bp.Get(grp, 4, 8)
+	if reused != b {
+		t.Fatalf("Buffer was not reused")
+	}
+	fresh := NewBuffer(grp, 4, 8)
+	for i := uint32(0); i < 8; i++ {
+		if reused.R.Get(i).Cmp(fresh.R.Get(i)) != 0 {
+			t.Errorf("R[%d] was not reset: %s", i, reused.R.Get(i).Text(10))
+		}
+		if reused.Permutations[i] != i {
+			t.Errorf("Permutation %d was not reset: %d", i,
+				reused.Permutations[i])
+		}
+	}
+	if reused.Z.Cmp(fresh.Z) != 0 {
+		t.Errorf("Z was not reset: %s", reused.Z.Text(10))
+	}
+	if reused.PermutedPayloadAKeys != nil || len(reused.FinalKeys) != 0 {
+		t.Errorf("Keys of the last node were not cleared")
+	}
+
+	expected := measure.BufferPoolMetric{Reused: 1, Allocated: 2}
+	if received := bp.GetMetric(); received != expected {
+		t.Errorf("Unexpected pool metric."+
+			"\n\tExpected: %+v\n\tReceived: %+v", expected, received)
+	}
+}
+
+// Tests that buffers released to a full pool are erased rather than kept
+func TestBufferPool_Put_Full(t *testing.T) {
+	bp := NewBufferPool(1)
+	a, b := NewBuffer(grp, 4, 4), NewBuffer(grp, 4, 4)
+
+	if !bp.Put(grp, a) {
+		t.Fatalf("Buffer was not added to the pool")
+	}
+	if bp.Put(grp, b) {
+		t.Errorf("Buffer was added to a full pool")
+	}
+	if b.GetBatchSize() != 0 {
+		t.Errorf("Dropped buffer was not erased")
+	}
+
+	metric := bp.GetMetric()
+	if metric.Idle != 1 || metric.Dropped != 1 ||
+		metric.IdleBytes != a.EstimateSize(grp) {
+		t.Errorf("Unexpected pool metric: %+v", metric)
+	}
+
+	// A nil pool allocates and erases buffers
+	var nilPool *BufferPool
+	if nilPool.Get(grp, 4, 4) == nil || nilPool.Put(grp, NewBuffer(grp, 4, 4)) {
+		t.Errorf("Nil pool did not allocate and drop buffers")
+	}
+}
@@ -159,6 +159,26 @@ func TestRound_Get(t *testing.T) {
 	}
 }
 
+// Tests that the size estimate grows with the batch and includes the keys
+// held by the last node
+func TestBuffer_EstimateSize(t *testing.T) {
+	intLen := uint64(grp.GetP().ByteLen())
+	r := NewBuffer(grp, 10, 20)
+
+	expected := (2+11*20)*intLen + 4*20
+	if r.EstimateSize(grp) != expected {
+		t.Errorf("Unexpected size estimate."+
+			"\n\tExpected: %d\n\tReceived: %d", expected, r.EstimateSize(grp))
+	}
+
+	r.InitLastNode()
+	expected += 2 * 20 * intLen
+	if r.EstimateSize(grp) != expected {
+		t.Errorf("Unexpected size estimate for the last node."+
+			"\n\tExpected: %d\n\tReceived: %d", expected, r.EstimateSize(grp))
+	}
+}
+
 // Tests that Erase() destroys all data contained in the buffer.
 func TestBuffer_Erase(t *testing.T) {
 	rng := rand.New(rand.NewSource(42))
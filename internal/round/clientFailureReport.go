@@ -9,88 +9,231 @@ package round
 
 import (
 	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
 	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/primitives/id"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Contains logic that handles an invalid client error within realtime
-// Reports this error through a channel to permissioning
+// Reports are persisted until they are acknowledged by permissioning
 
-// ClientReport maps a channel containing a series of client errors to a round ID
-type ClientReport struct {
-	ErrorTracker map[id.Round]chan *pb.ClientError
-	SourceId     *id.ID // Node ID of the source of the error
-	sync.RWMutex
-}
+// Types of client errors counted by the ClientReport
+const (
+	ClientErrorInvalidMAC     = "InvalidMAC"
+	ClientErrorSecretNotFound = "SecretNotFound"
+	ClientErrorOther          = "Other"
+)
 
-// NewClientFailureReport initiates a new client failure reporter.
-func NewClientFailureReport(sourceID *id.ID) *ClientReport {
-	m := make(map[id.Round]chan *pb.ClientError)
-	return &ClientReport{
-		ErrorTracker: m,
-		SourceId:     sourceID,
-		RWMutex:      sync.RWMutex{},
-	}
+const (
+	// Number of client errors which can wait to be stored before new ones
+	// are dropped
+	clientErrorBufferSize = 4096
+	// Maximum number of client errors returned by a single Receive
+	maxReceivedClientErrors = 1000
+	// Delay before the first retry of a client error which failed to be
+	// stored, doubled after each further failure up to the maximum
+	clientErrorRetryDelay    = 100 * time.Millisecond
+	maxClientErrorRetryDelay = 30 * time.Second
+	// Number of times a client error is tried before it is dropped
+	maxClientErrorAttempts = 10
+)
 
-	// m := make(map[id.Round]chan *pb.ClientError)
-	// m[0] = make(chan *pb.ClientError, 32)
-	// return &ClientReport{
-	//	UserErrorTracker: m,
-	// }
+// ClientReport stores the client errors found in each round until they are
+// reported to permissioning, and counts them by type. Errors are stored by a
+// separate thread so that the graphs reporting them never wait on storage.
+type ClientReport struct {
+	store    *storage.Storage
+	SourceId *id.ID // Node ID of the source of the error
+
+	// Errors waiting to be stored
+	unstored chan *storage.ClientErrorRecord
+	// 1 while a thread is storing errors
+	storing uint32
+
+	// Number of errors sent which have not yet been stored, signalled by
+	// stored when it reaches zero
+	pending    int
+	pendingMux sync.Mutex
+	stored     *sync.Cond
 }
 
-// InitErrorChan initializes a channel within the client error map
-func (cr *ClientReport) InitErrorChan(rndID id.Round, batchSize uint32) {
-	cr.RWMutex.Lock()
-	newChan := make(chan *pb.ClientError, batchSize)
-	cr.ErrorTracker[rndID] = newChan
-	cr.RWMutex.Unlock()
-
+// NewClientFailureReport initiates a new client failure reporter backed by
+// the given storage.
+func NewClientFailureReport(sourceID *id.ID, store *storage.Storage) *ClientReport {
+	cr := &ClientReport{
+		store:    store,
+		SourceId: sourceID,
+		unstored: make(chan *storage.ClientErrorRecord, clientErrorBufferSize),
+	}
+	cr.stored = sync.NewCond(&cr.pendingMux)
+	return cr
 }
 
-// Send a client error through the channel if possible
+// Send queues a client error for the given round to be stored until it is
+// acknowledged. Returns an error without blocking if too many errors are
+// waiting to be stored.
 func (cr *ClientReport) Send(rndID id.Round, clientError *pb.ClientError) error {
-	cr.RWMutex.RLock()
-	tracker := cr.ErrorTracker[rndID]
-	cr.RWMutex.RUnlock()
-
 	// Add source ID
 	clientError.Source = cr.SourceId.Marshal()
 
-	// Send to channel
-	select {
-	case tracker <- clientError:
-		return nil
-	default:
-		return errors.Errorf("Error tracker full at len %d"+
-			"for round %v. Should not happen!", len(cr.ErrorTracker[rndID]), rndID)
+	record := &storage.ClientErrorRecord{
+		RoundId:   uint64(rndID),
+		ClientId:  clientError.ClientId,
+		Error:     clientError.Error,
+		CreatedAt: time.Now(),
 	}
 
-}
+	cr.pendingMux.Lock()
+	cr.pending++
+	cr.pendingMux.Unlock()
 
-// Receive takes the channel (if initialized) and exhausts the channel into a list
-func (cr *ClientReport) Receive(rndID id.Round) ([]*pb.ClientError, error) {
-	// Read the tracker out of the map and clear it from the map
-	cr.RWMutex.Lock()
-	tracker := cr.ErrorTracker[rndID]
-	delete(cr.ErrorTracker, rndID)
-	cr.RWMutex.Unlock()
+	select {
+	case cr.unstored <- record:
+	default:
+		cr.done()
+		return errors.Errorf("Failed to store client error for round %d: "+
+			"%d errors are already waiting to be stored", rndID,
+			clientErrorBufferSize)
+	}
 
-	if tracker == nil {
-		return nil, errors.Errorf("Error channel for round %d non-existent", rndID)
+	// Start a storing thread if one is not already running
+	if atomic.CompareAndSwapUint32(&cr.storing, 0, 1) {
+		go cr.storeErrors()
 	}
+	return nil
+}
 
-	// Exhaust the channel
-	clientErrors := make([]*pb.ClientError, 0)
+// storeErrors stores queued client errors until there are none left
+func (cr *ClientReport) storeErrors() {
 	for {
 		select {
-		case ce := <-tracker:
-			clientErrors = append(clientErrors, ce)
+		case record := <-cr.unstored:
+			cr.storeError(record)
+			cr.done()
 		default:
-			// Clear out channel and map entry
-			return clientErrors, nil
+			atomic.StoreUint32(&cr.storing, 0)
+			// Keep storing if an error was queued after the queue was found
+			// empty and no other thread has started
+			if len(cr.unstored) == 0 ||
+				!atomic.CompareAndSwapUint32(&cr.storing, 0, 1) {
+				return
+			}
+		}
+	}
+}
+
+// storeError stores the client error and counts it by type. A client error
+// which fails to be stored is retried with backoff, so that errors are only
+// lost if storage stays unavailable.
+func (cr *ClientReport) storeError(record *storage.ClientErrorRecord) {
+	delay := clientErrorRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := cr.store.InsertClientError(record)
+		if err == nil {
+			break
+		}
+		if attempt == maxClientErrorAttempts {
+			jww.ERROR.Printf("Dropping client error for round %d after %d "+
+				"failed attempts to store it: %+v", record.RoundId, attempt,
+				err)
+			return
+		}
+
+		jww.WARN.Printf("Failed to store client error for round %d, "+
+			"retrying in %s: %+v", record.RoundId, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxClientErrorRetryDelay {
+			delay = maxClientErrorRetryDelay
+		}
+	}
+
+	err := cr.store.IncrementClientErrorCount(ClientErrorType(record.Error))
+	if err != nil {
+		jww.ERROR.Printf("Failed to count client error for round %d: %+v",
+			record.RoundId, err)
+	}
+}
+
+// done marks a sent error as handled
+func (cr *ClientReport) done() {
+	cr.pendingMux.Lock()
+	cr.pending--
+	if cr.pending == 0 {
+		cr.stored.Broadcast()
+	}
+	cr.pendingMux.Unlock()
+}
+
+// Flush blocks until every client error sent so far has been stored
+func (cr *ClientReport) Flush() {
+	cr.pendingMux.Lock()
+	for cr.pending > 0 {
+		cr.stored.Wait()
+	}
+	cr.pendingMux.Unlock()
+}
+
+// Receive returns the oldest unacknowledged client errors of every round,
+// along with the IDs of their records. The errors remain stored until their
+// IDs are passed to Acknowledge so that they are resent if reporting them
+// fails.
+func (cr *ClientReport) Receive() ([]*pb.ClientError, []uint64, error) {
+	records, err := cr.store.GetClientErrors(maxReceivedClientErrors)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "Failed to get client errors")
+	}
+
+	source := cr.SourceId.Marshal()
+	clientErrors := make([]*pb.ClientError, len(records))
+	ids := make([]uint64, len(records))
+	for i, record := range records {
+		clientErrors[i] = &pb.ClientError{
+			ClientId: record.ClientId,
+			Error:    record.Error,
+			Source:   source,
 		}
+		ids[i] = record.Id
+	}
+
+	return clientErrors, ids, nil
+}
+
+// Acknowledge deletes the client errors with the given IDs once they have
+// been received by permissioning
+func (cr *ClientReport) Acknowledge(ids []uint64) error {
+	return cr.store.DeleteClientErrors(ids)
+}
+
+// GetCounts returns the total number of client errors reported by the node,
+// keyed by error type
+func (cr *ClientReport) GetCounts() (map[string]uint64, error) {
+	counts, err := cr.store.GetClientErrorCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]uint64, len(counts))
+	for _, count := range counts {
+		result[count.Type] = count.Count
 	}
+	return result, nil
+}
 
+// ClientErrorType returns the type of the client error message
+func ClientErrorType(errMsg string) string {
+	switch {
+	case strings.HasPrefix(errMsg, services.InvalidMAC):
+		return ClientErrorInvalidMAC
+	case strings.HasPrefix(errMsg, services.SecretNotFound):
+		return ClientErrorSecretNotFound
+	default:
+		return ClientErrorOther
+	}
 }
@@ -9,71 +9,96 @@ package round
 
 import (
 	pb "gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/primitives/id"
 	"reflect"
 	"testing"
 )
 
+// Creates a ClientReport backed by a map storage for testing
+func newTestClientReport(t *testing.T) *ClientReport {
+	store, err := storage.NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %+v", err)
+	}
+	return NewClientFailureReport(
+		id.NewIdFromString("myNodeID", id.Node, t), store)
+}
+
 // Smoke test of new clientReport
 func TestNewClientReport(t *testing.T) {
-	ourNewReport := NewClientFailureReport(id.NewIdFromString("myNodeID", id.Node, t))
+	ourNewReport := newTestClientReport(t)
 
 	if ourNewReport == nil {
 		t.Fatalf("New Client report should not be nil: %+v", ourNewReport)
 	}
-
-	rndId := id.Round(0)
-	ourNewReport.ErrorTracker[rndId] = make(chan *pb.ClientError, 8)
-	if len(ourNewReport.ErrorTracker) != 1 {
-		t.Errorf("Client report expected to be of length 1! Length is: %+v", len(ourNewReport.ErrorTracker))
-	}
-
-	ce := &pb.ClientError{}
-
-	// Test
-	ourNewReport.ErrorTracker[rndId] <- ce
-
-	if len(ourNewReport.ErrorTracker[rndId]) != 1 {
-		t.Errorf("Client report expected to be of length 1! "+
-			"Length is: %+v", len(ourNewReport.ErrorTracker[rndId]))
-	}
-
 }
 
 // Happy path
 func TestClientReport_Send(t *testing.T) {
-	ourNewReport := NewClientFailureReport(id.NewIdFromString("myNodeID", id.Node, t))
+	ourNewReport := newTestClientReport(t)
 	rndId := id.Round(0)
 
-	ourNewReport.ErrorTracker[rndId] = make(chan *pb.ClientError, 8)
-
 	clientErr := &pb.ClientError{}
 	err := ourNewReport.Send(rndId, clientErr)
-	if len(ourNewReport.ErrorTracker) != 1 {
-		t.Errorf("Error tracker should have length of 1 after a report! "+
-			"Length is: %+v", len(ourNewReport.ErrorTracker))
-	}
-
 	if err != nil {
 		t.Errorf("Unexpcted error: %v", err)
 	}
 
 	err = ourNewReport.Send(rndId, clientErr)
 	if err != nil {
-		t.Errorf("Should be able to send when reporter is empty: %+v."+
-			"\nLength of reporter: %+v", err, len(ourNewReport.ErrorTracker))
+		t.Errorf("Should be able to send a second error: %+v", err)
+	}
+
+	ourNewReport.Flush()
+	received, ids, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+	if len(received) != 2 || len(ids) != 2 {
+		t.Errorf("Unexpected number of stored client errors."+
+			"\n\tExpected: %d\n\tReceived: %d", 2, len(received))
 	}
+}
+
+// Error path: errors are dropped without blocking once too many are waiting
+// to be stored
+func TestClientReport_Send_Full(t *testing.T) {
+	ourNewReport := newTestClientReport(t)
+	// Prevent a storing thread from starting
+	ourNewReport.storing = 1
+
+	for i := 0; i < clientErrorBufferSize; i++ {
+		err := ourNewReport.Send(id.Round(i), &pb.ClientError{})
+		if err != nil {
+			t.Fatalf("Failed to send client error %d: %+v", i, err)
+		}
+	}
+
+	err := ourNewReport.Send(0, &pb.ClientError{})
+	if err == nil {
+		t.Errorf("Expected error sending to a full buffer")
+	}
+
+	ourNewReport.storing = 0
+	go ourNewReport.storeErrors()
+	ourNewReport.Flush()
 
-	if len(ourNewReport.ErrorTracker[rndId]) != 2 {
-		t.Errorf("Error tracker should be two after a send! "+
-			"Length is: %+v", len(ourNewReport.ErrorTracker[rndId]))
+	received, _, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+	if len(received) != maxReceivedClientErrors {
+		t.Errorf("Unexpected number of client errors received."+
+			"\n\tExpected: %d\n\tReceived: %d",
+			maxReceivedClientErrors, len(received))
 	}
 }
 
-//
-//// Happy path
+// Happy path
 func TestClientReport_Send_Receive(t *testing.T) {
-	ourNewReport := NewClientFailureReport(id.NewIdFromString("myNodeID", id.Node, t))
+	ourNewReport := newTestClientReport(t)
 	testId := id.NewIdFromBytes([]byte("test"), t)
 	testErr := "I failed due to an invalid KMAC"
 	ce := &pb.ClientError{
@@ -81,42 +106,154 @@ func TestClientReport_Send_Receive(t *testing.T) {
 		Error:    testErr,
 	}
 
-	rndId := id.Round(0)
-	ourNewReport.ErrorTracker[rndId] = make(chan *pb.ClientError, 8)
-
 	// Send to queue
-	err := ourNewReport.Send(rndId, ce)
+	err := ourNewReport.Send(id.Round(0), ce)
 	if err != nil {
 		t.Errorf("Expected happy path, received error when sending! Err: %+v", err)
 	}
 
-	receivedClientErrs, err := ourNewReport.Receive(rndId)
+	ourNewReport.Flush()
+	receivedClientErrs, _, err := ourNewReport.Receive()
 	if err != nil {
 		t.Errorf("Expected happy path, received error when receiving! Err: %+v", err)
 	}
 
 	if len(receivedClientErrs) != 1 {
-		t.Logf("Received unexpected round id")
-		t.Fail()
+		t.Fatalf("Unexpected number of client errors received."+
+			"\n\tExpected: %d\n\tReceived: %d", 1, len(receivedClientErrs))
 	}
 
 	if !reflect.DeepEqual(receivedClientErrs[0], ce) {
-		t.Errorf("Client error received from channel does not match input from channel."+
+		t.Errorf("Client error received does not match input."+
 			"\n\tReceived: %v"+
 			"\n\tExpected: %v", receivedClientErrs[0], ce)
 	}
 
+	// Errors remain stored until they are acknowledged
+	receivedClientErrs, _, err = ourNewReport.Receive()
+	if err != nil {
+		t.Errorf("Expected happy path, received error when receiving! Err: %+v", err)
+	}
+	if len(receivedClientErrs) != 1 {
+		t.Errorf("Client errors should remain stored until acknowledged."+
+			"\n\tExpected: %d\n\tReceived: %d", 1, len(receivedClientErrs))
+	}
+}
+
+// Happy path: only the acknowledged errors are deleted, whatever their round
+func TestClientReport_Acknowledge(t *testing.T) {
+	ourNewReport := newTestClientReport(t)
+	rndId := id.Round(5)
+
+	err := ourNewReport.Send(rndId, &pb.ClientError{Error: "first"})
+	if err != nil {
+		t.Fatalf("Failed to send client error: %+v", err)
+	}
+	err = ourNewReport.Send(rndId+1, &pb.ClientError{Error: "second"})
+	if err != nil {
+		t.Fatalf("Failed to send client error: %+v", err)
+	}
+
+	ourNewReport.Flush()
+	_, ids, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+
+	// An error sent after the others were received is not acknowledged
+	err = ourNewReport.Send(rndId, &pb.ClientError{Error: "third"})
+	if err != nil {
+		t.Fatalf("Failed to send client error: %+v", err)
+	}
+	ourNewReport.Flush()
+
+	err = ourNewReport.Acknowledge(ids)
+	if err != nil {
+		t.Fatalf("Failed to acknowledge client errors: %+v", err)
+	}
+
+	received, _, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+	if len(received) != 1 || received[0].Error != "third" {
+		t.Errorf("Only acknowledged client errors should be deleted: %+v",
+			received)
+	}
+}
+
+// Happy path: receiving with no errors returns an empty list
+func TestClientReport_Receive_Empty(t *testing.T) {
+	ourNewReport := newTestClientReport(t)
+	received, ids, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+
+	if len(received) != 0 || len(ids) != 0 {
+		t.Errorf("Expected no client errors."+
+			"\n\tExpected: %d\n\tReceived: %d", 0, len(received))
+	}
 }
 
-// Error path: Attempt to receive from an empty queue
-func TestClientReport_Receive_Error(t *testing.T) {
-	ourNewReport := NewClientFailureReport(id.NewIdFromString("myNodeID", id.Node, t))
-	rndID := id.Round(0)
-	_, err := ourNewReport.Receive(rndID)
+// Happy path: counts persist after the errors are acknowledged
+func TestClientReport_GetCounts(t *testing.T) {
+	ourNewReport := newTestClientReport(t)
+	rndId := id.Round(1)
 
+	msgs := []string{
+		services.InvalidMAC,
+		services.InvalidMAC + ": extra context",
+		services.SecretNotFound,
+		"some other error",
+	}
+	for _, msg := range msgs {
+		err := ourNewReport.Send(rndId, &pb.ClientError{Error: msg})
+		if err != nil {
+			t.Fatalf("Failed to send client error: %+v", err)
+		}
+	}
+
+	ourNewReport.Flush()
+	_, ids, err := ourNewReport.Receive()
+	if err != nil {
+		t.Fatalf("Failed to receive client errors: %+v", err)
+	}
+	err = ourNewReport.Acknowledge(ids)
 	if err != nil {
-		return
+		t.Fatalf("Failed to acknowledge client errors: %+v", err)
 	}
 
-	t.Errorf("Expected error path, should not be able to receive from an empty queue!")
+	expected := map[string]uint64{
+		ClientErrorInvalidMAC:     2,
+		ClientErrorSecretNotFound: 1,
+		ClientErrorOther:          1,
+	}
+	counts, err := ourNewReport.GetCounts()
+	if err != nil {
+		t.Fatalf("Failed to get client error counts: %+v", err)
+	}
+	if !reflect.DeepEqual(expected, counts) {
+		t.Errorf("Unexpected client error counts."+
+			"\n\tExpected: %v\n\tReceived: %v", expected, counts)
+	}
+}
+
+// Tests that ClientErrorType classifies each error message
+func TestClientErrorType(t *testing.T) {
+	tests := map[string]string{
+		services.InvalidMAC:                     ClientErrorInvalidMAC,
+		services.InvalidMAC + " for slot 4":     ClientErrorInvalidMAC,
+		services.SecretNotFound:                 ClientErrorSecretNotFound,
+		services.SecretNotFound + " for user X": ClientErrorSecretNotFound,
+		"":                                      ClientErrorOther,
+		"unrelated failure":                     ClientErrorOther,
+	}
+
+	for msg, expected := range tests {
+		if received := ClientErrorType(msg); received != expected {
+			t.Errorf("Unexpected type for error %q."+
+				"\n\tExpected: %s\n\tReceived: %s", msg, expected, received)
+		}
+	}
 }
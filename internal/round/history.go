@@ -0,0 +1,58 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package round
+
+// history.go contains the conversion of a round into its persistent history
+
+import (
+	"gitlab.com/elixxir/server/storage"
+	"time"
+)
+
+// GetHistory returns the record of the round and the timings of each phase
+// which has started, for storage once the round has finished. An empty
+// roundErr denotes a round which completed successfully; otherwise the round
+// is recorded as failed in its current phase.
+func (r *Round) GetHistory(roundErr string) (*storage.RoundRecord,
+	[]*storage.RoundPhaseRecord) {
+
+	topology := make([]byte, 0)
+	for i := 0; i < r.topology.Len(); i++ {
+		topology = append(topology, r.topology.GetNodeAtIndex(i).Marshal()...)
+	}
+
+	record := &storage.RoundRecord{
+		Id:         uint64(r.id),
+		BatchSize:  r.batchSize,
+		Topology:   topology,
+		StartedAt:  r.GetTimeStart(),
+		FinishedAt: time.Now(),
+		Outcome:    storage.RoundCompleted,
+	}
+	if roundErr != "" {
+		record.Outcome = storage.RoundFailed
+		record.FailedPhase = r.GetCurrentPhaseType().String()
+		record.Error = roundErr
+	}
+
+	phases := make([]*storage.RoundPhaseRecord, 0, len(r.phases))
+	for _, ph := range r.phases {
+		events := ph.GetMeasure().GetEvents()
+		if len(events) == 0 {
+			continue
+		}
+		phases = append(phases, &storage.RoundPhaseRecord{
+			RoundId:    uint64(r.id),
+			Phase:      ph.GetType().String(),
+			StartedAt:  events[0].Timestamp,
+			FinishedAt: events[len(events)-1].Timestamp,
+		})
+	}
+
+	return record, phases
+}
@@ -80,7 +80,7 @@ func TestManager_GetPhase(t *testing.T) {
 	// We have to make phases with fake graphs...
 	phases := make([]phase.Phase, int(phase.NumPhases))
 	for i := 0; i < len(phases); i++ {
-		gc := services.NewGraphGenerator(1,
+		gc := services.MustNewGraphGenerator(1,
 			1, 1, 1)
 
 		definition := phase.Definition{
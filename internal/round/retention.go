@@ -0,0 +1,226 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package round
+
+// retention.go tracks the lifecycle of rounds and evicts finished rounds once
+// the retention policy no longer allows them to be kept
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy bounds the finished rounds kept by a RetentionManager. Each
+// limit is unbounded if zero.
+type RetentionPolicy struct {
+	// Maximum number of finished rounds kept
+	MaxCount int
+	// Maximum time a round is kept after it finishes
+	MaxAge time.Duration
+	// Maximum memory, in bytes, held by the buffers of finished rounds
+	MaxMemory uint64
+	// How often the limits are checked by the thread started by Start
+	CheckPeriod time.Duration
+}
+
+// Lifecycle is the stage of a round tracked by the RetentionManager
+type Lifecycle uint8
+
+const (
+	// Running rounds are never evicted
+	Running Lifecycle = iota
+	// Completed rounds finished realtime
+	Completed
+	// Failed rounds were reported as failed before they completed
+	Failed
+)
+
+// Adheres to the Stringer interface to return the name of the lifecycle stage
+func (l Lifecycle) String() string {
+	switch l {
+	case Running:
+		return "Running"
+	case Completed:
+		return "Completed"
+	case Failed:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+// EvictFunc releases everything held by the node for an evicted round
+type EvictFunc func(rid id.Round, lifecycle Lifecycle)
+
+// RetentionManager tracks the rounds of the node from when they start until
+// they are evicted. Finished rounds are evicted oldest first once they exceed
+// any limit of the policy.
+type RetentionManager struct {
+	policy RetentionPolicy
+	evict  EvictFunc
+
+	mux    sync.Mutex
+	rounds map[id.Round]*retainedRound
+	// Memory held by the buffers of finished rounds
+	memory uint64
+}
+
+type retainedRound struct {
+	lifecycle Lifecycle
+	finished  time.Time
+	size      uint64
+}
+
+// NewRetentionManager returns a RetentionManager which calls evict for every
+// round it evicts
+func NewRetentionManager(policy RetentionPolicy,
+	evict EvictFunc) *RetentionManager {
+	return &RetentionManager{
+		policy: policy,
+		evict:  evict,
+		rounds: make(map[id.Round]*retainedRound),
+	}
+}
+
+// Track starts tracking the round as running. The size is the memory, in
+// bytes, held by the round's buffer.
+func (rm *RetentionManager) Track(rid id.Round, size uint64) {
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+	if _, ok := rm.rounds[rid]; !ok {
+		rm.rounds[rid] = &retainedRound{lifecycle: Running, size: size}
+	}
+}
+
+// Complete marks the round as completed, starting its retention
+func (rm *RetentionManager) Complete(rid id.Round) {
+	rm.finish(rid, Completed)
+}
+
+// Fail marks the round as failed, starting its retention. Rounds which were
+// not tracked are tracked so that anything held for them is evicted.
+func (rm *RetentionManager) Fail(rid id.Round) {
+	rm.finish(rid, Failed)
+}
+
+// finish moves a running round to the given finished stage
+func (rm *RetentionManager) finish(rid id.Round, lifecycle Lifecycle) {
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+
+	rr, ok := rm.rounds[rid]
+	if !ok {
+		rr = &retainedRound{}
+		rm.rounds[rid] = rr
+	} else if rr.lifecycle != Running {
+		return
+	}
+
+	rr.lifecycle = lifecycle
+	rr.finished = time.Now()
+	rm.memory += rr.size
+}
+
+// GetLifecycle returns the stage of the round. Returns false if the round is
+// not tracked, either because it never started or was evicted.
+func (rm *RetentionManager) GetLifecycle(rid id.Round) (Lifecycle, bool) {
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+	rr, ok := rm.rounds[rid]
+	if !ok {
+		return 0, false
+	}
+	return rr.lifecycle, true
+}
+
+// GetMemory returns the memory, in bytes, held by the buffers of finished
+// rounds
+func (rm *RetentionManager) GetMemory() uint64 {
+	rm.mux.Lock()
+	defer rm.mux.Unlock()
+	return rm.memory
+}
+
+// Evict evicts every finished round which the policy no longer allows to be
+// kept at the given time, oldest first, and returns their IDs in the order
+// they were evicted
+func (rm *RetentionManager) Evict(now time.Time) []id.Round {
+	rm.mux.Lock()
+	type finishedRound struct {
+		id id.Round
+		*retainedRound
+	}
+	var finished []finishedRound
+	for rid, rr := range rm.rounds {
+		if rr.lifecycle != Running {
+			finished = append(finished, finishedRound{rid, rr})
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if finished[i].finished.Equal(finished[j].finished) {
+			return finished[i].id < finished[j].id
+		}
+		return finished[i].finished.Before(finished[j].finished)
+	})
+
+	var evicted []finishedRound
+	for i, fr := range finished {
+		overAge := rm.policy.MaxAge != 0 &&
+			now.Sub(fr.finished) > rm.policy.MaxAge
+		overCount := rm.policy.MaxCount != 0 &&
+			len(finished)-i > rm.policy.MaxCount
+		overMemory := rm.policy.MaxMemory != 0 &&
+			rm.memory > rm.policy.MaxMemory
+		if !overAge && !overCount && !overMemory {
+			break
+		}
+
+		delete(rm.rounds, fr.id)
+		rm.memory -= fr.size
+		evicted = append(evicted, fr)
+	}
+	rm.mux.Unlock()
+
+	ids := make([]id.Round, len(evicted))
+	for i, fr := range evicted {
+		jww.DEBUG.Printf("Evicting %s round %d", fr.lifecycle, fr.id)
+		if rm.evict != nil {
+			rm.evict(fr.id, fr.lifecycle)
+		}
+		ids[i] = fr.id
+	}
+	return ids
+}
+
+// Start starts a thread which evicts rounds every CheckPeriod. Sending on or
+// closing the returned channel stops the thread.
+func (rm *RetentionManager) Start() chan struct{} {
+	kill := make(chan struct{}, 1)
+	if rm.policy.CheckPeriod <= 0 {
+		jww.FATAL.Panicf("Invalid round retention check period: %s",
+			rm.policy.CheckPeriod)
+	}
+
+	go func() {
+		ticker := time.NewTicker(rm.policy.CheckPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-kill:
+				return
+			case now := <-ticker.C:
+				rm.Evict(now)
+			}
+		}
+	}()
+
+	return kill
+}
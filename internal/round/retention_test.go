@@ -0,0 +1,155 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package round
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Happy path: finished rounds are evicted once older than the maximum age,
+// while running rounds are kept
+func TestRetentionManager_Evict_MaxAge(t *testing.T) {
+	evicted := make(map[id.Round]Lifecycle)
+	rm := NewRetentionManager(RetentionPolicy{MaxAge: time.Minute},
+		func(rid id.Round, lifecycle Lifecycle) {
+			evicted[rid] = lifecycle
+		})
+
+	rm.Track(1, 10)
+	rm.Track(2, 10)
+	rm.Track(3, 10)
+	rm.Complete(1)
+	rm.Fail(2)
+
+	if ids := rm.Evict(time.Now()); len(ids) != 0 {
+		t.Errorf("Rounds evicted before reaching the maximum age: %v", ids)
+	}
+
+	ids := rm.Evict(time.Now().Add(2 * time.Minute))
+	if !reflect.DeepEqual(ids, []id.Round{1, 2}) {
+		t.Errorf("Unexpected rounds evicted."+
+			"\n\tExpected: %v\n\tReceived: %v", []id.Round{1, 2}, ids)
+	}
+	expected := map[id.Round]Lifecycle{1: Completed, 2: Failed}
+	if !reflect.DeepEqual(evicted, expected) {
+		t.Errorf("Unexpected rounds passed to the evict function."+
+			"\n\tExpected: %v\n\tReceived: %v", expected, evicted)
+	}
+
+	if lifecycle, ok := rm.GetLifecycle(3); !ok || lifecycle != Running {
+		t.Errorf("Running round was not kept: %s, %t", lifecycle, ok)
+	}
+	if _, ok := rm.GetLifecycle(1); ok {
+		t.Errorf("Evicted round is still tracked")
+	}
+}
+
+// Happy path: the oldest finished rounds are evicted once there are more than
+// the maximum count
+func TestRetentionManager_Evict_MaxCount(t *testing.T) {
+	rm := NewRetentionManager(RetentionPolicy{MaxCount: 2}, nil)
+
+	for rid := id.Round(1); rid <= 4; rid++ {
+		rm.Track(rid, 10)
+		rm.Complete(rid)
+	}
+
+	ids := rm.Evict(time.Now())
+	if !reflect.DeepEqual(ids, []id.Round{1, 2}) {
+		t.Errorf("Unexpected rounds evicted."+
+			"\n\tExpected: %v\n\tReceived: %v", []id.Round{1, 2}, ids)
+	}
+	if rm.GetMemory() != 20 {
+		t.Errorf("Unexpected memory held by finished rounds."+
+			"\n\tExpected: %d\n\tReceived: %d", 20, rm.GetMemory())
+	}
+}
+
+// Happy path: the oldest finished rounds are evicted until the memory of their
+// buffers is within the maximum
+func TestRetentionManager_Evict_MaxMemory(t *testing.T) {
+	rm := NewRetentionManager(RetentionPolicy{MaxMemory: 25}, nil)
+
+	for rid := id.Round(1); rid <= 3; rid++ {
+		rm.Track(rid, 10)
+		rm.Complete(rid)
+	}
+	// Memory of running rounds is not evictable
+	rm.Track(4, 100)
+
+	if rm.GetMemory() != 30 {
+		t.Errorf("Unexpected memory held by finished rounds."+
+			"\n\tExpected: %d\n\tReceived: %d", 30, rm.GetMemory())
+	}
+
+	ids := rm.Evict(time.Now())
+	if !reflect.DeepEqual(ids, []id.Round{1}) {
+		t.Errorf("Unexpected rounds evicted."+
+			"\n\tExpected: %v\n\tReceived: %v", []id.Round{1}, ids)
+	}
+	if rm.GetMemory() != 20 {
+		t.Errorf("Unexpected memory held by finished rounds."+
+			"\n\tExpected: %d\n\tReceived: %d", 20, rm.GetMemory())
+	}
+}
+
+// Happy path: a round which failed before being tracked is still evicted, and
+// finishing a round twice keeps its first lifecycle
+func TestRetentionManager_Fail_Untracked(t *testing.T) {
+	var evicted []id.Round
+	rm := NewRetentionManager(RetentionPolicy{MaxCount: 1},
+		func(rid id.Round, lifecycle Lifecycle) {
+			evicted = append(evicted, rid)
+		})
+
+	rm.Fail(7)
+	rm.Track(8, 10)
+	rm.Complete(8)
+	rm.Fail(8)
+
+	if lifecycle, _ := rm.GetLifecycle(8); lifecycle != Completed {
+		t.Errorf("Unexpected lifecycle of round finished twice."+
+			"\n\tExpected: %s\n\tReceived: %s", Completed, lifecycle)
+	}
+
+	rm.Evict(time.Now())
+	if !reflect.DeepEqual(evicted, []id.Round{7}) {
+		t.Errorf("Unexpected rounds evicted."+
+			"\n\tExpected: %v\n\tReceived: %v", []id.Round{7}, evicted)
+	}
+}
+
+// Happy path: the retention thread evicts rounds until it is killed
+func TestRetentionManager_Start(t *testing.T) {
+	evicted := make(chan id.Round, 1)
+	rm := NewRetentionManager(RetentionPolicy{
+		MaxAge:      time.Nanosecond,
+		CheckPeriod: time.Millisecond,
+	}, func(rid id.Round, lifecycle Lifecycle) {
+		evicted <- rid
+	})
+
+	kill := rm.Start()
+	defer close(kill)
+
+	rm.Track(3, 10)
+	rm.Complete(3)
+
+	select {
+	case rid := <-evicted:
+		if rid != 3 {
+			t.Errorf("Unexpected round evicted."+
+				"\n\tExpected: %d\n\tReceived: %d", 3, rid)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Retention thread did not evict the round")
+	}
+}
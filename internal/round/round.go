@@ -71,6 +71,20 @@ func New(grp *cyclic.Group, id id.Round, phases []phase.Phase,
 	errorHandler services.ErrorCallback, clientErr *ClientReport,
 	nodeSecretManager *storage.NodeSecretManager,
 	precanStore *storage.PrecanStore) (*Round, error) {
+	return NewWithBufferPool(grp, id, phases, responses, circuit, nodeID,
+		batchSize, rngStreamGen, streamPool, localIP, errorHandler, clientErr,
+		nodeSecretManager, precanStore, nil)
+}
+
+// NewWithBufferPool creates a new Round like New, taking its buffer from the
+// pool instead of allocating it. The buffer is allocated if the pool is nil.
+func NewWithBufferPool(grp *cyclic.Group, id id.Round, phases []phase.Phase,
+	responses phase.ResponseMap, circuit *connect.Circuit, nodeID *id.ID,
+	batchSize uint32, rngStreamGen *fastRNG.StreamGenerator,
+	streamPool *gpumaths.StreamPool, localIP string,
+	errorHandler services.ErrorCallback, clientErr *ClientReport,
+	nodeSecretManager *storage.NodeSecretManager,
+	precanStore *storage.PrecanStore, bufferPool *BufferPool) (*Round, error) {
 
 	if batchSize <= 0 {
 		return nil, errors.New("Cannot make a round with a <=0 batch size")
@@ -92,7 +106,15 @@ func New(grp *cyclic.Group, id id.Round, phases []phase.Phase,
 
 	for index, p := range phases {
 		if p.GetGraph() != nil {
-			p.GetGraph().Build(batchSize, errorHandler)
+			// Graphs reused from a GraphPool are already built
+			if p.GetGraph().IsBuilt() {
+				p.GetGraph().SetErrorHandler(errorHandler)
+			} else {
+				err := p.GetGraph().Build(batchSize, errorHandler)
+				if err != nil {
+					return nil, err
+				}
+			}
 			if p.GetGraph().GetExpandedBatchSize() > maxBatchSize {
 				maxBatchSize = p.GetGraph().GetExpandedBatchSize()
 			}
@@ -156,7 +178,7 @@ func New(grp *cyclic.Group, id id.Round, phases []phase.Phase,
 
 	round.topology = circuit
 
-	round.buffer = NewBuffer(grp, batchSize, maxBatchSize)
+	round.buffer = bufferPool.Get(grp, batchSize, maxBatchSize)
 	round.buffer.InitCryptoFields(grp)
 	round.phaseMap = make(map[phase.Type]int)
 
@@ -331,6 +353,9 @@ func (r *Round) GetMeasurements(nid *id.ID, numNodes, index int,
 		phaseMeasure := ph.GetMeasure()
 		phaseMeasure.NodeId = nid
 		rm.AddPhase(phaseName, phaseMeasure)
+		if g := ph.GetGraph(); g != nil {
+			rm.AddModuleMetrics(phaseName, g.GetModuleMetrics())
+		}
 	}
 
 	// Set end time
@@ -339,6 +364,57 @@ func (r *Round) GetMeasurements(nid *id.ID, numNodes, index int,
 	return rm
 }
 
+// ReleaseBuffer zeroes the buffer of the round and returns it to the pool for
+// reuse by later rounds, erasing it if the pool does not keep it. The round
+// must not be used afterwards.
+func (r *Round) ReleaseBuffer(grp *cyclic.Group, pool *BufferPool) {
+	r.detachPhases()
+	pool.Put(grp, r.buffer)
+}
+
+// ReleaseGraphs returns the graphs of every phase to the pool for reuse by
+// later rounds. The round must not be used afterwards.
+func (r *Round) ReleaseGraphs(pool *services.GraphPool) {
+	r.detachPhases()
+	for _, ph := range r.phases {
+		pool.Put(ph.GetGraph())
+	}
+}
+
+// Abort kills the graph of every phase of the round and releases its buffer to
+// the pool. Returns an error if a graph does not stop within the timeout, in
+// which case the buffer is not released as the graph may still be using it.
+func (r *Round) Abort(timeout time.Duration, grp *cyclic.Group,
+	pool *BufferPool) error {
+	r.StopRecording()
+	for _, ph := range r.phases {
+		g := ph.GetGraph()
+		if g != nil && !g.Kill(timeout) {
+			return errors.Errorf("Graph %s of phase %s of round %d did not "+
+				"stop within %s", g.GetName(), ph.GetType(), r.id, timeout)
+		}
+	}
+	if r.buffer != nil {
+		r.ReleaseBuffer(grp, pool)
+	}
+	return nil
+}
+
+// detachPhases stops the phases of the round from passing late inputs to the
+// graphs and buffer being released
+func (r *Round) detachPhases() {
+	for _, ph := range r.phases {
+		ph.Detach()
+	}
+}
+
+// StopRecording stops recording the inputs of every phase of the round
+func (r *Round) StopRecording() {
+	for _, ph := range r.phases {
+		ph.StopRecording()
+	}
+}
+
 func (r *Round) AddToDispatchDuration(delta time.Duration) {
 	r.roundMetrics.DispatchDuration += delta
 }
@@ -8,6 +8,7 @@
 package round
 
 import (
+	"context"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
 	"gitlab.com/elixxir/crypto/fastRNG"
@@ -15,6 +16,7 @@ import (
 	"gitlab.com/elixxir/server/internal/measure"
 	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
@@ -58,12 +60,12 @@ func TestNew(t *testing.T) {
 	roundId := id.Round(58)
 	var phases []phase.Phase
 
-	handler := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	handler := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return nil
 	}
 
 	phases = append(phases, phase.New(phase.Definition{Graph: initMockGraph(services.
-		NewGraphGenerator(1, 1,
+		MustNewGraphGenerator(1, 1,
 			1, 1)),
 		Type: phase.RealPermute, TransmissionHandler: handler, Timeout: time.Minute}))
 
@@ -122,11 +124,11 @@ func TestRound_GetMeasurements(t *testing.T) {
 	roundId := id.Round(58)
 	var phases []phase.Phase
 
-	handler := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	handler := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return nil
 	}
 
-	newGraph := services.NewGraphGenerator(1, 1, 1, 1)
+	newGraph := services.MustNewGraphGenerator(1, 1, 1, 1)
 
 	newPhaseDef := phase.Definition{
 		Graph:               initMockGraph(newGraph),
@@ -178,11 +180,63 @@ func TestRound_GetMeasurements(t *testing.T) {
 	}
 }
 
+// Tests that GetHistory records the round's topology, outcome and the
+// timings of each phase which has started.
+func TestRound_GetHistory(t *testing.T) {
+	handler := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+		return nil
+	}
+	newGraph := services.MustNewGraphGenerator(1, 1, 1, 1)
+	var phases []phase.Phase
+	for _, ty := range []phase.Type{phase.RealDecrypt, phase.RealPermute} {
+		phases = append(phases, phase.New(phase.Definition{
+			Graph:               initMockGraph(newGraph),
+			Type:                ty,
+			TransmissionHandler: handler,
+			Timeout:             time.Minute,
+		}))
+	}
+
+	nodes := []*id.ID{id.NewIdFromUInt(1, id.Node, t), id.NewIdFromUInt(2, id.Node, t)}
+	topology := connect.NewCircuit(nodes)
+	rnd, err := New(grp, 42, phases, nil, topology, nodes[0], 5, fastRNG.NewStreamGenerator(10000,
+		uint(runtime.NumCPU()), csprng.NewSystemRNG), nil, "0.0.0.0", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create new round: %+v", err)
+	}
+
+	// Only the first phase has started
+	phases[0].Measure(measure.TagActive)
+	phases[0].Measure(measure.TagVerification)
+
+	record, phaseRecords := rnd.GetHistory("")
+	if record.Id != 42 || record.BatchSize != 5 ||
+		record.Outcome != storage.RoundCompleted || record.Error != "" {
+		t.Errorf("Unexpected round record: %+v", record)
+	}
+	expectedTopology := append(nodes[0].Marshal(), nodes[1].Marshal()...)
+	if !reflect.DeepEqual(record.Topology, expectedTopology) {
+		t.Errorf("Unexpected topology.\n\tExpected: %v\n\tReceived: %v",
+			expectedTopology, record.Topology)
+	}
+	if len(phaseRecords) != 1 || phaseRecords[0].Phase != phase.RealDecrypt.String() ||
+		phaseRecords[0].RoundId != 42 ||
+		phaseRecords[0].FinishedAt.Before(phaseRecords[0].StartedAt) {
+		t.Errorf("Unexpected phase records: %+v", phaseRecords)
+	}
+
+	record, _ = rnd.GetHistory("round failed")
+	if record.Outcome != storage.RoundFailed || record.Error != "round failed" ||
+		record.FailedPhase != rnd.GetCurrentPhaseType().String() {
+		t.Errorf("Unexpected failed round record: %+v", record)
+	}
+}
+
 func TestRound_StartRoundTrip(t *testing.T) {
 	var phases []phase.Phase
 	roundId := id.Round(58)
 	phases = append(phases, phase.New(phase.Definition{Graph: initMockGraph(services.
-		NewGraphGenerator(1, 1,
+		MustNewGraphGenerator(1, 1,
 			1, 1)),
 		Type: phase.RealPermute, TransmissionHandler: nil, Timeout: time.Minute}))
 
@@ -212,7 +266,7 @@ func TestRound_StopRoundTrip(t *testing.T) {
 	var phases []phase.Phase
 	roundId := id.Round(58)
 	phases = append(phases, phase.New(phase.Definition{Graph: initMockGraph(services.
-		NewGraphGenerator(1, 1,
+		MustNewGraphGenerator(1, 1,
 			1, 1)),
 		Type: phase.RealPermute, TransmissionHandler: nil, Timeout: time.Minute}))
 
@@ -241,3 +295,55 @@ func TestRound_StopRoundTrip(t *testing.T) {
 		t.Error("StopRoundTrip did not set duration")
 	}
 }
+
+// Tests that graphs released by a round are reused, without being built again,
+// by a round created from them
+func TestRound_ReleaseGraphs(t *testing.T) {
+	handler := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+		return nil
+	}
+	newPhases := func(g *services.Graph) []phase.Phase {
+		return []phase.Phase{phase.New(phase.Definition{Graph: g,
+			Type: phase.RealPermute, TransmissionHandler: handler,
+			Timeout: time.Minute})}
+	}
+	topology := connect.NewCircuit([]*id.ID{{}})
+	rngGen := fastRNG.NewStreamGenerator(10000, uint(runtime.NumCPU()),
+		csprng.NewSystemRNG)
+
+	g := initMockGraph(services.MustNewGraphGenerator(1, 1, 1, 1))
+	rnd, err := New(grp, 1, newPhases(g), nil, topology, &id.ID{}, 5, rngGen,
+		nil, "0.0.0.0", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create new round: %+v", err)
+	}
+
+	pool := services.NewGraphPool(1)
+	rnd.ReleaseGraphs(pool)
+	reused := pool.Get(g.GetName(), 5)
+	if reused != g {
+		t.Fatalf("Released graph was not added to the pool")
+	}
+
+	// Late inputs of the released round must not reach the reused graph
+	oldPhase, err := rnd.GetPhase(phase.RealPermute)
+	if err != nil {
+		t.Fatalf("Failed to get phase of the released round: %+v", err)
+	}
+	if err = oldPhase.Input(0, &mixmessages.Slot{}); err == nil {
+		t.Errorf("Phase of the released round accepted input")
+	}
+	expandedBatchSize := reused.GetExpandedBatchSize()
+
+	_, err = New(grp, 2, newPhases(reused), nil, topology, &id.ID{}, 5, rngGen,
+		nil, "0.0.0.0", nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create round from a reused graph: %+v", err)
+	}
+	// Building again would connect a second output module
+	if reused.GetExpandedBatchSize() != expandedBatchSize ||
+		len(reused.Export().Modules[0].Outputs) != 1 {
+		t.Errorf("Reused graph should not be built again: %+v",
+			reused.Export())
+	}
+}
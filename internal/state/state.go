@@ -92,6 +92,7 @@ import (
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/primitives/current"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -102,6 +103,10 @@ import (
 // instruct state changes itself without creating a deadlock
 type Change func(from current.Activity) error
 
+// HealthCheck returns nil if the node is able to start a new round, otherwise
+// an error describing why it cannot
+type HealthCheck func() error
+
 // Machine is the core state machine object
 type Machine struct {
 	//holds the state
@@ -117,6 +122,8 @@ type Machine struct {
 	stateMap [][]bool
 	//changeChan
 	changeBuffer chan current.Activity
+	//holds the HealthCheck which must pass before accepting a new round
+	healthCheck *atomic.Value
 }
 
 func NewTestMachine(changeList [current.NUM_STATES]Change, start current.Activity, t interface{}) Machine {
@@ -145,6 +152,7 @@ func NewMachine(changeList [current.NUM_STATES]Change) Machine {
 		make(chan current.Activity),
 		make([][]bool, current.NUM_STATES),
 		make(chan current.Activity, 100),
+		&atomic.Value{},
 	}
 
 	//finish populating the stateMap
@@ -223,6 +231,26 @@ func (m Machine) Update(nextState current.Activity) (success bool, err error) {
 	return true, nil
 }
 
+// SetHealthCheck sets the check which must pass for the node to accept a new
+// round. It is checked by the caller before the round is queued, so that a
+// refused round is never left half started.
+func (m Machine) SetHealthCheck(hc HealthCheck) {
+	m.healthCheck.Store(hc)
+}
+
+// CheckHealth runs the HealthCheck set by SetHealthCheck. Returns nil if no
+// check has been set
+func (m Machine) CheckHealth() error {
+	if m.healthCheck == nil {
+		return nil
+	}
+	hc, ok := m.healthCheck.Load().(HealthCheck)
+	if !ok || hc == nil {
+		return nil
+	}
+	return hc()
+}
+
 // Get the current state under a read lock
 func (m Machine) Get() current.Activity {
 	m.RLock()
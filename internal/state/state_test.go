@@ -277,6 +277,40 @@ func TestUpdate_TransitionError(t *testing.T) {
 
 }
 
+//test that CheckHealth returns the error of the health check, and that the
+//health check does not prevent state changes, which is left to the caller
+func TestMachine_CheckHealth(t *testing.T) {
+	m := NewMachine(dummyStates)
+	if err := m.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth failed without a health check: %v", err)
+	}
+
+	healthy := false
+	m.SetHealthCheck(func() error {
+		if !healthy {
+			return errors.New("mock unhealthy")
+		}
+		return nil
+	})
+
+	err := m.CheckHealth()
+	if err == nil || !strings.Contains(err.Error(), "mock unhealthy") {
+		t.Errorf("CheckHealth returned wrong error, returned: %v", err)
+	}
+
+	*m.Activity = current.WAITING
+	success, err := m.Update(current.PRECOMPUTING)
+	if !success || err != nil {
+		t.Errorf("Update to %s failed while unhealthy: %v",
+			current.PRECOMPUTING, err)
+	}
+
+	healthy = true
+	if err = m.CheckHealth(); err != nil {
+		t.Errorf("CheckHealth failed once healthy: %v", err)
+	}
+}
+
 //Test that all waiting channels get notified on update
 func TestUpdate_ManyNotifications(t *testing.T) {
 	numNotifications := 10
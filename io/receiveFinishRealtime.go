@@ -100,6 +100,10 @@ func ReceiveFinishRealtime(instance *internal.Instance, msg *mixmessages.RoundIn
 	}
 
 	p.Measure(measure.TagVerification)
+	instance.RecordRoundHistory(r, "")
+	// The round and its data are kept for the post round handlers until
+	// evicted by the retention manager
+	instance.GetRoundRetention().Complete(roundID)
 	go func() {
 		p.UpdateFinalStates()
 		/*if !r.GetTopology().IsFirstNode(instance.GetID()) {
@@ -110,23 +114,6 @@ func ReceiveFinishRealtime(instance *internal.Instance, msg *mixmessages.RoundIn
 				}
 			}
 		}*/
-		if !instance.GetKeepBuffers() {
-			//Delete the round and its data from the manager
-			//Delay so it can be used by post round hanlders
-			go func() {
-				jww.INFO.Printf("[%v]: RID %d ReceiveFinishRealtime CLEARING "+
-					"CMIX BUFFERS", instance, roundID)
-
-				time.Sleep(time.Duration(60) * time.Second)
-				r.GetBuffer().Erase()
-				rm.DeleteRound(roundID)
-			}()
-
-		} else {
-			jww.WARN.Printf("[%v]: RID %d ReceiveFinishRealtime MEMORY "+
-				"LEAK - Round buffers not purged ", instance,
-				roundID)
-		}
 	}()
 
 	jww.INFO.Printf("[%v]: RID %d ReceiveFinishRealtime END", instance,
@@ -14,6 +14,7 @@ import (
 	"gitlab.com/elixxir/server/internal/measure"
 	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/internal/round"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/elixxir/server/testUtil"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/comms/messages"
@@ -21,6 +22,7 @@ import (
 	"google.golang.org/grpc/metadata"
 	"io"
 	"testing"
+	"time"
 )
 
 func TestReceiveFinishRealtime(t *testing.T) {
@@ -77,6 +79,22 @@ func TestReceiveFinishRealtime(t *testing.T) {
 	if err != nil {
 		t.Errorf("ReceiveFinishRealtime: errored: %+v", err)
 	}
+
+	// The round history is written asynchronously
+	var record *storage.RoundRecord
+	for i := 0; i < 100; i++ {
+		record, err = instance.GetStorage().GetRound(roundID)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Round history was not stored: %+v", err)
+	}
+	if record.Outcome != storage.RoundCompleted || record.BatchSize != uint32(batchSize) {
+		t.Errorf("Unexpected round history: %+v", record)
+	}
 }
 
 // Tests that the ReceiveFinishRealtime function will fail when passed with an
@@ -65,6 +65,12 @@ func ReceiveGetMeasure(instance *internal.Instance, msg *mixmessages.RoundInfo,
 	if resourceMonitor != nil {
 		resourceMetric = resourceMonitor.Get()
 	}
+	resourceMetric.BufferPool = instance.GetBufferPool().GetMetric()
+	resourceMetric.ClientErrors, err = instance.GetClientReport().GetCounts()
+	if err != nil {
+		jww.WARN.Printf("Failed to get client error counts for round "+
+			"%d metrics: %+v", roundID, err)
+	}
 
 	metrics := r.GetMeasurements(nodeId, numNodes, index, resourceMetric)
 
@@ -20,6 +20,7 @@ import (
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/primitives/id"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -104,6 +105,16 @@ func TestReceiveGetMeasure(t *testing.T) {
 		Sender:          fakeHost,
 	}
 
+	// Report a client error so that it is counted in the metrics
+	err = instance.GetClientReport().Send(roundID, &mixmessages.ClientError{
+		ClientId: []byte("client"),
+		Error:    "Failed to process client slot",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send client error: %+v", err)
+	}
+	instance.GetClientReport().Flush()
+
 	rnd.GetMeasurementsReadyChan() <- struct{}{}
 
 	resp, err = ReceiveGetMeasure(instance, &info, auth)
@@ -118,6 +129,12 @@ func TestReceiveGetMeasure(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to extract data from JSON: %+v", err)
 	}
+	expectedCounts := map[string]uint64{round.ClientErrorOther: 1}
+	if !reflect.DeepEqual(expectedCounts, remade.ResourceMetric.ClientErrors) {
+		t.Errorf("Unexpected client error counts."+
+			"\n\tExpected: %v\n\tReceived: %v",
+			expectedCounts, remade.ResourceMetric.ClientErrors)
+	}
 
 	info = mixmessages.RoundInfo{
 		ID: uint64(roundID) - 1,
@@ -351,13 +351,13 @@ func TestReceivePostNewBatch(t *testing.T) {
 	const batchSize = 1
 	const roundID = 2
 
-	gg := services.NewGraphGenerator(4, uint8(runtime.NumCPU()),
+	gg := services.MustNewGraphGenerator(4, uint8(runtime.NumCPU()),
 		1, 1.0)
 
 	realDecrypt := phase.New(phase.Definition{
 		Graph: realtime.InitDecryptGraph(gg),
 		Type:  phase.RealDecrypt,
-		TransmissionHandler: func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk,
+		TransmissionHandler: func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk,
 			getMessage phase.GetMessage) error {
 			return nil
 		},
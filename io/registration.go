@@ -11,12 +11,14 @@ package io
 
 import (
 	"crypto"
+	"encoding/binary"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	pb "gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/hash"
 	"gitlab.com/elixxir/crypto/registration"
 	"gitlab.com/elixxir/server/internal"
+	"gitlab.com/elixxir/server/storage"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/crypto/chacha"
 	"gitlab.com/xx_network/crypto/csprng"
@@ -25,6 +27,7 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/ndf"
 	"google.golang.org/protobuf/proto"
+	"time"
 )
 
 // RequestClientKey handles a client request for a nonce during the
@@ -136,10 +139,8 @@ func RequestClientKey(instance *internal.Instance,
 		return &pb.SignedKeyResponse{Error: errMsg.Error()}, errMsg
 	}
 
-	// Retrieve node secret
-	// TODO: replace hardcoding of keyID once multiple rotating node secrets
-	//  is supported
-	nodeSecret, err := instance.GetSecretManager().GetSecret(0)
+	// Retrieve the newest valid node secret
+	nodeSecret, err := instance.GetSecretManager().GetActiveSecret()
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +149,7 @@ func RequestClientKey(instance *internal.Instance,
 	cmixH := hash.CMixHash.New()
 	cmixH.Reset()
 	cmixH.Write(userId.Bytes())
-	cmixH.Write(nodeSecret.Bytes())
+	cmixH.Write(nodeSecret.Secret.Bytes())
 	clientKey := cmixH.Sum(nil)
 
 	// Construct client gateway key
@@ -174,20 +175,38 @@ func RequestClientKey(instance *internal.Instance,
 	jww.TRACE.Printf("[ClientKeyHMAC] EncryptedClientKey: %+v", encryptedClientKey)
 	jww.TRACE.Printf("[ClientKeyHMAC] EncryptedClientKeyHMAC: %+v", encryptedClientKeyHMAC)
 
+	// Record which node secret the client's key was derived from
+	err = instance.GetStorage().UpsertClientRegistration(&storage.ClientRegistration{
+		UserId:       userId.Marshal(),
+		KeyId:        nodeSecret.KeyId,
+		RegisteredAt: time.Now(),
+	})
+	if err != nil {
+		jww.WARN.Printf("Failed to record registration of client %s: %+v",
+			userId, err)
+	}
+	instance.GetSecretManager().SetClientKeyId(userId, nodeSecret.KeyId)
+
+	// Serialize the identity and expiry of the node secret used
+	keyID := make([]byte, 8)
+	binary.BigEndian.PutUint64(keyID, uint64(nodeSecret.KeyId))
+	var validUntil uint64
+	if !nodeSecret.ValidUntil.IsZero() {
+		validUntil = uint64(nodeSecret.ValidUntil.UnixNano())
+	}
+
 	// Construct response
 	resp := &pb.ClientKeyResponse{
 		EncryptedClientKey:     encryptedClientKey,
 		EncryptedClientKeyHMAC: encryptedClientKeyHMAC,
 		NodeDHPubKey:           DHPub.Bytes(),
-		// Fixme: the values below are future features for
-		//  expiring nodeSecret values.
-		//  KeyID identifies the active key identities that can still be used
-		//  ValidUntil denotes the time at which the key id retrieved becomes
-		//  invalid to the server
-		//  This is how we provide a form of forward secrecy in the case where
-		//  NodeSecrets are leaked
-		KeyID:      nil,
-		ValidUntil: 0,
+		// KeyID identifies the node secret the client key was derived from
+		// ValidUntil denotes the time at which the key id retrieved becomes
+		// invalid to the server
+		// This is how we provide a form of forward secrecy in the case where
+		// NodeSecrets are leaked
+		KeyID:      keyID,
+		ValidUntil: validUntil,
 	}
 
 	// Serialize response
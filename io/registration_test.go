@@ -9,6 +9,7 @@ package io
 
 import (
 	"crypto"
+	"encoding/binary"
 	cryptoRand "crypto/rand"
 	gorsa "crypto/rsa"
 	"fmt"
@@ -31,6 +32,7 @@ import (
 	"gitlab.com/xx_network/crypto/csprng"
 	"gitlab.com/xx_network/crypto/large"
 	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/crypto/xx"
 	"gitlab.com/xx_network/primitives/id"
 	"gitlab.com/xx_network/primitives/utils"
 	"math/rand"
@@ -155,6 +157,32 @@ func TestRequestClientKey(t *testing.T) {
 				t.Fatalf("Failed to verify client HMAC")
 			}
 
+			// Verify the response identifies the active node secret
+			activeSecret, err := instance.GetSecretManager().GetActiveSecret()
+			if err != nil {
+				t.Fatalf("GetActiveSecret error: %v", err)
+			}
+			if binary.BigEndian.Uint64(keyResponse.KeyID) != uint64(activeSecret.KeyId) {
+				t.Errorf("Unexpected key ID in response."+
+					"\n\tExpected: %d\n\tReceived: %v",
+					activeSecret.KeyId, keyResponse.KeyID)
+			}
+
+			// Verify the registration was recorded in storage
+			userId, err := xx.NewID(userRsaPub, salt, id.User)
+			if err != nil {
+				t.Fatalf("Failed to generate user ID: %v", err)
+			}
+			reg, err := instance.GetStorage().GetClientRegistration(userId)
+			if err != nil {
+				t.Fatalf("GetClientRegistration error: %v", err)
+			}
+			if reg.KeyId != activeSecret.KeyId {
+				t.Errorf("Unexpected key ID in registration record."+
+					"\n\tExpected: %d\n\tReceived: %d",
+					activeSecret.KeyId, reg.KeyId)
+			}
+
 		})
 	}
 }
@@ -176,7 +176,7 @@ func mockServerInstance(t *testing.T, s current.Activity) (*internal.Instance, *
 	topology := connect.NewCircuit(nodeIDs)
 	def := internal.Definition{
 		ResourceMonitor: &measure.ResourceMonitor{},
-		GraphGenerator: services.NewGraphGenerator(2,
+		GraphGenerator: services.MustNewGraphGenerator(2,
 			2, 2, 0),
 		RngStreamGen: fastRNG.NewStreamGenerator(10000,
 			uint(runtime.NumCPU()), csprng.NewSystemRNG),
@@ -311,7 +311,7 @@ func makeMultiInstanceParams(numNodes, batchsize, portstart int, grp *cyclic.Gro
 			},
 			ListeningAddress:        nodeLst[i].ListeningAddress,
 			MetricsHandler: func(i *server.Instance, roundID id.Round) error { return nil },
-			GraphGenerator: services.NewGraphGenerator(4, PanicHandler, 1, 4, 0.0),
+			GraphGenerator: services.MustNewGraphGenerator(4, PanicHandler, 1, 4, 0.0),
 			RngStreamGen: fastRNG.NewStreamGenerator(10000,
 				uint(runtime.NumCPU()), csprng.NewSystemRNG),
 		}
@@ -420,6 +420,8 @@ func (mp *MockPhase) AttemptToQueue(queue chan<- phase.Phase) bool {
 }
 func (mp *MockPhase) IsQueued() bool                      { return true }
 func (*MockPhase) UpdateFinalStates()                     { return }
+func (*MockPhase) StopRecording()                         { return }
+func (*MockPhase) Detach()                                { return }
 func (*MockPhase) GetTransmissionHandler() phase.Transmit { return nil }
 func (*MockPhase) GetTimeout() time.Duration              { return 0 }
 func (*MockPhase) Cmp(phase.Phase) bool                   { return false }
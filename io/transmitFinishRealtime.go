@@ -11,6 +11,7 @@
 package io
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/comms/mixmessages"
@@ -28,7 +29,7 @@ import (
 // TransmitFinishRealtime broadcasts the finish realtime message to all other nodes
 // It sends all messages concurrently, then waits for all to be done,
 // while catching any errors that occurred
-func TransmitFinishRealtime(roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+func TransmitFinishRealtime(ctx context.Context, roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 	instance, ok := serverInstance.(*internal.Instance)
 	if !ok {
 		return errors.Errorf("Invalid server instance passed in")
@@ -57,6 +58,10 @@ func TransmitFinishRealtime(roundID id.Round, serverInstance phase.GenericInstan
 			complete.Round[i] = msg
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return errors.WithMessagef(err, "Transmission of realtime results "+
+			"of round %d cancelled", roundID)
+	}
 
 	measureFunc := r.GetCurrentPhase().Measure
 	if measureFunc != nil {
@@ -77,6 +82,11 @@ func TransmitFinishRealtime(roundID id.Round, serverInstance phase.GenericInstan
 			var streamErr error
 			var ack *messages.Ack
 			for i := 0; i < 3; i++ {
+				if ctx.Err() != nil {
+					streamErr = errors.WithMessagef(ctx.Err(), "Sending "+
+						"TransmitFinishRealtime to %s cancelled", recipient.GetId())
+					break
+				}
 
 				currentRound := instance.GetRoundManager().GetCurrentRound()
 
@@ -8,6 +8,7 @@
 package io
 
 import (
+	"context"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/comms/node"
 	"gitlab.com/elixxir/server/internal/phase"
@@ -87,7 +88,7 @@ func TestSendFinishRealtime(t *testing.T) {
 	errCH := make(chan error)
 
 	go func() {
-		err = TransmitFinishRealtime(roundID, instance, getChunk, getMessage)
+		err = TransmitFinishRealtime(context.Background(), roundID, instance, getChunk, getMessage)
 		errCH <- err
 	}()
 
@@ -31,13 +31,25 @@ const mockRoundMetricJSON = `{
 		"MemAllocBytes": 5,
 		"MemAvailable": 13,
 		"NumThreads": 5,
-		"CPUPercentage": 0
+		"CPUPercentage": 0,
+		"BufferPool": {
+			"Idle": 1,
+			"IdleBytes": 4096,
+			"Reused": 3,
+			"Allocated": 2,
+			"Dropped": 0
+		},
+		"ClientErrors": {
+			"InvalidMAC": 2,
+			"SecretNotFound": 1
+		}
 	},
 	"StartTime": "0001-01-01T00:00:00Z",
 	"EndTime": "0001-02-03T00:00:00Z",
 	"RTDurationMilli": 0,
 	"RTPayload": "",
-	"DispatchDuration": 0
+	"DispatchDuration": 0,
+	"ModuleMetrics": {}
 }`
 
 // Mock an implementation with a GetMeasure function.
@@ -11,6 +11,7 @@
 package io
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -24,7 +25,7 @@ import (
 )
 
 // TransmitPhase sends a cMix Batch of messages to the provided Node.
-func TransmitPhase(roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
+func TransmitPhase(ctx context.Context, roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
 	getMessage phase.GetMessage) error {
 
 	instance, ok := serverInstance.(*internal.Instance)
@@ -72,6 +73,10 @@ func TransmitPhase(roundID id.Round, serverInstance phase.GenericInstance, getCh
 			cnt++
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return errors.WithMessagef(err, "Transmission of phase %s of "+
+			"round %d cancelled", rType, roundID)
+	}
 
 	localServer := instance.GetNetwork().String()
 	port := strings.Split(localServer, ":")[1]
@@ -10,6 +10,7 @@ package io
 // transmitPhaseStream.go contains the logic for streaming a phase comm
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -25,8 +26,9 @@ import (
 	"time"
 )
 
-// StreamTransmitPhase streams slot messages to the provided Node.
-func StreamTransmitPhase(roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
+// StreamTransmitPhase streams slot messages to the provided Node. The stream is
+// closed if ctx is cancelled before the transmission finishes.
+func StreamTransmitPhase(ctx context.Context, roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
 	getMessage phase.GetMessage) error {
 
 	instance, ok := serverInstance.(*internal.Instance)
@@ -72,12 +74,26 @@ func StreamTransmitPhase(roundID id.Round, serverInstance phase.GenericInstance,
 	}
 	defer cancel()
 
+	// Abort the stream if the phase is cancelled while transmitting
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-done:
+		}
+	}()
+
 	//pull the first chunk reception out so that it can be timestamped
 	chunk, finish := getChunk()
 	var start time.Time
 	numSlots := 0
 	// For each message chunk (slot) stream it out
 	for ; finish; chunk, finish = getChunk() {
+		if err = ctx.Err(); err != nil {
+			break
+		}
 		for i := chunk.Begin(); i < chunk.End(); i++ {
 			numSlots++
 			if numSlots == 1 {
@@ -97,6 +113,11 @@ func StreamTransmitPhase(roundID id.Round, serverInstance phase.GenericInstance,
 			}
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return errors.WithMessagef(err, "Streaming of phase %s of round %d "+
+			"cancelled after %d slots", rType, roundID, numSlots)
+	}
+
 	end := time.Now()
 	measureFunc := currentPhase.Measure
 	if measureFunc != nil {
@@ -168,7 +168,7 @@ func TestStreamTransmitPhase(t *testing.T) {
 	}
 
 	// call the transmitter
-	err = StreamTransmitPhase(roundID, instance, getChunk, getMsg)
+	err = StreamTransmitPhase(context.Background(), roundID, instance, getChunk, getMsg)
 
 	if err != nil {
 		t.Errorf("StreamTransmitPhase failed: %v", err)
@@ -8,6 +8,7 @@
 package io
 
 import (
+	"context"
 	"fmt"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/comms/node"
@@ -130,7 +131,7 @@ func TestTransmitPhase(t *testing.T) {
 	}
 
 	//call the transmitter
-	err = TransmitPhase(roundID, instance, getChunk, getMsg)
+	err = TransmitPhase(context.Background(), roundID, instance, getChunk, getMsg)
 
 	if err != nil {
 		t.Errorf("TransmitPhase: Unexpected error: %+v", err)
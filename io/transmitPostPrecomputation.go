@@ -10,6 +10,7 @@ package io
 // transmitPostPrecompResult.go contains the logic for transmitting a precompResult comm
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -23,7 +24,7 @@ import (
 
 // TransmitPrecompResult: The last node transmits the precomputation to all
 // nodes but the first, then the first node, after precomp strip
-func TransmitPrecompResult(roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
+func TransmitPrecompResult(ctx context.Context, roundID id.Round, serverInstance phase.GenericInstance, getChunk phase.GetChunk,
 	getMessage phase.GetMessage) error {
 
 	var wg sync.WaitGroup
@@ -54,6 +55,10 @@ func TransmitPrecompResult(roundID id.Round, serverInstance phase.GenericInstanc
 			slots[i] = msg
 		}
 	}
+	if err = ctx.Err(); err != nil {
+		return errors.WithMessagef(err, "Transmission of precomputation "+
+			"result of round %d cancelled", roundID)
+	}
 
 	measureFunc := r.GetCurrentPhase().Measure
 	if measureFunc != nil {
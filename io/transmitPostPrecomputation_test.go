@@ -8,6 +8,7 @@
 package io
 
 import (
+	"context"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/comms/node"
 	"gitlab.com/elixxir/comms/testkeys"
@@ -165,7 +166,7 @@ func TestTransmitPostPrecompResult(t *testing.T) {
 		return chunk, good
 	}
 
-	err = TransmitPrecompResult(rndID, instance, getchunk, getMockPostPrecompSlot)
+	err = TransmitPrecompResult(context.Background(), rndID, instance, getchunk, getMockPostPrecompSlot)
 
 	if err != nil {
 		t.Errorf("TransmitPrecompResult: Unexpected error: %+v", err)
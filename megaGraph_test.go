@@ -8,6 +8,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/jinzhu/copier"
 	jww "github.com/spf13/jwalterweatherman"
@@ -316,13 +317,13 @@ func buildAndStartGraph(batchSize uint32, grp *cyclic.Group,
 	}
 	// NOTE: input size greater than 1 would necessarily cause a hang here
 	// since we never send more than 1 message through.
-	gc := services.NewGraphGenerator(1,
+	gc := services.MustNewGraphGenerator(1,
 		1, 1, 0)
 	dGrph := InitDbgGraph(gc, streams, t, batchSize)
 	dGrph.Build(batchSize, PanicHandler)
 
 	dGrph.Link(grp, roundBuf, &rngStreamGen)
-	dGrph.Run()
+	dGrph.Run(context.Background())
 	return dGrph
 }
 
@@ -336,14 +337,14 @@ func buildAndStartGraph3(batchSize uint32, grp *cyclic.Group,
 	}
 	// NOTE: input size greater than 1 would necessarily cause a hang here
 	// since we never send more than 1 message through.
-	gc := services.NewGraphGenerator(1,
+	gc := services.MustNewGraphGenerator(1,
 		1, 1, 0)
 	dGrph := InitDbgGraph3(gc, streams, grp, batchSize, roundBuf,
 		rngStreamGen, t)
 	dGrph.Build(batchSize, PanicHandler)
 
 	dGrph.Link(grp, roundBuf, rngStreamGen)
-	dGrph.Run()
+	dGrph.Run(context.Background())
 	return dGrph
 }
 
@@ -801,7 +802,11 @@ func (ds *DebugStream) Link(grp *cyclic.Group, batchSize uint32,
 	copy(fakeNodeID[:], "fakeNodeID")
 	fakeNodeID.SetType(id.Node)
 
-	testReport := round.NewClientFailureReport(fakeNodeID)
+	store, err := storage.NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		panic(err)
+	}
+	testReport := round.NewClientFailureReport(fakeNodeID, store)
 
 	ds.LinkKeygenDecryptStream(grp, batchSize, roundBuf, nil, ecrPayloadA, ecrPayloadB, grp.NewIntBuffer(batchSize, grp.NewInt(1)), grp.NewIntBuffer(batchSize, grp.NewInt(1)), users, make([][]byte, batchSize), make([][][]byte, batchSize), make([][]bool, batchSize), nil, testReport, 0, storage.NewNodeSecretManager(), storage.NewPrecanStore(true, grp))
 
@@ -1036,8 +1041,10 @@ func InitDbgGraph3(gc services.GraphGenerator, streams map[string]*DebugStream,
 	return g
 }
 
-func RunDbgGraph(batchSize uint32, rngConstructor func() csprng.Source,
-	t *testing.T) {
+// RunDbgGraph runs the debug graph on a batch, with its modules run on a pool
+// of numWorkers workers or, if zero, on threads for each module
+func RunDbgGraph(batchSize uint32, numWorkers uint8,
+	rngConstructor func() csprng.Source, t *testing.T) {
 	grp := cyclic.NewGroup(large.NewIntFromString(MODP768, 16),
 		large.NewInt(2))
 
@@ -1089,8 +1096,9 @@ func RunDbgGraph(batchSize uint32, rngConstructor func() csprng.Source,
 			g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(1,
+	gc := services.MustNewGraphGenerator(1,
 		uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc.SetNumWorkers(numWorkers)
 	streams := make(map[string]*DebugStream)
 	dGrph := InitDbgGraph(gc, streams, t, batchSize)
 
@@ -1118,7 +1126,7 @@ func RunDbgGraph(batchSize uint32, rngConstructor func() csprng.Source,
 
 	megaStream := stream.(*DebugStream)
 
-	dGrph.Run()
+	dGrph.Run(context.Background())
 
 	go func() {
 		t.Log("Beginning test")
@@ -1177,7 +1185,7 @@ func Test_DebugStream(t *testing.T) {
 			g, m, err.Error()))
 	}
 
-	gc := services.NewGraphGenerator(1,
+	gc := services.MustNewGraphGenerator(1,
 		uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 	streams := make(map[string]*DebugStream)
 	dGrph := InitDbgGraph(gc, streams, t, batchSize)
@@ -1234,7 +1242,12 @@ func (p *PseudoRNG) SetSeed(seed []byte) error {
 }
 
 func Test_DbgGraph(t *testing.T) {
-	RunDbgGraph(3, NewPseudoRNG, t)
+	RunDbgGraph(3, 0, NewPseudoRNG, t)
+}
+
+// Runs the debug graph with its modules sharing a pool of workers
+func Test_DbgGraph_WorkerPool(t *testing.T) {
+	RunDbgGraph(3, uint8(runtime.NumCPU()), NewPseudoRNG, t)
 }
 
 /**/
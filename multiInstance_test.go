@@ -8,6 +8,7 @@
 package main
 
 import (
+	"context"
 	crand "crypto/rand"
 	gorsa "crypto/rsa"
 	"crypto/x509"
@@ -165,10 +166,10 @@ func MultiInstanceTest(numNodes, batchSize int, grp *cyclic.Group, useGPU, error
 		}
 
 		if errorPhase && i == 0 {
-			gc := services.NewGraphGenerator(4,
+			gc := services.MustNewGraphGenerator(4,
 				uint8(runtime.NumCPU()), 1, 0)
 			g := graphs.InitErrorGraph(gc)
-			th := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+			th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 				return errors.New("Failed intentionally")
 			}
 			overrides := map[int]phase.Phase{}
@@ -204,7 +205,10 @@ func MultiInstanceTest(numNodes, batchSize int, grp *cyclic.Group, useGPU, error
 		if err != nil {
 			t.Errorf("Failed to add permissioning host: %v", err)
 		}
-		instance.PopulateDummyUsers(true, grp)
+		err = instance.PopulateDummyUsers(true, grp)
+		if err != nil {
+			t.Errorf("Failed to populate precanned users: %+v", err)
+		}
 		instance.AddDummyUserTesting(userID, baseKeys[i].Bytes(), grp, t)
 	}
 
@@ -659,7 +663,7 @@ func makeMultiInstanceParams(numNodes, portStart int, grp *cyclic.Group, useGPU
 			ListeningAddress:   nodeLst[i].Address,
 			MetricsHandler:     func(i *internal.Instance, roundID id.Round) error { return nil },
 			RecoveredErrorPath: fmt.Sprintf("/tmp/err_%d", i),
-			GraphGenerator:     services.NewGraphGenerator(4, 1, 4, 1.0),
+			GraphGenerator:     services.MustNewGraphGenerator(4, 1, 4, 1.0),
 			RngStreamGen: fastRNG.NewStreamGenerator(10000,
 				uint(runtime.NumCPU()), csprng.NewSystemRNG),
 			DevMode: true,
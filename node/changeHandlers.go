@@ -204,7 +204,10 @@ func NotStarted(instance *internal.Instance) error {
 	cmixGrp := instance.GetNetworkStatus().GetCmixGroup()
 
 	//populate the dummy precanned users
-	instance.PopulateDummyUsers(instance.GetDefinition().DevMode, cmixGrp)
+	err = instance.PopulateDummyUsers(instance.GetDefinition().DevMode, cmixGrp)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to populate precanned users")
+	}
 
 	jww.INFO.Printf("Waiting on communication from gateway to continue")
 
@@ -308,14 +311,22 @@ func Precomputing(instance *internal.Instance) error {
 	}
 
 	//Build the components of the round
-	phases, phaseResponses := NewRoundComponents(
+	phases, phaseResponses, err := NewRoundComponents(
 		instance.GetGraphGenerator(),
 		circuit,
 		instance.GetID(),
 		instance,
 		roundTimeout, instance.GetStreamPool(),
 		instance.GetDisableStreaming(),
-		roundID)
+		roundID, roundInfo.GetBatchSize())
+	if err != nil {
+		// Only the round is failed, the state machine cannot be updated
+		// from within a state change so the failure is reported separately
+		roundErr := errors.WithMessagef(err,
+			"Failed to create components for round %d", roundID)
+		go instance.ReportRoundFailure(roundErr, instance.GetID(), roundID)
+		return nil
+	}
 
 	var override = func() {
 		phaseOverrides := instance.GetPhaseOverrides()
@@ -332,17 +343,20 @@ func Precomputing(instance *internal.Instance) error {
 	}
 
 	//Build the round
-	rnd, err := round.New(instance.GetNetworkStatus().GetCmixGroup(), roundID,
-		phases, phaseResponses, circuit, instance.GetID(),
+	rnd, err := round.NewWithBufferPool(instance.GetNetworkStatus().GetCmixGroup(),
+		roundID, phases, phaseResponses, circuit, instance.GetID(),
 		roundInfo.GetBatchSize(), instance.GetRngStreamGen(), instance.GetStreamPool(),
 		instance.GetIP(), GetDefaultPanicHandler(instance, roundID),
-		instance.GetClientReport(), instance.GetSecretManager(), instance.GetPrecanStore())
+		instance.GetClientReport(), instance.GetSecretManager(), instance.GetPrecanStore(),
+		instance.GetBufferPool())
 	if err != nil {
 		return errors.WithMessage(err, "Failed to create new round")
 	}
 
 	//Add the round to the manager
 	instance.GetRoundManager().AddRound(rnd)
+	instance.GetRoundRetention().Track(roundID, rnd.GetBuffer().EstimateSize(
+		instance.GetNetworkStatus().GetCmixGroup()))
 	jww.INFO.Printf("[%+v]: RID %d CreateNewRound COMPLETE", instance,
 		roundID)
 
@@ -414,6 +428,8 @@ func Completed(from current.Activity) error {
 	return nil
 }
 
+// Error recovers from the round error on the instance by aborting the round,
+// restarting the node if it cannot
 func Error(instance *internal.Instance) error {
 	//If the error state was recovered from a restart, exit.
 	if instance.GetRecoveredErrorUnsafe() != nil {
@@ -481,6 +497,18 @@ func Error(instance *internal.Instance) error {
 			}
 		}
 	*/
+
+	// Errors of a round are recovered from by aborting the round, restarting
+	// is reserved for errors which cannot be
+	err := instance.AbortRound(msg)
+	if err == nil {
+		jww.ERROR.Printf("Round %d aborted, reporting error to "+
+			"permissioning: %s", msg.Id, msg.Error)
+		return nil
+	}
+	jww.ERROR.Printf("Unable to recover from error by aborting the round, "+
+		"restarting: %+v", err)
+
 	b, err := proto.Marshal(msg)
 	if err != nil {
 		return errors.WithMessage(err, "Failed to marshal message into bytes")
@@ -8,6 +8,7 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -53,7 +54,7 @@ func setup(t *testing.T) (*internal.Instance, *connect.Circuit) {
 
 	//Build the topology
 	topology := connect.NewCircuit(nodeIDs)
-	gg := services.NewGraphGenerator(4, 1,
+	gg := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 	def := internal.Definition{
 		ResourceMonitor:    &measure.ResourceMonitor{},
@@ -119,6 +120,8 @@ func TestNewStateChanges(t *testing.T) {
 	}
 }
 
+// Happy path: the error of a round aborts the round without restarting the
+// node, holding the error to be reported to permissioning
 func TestError(t *testing.T) {
 	instance, topology := setup(t)
 	rndErr := &mixmessages.RoundError{
@@ -133,9 +136,8 @@ func TestError(t *testing.T) {
 
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Println("Recovered in SetGroup(): ", r)
-		} else {
-			t.Errorf("SetGroup() did not panic when expected while attempting to set the group again")
+			t.Errorf("Error panicked on an error which can be recovered "+
+				"from: %v", r)
 		}
 		instance.GetNetwork().Shutdown()
 	}()
@@ -156,8 +158,24 @@ func TestError(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to error: %+v", err)
 	}
+
+	if _, err = instance.GetRoundManager().GetRound(1); err == nil {
+		t.Errorf("Aborted round is still in the round manager")
+	}
+	if instance.GetRecoveredError() != rndErr {
+		t.Errorf("Error is not held to be reported to permissioning."+
+			"\n\tExpected: %v\n\tReceived: %v", rndErr,
+			instance.GetRecoveredError())
+	}
+
+	// The resource queue is running again, so it must be killed
+	err = instance.GetResourceQueue().Kill(time.Second)
+	if err != nil {
+		t.Errorf("Resource queue was not restarted: %+v", err)
+	}
 }
 
+// Error path: an error which is not associated with a round restarts the node
 func TestError_RID0(t *testing.T) {
 	instance, topology := setup(t)
 	rndErr := &mixmessages.RoundError{
@@ -260,10 +278,10 @@ func TestPrecomputing(t *testing.T) {
 func TestPrecomputing_override(t *testing.T) {
 	var err error
 	instance, topology := setup(t)
-	gc := services.NewGraphGenerator(4,
+	gc := services.MustNewGraphGenerator(4,
 		uint8(runtime.NumCPU()), 1, 0)
 	g := graphs.InitErrorGraph(gc)
-	th := func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+	th := func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
 		return errors.New("Failed intentionally")
 	}
 	overrides := map[int]phase.Phase{}
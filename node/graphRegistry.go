@@ -0,0 +1,116 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package node
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/elixxir/server/graphs"
+	"gitlab.com/elixxir/server/graphs/precomputation"
+	"gitlab.com/elixxir/server/graphs/realtime"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/services"
+)
+
+// graphRegistry.go builds the graphs of phases from graph definitions in
+// devMode
+
+// NewGraphRegistry returns a registry of every module and stream used by the
+// graphs of a round. Modules are registered under their variable names.
+func NewGraphRegistry() *services.GraphRegistry {
+	r := services.NewGraphRegistry()
+
+	r.RegisterModule("Keygen", graphs.Keygen)
+
+	r.RegisterModule("Generate", precomputation.Generate)
+	r.RegisterModule("ShareExp", precomputation.ShareExp)
+	r.RegisterModule("DecryptElgamal", precomputation.DecryptElgamal)
+	r.RegisterModule("DecryptElgamalChunk", precomputation.DecryptElgamalChunk)
+	r.RegisterModule("PermuteElgamal", precomputation.PermuteElgamal)
+	r.RegisterModule("PermuteElgamalChunk", precomputation.PermuteElgamalChunk)
+	r.RegisterModule("RevealRootCoprime", precomputation.RevealRootCoprime)
+	r.RegisterModule("RevealRootCoprimeChunk", precomputation.RevealRootCoprimeChunk)
+	r.RegisterModule("StripInverse", precomputation.StripInverse)
+	r.RegisterModule("StripMul2", precomputation.StripMul2)
+
+	r.RegisterModule("DecryptMul3", realtime.DecryptMul3)
+	r.RegisterModule("DecryptMul3Chunk", realtime.DecryptMul3Chunk)
+	r.RegisterModule("PermuteMul2", realtime.PermuteMul2)
+	r.RegisterModule("PermuteMul2Chunk", realtime.PermuteMul2Chunk)
+	r.RegisterModule("IdentifyMul2", realtime.IdentifyMul2)
+	r.RegisterModule("IdentifyMul2Chunk", realtime.IdentifyMul2Chunk)
+
+	r.RegisterStream(func() services.Stream { return &precomputation.GenerateStream{} })
+	r.RegisterStream(func() services.Stream { return &precomputation.ShareStream{} })
+	r.RegisterStream(func() services.Stream { return &precomputation.DecryptStream{} })
+	r.RegisterStream(func() services.Stream { return &precomputation.PermuteStream{} })
+	r.RegisterStream(func() services.Stream { return &precomputation.RevealStream{} })
+	r.RegisterStream(func() services.Stream { return &precomputation.StripStream{} })
+
+	r.RegisterStream(func() services.Stream { return &realtime.KeygenDecryptStream{} })
+	r.RegisterStream(func() services.Stream { return &realtime.PermuteStream{} })
+	r.RegisterStream(func() services.Stream { return &realtime.IdentifyStream{} })
+
+	return r
+}
+
+// ReplaceRoundGraphs replaces each graph with the definition of the same name
+// by the graph built from the definition. Returns an error if a definition is
+// invalid or does not use the stream of the graph it replaces, which the
+// transmission handlers of the phase depend on.
+func ReplaceRoundGraphs(roundGraphs map[phase.Type]*services.Graph,
+	gc services.GraphGenerator, registry *services.GraphRegistry,
+	definitions map[string]services.GraphDefinition) error {
+	for p, g := range roundGraphs {
+		def, ok := definitions[g.GetName()]
+		if !ok {
+			continue
+		}
+
+		defined, err := registry.NewGraph(gc, def)
+		if err != nil {
+			return errors.WithMessagef(err, "Failed to create graph for "+
+				"phase %s", p)
+		}
+
+		if defined.GetStream().GetName() != g.GetStream().GetName() {
+			return errors.Errorf("Graph %s for phase %s uses stream %s, "+
+				"expected %s", def.Name, p, defined.GetStream().GetName(),
+				g.GetStream().GetName())
+		}
+
+		roundGraphs[p] = defined
+	}
+
+	return nil
+}
+
+// CheckGraphDefinitions checks that every definition, keyed by name, can
+// replace the graph of the same name on the nodes of a round which execute it
+func CheckGraphDefinitions(gc services.GraphGenerator,
+	definitions map[string]services.GraphDefinition, useGPU bool) error {
+	registry := NewGraphRegistry()
+	replaced := make(map[string]bool, len(definitions))
+	for _, isLastNode := range []bool{false, true} {
+		roundGraphs := NewRoundGraphs(gc, isLastNode, useGPU)
+		for _, g := range roundGraphs {
+			replaced[g.GetName()] = true
+		}
+
+		err := ReplaceRoundGraphs(roundGraphs, gc, registry, definitions)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name := range definitions {
+		if !replaced[name] {
+			return errors.Errorf("No graph named %s to replace", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package node
+
+import (
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/services"
+	"reflect"
+	"testing"
+)
+
+// Definition of the graph of realtime.InitIdentifyGraph
+const identifyGraphDefinition = `
+name: "RealtimeIdentify"
+stream: "RealtimeIdentifyStream"
+modules:
+  - module: "PermuteMul2"
+  - module: "IdentifyMul2"
+first: ["PermuteMul2"]
+last: ["IdentifyMul2"]
+edges:
+  - {from: "PermuteMul2", to: "IdentifyMul2"}
+`
+
+func parseTestGraphDefinitions(t *testing.T,
+	data ...string) map[string]services.GraphDefinition {
+	definitions := make(map[string]services.GraphDefinition, len(data))
+	for _, d := range data {
+		def, err := services.ParseGraphDefinition([]byte(d))
+		if err != nil {
+			t.Fatalf("Failed to parse graph definition: %+v", err)
+		}
+		definitions[def.Name] = def
+	}
+	return definitions
+}
+
+// Happy path: the graph of the last node is replaced by a graph built from a
+// definition of the same name, identical to the graph it replaces
+func TestReplaceRoundGraphs(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+	definitions := parseTestGraphDefinitions(t, identifyGraphDefinition)
+
+	roundGraphs := NewRoundGraphs(gc, true, false)
+	original := roundGraphs[phase.RealPermute]
+	decrypt := roundGraphs[phase.RealDecrypt]
+
+	err := ReplaceRoundGraphs(roundGraphs, gc, NewGraphRegistry(), definitions)
+	if err != nil {
+		t.Fatalf("ReplaceRoundGraphs returned an error: %+v", err)
+	}
+
+	if roundGraphs[phase.RealPermute] == original {
+		t.Errorf("Graph for %s was not replaced", phase.RealPermute)
+	}
+	if roundGraphs[phase.RealDecrypt] != decrypt {
+		t.Errorf("Graph for %s without a definition was replaced",
+			phase.RealDecrypt)
+	}
+
+	expected, received := original.Export(), roundGraphs[phase.RealPermute].Export()
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Defined graph differs from the graph it replaces."+
+			"\n\tExpected: %+v\n\tReceived: %+v", expected, received)
+	}
+}
+
+// Error path: a definition may not change the stream of the graph it replaces
+func TestReplaceRoundGraphs_StreamMismatch(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+	definitions := parseTestGraphDefinitions(t, `
+name: "RealtimeIdentify"
+stream: "RealtimePermuteStream"
+modules: [{module: "PermuteMul2"}]
+first: ["PermuteMul2"]
+last: ["PermuteMul2"]
+`)
+
+	err := ReplaceRoundGraphs(NewRoundGraphs(gc, true, false), gc,
+		NewGraphRegistry(), definitions)
+	if err == nil {
+		t.Errorf("ReplaceRoundGraphs did not error on a stream mismatch")
+	}
+}
+
+// Tests that CheckGraphDefinitions accepts definitions of graphs executed by
+// either node position and rejects definitions which replace nothing
+func TestCheckGraphDefinitions(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+
+	definitions := parseTestGraphDefinitions(t, identifyGraphDefinition)
+	if err := CheckGraphDefinitions(gc, definitions, false); err != nil {
+		t.Errorf("CheckGraphDefinitions returned an error: %+v", err)
+	}
+
+	// The CPU identify graph is not executed when using the GPU
+	if err := CheckGraphDefinitions(gc, definitions, true); err == nil {
+		t.Errorf("CheckGraphDefinitions did not error on a definition " +
+			"which replaces no graph")
+	}
+}
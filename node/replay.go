@@ -0,0 +1,171 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package node
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/elixxir/gpumathsgo"
+	"gitlab.com/elixxir/server/graphs"
+	"gitlab.com/elixxir/server/graphs/precomputation"
+	"gitlab.com/elixxir/server/graphs/realtime"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/internal/round"
+	"gitlab.com/elixxir/server/services"
+	"gitlab.com/elixxir/server/storage"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/id"
+	"time"
+)
+
+// replay.go replays the recorded inputs of a phase through its graph offline
+
+// GetGraphInitializers returns the initializer of every CPU graph executed by
+// the phases of a round, keyed by graph name. GPU graphs are omitted as they
+// cannot be run without a GPU stream pool.
+func GetGraphInitializers(gc services.GraphGenerator) map[string]graphs.Initializer {
+	initializers := []graphs.Initializer{
+		precomputation.InitGenerateGraph,
+		precomputation.InitDecryptGraph,
+		precomputation.InitPermuteGraph,
+		precomputation.InitRevealGraph,
+		precomputation.InitStripGraph,
+		realtime.InitDecryptGraph,
+		realtime.InitPermuteGraph,
+		realtime.InitIdentifyGraph,
+	}
+
+	byName := make(map[string]graphs.Initializer, len(initializers))
+	for _, initialize := range initializers {
+		byName[initialize(gc).GetName()] = initialize
+	}
+	return byName
+}
+
+// ReplayRecording rebuilds the graph with the given initializer and runs the
+// recorded inputs through it. Returns the output of the graph for every slot
+// of the batch, indexed by slot.
+//
+// The graph is linked to a synthetic round buffer of the recorded size whose
+// keys are all one and whose permutation is the identity, so the output only
+// depends on the inputs. The node secrets are not available to realtime
+// decrypt, so only the keys of precanned users are found.
+func ReplayRecording(gc services.GraphGenerator, rec *phase.Recording,
+	initialize graphs.Initializer) ([]*mixmessages.Slot, error) {
+	grp := rec.Group
+
+	g := initialize(gc)
+	errs := make(chan error, 1)
+	err := g.Build(rec.BatchSize, func(graph, module string, err error) {
+		select {
+		case errs <- errors.WithMessagef(err, "Module %s of graph %s "+
+			"failed", module, graph):
+		default:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if g.GetExpandedBatchSize() > rec.ExpandedBatchSize {
+		return nil, errors.Errorf("Graph %s expands the batch to %d slots, "+
+			"more than the %d slots of the recorded round buffer",
+			g.GetName(), g.GetExpandedBatchSize(), rec.ExpandedBatchSize)
+	}
+
+	roundBuf := newReplayBuffer(grp, rec.BatchSize, rec.ExpandedBatchSize)
+	rngStreamGen := fastRNG.NewStreamGenerator(1, 1, csprng.NewSystemRNG)
+	var streamPool *gpumaths.StreamPool
+	if rec.Phase == phase.RealDecrypt {
+		store, err := storage.NewStorage("", "", "", "", "", "", true)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to create storage")
+		}
+		// Keygen only looks up the keys of precanned users once a node
+		// secret exists, so a blank secret stands in for the node's secrets
+		nodeSecrets := storage.NewNodeSecretManager()
+		err = nodeSecrets.UpsertSecret(0, make([]byte, storage.SecretSize))
+		if err != nil {
+			return nil, errors.WithMessage(err, "Failed to add node secret")
+		}
+		g.Link(grp, roundBuf, rngStreamGen, streamPool,
+			round.NewClientFailureReport(&id.ID{}, store), rec.RoundID,
+			nodeSecrets, storage.NewPrecanStore(true, grp))
+	} else {
+		g.Link(grp, roundBuf, rngStreamGen, streamPool)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	g.Run(ctx)
+	defer g.Kill(time.Second)
+
+	if uint32(len(rec.Inputs)) < rec.BatchSize {
+		jww.WARN.Printf("Recording of round %d has %d of %d slots, the "+
+			"graph will time out waiting for the rest", rec.RoundID,
+			len(rec.Inputs), rec.BatchSize)
+	}
+
+	stream := g.GetStream()
+	go func() {
+		for _, input := range rec.Inputs {
+			slot, err := input.GetSlot()
+			if err == nil {
+				err = stream.Input(input.Index, slot)
+			}
+			if err != nil {
+				select {
+				case errs <- errors.WithMessagef(err, "Failed to input "+
+					"slot %d", input.Index):
+				default:
+				}
+				return
+			}
+			g.Send(services.NewChunk(input.Index, input.Index+1), nil)
+		}
+	}()
+
+	output := make([]*mixmessages.Slot, rec.BatchSize)
+	done := make(chan struct{})
+	go func() {
+		for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+			for i := chunk.Begin(); i < chunk.End() && i < rec.BatchSize; i++ {
+				output[i] = stream.Output(i)
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return output, nil
+	case err = <-errs:
+		return nil, err
+	}
+}
+
+// newReplayBuffer returns a round buffer whose keys are all one and whose
+// permutation is the identity
+func newReplayBuffer(grp *cyclic.Group, batchSize,
+	expandedBatchSize uint32) *round.Buffer {
+	roundBuf := round.NewBuffer(grp, batchSize, expandedBatchSize)
+	grp.SetUint64(roundBuf.CypherPublicKey, 1)
+	grp.SetUint64(roundBuf.Z, 1)
+
+	// Strip reads the keys the last node stores during precomputation permute
+	roundBuf.InitLastNode()
+	for i := range roundBuf.PermutedPayloadAKeys {
+		roundBuf.PermutedPayloadAKeys[i] = grp.NewInt(1)
+		roundBuf.PermutedPayloadBKeys[i] = grp.NewInt(1)
+	}
+
+	return roundBuf
+}
@@ -0,0 +1,133 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package node
+
+import (
+	"bytes"
+	"gitlab.com/elixxir/comms/mixmessages"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/elixxir/server/internal/phase"
+	"gitlab.com/elixxir/server/services"
+	"gitlab.com/xx_network/crypto/large"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the initializers of every CPU graph of a round are returned
+func TestGetGraphInitializers(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+	initializers := GetGraphInitializers(gc)
+
+	expected := make(map[string]bool)
+	for _, isLastNode := range []bool{false, true} {
+		for _, g := range NewRoundGraphs(gc, isLastNode, false) {
+			expected[g.GetName()] = true
+		}
+	}
+
+	if len(initializers) != len(expected) {
+		t.Errorf("Unexpected number of initializers."+
+			"\n\tExpected: %d\n\tReceived: %d", len(expected), len(initializers))
+	}
+	for name := range expected {
+		initialize, ok := initializers[name]
+		if !ok {
+			t.Errorf("No initializer for graph %s", name)
+		} else if g := initialize(gc); g.GetName() != name {
+			t.Errorf("Initializer for graph %s creates graph %s", name,
+				g.GetName())
+		}
+	}
+}
+
+// Happy path: inputs recorded from realtime permute are replayed through the
+// graph and, with keys of one and the identity permutation, output unchanged
+func TestReplayRecording(t *testing.T) {
+	primeString := "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+		"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+		"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+	grp := cyclic.NewGroup(large.NewIntFromString(primeString, 16),
+		large.NewInt(2))
+
+	batchSize := uint32(8)
+	path := filepath.Join(t.TempDir(), "round-5-RealPermute.jsonl")
+	recorder := phase.NewRecorder(path, phase.RecordingHeader{
+		RoundID:           5,
+		Phase:             phase.RealPermute,
+		Graph:             "RealtimePermute",
+		BatchSize:         batchSize,
+		ExpandedBatchSize: batchSize,
+		Group:             grp,
+	}, phase.RecordingLimits{})
+
+	// Slots are recorded out of order, as when streamed
+	inputs := make([]*mixmessages.Slot, batchSize)
+	for i := batchSize; i > 0; i-- {
+		index := i - 1
+		inputs[index] = &mixmessages.Slot{
+			Index:    index,
+			PayloadA: grp.NewInt(int64(100 + index)).Bytes(),
+			PayloadB: grp.NewInt(int64(200 + index)).Bytes(),
+		}
+		recorder.Record(index, inputs[index])
+	}
+	recorder.Close()
+	if err := recorder.Wait(); err != nil {
+		t.Fatalf("Wait returned an error: %+v", err)
+	}
+
+	rec, err := phase.LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording returned an error: %+v", err)
+	}
+
+	gc := services.MustNewGraphGenerator(4, 2, services.AutoOutputSize, 1.0)
+	initialize := GetGraphInitializers(gc)[rec.Graph]
+
+	for run := 0; run < 2; run++ {
+		output, err := ReplayRecording(gc, rec, initialize)
+		if err != nil {
+			t.Fatalf("ReplayRecording returned an error: %+v", err)
+		}
+
+		for i, slot := range output {
+			if slot == nil || !bytes.Equal(slot.PayloadA, inputs[i].PayloadA) ||
+				!bytes.Equal(slot.PayloadB, inputs[i].PayloadB) {
+				t.Errorf("Unexpected output for slot %d on run %d."+
+					"\n\tExpected: %v\n\tReceived: %v", i, run, inputs[i], slot)
+			}
+		}
+	}
+}
+
+// Error path: a graph which expands the batch beyond the recorded round buffer
+// cannot be replayed
+func TestReplayRecording_BufferTooSmall(t *testing.T) {
+	grp := cyclic.NewGroup(large.NewInt(107), large.NewInt(2))
+	rec := &phase.Recording{RecordingHeader: phase.RecordingHeader{
+		Phase:             phase.RealPermute,
+		BatchSize:         5,
+		ExpandedBatchSize: 5,
+		Group:             grp,
+	}}
+
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+	_, err := ReplayRecording(gc, rec, GetGraphInitializers(gc)["RealtimePermute"])
+	if err == nil {
+		t.Errorf("ReplayRecording did not error on a round buffer smaller " +
+			"than the expanded batch")
+	}
+}
@@ -8,6 +8,8 @@
 package node
 
 import (
+	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	"gitlab.com/elixxir/gpumathsgo"
 	"gitlab.com/elixxir/server/graphs/precomputation"
@@ -18,16 +20,23 @@ import (
 	"gitlab.com/elixxir/server/services"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/id"
+	"path/filepath"
 	"time"
 )
 
 // round.go creates the components for a round
 
-// NewRoundComponents sets up the transitions of different phases in the round
+// NewRoundComponents sets up the transitions of different phases in the round.
+// In devMode, graphs with a configured graph definition are built from the
+// definition instead. Graphs built for the batch size are taken from the
+// instance's graph pool where available, the rest are built here. Returns an
+// error if a graph cannot be built for the batch size. The inputs of phases
+// recorded by the instance are recorded for replay.
 func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 	nodeID *id.ID, instance *internal.Instance,
 	newRoundTimeout time.Duration, pool *gpumaths.StreamPool,
-	disableStreaming bool, roundID id.Round) ([]phase.Phase, phase.ResponseMap) {
+	disableStreaming bool, roundID id.Round,
+	batchSize uint32) ([]phase.Phase, phase.ResponseMap, error) {
 
 	responses := make(phase.ResponseMap)
 
@@ -39,11 +48,19 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 	// Used to determine usage of GPU maths in certain phases
 	useGPU := instance.GetDefinition().UseGPU
 
+	graphs, err := newRoundGraphs(gc, instance, roundID, batchSize,
+		topology.IsLastNode(nodeID), pool != nil && useGPU)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recorders := newPhaseRecorders(instance, roundID, graphs, batchSize)
+
 	/*--PRECOMP GENERATE------------------------------------------------------*/
 
 	//Build Precomputation Generation phase and response
 	precompGenerateDefinition := phase.Definition{
-		Graph:               precomputation.InitGenerateGraph(gc),
+		Graph:               graphs[phase.PrecompGeneration],
 		Type:                phase.PrecompGeneration,
 		TransmissionHandler: io.TransmitPhase,
 		Timeout:             newRoundTimeout,
@@ -115,11 +132,8 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		Type:                phase.PrecompDecrypt,
 		TransmissionHandler: transmissionHandler,
 		Timeout:             newRoundTimeout,
-	}
-	if pool != nil && useGPU {
-		precompDecryptDefinition.Graph = precomputation.InitDecryptGPUGraph(gc)
-	} else {
-		precompDecryptDefinition.Graph = precomputation.InitDecryptGraph(gc)
+		Graph:               graphs[phase.PrecompDecrypt],
+		Recorder:            recorders[phase.PrecompDecrypt],
 	}
 
 	// Every node except the first node handles precomp decrypt in the normal
@@ -153,11 +167,8 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		Type:                phase.PrecompPermute,
 		TransmissionHandler: transmissionHandler,
 		Timeout:             newRoundTimeout,
-	}
-	if pool != nil && useGPU {
-		precompPermuteDefinition.Graph = precomputation.InitPermuteGPUGraph(gc)
-	} else {
-		precompPermuteDefinition.Graph = precomputation.InitPermuteGraph(gc)
+		Graph:               graphs[phase.PrecompPermute],
+		Recorder:            recorders[phase.PrecompPermute],
 	}
 
 	// Every node except the first node handles precomp permute in the normal
@@ -192,11 +203,8 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		TransmissionHandler: transmissionHandler,
 		Timeout:             newRoundTimeout,
 		DoVerification:      true,
-	}
-	if pool != nil && useGPU {
-		precompRevealDefinition.Graph = precomputation.InitRevealGPUGraph(gc)
-	} else {
-		precompRevealDefinition.Graph = precomputation.InitRevealGraph(gc)
+		Graph:               graphs[phase.PrecompReveal],
+		Recorder:            recorders[phase.PrecompReveal],
 	}
 
 	// Every node except the first node handles precomp permute in the normal
@@ -219,13 +227,6 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 
 	if topology.IsLastNode(nodeID) {
 		precompRevealDefinition.TransmissionHandler = io.TransmitPrecompResult
-		// Last node also computes the strip operation along with reveal, so its
-		// graph is replaced with the composed reveal-strip graph
-		if pool != nil && useGPU {
-			precompRevealDefinition.Graph = precomputation.InitStripGPUGraph(gc)
-		} else {
-			precompRevealDefinition.Graph = precomputation.InitStripGraph(gc)
-		}
 	}
 
 	//All nodes process the verification step
@@ -246,11 +247,8 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		Type:                phase.RealDecrypt,
 		TransmissionHandler: transmissionHandler,
 		Timeout:             newRoundTimeout,
-	}
-	if pool != nil && useGPU {
-		realtimeDecryptDefinition.Graph = realtime.InitDecryptGPUGraph(gc)
-	} else {
-		realtimeDecryptDefinition.Graph = realtime.InitDecryptGraph(gc)
+		Graph:               graphs[phase.RealDecrypt],
+		Recorder:            recorders[phase.RealDecrypt],
 	}
 
 	decryptResponse := phase.ResponseDefinition{
@@ -281,11 +279,8 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		TransmissionHandler: transmissionHandler,
 		Timeout:             newRoundTimeout,
 		DoVerification:      true,
-	}
-	if pool != nil && useGPU {
-		realtimePermuteDefinition.Graph = realtime.InitPermuteGPUGraph(gc)
-	} else {
-		realtimePermuteDefinition.Graph = realtime.InitPermuteGraph(gc)
+		Graph:               graphs[phase.RealPermute],
+		Recorder:            recorders[phase.RealPermute],
 	}
 
 	//A permute message is never received by first node
@@ -305,15 +300,9 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 			// finish realtime needs access to lastNode to send out the results,
 			// an anonymous function is used to wrap the function, passing
 			// access while maintaining the transmit signature
-			func(roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
-				return io.TransmitFinishRealtime(roundID, instance, getChunk, getMessage)
+			func(ctx context.Context, roundID id.Round, instance phase.GenericInstance, getChunk phase.GetChunk, getMessage phase.GetMessage) error {
+				return io.TransmitFinishRealtime(ctx, roundID, instance, getChunk, getMessage)
 			}
-		//Last node also executes the combined permute-identify graph
-		if pool != nil && useGPU {
-			realtimePermuteDefinition.Graph = realtime.InitIdentifyGPUGraph(gc)
-		} else {
-			realtimePermuteDefinition.Graph = realtime.InitIdentifyGraph(gc)
-		}
 	}
 
 	//All nodes process the verification step
@@ -336,5 +325,159 @@ func NewRoundComponents(gc services.GraphGenerator, topology *connect.Circuit,
 		phase.New(realtimePermuteDefinition),
 	}
 
-	return phases, responses
+	return phases, responses, nil
+}
+
+// newPhaseRecorders returns a Recorder for each phase of the round recorded by
+// the instance, each writing to its own file in the recording directory.
+// Phases are only recorded in devMode.
+func newPhaseRecorders(instance *internal.Instance, roundID id.Round,
+	graphs map[phase.Type]*services.Graph,
+	batchSize uint32) map[phase.Type]*phase.Recorder {
+	def := instance.GetDefinition()
+	if !def.DevMode || def.RecordingPath == "" {
+		return nil
+	}
+
+	// The round buffer is sized for the largest expanded batch size of the
+	// graphs, as done by round.New
+	expandedBatchSize := batchSize
+	for _, g := range graphs {
+		if g.GetExpandedBatchSize() > expandedBatchSize {
+			expandedBatchSize = g.GetExpandedBatchSize()
+		}
+	}
+
+	recorders := make(map[phase.Type]*phase.Recorder, len(def.RecordedPhases))
+	for _, p := range def.RecordedPhases {
+		g, ok := graphs[p]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(def.RecordingPath,
+			fmt.Sprintf("round-%d-%s.jsonl", roundID, p))
+		recorders[p] = phase.NewRecorder(path, phase.RecordingHeader{
+			RoundID:           roundID,
+			Phase:             p,
+			Graph:             g.GetName(),
+			BatchSize:         batchSize,
+			ExpandedBatchSize: expandedBatchSize,
+			Group:             instance.GetNetworkStatus().GetCmixGroup(),
+		}, def.RecordingLimits)
+	}
+	return recorders
+}
+
+// roundGraph is the name of a graph executed by a phase of a round and the
+// function which initializes it
+type roundGraph struct {
+	name string
+	init func(gc services.GraphGenerator) *services.Graph
+}
+
+// roundGraphInitializers returns the graph executed by each phase of a round,
+// keyed by phase. Phases without a graph are omitted. The last node computes
+// the strip operation along with reveal and identifies recipients along with
+// permute, so it executes the composed reveal-strip and permute-identify
+// graphs.
+func roundGraphInitializers(isLastNode, useGPU bool) map[phase.Type]roundGraph {
+	graphs := map[phase.Type]roundGraph{
+		phase.PrecompGeneration: {precomputation.GenerateGraphName,
+			precomputation.InitGenerateGraph},
+	}
+
+	if useGPU {
+		graphs[phase.PrecompDecrypt] = roundGraph{
+			precomputation.DecryptGPUGraphName,
+			precomputation.InitDecryptGPUGraph}
+		graphs[phase.PrecompPermute] = roundGraph{
+			precomputation.PermuteGPUGraphName,
+			precomputation.InitPermuteGPUGraph}
+		graphs[phase.RealDecrypt] = roundGraph{
+			realtime.DecryptGPUGraphName, realtime.InitDecryptGPUGraph}
+		if isLastNode {
+			graphs[phase.PrecompReveal] = roundGraph{
+				precomputation.StripGPUGraphName,
+				precomputation.InitStripGPUGraph}
+			graphs[phase.RealPermute] = roundGraph{
+				realtime.IdentifyGPUGraphName, realtime.InitIdentifyGPUGraph}
+		} else {
+			graphs[phase.PrecompReveal] = roundGraph{
+				precomputation.RevealGPUGraphName,
+				precomputation.InitRevealGPUGraph}
+			graphs[phase.RealPermute] = roundGraph{
+				realtime.PermuteGPUGraphName, realtime.InitPermuteGPUGraph}
+		}
+	} else {
+		graphs[phase.PrecompDecrypt] = roundGraph{
+			precomputation.DecryptGraphName, precomputation.InitDecryptGraph}
+		graphs[phase.PrecompPermute] = roundGraph{
+			precomputation.PermuteGraphName, precomputation.InitPermuteGraph}
+		graphs[phase.RealDecrypt] = roundGraph{
+			realtime.DecryptGraphName, realtime.InitDecryptGraph}
+		if isLastNode {
+			graphs[phase.PrecompReveal] = roundGraph{
+				precomputation.StripGraphName, precomputation.InitStripGraph}
+			graphs[phase.RealPermute] = roundGraph{
+				realtime.IdentifyGraphName, realtime.InitIdentifyGraph}
+		} else {
+			graphs[phase.PrecompReveal] = roundGraph{
+				precomputation.RevealGraphName, precomputation.InitRevealGraph}
+			graphs[phase.RealPermute] = roundGraph{
+				realtime.PermuteGraphName, realtime.InitPermuteGraph}
+		}
+	}
+
+	return graphs
+}
+
+// NewRoundGraphs initializes the graph executed by each phase of a round,
+// keyed by phase. Phases without a graph are omitted.
+func NewRoundGraphs(gc services.GraphGenerator, isLastNode,
+	useGPU bool) map[phase.Type]*services.Graph {
+	initializers := roundGraphInitializers(isLastNode, useGPU)
+	graphs := make(map[phase.Type]*services.Graph, len(initializers))
+	for p, rg := range initializers {
+		graphs[p] = rg.init(gc)
+	}
+	return graphs
+}
+
+// newRoundGraphs returns the built graph executed by each phase of the round,
+// keyed by phase. Graphs are taken from the instance's graph pool where
+// available; only the rest are initialized and built for the batch size. In
+// devMode, initialized graphs with a configured graph definition are built
+// from the definition instead.
+func newRoundGraphs(gc services.GraphGenerator, instance *internal.Instance,
+	roundID id.Round, batchSize uint32, isLastNode,
+	useGPU bool) (map[phase.Type]*services.Graph, error) {
+	initializers := roundGraphInitializers(isLastNode, useGPU)
+	graphs := make(map[phase.Type]*services.Graph, len(initializers))
+	unpooled := make(map[phase.Type]*services.Graph)
+	for p, rg := range initializers {
+		if pooled := instance.GetGraphPool().Get(rg.name, batchSize); pooled != nil {
+			graphs[p] = pooled
+			continue
+		}
+		unpooled[p] = rg.init(gc)
+	}
+
+	if def := instance.GetDefinition(); def.DevMode && len(def.GraphDefinitions) > 0 {
+		err := ReplaceRoundGraphs(unpooled, gc, NewGraphRegistry(),
+			def.GraphDefinitions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for p, g := range unpooled {
+		err := g.Build(batchSize, GetDefaultPanicHandler(instance, roundID))
+		if err != nil {
+			return nil, errors.WithMessagef(err,
+				"Failed to build graph for phase %s", p)
+		}
+		graphs[p] = g
+	}
+
+	return graphs, nil
 }
@@ -8,6 +8,8 @@
 package node
 
 import (
+	"errors"
+	"gitlab.com/elixxir/server/internal/phase"
 	"gitlab.com/elixxir/server/services"
 	"gitlab.com/xx_network/comms/connect"
 	"gitlab.com/xx_network/primitives/id"
@@ -17,10 +19,71 @@ import (
 
 const expectedNumPhases = 7
 
+// Tests that NewRoundGraphs selects the composed graphs on the last node and
+// the GPU variants when requested
+func TestNewRoundGraphs(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+
+	tests := []struct {
+		isLastNode, useGPU bool
+		expected           map[phase.Type]string
+	}{
+		{false, false, map[phase.Type]string{
+			phase.PrecompGeneration: "PrecompGenerate",
+			phase.PrecompDecrypt:    "PrecompDecrypt",
+			phase.PrecompPermute:    "PrecompPermute",
+			phase.PrecompReveal:     "PrecompReveal",
+			phase.RealDecrypt:       "RealtimeDecrypt",
+			phase.RealPermute:       "RealtimePermute",
+		}},
+		{true, true, map[phase.Type]string{
+			phase.PrecompGeneration: "PrecompGenerate",
+			phase.PrecompDecrypt:    "PrecompDecryptGPU",
+			phase.PrecompPermute:    "PrecompPermuteGPU",
+			phase.PrecompReveal:     "PrecompStripGPU",
+			phase.RealDecrypt:       "RealtimeDecryptGPU",
+			phase.RealPermute:       "RealtimeIdentifyGPU",
+		}},
+	}
+
+	for i, tt := range tests {
+		graphs := NewRoundGraphs(gc, tt.isLastNode, tt.useGPU)
+		if len(graphs) != len(tt.expected) {
+			t.Errorf("Unexpected number of graphs (%d)."+
+				"\n\tExpected: %d\n\tReceived: %d", i, len(tt.expected),
+				len(graphs))
+		}
+		for p, name := range tt.expected {
+			if g, ok := graphs[p]; !ok || g.GetName() != name {
+				t.Errorf("Unexpected graph for %s (%d).\n\tExpected: %s"+
+					"\n\tReceived: %v", p, i, name, g)
+			}
+		}
+	}
+}
+
+// Tests that the name each graph is looked up by in the graph pool is the
+// name of the graph its initializer creates
+func TestRoundGraphInitializers_Names(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1, services.AutoOutputSize, 1.0)
+
+	for _, isLastNode := range []bool{false, true} {
+		for _, useGPU := range []bool{false, true} {
+			for p, rg := range roundGraphInitializers(isLastNode, useGPU) {
+				if name := rg.init(gc).GetName(); name != rg.name {
+					t.Errorf("Unexpected graph name for %s (isLastNode %t, "+
+						"useGPU %t).\n\tExpected: %s\n\tReceived: %s", p,
+						isLastNode, useGPU, rg.name, name)
+				}
+			}
+		}
+	}
+}
+
 func TestNewRoundComponents_FirstNode(t *testing.T) {
 	expectedFirstNodeResponses := 7
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -30,7 +93,10 @@ func TestNewRoundComponents_FirstNode(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -46,10 +112,29 @@ func TestNewRoundComponents_FirstNode(t *testing.T) {
 
 }
 
+// Error path: NewRoundComponents returns the error from building the graphs
+// instead of panicking when the batch size is invalid
+func TestNewRoundComponents_InvalidBatchSize(t *testing.T) {
+	gc := services.MustNewGraphGenerator(4, 1,
+		services.AutoOutputSize, 1.0)
+
+	topology := buildMockTopology(3, t)
+
+	nodeID := topology.GetNodeAtIndex(0)
+
+	instance, _, _, _, _, _, _ := createServerInstance(t)
+
+	_, _, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0, 0)
+	if !errors.Is(err, services.ErrInvalidBatchSize) {
+		t.Errorf("NewRoundComponents returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", services.ErrInvalidBatchSize, err)
+	}
+}
+
 func TestNewRoundComponents_MiddleNode(t *testing.T) {
 	expectedMiddleNodeResponses := 9
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -59,7 +144,10 @@ func TestNewRoundComponents_MiddleNode(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -77,7 +165,7 @@ func TestNewRoundComponents_MiddleNode(t *testing.T) {
 func TestNewRoundComponents_LastNode(t *testing.T) {
 	expectedLastNodeResponses := 9
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -87,7 +175,10 @@ func TestNewRoundComponents_LastNode(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, false, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -105,7 +196,7 @@ func TestNewRoundComponents_LastNode(t *testing.T) {
 func TestNewRoundComponents_FirstNode_Streaming(t *testing.T) {
 	expectedFirstNodeResponses := 7
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -115,7 +206,10 @@ func TestNewRoundComponents_FirstNode_Streaming(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -134,7 +228,7 @@ func TestNewRoundComponents_FirstNode_Streaming(t *testing.T) {
 func TestNewRoundComponents_MiddleNode_Streaming(t *testing.T) {
 	expectedMiddleNodeResponses := 9
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -144,7 +238,10 @@ func TestNewRoundComponents_MiddleNode_Streaming(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -162,7 +259,7 @@ func TestNewRoundComponents_MiddleNode_Streaming(t *testing.T) {
 func TestNewRoundComponents_LastNode_Streaming(t *testing.T) {
 	expectedLastNodeResponses := 9
 
-	gc := services.NewGraphGenerator(4, 1,
+	gc := services.MustNewGraphGenerator(4, 1,
 		services.AutoOutputSize, 1.0)
 
 	topology := buildMockTopology(3, t)
@@ -172,7 +269,10 @@ func TestNewRoundComponents_LastNode_Streaming(t *testing.T) {
 	// Dummy instance to prevent segfault
 	instance, _, _, _, _, _, _ := createServerInstance(t)
 
-	phases, responses := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0)
+	phases, responses, err := NewRoundComponents(gc, topology, nodeID, instance, 2*time.Second, nil, true, 0, 32)
+	if err != nil {
+		t.Fatalf("NewRoundComponents returned an error: %+v", err)
+	}
 
 	if len(phases) != expectedNumPhases {
 		t.Errorf("NewRoundComponents: incorrect number for phases for "+
@@ -187,17 +187,19 @@ func PollPermissioning(permHost *connect.Host, instance *internal.Instance,
 		lastUpdateId = 0
 	}
 
+	// Report every unacknowledged client error once a round completes,
+	// including those of earlier rounds whose reports were not received
 	var clientReport []*pb.ClientError
+	var clientErrorIds []uint64
 	var err error
-	latestRound := instance.GetRoundManager().GetCurrentRound()
 	if reportedActivity == current.COMPLETED {
-		clientReport, err = instance.GetClientReport().Receive(latestRound)
+		clientReport, clientErrorIds, err = instance.GetClientReport().Receive()
 		if err != nil {
 			jww.ERROR.Printf("Unable to receive client report: %+v", err)
 		}
 		if len(clientReport) > 0 {
-			jww.WARN.Printf("Client error reports found for"+
-				" round %v: %d reports found", latestRound, len(clientReport))
+			jww.WARN.Printf("Client error reports found: %d reports found",
+				len(clientReport))
 		}
 
 	}
@@ -254,6 +256,15 @@ func PollPermissioning(permHost *connect.Host, instance *internal.Instance,
 		return nil, errors.Errorf("Unable to send %s: %+v", sender.Name, err)
 	}
 
+	// Client errors have been received, so they no longer need to be resent
+	if len(clientErrorIds) > 0 {
+		ackErr := instance.GetClientReport().Acknowledge(clientErrorIds)
+		if ackErr != nil {
+			jww.ERROR.Printf("Unable to clear %d reported client errors: %+v",
+				len(clientErrorIds), ackErr)
+		}
+	}
+
 	// Process response
 	permissioningResponse := face.(*pb.PermissionPollResponse)
 	return permissioningResponse, err
@@ -336,6 +347,17 @@ func UpdateRounds(permissioningResponse *pb.PermissionPollResponse, instance *in
 						roundInfo.ID, err)
 				}
 
+				// Refuse the round if the node cannot currently complete it
+				err = instance.GetStateMachine().CheckHealth()
+				if err != nil {
+					roundErr := errors.Errorf("Refusing to precompute round %v: %+v",
+						roundInfo.ID, err)
+					jww.WARN.Printf("%+v", roundErr)
+					instance.ReportRoundFailure(roundErr, instance.GetID(),
+						id.Round(roundInfo.ID))
+					continue
+				}
+
 				// Send info to round queue
 				err = instance.GetCreateRoundQueue().Send(roundInfo)
 				if err != nil {
@@ -10,6 +10,7 @@ package permissioning
 import (
 	"bytes"
 	crand "crypto/rand"
+	"errors"
 	"fmt"
 	"gitlab.com/elixxir/crypto/fastRNG"
 	"gitlab.com/xx_network/crypto/csprng"
@@ -988,3 +989,64 @@ func TestUpdateRounds_Failed(t *testing.T) {
 		t.Errorf("UpdateRounds failed: %+v", err)
 	}
 }
+
+// Tests that a node which is unhealthy refuses a round it is assigned, reporting
+// a failure for the round rather than precomputing it
+func TestUpdateRounds_Unhealthy(t *testing.T) {
+	instance, _, _, _, _, key, err := createServerInstance(t)
+	if err != nil {
+		t.Fatalf("Couldn't create instance: %+v", err)
+	}
+	instance.IsFirstRun()
+	instance.GetStateMachine().SetHealthCheck(func() error {
+		return errors.New("database unavailable")
+	})
+
+	timestamps := make([]uint64, states.NUM_STATES)
+	timestamps[states.PRECOMPUTING] = uint64(time.Now().UnixNano())
+	precompRoundInfo := &pb.RoundInfo{
+		ID:       1,
+		UpdateID: 0,
+		State:    uint32(states.PRECOMPUTING),
+		Topology: [][]byte{id.NewIdFromUInt(0, id.Node, t).Marshal(),
+			id.NewIdFromUInt(1, id.Node, t).Marshal()},
+		Timestamps: timestamps,
+	}
+	err = signRoundInfo(precompRoundInfo, key)
+	if err != nil {
+		t.Fatalf("Failed to sign precomp round info: %+v", err)
+	}
+	fullNdf, err := setupFullNdf(key)
+	if err != nil {
+		t.Fatalf("Failed to setup full ndf: %+v", err)
+	}
+	stripNdf, err := setupPartialNdf(key)
+	if err != nil {
+		t.Fatalf("Failed to setup partial ndf: %+v", err)
+	}
+
+	mockPollResponse := &pb.PermissionPollResponse{
+		FullNDF:    fullNdf,
+		PartialNDF: stripNdf,
+		Updates:    []*pb.RoundInfo{precompRoundInfo},
+	}
+	err = UpdateNDf(mockPollResponse, instance)
+	if err != nil {
+		t.Fatalf("Failed to update ndf: %+v", err)
+	}
+	err = UpdateRounds(mockPollResponse, instance)
+	if err != nil {
+		t.Errorf("UpdateRounds failed: %+v", err)
+	}
+
+	if instance.GetStateMachine().Get() != current.ERROR {
+		t.Errorf("Unexpected state after refusing a round."+
+			"\n\tExpected: %s\n\tReceived: %s", current.ERROR,
+			instance.GetStateMachine().Get())
+	}
+	roundErr := instance.GetRoundError()
+	if roundErr == nil || roundErr.Id != precompRoundInfo.ID ||
+		!bytes.Contains([]byte(roundErr.Error), []byte("database unavailable")) {
+		t.Errorf("Unexpected round error for refused round: %+v", roundErr)
+	}
+}
@@ -46,6 +46,20 @@ type assignmentList struct {
 	waiting []Chunk
 }
 
+// reset clears the progress of every assignment so that the list can be
+// used for another batch of the same size
+func (al *assignmentList) reset() {
+	for _, a := range al.assignments {
+		atomic.StoreUint32(a.count, 0)
+	}
+	atomic.StoreUint32(al.waitingIndex, 0)
+	atomic.StoreUint32(al.waitingAdded, 0)
+	atomic.StoreUint32(al.completed, 0)
+	for i := range al.waiting {
+		al.waiting[i] = Chunk{}
+	}
+}
+
 // newAssignment creates an assignment
 func newAssignment(start uint32) *assignment {
 	var count uint32
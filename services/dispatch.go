@@ -11,7 +11,8 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
-	"strings"
+	"gitlab.com/elixxir/server/internal/measure"
+	"sort"
 	"time"
 )
 
@@ -19,86 +20,61 @@ var (
 	InvalidTypeAssert = errors.New("type assert failed")
 	InvalidMAC        = "User could not be validated"
 	SecretNotFound    = "Could not find secret"
-	timeoutDuration   = 2 * time.Minute
 )
 
-// AdaptMeasureName is the name used to measure how long the adapt function
-// takes in dispatch.
-const AdaptMeasureName = "Adapt"
+// ModuleTimeoutError is passed to the ErrorCallback of a graph when a thread
+// of one of its modules receives no input within the module's timeout
+type ModuleTimeoutError struct {
+	Graph    string
+	Module   string
+	ThreadID uint64
+	Timeout  time.Duration
+}
 
-// OutModsMeasureName is the name used to measure how long the outputModules
-// processing loop takes in the dispatch function.
-const OutModsMeasureName = "Mod"
+func (e *ModuleTimeoutError) Error() string {
+	return fmt.Sprintf("thread %d of module %s in graph %s received no "+
+		"input within %s", e.ThreadID, e.Module, e.Graph, e.Timeout)
+}
 
-// dispatch runs a Module while taking measurements for the Graph
+// dispatch runs a Module while recording the timings of the thread in mm
 // and forwards the output of this Module to its output Modules
-func dispatch(g *Graph, m *Module, threadID uint64) {
-	s := g.stream
-
-	// We measure the adapt function and the mod
-	atID := fmt.Sprintf("%s%d", AdaptMeasureName, threadID)
-	omID := fmt.Sprintf("%s%d", OutModsMeasureName, threadID)
-
+func dispatch(g *Graph, m *Module, threadID uint64, mm *measure.ModuleMetrics) {
 	var chunk Chunk
 	var ok bool
-	timeout := time.NewTimer(timeoutDuration)
+	timeout := time.NewTimer(m.Timeout)
+	defer timeout.Stop()
+	waitStart := time.Now()
 	keepLooping := true
 	for keepLooping {
 		select {
+		case <-g.killed:
+			keepLooping = false
+			jww.DEBUG.Printf("Graph %v in module %v killed thread %v", g.GetName(), m.Name, threadID)
 		// Time out that channel read in the loop to prevent it getting stuck
 		case <-timeout.C:
 			keepLooping = false
+			err := &ModuleTimeoutError{
+				Graph:    g.GetName(),
+				Module:   m.Name,
+				ThreadID: threadID,
+				Timeout:  m.Timeout,
+			}
 			jww.WARN.Printf("Graph %v in module %v timed out thread %v", g.GetName(), m.Name, threadID)
+			g.reportTimeout(err)
 		case chunk, ok = <-m.input:
 			if ok {
-				g.Lock()
-				g.metrics.Measure(atID)
-				g.Unlock()
-				// Run the Module for each chunk
-				err := m.Adapt(s, m.Cryptop, chunk)
-				g.Lock()
-				g.metrics.Measure(atID)
-				g.Unlock()
-
-				if err != nil {
-					go g.errorHandler(g.name, m.Name, err)
-				}
-
-				g.Lock()
-				g.metrics.Measure(omID)
-				g.Unlock()
-				for _, om := range m.outputModules {
-					chunkList, err := om.assignmentList.PrimeOutputs(chunk)
-					if err != nil {
-						go g.errorHandler(g.name, m.Name, err)
-						g.Lock()
-						g.metrics.Measure(omID)
-						g.Unlock()
-						return
-					}
-
-					// Send output chunks of this Module to inputs of the output Modules
-					for _, r := range chunkList {
-						om.input <- r
-					}
-
-					fin, err := om.assignmentList.DenoteCompleted(len(chunkList))
-
-					if err != nil {
-						go g.errorHandler(g.name, m.Name, err)
-						g.Lock()
-						g.metrics.Measure(omID)
-						g.Unlock()
-						return
-					}
-					if fin {
-						om.closeInput()
+				// Stop the timeout while the chunk runs and drain a tick
+				// that fired before the chunk arrived, so that only the
+				// wait for the next chunk can time out the thread
+				if !timeout.Stop() {
+					select {
+					case <-timeout.C:
+					default:
 					}
 				}
-				g.Lock()
-				g.metrics.Measure(omID)
-				g.Unlock()
-				timeout.Reset(timeoutDuration)
+				// Run the Module for each chunk
+				keepLooping, waitStart = runChunk(g, m, chunk, mm, waitStart)
+				timeout.Reset(m.Timeout)
 			} else {
 				// normal loop exit
 				keepLooping = false
@@ -107,47 +83,106 @@ func dispatch(g *Graph, m *Module, threadID uint64) {
 	}
 }
 
-// GetMetrics aggregates all the dispatch metrics and returns the total time
-// spent inside the adapt function and inside the output modules processing loop
-func (g *Graph) GetMetrics() (time.Duration, time.Duration) {
-	// Get every event and generate the time deltas
+// reportTimeout passes the first module timeout of the run to the error
+// handler. The first timeout fails the round, so later ones, which every
+// other idle thread also hits, are only logged.
+func (g *Graph) reportTimeout(err *ModuleTimeoutError) {
+	g.timeoutOnce.Do(func() {
+		if g.errorHandler != nil {
+			go g.errorHandler(g.name, err.Module, err)
+		}
+	})
+}
+
+// runChunk runs the Module on the chunk and forwards its output, adding the
+// time since waitStart and the time spent on the chunk to mm. Returns false if
+// the thread should stop, and the time at which the chunk was finished.
+func runChunk(g *Graph, m *Module, chunk Chunk, mm *measure.ModuleMetrics,
+	waitStart time.Time) (bool, time.Time) {
+	adaptStart := time.Now()
+	err := m.Adapt(g.stream, m.Cryptop, chunk)
+	outStart := time.Now()
+
+	if err != nil {
+		go g.errorHandler(g.name, m.Name, err)
+	}
+
+	keepLooping := forwardOutputs(g, m, chunk)
+	outEnd := time.Now()
+
 	g.Lock()
-	events := g.metrics.GetEvents()
+	mm.QueueWait.Add(adaptStart.Sub(waitStart))
+	mm.Adapt.Add(outStart.Sub(adaptStart))
+	mm.OutputPriming.Add(outEnd.Sub(outStart))
 	g.Unlock()
-	times := make(map[string]time.Time)
-	deltas := make(map[string]time.Duration)
-
-	// NOTE: Metrics are ordered, but interleaved with each other.
-	// The following unrolls that, so e.g.:
-	//   Metric1, Metric2, Metric1, Metric1, Metric2
-	// Gets converted to: Delta(Metric1, Metric1), Delta(Metric2, Metric2)
-	//                    Delta(Metric1, Metric1), ...
-	// and so on, orderd by matching tags in the list.
-	for _, e := range events {
-		lastTime, ok := times[e.Tag]
-		if ok { // lastTime condition
-			// If the tag exists, then we had a "previous" event
-			// of the same tag. Calculate the delta between
-			// this one and the last one.
-			deltas[e.Tag] = e.Timestamp.Sub(lastTime)
-			// Delete the tag, so we can detect the "startTime"
-			// condition.
-			delete(times, e.Tag)
-		} else { // startTime condition
-			times[e.Tag] = e.Timestamp
+
+	return keepLooping, outEnd
+}
+
+// forwardOutputs sends the output of this Module for the chunk to the inputs
+// of its output Modules. Returns false if the thread should stop.
+func forwardOutputs(g *Graph, m *Module, chunk Chunk) bool {
+	for _, om := range m.outputModules {
+		chunkList, err := om.assignmentList.PrimeOutputs(chunk)
+		if err != nil {
+			go g.errorHandler(g.name, m.Name, err)
+			return false
 		}
-	}
 
-	// Look at each delta and sum them by type. This collapses each
-	// thread's time spent into a single metric for that thread.
-	var modTime, adaptTime time.Duration
-	for k, v := range deltas {
-		if strings.Contains(k, AdaptMeasureName) {
-			adaptTime += v
+		// Send output chunks of this Module to inputs of the output Modules
+		for _, r := range chunkList {
+			select {
+			case om.input <- r:
+			case <-g.killed:
+				return false
+			}
 		}
-		if strings.Contains(k, OutModsMeasureName) {
-			modTime += v
+
+		fin, err := om.assignmentList.DenoteCompleted(len(chunkList))
+
+		if err != nil {
+			go g.errorHandler(g.name, m.Name, err)
+			return false
+		}
+		if fin {
+			om.closeInput()
 		}
 	}
+	return true
+}
+
+// GetMetrics aggregates the timings of every dispatch thread and returns the
+// total time spent inside the adapt function and inside the output modules
+// processing loop
+func (g *Graph) GetMetrics() (time.Duration, time.Duration) {
+	g.Lock()
+	defer g.Unlock()
+
+	var modTime, adaptTime time.Duration
+	for _, mm := range g.moduleMetrics {
+		adaptTime += mm.Adapt.Sum
+		modTime += mm.OutputPriming.Sum
+	}
 	return adaptTime, modTime
 }
+
+// GetModuleMetrics returns a copy of the timings of every dispatch thread,
+// ordered by module and thread
+func (g *Graph) GetModuleMetrics() []measure.ModuleMetrics {
+	g.Lock()
+	defer g.Unlock()
+
+	threadIDs := make([]uint64, 0, len(g.moduleMetrics))
+	for threadID := range g.moduleMetrics {
+		threadIDs = append(threadIDs, threadID)
+	}
+	sort.Slice(threadIDs, func(i, j int) bool {
+		return threadIDs[i] < threadIDs[j]
+	})
+
+	moduleMetrics := make([]measure.ModuleMetrics, len(threadIDs))
+	for i, threadID := range threadIDs {
+		moduleMetrics[i] = *g.moduleMetrics[threadID]
+	}
+	return moduleMetrics
+}
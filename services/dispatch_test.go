@@ -8,6 +8,8 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -15,9 +17,12 @@ import (
 	"gitlab.com/xx_network/crypto/large"
 	"math"
 	"math/rand"
+	"reflect"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 type RoundBuffer struct {
@@ -173,7 +178,7 @@ var ModuleD = Module{
 
 // TestGraphBacktrack checks error checking to see if a graph path goes back on itself
 func TestGraphBacktrack(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -190,7 +195,7 @@ func TestGraphBacktrack(t *testing.T) {
 	g.Last(moduleD)
 
 	visited := make([]uint64, 0)
-	err := g.checkDAG(moduleA, visited)
+	err := g.checkDAG(moduleA, visited, make(map[uint64]bool))
 	if !strings.HasSuffix(err.Error(), "was visited multiple times") {
 		t.Error("dagcheck returned no error for a vertex going back up the chain")
 	}
@@ -198,7 +203,7 @@ func TestGraphBacktrack(t *testing.T) {
 
 // TestGraphNoModules checks error happens when graph has no modules
 func TestGraphNoModules(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	err := g.checkGraph()
@@ -210,7 +215,7 @@ func TestGraphNoModules(t *testing.T) {
 // TestGraphNodeNoFirstModule checks an error is thrown when no first module is
 // specified
 func TestGraphNodeNoFirstModule(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -232,7 +237,7 @@ func TestGraphNodeNoFirstModule(t *testing.T) {
 // TestGraphNodeNoLastModule checks an error is thrown when no last module is
 // specified
 func TestGraphNodeNoLastModule(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -253,7 +258,7 @@ func TestGraphNodeNoLastModule(t *testing.T) {
 
 // TestGraphNodeNoOneModule checks that a correct graph with one node works
 func TestGraphNodeOneModule(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -269,7 +274,7 @@ func TestGraphNodeOneModule(t *testing.T) {
 
 // TestGraphNodeNoVisit checks error checking to see if all graph nodes are visited
 func TestGraphNodeNoVisit(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -283,8 +288,7 @@ func TestGraphNodeNoVisit(t *testing.T) {
 	g.Connect(moduleC, moduleD)
 	g.Last(moduleD)
 
-	visitedModules.mods = []uint64{1, 2, 3}
-	err := g.checkAllNodesUsed()
+	err := g.checkAllNodesUsed(map[uint64]bool{1: true, 2: true, 3: true})
 	if !strings.HasSuffix(err.Error(), " was not used in graph anywhere") {
 		t.Error("checkAllNodesUsed returned incorrectly that all vertexes have been used")
 	}
@@ -292,7 +296,7 @@ func TestGraphNodeNoVisit(t *testing.T) {
 
 // TestGraphNodeAllVisited checks that no error is reported when all graph nodes are visited
 func TestGraphNodeAllVisited(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -307,8 +311,8 @@ func TestGraphNodeAllVisited(t *testing.T) {
 	g.Connect(moduleC, moduleD)
 	g.Last(moduleD)
 
-	visitedModules.mods = []uint64{1, 2, 3, 4}
-	err := g.checkAllNodesUsed()
+	err := g.checkAllNodesUsed(
+		map[uint64]bool{1: true, 2: true, 3: true, 4: true})
 	if err != nil {
 		t.Error("checkAllNodesUsed returned incorrectly that all vertexes have *not* been used")
 	}
@@ -316,7 +320,7 @@ func TestGraphNodeAllVisited(t *testing.T) {
 
 // TestGraphWrongEndNode checks error checking to see if a graph path ends on a node other than g.Last
 func TestGraphWrongEndNode(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", &Stream1{})
 
 	moduleA := ModuleA.DeepCopy()
@@ -331,7 +335,7 @@ func TestGraphWrongEndNode(t *testing.T) {
 	g.Last(moduleD)
 
 	visited := make([]uint64, 0)
-	err := g.checkDAG(moduleA, visited)
+	err := g.checkDAG(moduleA, visited, make(map[uint64]bool))
 	if !strings.HasPrefix(err.Error(), "graph path ended at vertex ID") {
 		t.Error("dagcheck returned no error for a path ending on vertex other than Last")
 	}
@@ -348,7 +352,7 @@ func TestGraph(t *testing.T) {
 
 	batchSize := uint32(1000)
 
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 
 	g := gc.NewGraph("test", &Stream1{})
 
@@ -372,7 +376,7 @@ func TestGraph(t *testing.T) {
 
 	g.Link(grp, &roundBuf)
 
-	g.Run()
+	g.Run(context.Background())
 
 	go func(g *Graph) {
 
@@ -415,6 +419,158 @@ func TestGraph(t *testing.T) {
 	<-endCh
 }
 
+// Tests that a graph with two first modules feeds every slot to both branches
+// and that the module joining them waits on both before running
+func TestGraph_MultipleFirstModules(t *testing.T) {
+	grp := initDispatchGroup()
+
+	batchSize := uint32(1000)
+
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+
+	g := gc.NewGraph("test", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	moduleC := ModuleC.DeepCopy()
+	moduleD := ModuleD.DeepCopy()
+
+	// A and C are independent branches, joined by D
+	g.First(moduleA)
+	g.AddFirst(moduleC)
+	g.Connect(moduleA, moduleB)
+	g.Connect(moduleB, moduleD)
+	g.Connect(moduleC, moduleD)
+	g.Last(moduleD)
+
+	if err := g.Build(batchSize, PanicHandler); err != nil {
+		t.Fatalf("Build returned an error: %+v", err)
+	}
+
+	roundSize := uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize())))
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(roundSize)
+
+	g.Link(grp, &roundBuf)
+
+	g.Run(context.Background())
+
+	lastSlot := make(chan struct{})
+	go func(g *Graph) {
+		for i := uint32(0); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), func(tag string) { close(lastSlot) })
+		}
+	}(g)
+
+	stream := g.GetStream().(*Stream1)
+	received := uint32(0)
+	for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			E := (stream.A[i] + stream.B[i]) * stream.D[i]
+			H := int(math.Abs(float64(stream.F[i]*stream.G[i]))) % stream.Prime
+			if E-H != stream.I[i] {
+				t.Errorf("Streams not equal on slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, E-H, stream.I[i])
+			}
+		}
+		received += chunk.Len()
+	}
+
+	if received != batchSize {
+		t.Errorf("Unexpected number of slots output."+
+			"\n\tExpected: %d\n\tReceived: %d", batchSize, received)
+	}
+
+	select {
+	case <-lastSlot:
+	case <-time.After(time.Second):
+		t.Errorf("Receiving the last slot was not measured")
+	}
+}
+
+// Tests that a graph with two last modules only outputs a slot once both of
+// them have processed it
+func TestGraph_MultipleLastModules(t *testing.T) {
+	grp := initDispatchGroup()
+
+	batchSize := uint32(1000)
+
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+
+	g := gc.NewGraph("test", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	moduleC := ModuleC.DeepCopy()
+
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Connect(moduleA, moduleC)
+	g.Last(moduleB)
+	g.AddLast(moduleC)
+
+	if err := g.Build(batchSize, PanicHandler); err != nil {
+		t.Fatalf("Build returned an error: %+v", err)
+	}
+
+	roundSize := uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize())))
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(roundSize)
+
+	g.Link(grp, &roundBuf)
+
+	g.Run(context.Background())
+
+	go func(g *Graph) {
+		for i := uint32(0); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}(g)
+
+	stream := g.GetStream().(*Stream1)
+	received := uint32(0)
+	for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			E := (stream.A[i] + stream.B[i]) * stream.D[i]
+			if E != stream.E[i] {
+				t.Errorf("Output of module B not ready on slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, E, stream.E[i])
+			}
+			H := int(math.Abs(float64(stream.F[i]*stream.G[i]))) % stream.Prime
+			if H != stream.H[i] {
+				t.Errorf("Output of module C not ready on slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, H, stream.H[i])
+			}
+		}
+		received += chunk.Len()
+	}
+
+	if received != batchSize {
+		t.Errorf("Unexpected number of slots output."+
+			"\n\tExpected: %d\n\tReceived: %d", batchSize, received)
+	}
+}
+
+// Error path: a first module cannot also be fed by another module
+func TestGraph_FirstModuleWithInputs(t *testing.T) {
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	g := gc.NewGraph("test", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+
+	g.First(moduleA)
+	g.AddFirst(moduleB)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+
+	err := g.checkGraph()
+	if !errors.Is(err, ErrFirstModuleHasInputs) {
+		t.Errorf("checkGraph returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrFirstModuleHasInputs, err)
+	}
+}
+
 type AddPrototype func(X, Y int) int
 
 var Add AddPrototype = func(X, Y int) int {
@@ -489,3 +645,205 @@ func initDispatchGroup() *cyclic.Group {
 	grp := cyclic.NewGroup(large.NewIntFromString(primeString, 16), large.NewInt(2))
 	return grp
 }
+
+// Tests that a module thread which receives no input within the module's
+// timeout reports a ModuleTimeoutError to the graph's error callback, and that
+// modules without a timeout use the one of the GraphGenerator
+func TestGraph_ModuleTimeout(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	if err := gc.SetModuleTimeout(time.Hour); err != nil {
+		t.Fatalf("SetModuleTimeout returned an error: %+v", err)
+	}
+	g := gc.NewGraph("TimeoutTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleA.Timeout = 50 * time.Millisecond
+	moduleB := ModuleB.DeepCopy()
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+
+	errs := make(chan error, 1)
+	g.Build(4, func(graph, module string, err error) {
+		errs <- err
+	})
+	if moduleB.Timeout != time.Hour {
+		t.Errorf("Module without a timeout did not use the default."+
+			"\n\tExpected: %s\n\tReceived: %s", time.Hour, moduleB.Timeout)
+	}
+
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+	defer g.Kill(time.Second)
+
+	select {
+	case err := <-errs:
+		expected := &ModuleTimeoutError{
+			Graph:    "TimeoutTest",
+			Module:   moduleA.Name,
+			ThreadID: moduleA.id << 8,
+			Timeout:  50 * time.Millisecond,
+		}
+		if !reflect.DeepEqual(expected, err) {
+			t.Errorf("Unexpected timeout error."+
+				"\n\tExpected: %+v\n\tReceived: %+v", expected, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Module timeout was not reported to the error callback")
+	}
+}
+
+// Tests that when every thread of every module times out, the error callback
+// is only called once for the run
+func TestGraph_ModuleTimeout_ReportedOnce(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 4, 1, 0)
+	if err := gc.SetModuleTimeout(20 * time.Millisecond); err != nil {
+		t.Fatalf("SetModuleTimeout returned an error: %+v", err)
+	}
+	g := gc.NewGraph("TimeoutOnceTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+
+	var reports uint32
+	g.Build(4, func(graph, module string, err error) {
+		atomic.AddUint32(&reports, 1)
+	})
+
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+	defer g.Kill(time.Second)
+
+	time.Sleep(200 * time.Millisecond)
+	if received := atomic.LoadUint32(&reports); received != 1 {
+		t.Errorf("Unexpected number of timeouts reported."+
+			"\n\tExpected: %d\n\tReceived: %d", 1, received)
+	}
+}
+
+// Tests that a chunk which takes longer than the module's timeout to run does
+// not time out the thread, since only the wait for input is timed
+func TestGraph_ModuleTimeout_SlowChunk(t *testing.T) {
+	gc := MustNewGraphGenerator(2, 1, 1, 0)
+	if err := gc.SetModuleTimeout(100 * time.Millisecond); err != nil {
+		t.Fatalf("SetModuleTimeout returned an error: %+v", err)
+	}
+	g := gc.NewGraph("SlowChunkTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	adapt := moduleA.Adapt
+	moduleA.Adapt = func(s Stream, cryptop cryptops.Cryptop, chunk Chunk) error {
+		time.Sleep(250 * time.Millisecond)
+		return adapt(s, cryptop, chunk)
+	}
+	moduleA.InputSize = 2
+	g.First(moduleA)
+	g.Last(moduleA)
+
+	errs := make(chan error, 1)
+	err := g.Build(4, func(graph, module string, err error) {
+		errs <- err
+	})
+	if err != nil {
+		t.Fatalf("Build returned an error: %+v", err)
+	}
+
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+	defer g.Kill(time.Second)
+
+	// The second chunk arrives shortly after the first one has run
+	go func() {
+		g.Send(NewChunk(0, 2), nil)
+		time.Sleep(300 * time.Millisecond)
+		g.Send(NewChunk(2, g.GetExpandedBatchSize()), nil)
+	}()
+	for _, ok := g.GetOutput(); ok; _, ok = g.GetOutput() {
+	}
+
+	select {
+	case err = <-errs:
+		t.Errorf("Slow chunk timed out the thread: %+v", err)
+	default:
+	}
+}
+
+// Tests that GetModuleMetrics records a timing for every input chunk of every
+// module thread and that GetMetrics sums them
+func TestGraph_GetModuleMetrics(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 2, 1, 0)
+	g := gc.NewGraph("MetricsTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+	g.Build(64, PanicHandler)
+
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+
+	go func() {
+		for i := uint32(0); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}()
+	for _, ok := g.GetOutput(); ok; _, ok = g.GetOutput() {
+	}
+	if !g.Kill(time.Second) {
+		t.Fatalf("Graph did not stop")
+	}
+
+	moduleMetrics := g.GetModuleMetrics()
+	if len(moduleMetrics) != 4 {
+		t.Fatalf("Unexpected number of module threads."+
+			"\n\tExpected: %d\n\tReceived: %d", 4, len(moduleMetrics))
+	}
+
+	chunks := map[string]uint64{}
+	var adaptSum, outputSum time.Duration
+	for i, mm := range moduleMetrics {
+		expectedName := []string{moduleA.Name, moduleB.Name}[i/2]
+		if mm.Module != expectedName || mm.Thread != uint8(i%2) {
+			t.Errorf("Unexpected module thread %d."+
+				"\n\tExpected: %s %d\n\tReceived: %s %d", i, expectedName,
+				i%2, mm.Module, mm.Thread)
+		}
+		if mm.QueueWait.Count != mm.Adapt.Count ||
+			mm.Adapt.Count != mm.OutputPriming.Count {
+			t.Errorf("Histograms of %s thread %d have different counts: %+v",
+				mm.Module, mm.Thread, mm)
+		}
+		chunks[mm.Module] += mm.Adapt.Count
+		adaptSum += mm.Adapt.Sum
+		outputSum += mm.OutputPriming.Sum
+	}
+
+	expectedChunks := map[string]uint64{
+		moduleA.Name: uint64(g.GetExpandedBatchSize() / moduleA.InputSize),
+		moduleB.Name: uint64(g.GetExpandedBatchSize() / moduleB.InputSize),
+	}
+	if !reflect.DeepEqual(expectedChunks, chunks) {
+		t.Errorf("Unexpected number of chunks per module."+
+			"\n\tExpected: %v\n\tReceived: %v", expectedChunks, chunks)
+	}
+
+	adaptDur, outModsDur := g.GetMetrics()
+	if adaptDur != adaptSum || outModsDur != outputSum {
+		t.Errorf("GetMetrics does not match the module metrics."+
+			"\n\tExpected: %s %s\n\tReceived: %s %s", adaptSum, outputSum,
+			adaptDur, outModsDur)
+	}
+}
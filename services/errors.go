@@ -0,0 +1,60 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Contains the errors returned when graphs and graph generators are invalid
+
+package services
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Topology errors returned by Build
+	ErrNoModules     = errors.New("no modules in graph")
+	ErrNoFirstModule = errors.New("no first module")
+	ErrNoLastModule  = errors.New("no last module")
+	// Returned when a first module is also the output of another module
+	ErrFirstModuleHasInputs = errors.New("first module has input modules")
+
+	// Parameter errors returned by Build and NewGraphGenerator
+	ErrInvalidBatchSize      = errors.New("invalid batch size")
+	ErrInvalidInputSize      = errors.New("invalid module input size")
+	ErrInvalidThreshold      = errors.New("invalid threshold")
+	ErrInvalidModuleTimeout  = errors.New("invalid module timeout")
+	ErrInvalidGraphGenerator = errors.New("invalid graph generator")
+
+	// Returned when a GraphDefinition cannot be parsed or refers to unknown
+	// modules, streams or IDs
+	ErrInvalidGraphDefinition = errors.New("invalid graph definition")
+)
+
+// BuildError is returned by Build when a Graph cannot be built for a batch.
+// Err describes the problem and may be compared against the errors above with
+// errors.Is.
+type BuildError struct {
+	Graph string
+	// Module which caused the error, empty if the error is not specific to a
+	// module
+	Module    string
+	BatchSize uint32
+	Err       error
+}
+
+func (e *BuildError) Error() string {
+	if e.Module == "" {
+		return fmt.Sprintf("cannot build graph %s for batch size %d: %s",
+			e.Graph, e.BatchSize, e.Err)
+	}
+	return fmt.Sprintf("cannot build graph %s for batch size %d: module %s: %s",
+		e.Graph, e.BatchSize, e.Module, e.Err)
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
@@ -10,6 +10,7 @@
 package services
 
 import (
+	"context"
 	"github.com/pkg/errors"
 	"gitlab.com/elixxir/comms/mixmessages"
 	"gitlab.com/elixxir/crypto/cyclic"
@@ -209,7 +210,7 @@ func (s *ExpTestStream) DeepCopy() *ExpTestStream {
 // Precondition: ExpTestStream is populated with test data
 // Prepares and runs a graph with the specified 3 modules
 func runTestGraph(stream *ExpTestStream, moduleA, moduleB, moduleC *Module) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	// need to do _something_ here???
 	// what is it?
 	g := gc.NewGraph("test", stream)
@@ -223,7 +224,7 @@ func runTestGraph(stream *ExpTestStream, moduleA, moduleB, moduleC *Module) {
 	g.Link(stream.g, stream.length)
 	// Does this block until the graph finishes all slots?
 	// Would be cool if it did.
-	g.Run()
+	g.Run(context.Background())
 	g.Send(NewChunk(0, stream.length), nil)
 	// Wait on graph to run
 	ok := true
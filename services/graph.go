@@ -8,6 +8,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -16,21 +17,25 @@ import (
 	"math"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	AutoOutputSize = AutoInputSize
 	AutoNumThreads = 0
+	AutoTimeout    = 0
 )
 
 var ErrSaltIncorrectLength = errors.New("salt of incorrect length, must be 256 bits")
 var ErrUserIDTooShort = errors.New("User id length too short")
 
 type Graph struct {
-	generator   GraphGenerator
-	modules     map[uint64]*Module
-	firstModule *Module
-	lastModule  *Module
+	generator GraphGenerator
+	modules   map[uint64]*Module
+	// Entry modules, each of which is fed every chunk passed to Send
+	firstModules []*Module
+	// Exit modules, all of which must finish a slot before it is output
+	lastModules []*Module
 
 	name string
 
@@ -49,6 +54,8 @@ type Graph struct {
 	outputChannel IoNotify
 
 	sentInputs *uint32
+	// Number of first modules which have received the whole batch
+	doneInputs *uint32
 
 	outputSize      uint32
 	outputThreshold float32
@@ -57,13 +64,27 @@ type Graph struct {
 
 	// NOTE: This mutex is only used for metrics
 	sync.Mutex
-	metrics measure.Metrics
+	// Timings of each dispatch thread, keyed on thread ID
+	moduleMetrics map[uint64]*measure.ModuleMetrics
 
 	errorHandler ErrorCallback
+	// Ensures only the first module timeout of a run is reported
+	timeoutOnce sync.Once
+
+	// Closed when the graph is killed to stop its dispatch goroutines and
+	// unblock any sends into or reads from the graph
+	killed   chan struct{}
+	killOnce sync.Once
+	// Tracks the running dispatch goroutines
+	dispatchers sync.WaitGroup
+	// Closed once every goroutine started by the last call to Run has exited
+	stopped chan struct{}
 }
 
-// Build the initialized Graph for a Phase
-func (g *Graph) Build(batchSize uint32, errorHandler ErrorCallback) {
+// Build the initialized Graph for a Phase. Returns a *BuildError if the Graph
+// or its modules are invalid for the batch size, in which case the Graph must
+// not be used.
+func (g *Graph) Build(batchSize uint32, errorHandler ErrorCallback) error {
 
 	if g.overrideBatchSize != 0 {
 		batchSize = g.overrideBatchSize
@@ -71,17 +92,34 @@ func (g *Graph) Build(batchSize uint32, errorHandler ErrorCallback) {
 
 	g.errorHandler = errorHandler
 
+	buildErr := func(m *Module, err error) error {
+		e := &BuildError{Graph: g.name, BatchSize: batchSize, Err: err}
+		if m != nil {
+			e.Module = m.Name
+		}
+		return e
+	}
+
 	// Checks graph is properly formatted
 	err := g.checkGraph()
 	if err != nil {
-		jww.FATAL.Printf("CheckGraph failed : %+v", err)
+		return buildErr(nil, err)
+	}
+
+	if batchSize == 0 {
+		return buildErr(nil, errors.WithMessage(ErrInvalidBatchSize,
+			"batch size must be greater than zero"))
 	}
 
 	// Find expanded batch size
 	var integers []uint32
 
 	for _, m := range g.modules {
-		m.checkParameters(g.generator.minInputSize, g.generator.defaultNumTh)
+		err = m.checkParameters(g.generator.minInputSize,
+			g.generator.defaultNumTh, g.generator.moduleTimeout)
+		if err != nil {
+			return buildErr(m, err)
+		}
 		if m.InputSize != InputIsBatchSize {
 			integers = append(integers, m.InputSize)
 		}
@@ -92,102 +130,101 @@ func (g *Graph) Build(batchSize uint32, errorHandler ErrorCallback) {
 	lcm := LCM(integers)
 
 	expandBatchSize := uint32(math.Ceil(float64(batchSize)/float64(lcm))) * lcm
+	if expandBatchSize < batchSize {
+		return buildErr(nil, errors.WithMessagef(ErrInvalidBatchSize,
+			"batch size %d overflows when expanded to a multiple of %d",
+			batchSize, lcm))
+	}
 
-	g.batchSize = batchSize
-	g.expandBatchSize = expandBatchSize
-
-	// setup output module
-	g.outputModule = &Module{
+	// setup output module, which joins the outputs of every last module
+	outputModule := &Module{
 		InputSize:      g.outputSize,
 		StartThreshold: g.outputThreshold,
-		inputModules:   []*Module{g.lastModule},
+		inputModules:   append([]*Module{}, g.lastModules...),
 		Name:           "Output",
 		copy:           true,
 	}
 
-	g.lastModule.outputModules = append(g.lastModule.outputModules, g.outputModule)
-	g.add(g.outputModule)
-
 	// build assignments for each module
 	for _, m := range g.modules {
-		m.buildAssignments(expandBatchSize)
+		if err = m.buildAssignments(expandBatchSize); err != nil {
+			return buildErr(m, err)
+		}
 	}
+	if err = outputModule.buildAssignments(expandBatchSize); err != nil {
+		return buildErr(outputModule, err)
+	}
+
+	g.batchSize = batchSize
+	g.expandBatchSize = expandBatchSize
+
+	g.outputModule = outputModule
+	for _, m := range g.lastModules {
+		m.outputModules = append(m.outputModules, g.outputModule)
+	}
+	g.add(g.outputModule)
 
 	g.built = true
+	g.killed = make(chan struct{})
 
 	//populate channels
-	g.firstModule.open(g.expandBatchSize)
-	g.lastModule.open(g.expandBatchSize)
-
 	for _, m := range g.modules {
-		if m.id != g.firstModule.id && m.id != g.lastModule.id {
-			m.open(g.expandBatchSize)
-		}
+		m.open(g.expandBatchSize)
 	}
 	// finish setting up output
 	g.outputChannel = g.outputModule.input
 
 	delete(g.modules, g.outputModule.id)
-}
 
-// This has to be global to communicate between checkDAG and checkAllNodesUsed
-// It has to be lockable, otherwise multiple threads checking the graph at the
-// same time can overwrite the mods value and break checkAllNodesUsed()
-var visitedModules struct {
-	sync.Mutex
-	mods []uint64
+	return nil
 }
 
-// checkGraph checks that the graph is valid, meaning more than 1 vertex, has a
-// first and last module, is a Directed Acyclic Graph, and all vertexes in the
-// graph are used
+// checkGraph checks that the graph is valid, meaning more than 1 vertex, has
+// first and last modules, no first module is fed by another module, is a
+// Directed Acyclic Graph, and all vertexes in the graph are used
 func (g *Graph) checkGraph() error {
 	//Check if graph has modules
 	if len(g.modules) == 0 {
-		return fmt.Errorf("no modules in graph")
+		return ErrNoModules
 	}
 
-	if g.firstModule == nil {
-		return fmt.Errorf("no first module")
+	if len(g.firstModules) == 0 {
+		return ErrNoFirstModule
 	}
 
-	if g.lastModule == nil {
-		return fmt.Errorf("no last module")
+	if len(g.lastModules) == 0 {
+		return ErrNoLastModule
 	}
 
-	if g.firstModule == g.lastModule || len(g.modules) == 1 {
-		return nil
+	for _, m := range g.firstModules {
+		if len(m.inputModules) != 0 {
+			return errors.WithMessagef(ErrFirstModuleHasInputs,
+				"first module %s (vertex %d)", m.Name, m.id)
+		}
 	}
 
-	// Make an array of visited modules, containing the first ID
-	visited := make([]uint64, 0)
-	// Clear the visitedModules
-	visitedModules.Lock()
-	visitedModules.mods = make([]uint64, 0)
-	// Start checking based on the firstModule
-	err := g.checkDAG(g.firstModule, visited)
-	if err != nil {
-		return err
+	if len(g.modules) == 1 {
+		return nil
 	}
 
-	err = g.checkAllNodesUsed()
-	visitedModules.Unlock()
-	if err != nil {
-		return err
+	// Modules reached from the firstModules, filled in by checkDAG and used
+	// by checkAllNodesUsed
+	reached := make(map[uint64]bool, len(g.modules))
+	// Start checking from each of the firstModules
+	for _, m := range g.firstModules {
+		err := g.checkDAG(m, make([]uint64, 0), reached)
+		if err != nil {
+			return err
+		}
 	}
-	return nil
+
+	return g.checkAllNodesUsed(reached)
 }
 
 // checkAllNodesUsed checks that all nodes in a graph are called
-func (g *Graph) checkAllNodesUsed() error {
+func (g *Graph) checkAllNodesUsed(reached map[uint64]bool) error {
 	for _, v := range g.modules {
-		seen := false
-		for _, y := range visitedModules.mods {
-			if v.id == y {
-				seen = true
-			}
-		}
-		if seen == false {
+		if !reached[v.id] {
 			return fmt.Errorf("graph vertex %d was not used in graph anywhere", v.id)
 		}
 	}
@@ -196,15 +233,16 @@ func (g *Graph) checkAllNodesUsed() error {
 
 // checkDAG checks that no nodes cause a loopback or are run twice in any path
 // A graph loopback occurs when a node tries to call a node already called back
-// the chain.
-func (g *Graph) checkDAG(mod *Module, visited []uint64) error {
-	// Add node to visitedModules, since it's just being visited
-	visitedModules.mods = append(visitedModules.mods, mod.id)
-
-	// Reached the end of this path, check that the end is the lastModule
-	if len(mod.outputModules) == 0 && mod.id != g.lastModule.id {
+// the chain. Every module visited is added to reached.
+func (g *Graph) checkDAG(mod *Module, visited []uint64,
+	reached map[uint64]bool) error {
+	// Add node to reached, since it's just being visited
+	reached[mod.id] = true
+
+	// Reached the end of this path, check that the end is a last module
+	if len(mod.outputModules) == 0 && !g.isLast(mod) {
 		return fmt.Errorf("graph path ended at vertex ID %d,"+
-			" not lastModule ID %d", mod.id, g.lastModule.id)
+			" which is not a last module", mod.id)
 	}
 
 	// Check that this node isn't already in the visited path
@@ -216,7 +254,7 @@ func (g *Graph) checkDAG(mod *Module, visited []uint64) error {
 
 	// Recurse for all output modules to this one
 	for i := range mod.outputModules {
-		e := g.checkDAG(mod.outputModules[i], append(visited, mod.id))
+		e := g.checkDAG(mod.outputModules[i], append(visited, mod.id), reached)
 		if e != nil {
 			return e
 		}
@@ -225,8 +263,10 @@ func (g *Graph) checkDAG(mod *Module, visited []uint64) error {
 	return nil
 }
 
-// Run each of the modules in the Graph via the dispatcher
-func (g *Graph) Run() {
+// Run each of the modules in the Graph via the dispatcher, or on a pool of
+// workers if the GraphGenerator sets one. The Graph is killed if ctx is
+// cancelled before all modules have finished.
+func (g *Graph) Run(ctx context.Context) {
 	if !g.built {
 		jww.FATAL.Panicf("graph not built")
 	}
@@ -235,14 +275,138 @@ func (g *Graph) Run() {
 		jww.FATAL.Panicf("stream not linked and built")
 	}
 
+	g.Lock()
+	g.moduleMetrics = make(map[uint64]*measure.ModuleMetrics)
+	g.Unlock()
+
+	if g.generator.numWorkers != 0 {
+		g.runWorkers(g.generator.numWorkers)
+	} else {
+		g.runModuleThreads()
+	}
+
+	// Kill the graph on cancellation until every module has finished
+	finished := make(chan struct{})
+	stopped := make(chan struct{})
+	g.stopped = stopped
+	go func() {
+		g.dispatchers.Wait()
+		close(finished)
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			g.kill()
+			<-finished
+		case <-finished:
+		}
+	}()
+}
+
+// runModuleThreads runs NumThreads dispatch goroutines for each module
+func (g *Graph) runModuleThreads() {
 	for i, m := range g.modules {
 		i = i << 8 // high part of int
 		for j := uint8(0); j < m.NumThreads; j++ {
-			go dispatch(g, m, i+uint64(j))
+			mm := &measure.ModuleMetrics{Module: m.Name, Thread: j}
+			g.Lock()
+			g.moduleMetrics[i+uint64(j)] = mm
+			g.Unlock()
+
+			g.dispatchers.Add(1)
+			go func(m *Module, threadID uint64, mm *measure.ModuleMetrics) {
+				defer g.dispatchers.Done()
+				dispatch(g, m, threadID, mm)
+			}(m, i+uint64(j), mm)
 		}
 	}
 }
 
+// Closes the killed channel, stopping the graph
+func (g *Graph) kill() {
+	g.killOnce.Do(func() { close(g.killed) })
+}
+
+// Kill stops the Graph's dispatch goroutines and unblocks any pending sends
+// into and reads from the Graph, then waits up to timeout for the dispatch
+// goroutines to exit. Returns false if they did not exit in time.
+func (g *Graph) Kill(timeout time.Duration) bool {
+	if !g.built {
+		return true
+	}
+	g.kill()
+
+	stopped := make(chan struct{})
+	go func() {
+		g.dispatchers.Wait()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// IsKilled returns true if the Graph has been killed
+func (g *Graph) IsKilled() bool {
+	select {
+	case <-g.killed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reset returns a built Graph to the state it was in after Build, so that it
+// can be linked and run again for a batch of the same size without allocating
+// new assignments. The Graph must have stopped, e.g. by calling Kill.
+func (g *Graph) Reset() {
+	if !g.built {
+		jww.FATAL.Panicf("cannot reset graph %s which is not built", g.name)
+	}
+
+	// Wait for the goroutines of the last run to exit before replacing the
+	// state they use
+	if g.stopped != nil {
+		<-g.stopped
+	}
+
+	for _, m := range g.modules {
+		m.assignmentList.reset()
+		m.open(g.expandBatchSize)
+	}
+	g.outputModule.assignmentList.reset()
+	g.outputModule.open(g.expandBatchSize)
+	g.outputChannel = g.outputModule.input
+
+	atomic.StoreUint32(g.sentInputs, 0)
+	atomic.StoreUint32(g.doneInputs, 0)
+	g.killed = make(chan struct{})
+	g.killOnce = sync.Once{}
+	g.timeoutOnce = sync.Once{}
+	g.linked = false
+
+	g.Lock()
+	g.moduleMetrics = nil
+	g.Unlock()
+}
+
+// IsBuilt returns true if the Graph has been built
+func (g *Graph) IsBuilt() bool {
+	return g.built
+}
+
+// SetErrorHandler replaces the error handler the Graph was built with
+func (g *Graph) SetErrorHandler(errorHandler ErrorCallback) {
+	g.errorHandler = errorHandler
+}
+
 // Connect the output of one Module in the Graph to the input of the second Module
 func (g *Graph) Connect(a, b *Module) {
 
@@ -258,14 +422,54 @@ func (g *Graph) Link(grp *cyclic.Group, source ...interface{}) {
 	g.linked = true
 }
 
+// First sets the module which receives the input of the Graph, replacing any
+// first modules set before
 func (g *Graph) First(f *Module) {
 	g.add(f)
-	g.firstModule = f
+	g.firstModules = []*Module{f}
+}
+
+// AddFirst adds another module which receives the input of the Graph. Every
+// chunk passed to Send is fed to each first module, so independent branches
+// of the Graph can process the same slots in parallel.
+func (g *Graph) AddFirst(f *Module) {
+	g.add(f)
+	g.firstModules = append(g.firstModules, f)
 }
 
+// Last sets the module whose output is the output of the Graph, replacing any
+// last modules set before
 func (g *Graph) Last(l *Module) {
 	g.add(l)
-	g.lastModule = l
+	g.lastModules = []*Module{l}
+}
+
+// AddLast adds another module whose output is the output of the Graph. Slots
+// are only output once every last module has processed them, joining the
+// branches of the Graph.
+func (g *Graph) AddLast(l *Module) {
+	g.add(l)
+	g.lastModules = append(g.lastModules, l)
+}
+
+// isFirst returns true if m is one of the first modules of the Graph
+func (g *Graph) isFirst(m *Module) bool {
+	for _, f := range g.firstModules {
+		if f == m {
+			return true
+		}
+	}
+	return false
+}
+
+// isLast returns true if m is one of the last modules of the Graph
+func (g *Graph) isLast(m *Module) bool {
+	for _, l := range g.lastModules {
+		if l == m {
+			return true
+		}
+	}
+	return false
 }
 
 func (g *Graph) add(m *Module) {
@@ -293,60 +497,82 @@ func (g *Graph) OverrideBatchSize(b uint32) {
 
 type Measure func(tag string)
 
-// Send combines Chunks into a size described by the firstModule.assignmentList
-// and sends the resized Chunks into firstModule.input
+// Send combines Chunks into the sizes described by the assignmentList of each
+// first module and sends the resized Chunks into the input of that module
 func (g *Graph) Send(chunk Chunk, measureObj Measure) {
+	// If the entire batch has been sent then also send the difference between
+	// batchSize and expanded batchSize
+	numSent := atomic.AddUint32(g.sentInputs, chunk.Len())
+	pad := numSent == g.batchSize && g.batchSize < g.expandBatchSize
+
+	for _, m := range g.firstModules {
+		if !g.sendToFirst(m, chunk, pad) {
+			continue
+		}
+
+		// FIXME: Perhaps not the correct place to close the channel.
+		// Ideally, only the sender closes, and only if there's one sender.
+		// Does commenting this fix the double close?
+		// It does not.
+		m.closeInput()
+		done := atomic.AddUint32(g.doneInputs, 1)
+		if done == uint32(len(g.firstModules)) && measureObj != nil {
+			measureObj(measure.TagReceiveLastSlot)
+		}
+	}
+}
+
+// sendToFirst sends the chunk, followed by the padding of the batch if pad is
+// set, into the input of the first module m. Returns true once m has received
+// the whole batch.
+func (g *Graph) sendToFirst(m *Module, chunk Chunk, pad bool) bool {
 	// Retrieve Chunks of the proper size as described by the assignmentList
-	srList, err := g.firstModule.assignmentList.PrimeOutputs(chunk)
+	srList, err := m.assignmentList.PrimeOutputs(chunk)
 
 	if err != nil {
 		g.errorHandler(g.name, "input", err)
 	}
 
-	// Send resized Chunks into the input of firstModule
-	for _, r := range srList {
-		g.firstModule.input <- r
-	}
-
-	// If the entire batch has been sent then send the difference between batchSize and expanded batchSize
-	numSent := atomic.AddUint32(g.sentInputs, chunk.Len())
-	if numSent == g.batchSize && g.batchSize < g.expandBatchSize {
-		// Build the final chunk accounting for the difference in batchSize and expandBatchSize
+	if pad {
+		// Build the final chunk accounting for the difference in batchSize
+		// and expandBatchSize
 		endChunk := NewChunk(g.batchSize, g.expandBatchSize)
-		srList, err = g.firstModule.assignmentList.PrimeOutputs(endChunk)
+		endList, err := m.assignmentList.PrimeOutputs(endChunk)
 
 		if err != nil {
 			g.errorHandler(g.name, "input", err)
 		}
+		srList = append(srList, endList...)
+	}
 
-		for _, r := range srList {
-			g.firstModule.input <- r
+	// Send resized Chunks into the input of the module
+	for _, r := range srList {
+		select {
+		case m.input <- r:
+		case <-g.killed:
+			return false
 		}
 	}
 
-	done, err := g.firstModule.assignmentList.DenoteCompleted(len(srList))
+	done, err := m.assignmentList.DenoteCompleted(len(srList))
 	if err != nil {
 		g.errorHandler(g.name, "input", err)
 	}
 
-	if done {
-		// FIXME: Perhaps not the correct place to close the channel.
-		// Ideally, only the sender closes, and only if there's one sender.
-		// Does commenting this fix the double close?
-		// It does not.
-		g.firstModule.closeInput()
-		if measureObj != nil {
-			measureObj(measure.TagReceiveLastSlot)
-		}
-	}
+	return done
 }
 
 // GetOutput from the last op in the graph get sent on this channel.
+// Returns false once all output has been received or the graph is killed.
 func (g *Graph) GetOutput() (Chunk, bool) {
 	var chunk Chunk
 	var ok bool
 	for true {
-		chunk, ok = <-g.outputChannel
+		select {
+		case chunk, ok = <-g.outputChannel:
+		case <-g.killed:
+			return Chunk{}, false
+		}
 		if chunk.end > g.batchSize {
 			if chunk.begin < g.batchSize {
 				chunk.end = g.batchSize
@@ -0,0 +1,230 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles building graphs from declarative definitions of their modules and
+// edges, so that experimental graphs can be described without writing Go code
+
+package services
+
+import (
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/utils"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"time"
+)
+
+// GraphDefinition describes a Graph built from the modules of a GraphRegistry
+type GraphDefinition struct {
+	// Name of the Graph
+	Name string `yaml:"name"`
+	// Name of the registered Stream the modules operate on
+	Stream string `yaml:"stream"`
+	// Overrides the output threshold of the GraphGenerator if set
+	OutputThreshold *float32 `yaml:"outputThreshold"`
+
+	Modules []ModuleDefinition `yaml:"modules"`
+	// IDs of the modules which receive the input of the Graph
+	First []string `yaml:"first"`
+	// IDs of the modules whose output is the output of the Graph
+	Last  []string         `yaml:"last"`
+	Edges []EdgeDefinition `yaml:"edges"`
+}
+
+// ModuleDefinition describes a copy of a registered Module in a Graph. Unset
+// overrides keep the value of the registered Module.
+type ModuleDefinition struct {
+	// ID the module is referred to by in the GraphDefinition. Defaults to the
+	// name of the registered Module.
+	ID string `yaml:"id"`
+	// Name the Module is registered under
+	Module string `yaml:"module"`
+
+	InputSize      *uint32        `yaml:"inputSize"`
+	NumThreads     *uint8         `yaml:"numThreads"`
+	StartThreshold *float32       `yaml:"startThreshold"`
+	Timeout        *time.Duration `yaml:"timeout"`
+}
+
+// EdgeDefinition connects the output of one module to the input of another,
+// both given by ID
+type EdgeDefinition struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// LoadGraphDefinition reads the YAML GraphDefinition in the file at path
+func LoadGraphDefinition(path string) (GraphDefinition, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return GraphDefinition{}, errors.Errorf("Failed to read graph "+
+			"definition file %s: %+v", path, err)
+	}
+
+	def, err := ParseGraphDefinition(data)
+	if err != nil {
+		return GraphDefinition{}, errors.WithMessagef(err,
+			"Invalid graph definition file %s", path)
+	}
+	return def, nil
+}
+
+// ParseGraphDefinition parses a YAML GraphDefinition. Unknown fields are
+// rejected.
+func ParseGraphDefinition(data []byte) (GraphDefinition, error) {
+	def := GraphDefinition{}
+	if err := yaml.UnmarshalStrict(data, &def); err != nil {
+		return GraphDefinition{}, errors.WithMessage(
+			ErrInvalidGraphDefinition, err.Error())
+	}
+	if def.Name == "" {
+		return GraphDefinition{}, errors.WithMessage(
+			ErrInvalidGraphDefinition, "graph has no name")
+	}
+	if def.Stream == "" {
+		return GraphDefinition{}, errors.WithMessagef(
+			ErrInvalidGraphDefinition, "graph %s has no stream", def.Name)
+	}
+	return def, nil
+}
+
+// GraphRegistry holds the modules and streams which graphs can be built from
+// by name
+type GraphRegistry struct {
+	modules map[string]Module
+	streams map[string]func() Stream
+}
+
+// NewGraphRegistry returns an empty GraphRegistry
+func NewGraphRegistry() *GraphRegistry {
+	return &GraphRegistry{
+		modules: make(map[string]Module),
+		streams: make(map[string]func() Stream),
+	}
+}
+
+// RegisterModule registers the Module under name, replacing any Module
+// registered under the same name. Graphs use copies of the Module.
+func (r *GraphRegistry) RegisterModule(name string, m Module) {
+	r.modules[name] = m
+}
+
+// RegisterStream registers the constructor of a Stream under the name the
+// Stream returns from GetName
+func (r *GraphRegistry) RegisterStream(newStream func() Stream) {
+	r.streams[newStream().GetName()] = newStream
+}
+
+// GetModuleNames returns the names of every registered Module, sorted
+func (r *GraphRegistry) GetModuleNames() []string {
+	names := make([]string, 0, len(r.modules))
+	for name := range r.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewGraph returns the unbuilt Graph described by def, created from the
+// GraphGenerator. Returns an error wrapping ErrInvalidGraphDefinition if def
+// refers to unknown modules, streams or IDs. Checks of the topology are left
+// to Build.
+func (r *GraphRegistry) NewGraph(gc GraphGenerator,
+	def GraphDefinition) (*Graph, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return errors.WithMessagef(ErrInvalidGraphDefinition,
+			"graph %s: "+format, append([]interface{}{def.Name}, args...)...)
+	}
+
+	newStream, ok := r.streams[def.Stream]
+	if !ok {
+		return nil, invalid("unknown stream %s", def.Stream)
+	}
+
+	if def.OutputThreshold != nil {
+		if *def.OutputThreshold < 0 || *def.OutputThreshold > 1 {
+			return nil, invalid("output threshold must be between 0.0 "+
+				"and 1.0: received: %v", *def.OutputThreshold)
+		}
+	}
+
+	g := gc.NewGraph(def.Name, newStream())
+	if def.OutputThreshold != nil {
+		g.outputThreshold = *def.OutputThreshold
+	}
+
+	modules := make(map[string]*Module, len(def.Modules))
+	for _, md := range def.Modules {
+		registered, ok := r.modules[md.Module]
+		if !ok {
+			return nil, invalid("unknown module %s", md.Module)
+		}
+
+		id := md.ID
+		if id == "" {
+			id = md.Module
+		}
+		if _, exists := modules[id]; exists {
+			return nil, invalid("duplicate module ID %s", id)
+		}
+
+		m := registered.DeepCopy()
+		if md.InputSize != nil {
+			m.InputSize = *md.InputSize
+		}
+		if md.NumThreads != nil {
+			m.NumThreads = *md.NumThreads
+		}
+		if md.StartThreshold != nil {
+			m.StartThreshold = *md.StartThreshold
+		}
+		if md.Timeout != nil {
+			m.Timeout = *md.Timeout
+		}
+
+		// Adding every module in order keeps their IDs stable and lets Build
+		// report modules which are not connected
+		g.add(m)
+		modules[id] = m
+	}
+
+	lookup := func(id string) (*Module, error) {
+		m, ok := modules[id]
+		if !ok {
+			return nil, invalid("unknown module ID %s", id)
+		}
+		return m, nil
+	}
+
+	for _, id := range def.First {
+		m, err := lookup(id)
+		if err != nil {
+			return nil, err
+		}
+		g.AddFirst(m)
+	}
+	for _, e := range def.Edges {
+		from, err := lookup(e.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := lookup(e.To)
+		if err != nil {
+			return nil, err
+		}
+		g.Connect(from, to)
+	}
+	for _, id := range def.Last {
+		m, err := lookup(id)
+		if err != nil {
+			return nil, err
+		}
+		g.AddLast(m)
+	}
+
+	return g, nil
+}
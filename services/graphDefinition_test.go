@@ -0,0 +1,161 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Definition of the graph of TestGraph
+const testGraphDefinition = `
+name: "Defined"
+stream: "Stream1"
+modules:
+  - module: "A"
+  - module: "B"
+  - id: "C"
+    module: "C"
+    inputSize: 5
+    numThreads: 2
+    timeout: "1m"
+  - module: "D"
+    startThreshold: 1.0
+first: ["A"]
+last: ["D"]
+edges:
+  - {from: "A", to: "B"}
+  - {from: "B", to: "D"}
+  - {from: "A", to: "C"}
+  - {from: "C", to: "D"}
+`
+
+func newTestGraphRegistry() *GraphRegistry {
+	r := NewGraphRegistry()
+	r.RegisterModule("A", ModuleA)
+	r.RegisterModule("B", ModuleB)
+	r.RegisterModule("C", ModuleC)
+	r.RegisterModule("D", ModuleD)
+	r.RegisterStream(func() Stream { return &Stream1{} })
+	return r
+}
+
+// Happy path: a graph built from a definition applies the overrides of its
+// modules and computes the same output as the graph of TestGraph
+func TestGraphRegistry_NewGraph(t *testing.T) {
+	def, err := ParseGraphDefinition([]byte(testGraphDefinition))
+	if err != nil {
+		t.Fatalf("ParseGraphDefinition returned an error: %+v", err)
+	}
+
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	g, err := newTestGraphRegistry().NewGraph(gc, def)
+	if err != nil {
+		t.Fatalf("NewGraph returned an error: %+v", err)
+	}
+
+	moduleC := g.GetModuleByName("ModuleC")[0]
+	if moduleC.NumThreads != 2 || moduleC.Timeout != time.Minute {
+		t.Errorf("Overrides not applied to module C."+
+			"\n\tExpected: %d threads, %s timeout"+
+			"\n\tReceived: %d threads, %s timeout", 2, time.Minute,
+			moduleC.NumThreads, moduleC.Timeout)
+	}
+	if ModuleC.NumThreads != AutoNumThreads {
+		t.Errorf("Overrides modified the registered module")
+	}
+
+	batchSize := uint32(100)
+	if err = g.Build(batchSize, PanicHandler); err != nil {
+		t.Fatalf("Build returned an error: %+v", err)
+	}
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+
+	go func() {
+		for i := uint32(0); i < batchSize; i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}()
+
+	stream := g.GetStream().(*Stream1)
+	received := uint32(0)
+	for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			E := (stream.A[i] + stream.B[i]) * stream.D[i]
+			H := int(math.Abs(float64(stream.F[i]*stream.G[i]))) % stream.Prime
+			if E-H != stream.I[i] {
+				t.Errorf("Streams not equal on slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, E-H, stream.I[i])
+			}
+		}
+		received += chunk.Len()
+	}
+	if received != batchSize {
+		t.Errorf("Unexpected number of slots output."+
+			"\n\tExpected: %d\n\tReceived: %d", batchSize, received)
+	}
+}
+
+// Error path: definitions which cannot be parsed, or which refer to unknown
+// modules, streams or IDs, are rejected
+func TestGraphRegistry_NewGraph_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "name: a\nstream: Stream1\nmodule: [A]\n",
+		"no name":        "stream: Stream1\n",
+		"no stream":      "name: a\n",
+		"unknown stream": "name: a\nstream: Stream2\n",
+		"unknown module": "name: a\nstream: Stream1\nmodules: [{module: E}]\n",
+		"duplicate ID": "name: a\nstream: Stream1\n" +
+			"modules: [{module: A}, {id: A, module: B}]\n",
+		"unknown ID": "name: a\nstream: Stream1\nmodules: [{module: A}]\n" +
+			"first: [A]\nedges: [{from: A, to: B}]\n",
+		"bad threshold": "name: a\nstream: Stream1\noutputThreshold: 2\n",
+	}
+
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	r := newTestGraphRegistry()
+	for name, data := range tests {
+		def, err := ParseGraphDefinition([]byte(data))
+		if err == nil {
+			_, err = r.NewGraph(gc, def)
+		}
+		if !errors.Is(err, ErrInvalidGraphDefinition) {
+			t.Errorf("Unexpected error for %s."+
+				"\n\tExpected: %v\n\tReceived: %v", name,
+				ErrInvalidGraphDefinition, err)
+		}
+	}
+}
+
+// Error path: modules of a definition which are not connected are reported
+// by Build
+func TestGraphRegistry_NewGraph_Unconnected(t *testing.T) {
+	def, err := ParseGraphDefinition([]byte("name: a\nstream: Stream1\n" +
+		"modules: [{module: A}, {module: B}]\nfirst: [A]\nlast: [A]\n"))
+	if err != nil {
+		t.Fatalf("ParseGraphDefinition returned an error: %+v", err)
+	}
+
+	g, err := newTestGraphRegistry().NewGraph(
+		MustNewGraphGenerator(4, 1, 1, 0), def)
+	if err != nil {
+		t.Fatalf("NewGraph returned an error: %+v", err)
+	}
+
+	var buildErr *BuildError
+	if err = g.Build(8, PanicHandler); !errors.As(err, &buildErr) {
+		t.Errorf("Build did not report the unconnected module: %+v", err)
+	}
+}
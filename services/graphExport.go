@@ -0,0 +1,154 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles exporting the topology of a Graph for inspection
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GraphExport describes the topology of a Graph. Module parameters set to be
+// determined automatically are only resolved once the Graph is built.
+type GraphExport struct {
+	Name              string         `json:"name"`
+	Built             bool           `json:"built"`
+	BatchSize         uint32         `json:"batchSize"`
+	ExpandedBatchSize uint32         `json:"expandedBatchSize"`
+	Modules           []ModuleExport `json:"modules"`
+}
+
+// ModuleExport describes a single Module of an exported Graph
+type ModuleExport struct {
+	Id             uint64        `json:"id"`
+	Name           string        `json:"name"`
+	InputSize      uint32        `json:"inputSize"`
+	NumThreads     uint8         `json:"numThreads"`
+	StartThreshold float32       `json:"startThreshold"`
+	Timeout        time.Duration `json:"timeout"`
+	First          bool          `json:"first,omitempty"`
+	Last           bool          `json:"last,omitempty"`
+	Output         bool          `json:"output,omitempty"`
+	Outputs        []uint64      `json:"outputs"`
+}
+
+// Export returns the topology of the Graph, with modules ordered by ID. Once
+// the Graph is built, the module receiving its output is included.
+func (g *Graph) Export() GraphExport {
+	export := GraphExport{
+		Name:              g.name,
+		Built:             g.built,
+		BatchSize:         g.batchSize,
+		ExpandedBatchSize: g.expandBatchSize,
+		Modules:           make([]ModuleExport, 0, len(g.modules)+1),
+	}
+
+	modules := make([]*Module, 0, len(g.modules)+1)
+	for _, m := range g.modules {
+		modules = append(modules, m)
+	}
+	if g.outputModule != nil {
+		modules = append(modules, g.outputModule)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].id < modules[j].id
+	})
+
+	for _, m := range modules {
+		outputs := make([]uint64, len(m.outputModules))
+		for i, out := range m.outputModules {
+			outputs[i] = out.id
+		}
+		export.Modules = append(export.Modules, ModuleExport{
+			Id:             m.id,
+			Name:           m.Name,
+			InputSize:      m.InputSize,
+			NumThreads:     m.NumThreads,
+			StartThreshold: m.StartThreshold,
+			Timeout:        m.Timeout,
+			First:          g.isFirst(m),
+			Last:           g.isLast(m),
+			Output:         m == g.outputModule,
+			Outputs:        outputs,
+		})
+	}
+
+	return export
+}
+
+// ExportJSON returns the topology of the Graph encoded as indented JSON
+func (g *Graph) ExportJSON() ([]byte, error) {
+	return json.MarshalIndent(g.Export(), "", "  ")
+}
+
+// ExportDOT returns the topology of the Graph in the Graphviz DOT language
+func (g *Graph) ExportDOT() string {
+	export := g.Export()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", export.Name)
+	if export.Built {
+		fmt.Fprintf(&b, "\tlabel=%q;\n", fmt.Sprintf(
+			"%s\nBatchSize: %d\nExpandedBatchSize: %d", export.Name,
+			export.BatchSize, export.ExpandedBatchSize))
+	} else {
+		fmt.Fprintf(&b, "\tlabel=%q;\n", export.Name+"\n(not built)")
+	}
+	b.WriteString("\tnode [shape=box];\n")
+
+	for _, m := range export.Modules {
+		attrs := ""
+		if m.First || m.Last || m.Output {
+			attrs = ", style=bold"
+		}
+		fmt.Fprintf(&b, "\t%d [label=%q%s];\n", m.Id, fmt.Sprintf(
+			"%s\nInputSize: %s\nNumThreads: %s\nStartThreshold: %.2f\nTimeout: %s",
+			m.Name, formatInputSize(m.InputSize), formatNumThreads(m.NumThreads),
+			m.StartThreshold, formatTimeout(m.Timeout)), attrs)
+	}
+	for _, m := range export.Modules {
+		for _, out := range m.Outputs {
+			fmt.Fprintf(&b, "\t%d -> %d;\n", m.Id, out)
+		}
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// Returns a printable input size, naming the values resolved at build time
+func formatInputSize(inputSize uint32) string {
+	switch inputSize {
+	case AutoInputSize:
+		return "auto"
+	case InputIsBatchSize:
+		return "batch size"
+	default:
+		return fmt.Sprint(inputSize)
+	}
+}
+
+// Returns a printable module timeout, naming the value resolved at build time
+func formatTimeout(timeout time.Duration) string {
+	if timeout == AutoTimeout {
+		return "auto"
+	}
+	return timeout.String()
+}
+
+// Returns a printable thread count, naming the value resolved at build time
+func formatNumThreads(numThreads uint8) string {
+	if numThreads == AutoNumThreads {
+		return "auto"
+	}
+	return fmt.Sprint(numThreads)
+}
@@ -0,0 +1,126 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package services
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Builds a graph where moduleA feeds both moduleB and moduleC, which both
+// feed moduleD
+func newExportTestGraph() *Graph {
+	gc := MustNewGraphGenerator(4, 2, 4, 0)
+	g := gc.NewGraph("ExportTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	moduleC := ModuleC.DeepCopy()
+	moduleC.InputSize = 4
+	moduleD := ModuleD.DeepCopy()
+
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Connect(moduleA, moduleC)
+	g.Connect(moduleB, moduleD)
+	g.Connect(moduleC, moduleD)
+	g.Last(moduleD)
+
+	return g
+}
+
+// Tests that Export resolves module parameters once the graph is built
+func TestGraph_Export(t *testing.T) {
+	g := newExportTestGraph()
+
+	export := g.Export()
+	if export.Built || len(export.Modules) != 4 {
+		t.Fatalf("Unexpected export of unbuilt graph: %+v", export)
+	}
+	if export.Modules[1].InputSize != AutoInputSize {
+		t.Errorf("Auto input size should not be resolved before building."+
+			"\n\tExpected: %d\n\tReceived: %d", AutoInputSize,
+			export.Modules[1].InputSize)
+	}
+
+	g.Build(30, nil)
+	export = g.Export()
+
+	expected := GraphExport{
+		Name:              "ExportTest",
+		Built:             true,
+		BatchSize:         30,
+		ExpandedBatchSize: 56,
+		Modules: []ModuleExport{
+			{Id: 1, Name: "ModuleA", InputSize: 8, NumThreads: 2,
+				Timeout: DefaultModuleTimeout, First: true,
+				Outputs: []uint64{2, 3}},
+			{Id: 2, Name: "ModuleB", InputSize: 4, NumThreads: 2,
+				Timeout: DefaultModuleTimeout, Outputs: []uint64{4}},
+			{Id: 3, Name: "ModuleC", InputSize: 4, NumThreads: 2,
+				Timeout: DefaultModuleTimeout, Outputs: []uint64{4}},
+			{Id: 4, Name: "ModuleD", InputSize: 14, NumThreads: 2,
+				StartThreshold: 1, Timeout: DefaultModuleTimeout, Last: true,
+				Outputs: []uint64{5}},
+			{Id: 5, Name: "Output", InputSize: 4, Output: true,
+				Outputs: []uint64{}},
+		},
+	}
+	if !reflect.DeepEqual(expected, export) {
+		t.Errorf("Unexpected export.\n\tExpected: %+v\n\tReceived: %+v",
+			expected, export)
+	}
+}
+
+// Tests that ExportJSON decodes to the same topology as Export
+func TestGraph_ExportJSON(t *testing.T) {
+	g := newExportTestGraph()
+	g.Build(30, nil)
+
+	data, err := g.ExportJSON()
+	if err != nil {
+		t.Fatalf("ExportJSON error: %+v", err)
+	}
+	decoded := GraphExport{}
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode JSON export: %+v", err)
+	}
+	if !reflect.DeepEqual(g.Export(), decoded) {
+		t.Errorf("Decoded JSON does not match the export."+
+			"\n\tExpected: %+v\n\tReceived: %+v", g.Export(), decoded)
+	}
+}
+
+// Tests that ExportDOT lists every module and edge of the graph
+func TestGraph_ExportDOT(t *testing.T) {
+	g := newExportTestGraph()
+
+	dot := g.ExportDOT()
+	for _, s := range []string{`digraph "ExportTest" {`, `(not built)`,
+		`InputSize: auto`, `NumThreads: auto`, `Timeout: auto`} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("DOT export of unbuilt graph is missing %q:\n%s", s, dot)
+		}
+	}
+
+	g.Build(30, nil)
+	dot = g.ExportDOT()
+	for _, s := range []string{`BatchSize: 30\nExpandedBatchSize: 56`,
+		`2 [label="ModuleB\nInputSize: 4\nNumThreads: 2\nStartThreshold: ` +
+			`0.00\nTimeout: 2m0s"];`,
+		"1 -> 2;", "1 -> 3;", "2 -> 4;", "3 -> 4;", "4 -> 5;"} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("DOT export is missing %q:\n%s", s, dot)
+		}
+	}
+	if !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("DOT export is not terminated:\n%s", dot)
+	}
+}
@@ -8,9 +8,15 @@
 package services
 
 import (
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
+	"time"
 )
 
+// DefaultModuleTimeout is the time a module thread waits for its next input
+// before timing out, unless set on the module or the GraphGenerator
+const DefaultModuleTimeout = 2 * time.Minute
+
 // Should probably add more params to this like block ID, worker thread ID, etc
 type ErrorCallback func(graph, module string, err error)
 
@@ -19,15 +25,22 @@ type GraphGenerator struct {
 	defaultNumTh    uint8
 	outputSize      uint32
 	outputThreshold float32
+	moduleTimeout   time.Duration
+	numWorkers      uint8
 }
 
-func NewGraphGenerator(minInputSize uint32, defaultNumTh uint8, outputSize uint32, outputThreshold float32) GraphGenerator {
+// NewGraphGenerator returns a GraphGenerator with the given parameters, or an
+// error wrapping ErrInvalidGraphGenerator if they are invalid
+func NewGraphGenerator(minInputSize uint32, defaultNumTh uint8,
+	outputSize uint32, outputThreshold float32) (GraphGenerator, error) {
 	if defaultNumTh == 0 {
-		jww.FATAL.Panicf("Cannot default to zero threads")
+		return GraphGenerator{}, errors.WithMessage(ErrInvalidGraphGenerator,
+			"cannot default to zero threads")
 	}
 
 	if minInputSize == 0 {
-		jww.FATAL.Panicf("Minimum input size must be greater than zero")
+		return GraphGenerator{}, errors.WithMessage(ErrInvalidGraphGenerator,
+			"minimum input size must be greater than zero")
 	}
 
 	if outputSize == AutoOutputSize {
@@ -35,8 +48,9 @@ func NewGraphGenerator(minInputSize uint32, defaultNumTh uint8, outputSize uint3
 	}
 
 	if outputThreshold < 0.0 || outputThreshold > 1.0 {
-		jww.FATAL.Panicf("Output Threshold must be between 0.0 and 1."+
-			"0: received: %v", outputThreshold)
+		return GraphGenerator{}, errors.WithMessagef(ErrInvalidGraphGenerator,
+			"output threshold must be between 0.0 and 1.0: received: %v",
+			outputThreshold)
 	}
 
 	return GraphGenerator{
@@ -44,7 +58,47 @@ func NewGraphGenerator(minInputSize uint32, defaultNumTh uint8, outputSize uint3
 		defaultNumTh:    defaultNumTh,
 		outputSize:      outputSize,
 		outputThreshold: outputThreshold,
+		moduleTimeout:   DefaultModuleTimeout,
+	}, nil
+}
+
+// MustNewGraphGenerator is like NewGraphGenerator but panics if the parameters
+// are invalid. Only use it with parameters known to be valid.
+func MustNewGraphGenerator(minInputSize uint32, defaultNumTh uint8,
+	outputSize uint32, outputThreshold float32) GraphGenerator {
+	gc, err := NewGraphGenerator(minInputSize, defaultNumTh, outputSize,
+		outputThreshold)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to create graph generator: %+v", err)
+	}
+	return gc
+}
+
+// SetModuleTimeout sets the timeout of modules in new graphs which do not set
+// their own. Batches of different sizes may need longer or shorter timeouts.
+func (gc *GraphGenerator) SetModuleTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.WithMessagef(ErrInvalidModuleTimeout,
+			"module timeout must be greater than zero: received: %s", timeout)
 	}
+	gc.moduleTimeout = timeout
+	return nil
+}
+
+func (gc *GraphGenerator) GetModuleTimeout() time.Duration {
+	return gc.moduleTimeout
+}
+
+// SetNumWorkers makes new graphs run all of their modules on a shared pool of
+// numWorkers workers, which take chunks from the most downstream modules
+// first. The NumThreads of the modules is then ignored. Set to zero to run
+// NumThreads goroutines for each module instead, which is the default.
+func (gc *GraphGenerator) SetNumWorkers(numWorkers uint8) {
+	gc.numWorkers = numWorkers
+}
+
+func (gc *GraphGenerator) GetNumWorkers() uint8 {
+	return gc.numWorkers
 }
 
 func (gc *GraphGenerator) GetMinInputSize() uint32 {
@@ -80,6 +134,7 @@ func (gc *GraphGenerator) NewGraph(name string, stream Stream) *Graph {
 	g.stream = stream
 
 	g.sentInputs = new(uint32)
+	g.doneInputs = new(uint32)
 
 	g.outputSize = gc.outputSize
 	g.outputThreshold = gc.outputThreshold
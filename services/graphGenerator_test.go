@@ -8,8 +8,10 @@
 package services
 
 import (
+	"errors"
 	"runtime"
 	"testing"
+	"time"
 )
 
 var GCPanicHandler ErrorCallback = func(g, m string, err error) {
@@ -31,30 +33,30 @@ func assertPanic(t *testing.T, f func()) {
 func TestNewGraphGenerator(t *testing.T) {
 	//Test defaultNumTH set to 0 fails
 	gcTest := func() {
-		NewGraphGenerator(4, 0, 1, 0)
+		MustNewGraphGenerator(4, 0, 1, 0)
 	}
 	assertPanic(t, gcTest)
 
 	//Test minInputSize = 0 fails
 	gcTest = func() {
-		NewGraphGenerator(0, 1, 1, 0)
+		MustNewGraphGenerator(0, 1, 1, 0)
 	}
 	assertPanic(t, gcTest)
 
 	//Test if outputSize < 0 it fails
 	gcTest = func() {
-		NewGraphGenerator(1, 1, 1, -1)
+		MustNewGraphGenerator(1, 1, 1, -1)
 	}
 	assertPanic(t, gcTest)
 
 	//Test OutputThreshold > 1 it fails
 	gcTest = func() {
-		NewGraphGenerator(1, 1, 1, 2)
+		MustNewGraphGenerator(1, 1, 1, 2)
 	}
 	assertPanic(t, gcTest)
 
 	// Test that graph generator returns a graph with expected values
-	gc := NewGraphGenerator(1, 1, 1, 0)
+	gc := MustNewGraphGenerator(1, 1, 1, 0)
 	if gc.defaultNumTh != 1 || gc.minInputSize != 1 || gc.outputSize != 1 || gc.outputThreshold != 0 {
 		t.Logf("Graph Generator returned unexpected value")
 		t.Fail()
@@ -62,9 +64,35 @@ func TestNewGraphGenerator(t *testing.T) {
 
 }
 
+// Error path: NewGraphGenerator returns ErrInvalidGraphGenerator for the
+// parameters which MustNewGraphGenerator panics on
+func TestNewGraphGenerator_Error(t *testing.T) {
+	params := []struct {
+		minInputSize    uint32
+		defaultNumTh    uint8
+		outputSize      uint32
+		outputThreshold float32
+	}{
+		{4, 0, 1, 0},
+		{0, 1, 1, 0},
+		{1, 1, 1, -1},
+		{1, 1, 1, 2},
+	}
+
+	for i, p := range params {
+		_, err := NewGraphGenerator(p.minInputSize, p.defaultNumTh,
+			p.outputSize, p.outputThreshold)
+		if !errors.Is(err, ErrInvalidGraphGenerator) {
+			t.Errorf("NewGraphGenerator returned an unexpected error (%d)."+
+				"\n\tExpected: %v\n\tReceived: %v", i,
+				ErrInvalidGraphGenerator, err)
+		}
+	}
+}
+
 func TestGraphGenerator_NewGraph(t *testing.T) {
 	stream := &Stream1{}
-	gg := NewGraphGenerator(4, 1, 1, 0)
+	gg := MustNewGraphGenerator(4, 1, 1, 0)
 	newGraph := gg.NewGraph("testGraph", stream)
 
 	if newGraph.stream != stream {
@@ -79,7 +107,7 @@ func TestGraphGenerator_NewGraph(t *testing.T) {
 }
 
 func TestGraphGenerator_GetDefaultNumTh(t *testing.T) {
-	gc := NewGraphGenerator(4, 1, 1, 0)
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
 
 	if gc.GetDefaultNumTh() != 1 {
 		t.Logf("GetDefualtTh returned unexpected value")
@@ -94,7 +122,7 @@ func TestGraphGenerator_GetDefaultNumTh(t *testing.T) {
 }
 
 func TestGraphGenerator_GetMinInputSize(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 
 	if gc.GetMinInputSize() != 4 {
 		t.Logf("GetMinInputSize returned unexpected value")
@@ -110,7 +138,7 @@ func TestGraphGenerator_GetMinInputSize(t *testing.T) {
 }
 
 func TestGraphGenerator_GetOutputSize(t *testing.T) {
-	gc := NewGraphGenerator(1, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(1, uint8(runtime.NumCPU()), 1, 0)
 
 	if gc.GetMinInputSize() != 1 {
 		t.Logf("GetOutputSize returned unexpected value")
@@ -126,7 +154,7 @@ func TestGraphGenerator_GetOutputSize(t *testing.T) {
 }
 
 func TestGraphGenerator_GetOutputThreshold(t *testing.T) {
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 
 	if gc.GetOutputThreshold() != 0 {
 		t.Logf("GetOutputThreshold returned unexpected value")
@@ -140,3 +168,54 @@ func TestGraphGenerator_GetOutputThreshold(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Happy path: new generators use the default module timeout until it is set
+func TestGraphGenerator_SetModuleTimeout(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	if gc.GetModuleTimeout() != DefaultModuleTimeout {
+		t.Errorf("Unexpected default module timeout."+
+			"\n\tExpected: %s\n\tReceived: %s", DefaultModuleTimeout,
+			gc.GetModuleTimeout())
+	}
+
+	if err := gc.SetModuleTimeout(time.Second); err != nil {
+		t.Fatalf("SetModuleTimeout returned an error: %+v", err)
+	}
+	if gc.GetModuleTimeout() != time.Second {
+		t.Errorf("Unexpected module timeout."+
+			"\n\tExpected: %s\n\tReceived: %s", time.Second,
+			gc.GetModuleTimeout())
+	}
+}
+
+// Error path: module timeouts must be positive
+func TestGraphGenerator_SetModuleTimeout_Invalid(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	err := gc.SetModuleTimeout(0)
+	if !errors.Is(err, ErrInvalidModuleTimeout) {
+		t.Errorf("SetModuleTimeout returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrInvalidModuleTimeout, err)
+	}
+	if gc.GetModuleTimeout() != DefaultModuleTimeout {
+		t.Errorf("Invalid timeout was set."+
+			"\n\tExpected: %s\n\tReceived: %s", DefaultModuleTimeout,
+			gc.GetModuleTimeout())
+	}
+}
+
+// Happy path: graphs use threads for each module until a number of workers
+// is set, and copy the number of workers of their generator
+func TestGraphGenerator_SetNumWorkers(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	if gc.GetNumWorkers() != 0 {
+		t.Errorf("Unexpected default number of workers."+
+			"\n\tExpected: %d\n\tReceived: %d", 0, gc.GetNumWorkers())
+	}
+
+	gc.SetNumWorkers(8)
+	g := gc.NewGraph("test", &Stream1{})
+	if g.generator.numWorkers != 8 {
+		t.Errorf("Unexpected number of workers in graph."+
+			"\n\tExpected: %d\n\tReceived: %d", 8, g.generator.numWorkers)
+	}
+}
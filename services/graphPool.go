@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles keeping built graphs so that they can be reused by later rounds
+
+package services
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"sync"
+	"time"
+)
+
+// Time Put waits for the dispatch goroutines of a graph to stop before
+// dropping it
+const graphPoolKillTimeout = 5 * time.Second
+
+// GraphPool holds built graphs which are no longer in use so that later rounds
+// can reuse them instead of building new ones. Graphs are kept by name and
+// batch size, so graphs of the same name must have the same construction.
+type GraphPool struct {
+	maxIdle int
+	graphs  map[graphPoolKey][]*Graph
+	sync.Mutex
+}
+
+type graphPoolKey struct {
+	name      string
+	batchSize uint32
+}
+
+// NewGraphPool returns a GraphPool which keeps up to maxIdle graphs of each
+// name and batch size. A pool with a maxIdle of zero keeps no graphs.
+func NewGraphPool(maxIdle int) *GraphPool {
+	if maxIdle < 0 {
+		jww.FATAL.Panicf("Graph pool size must not be negative: "+
+			"received %d", maxIdle)
+	}
+	return &GraphPool{
+		maxIdle: maxIdle,
+		graphs:  make(map[graphPoolKey][]*Graph),
+	}
+}
+
+// Get removes and returns an idle graph with the given name built for the
+// batch size. Returns nil if the pool has no such graph or is nil. The graph
+// must be linked before it is run.
+func (gp *GraphPool) Get(name string, batchSize uint32) *Graph {
+	if gp == nil {
+		return nil
+	}
+
+	gp.Lock()
+	defer gp.Unlock()
+
+	key := graphPoolKey{name, batchSize}
+	idle := gp.graphs[key]
+	if len(idle) == 0 {
+		return nil
+	}
+
+	g := idle[len(idle)-1]
+	idle[len(idle)-1] = nil
+	gp.graphs[key] = idle[:len(idle)-1]
+	return g
+}
+
+// Put stops and resets the graph and adds it to the pool. The graph is dropped
+// if it is not built, does not stop in time or the pool already holds maxIdle
+// graphs of its name and batch size. Returns true if the graph was added.
+func (gp *GraphPool) Put(g *Graph) bool {
+	if gp == nil || g == nil || !g.IsBuilt() {
+		return false
+	}
+
+	key := graphPoolKey{g.GetName(), g.GetBatchSize()}
+	gp.Lock()
+	full := len(gp.graphs[key]) >= gp.maxIdle
+	gp.Unlock()
+	if full {
+		return false
+	}
+
+	if !g.Kill(graphPoolKillTimeout) {
+		jww.WARN.Printf("Graph %s did not stop within %s, dropping it "+
+			"from the graph pool", g.GetName(), graphPoolKillTimeout)
+		return false
+	}
+	g.Reset()
+
+	gp.Lock()
+	defer gp.Unlock()
+	if len(gp.graphs[key]) >= gp.maxIdle {
+		return false
+	}
+	gp.graphs[key] = append(gp.graphs[key], g)
+	return true
+}
+
+// Len returns the number of idle graphs in the pool
+func (gp *GraphPool) Len() int {
+	if gp == nil {
+		return 0
+	}
+
+	gp.Lock()
+	defer gp.Unlock()
+
+	n := 0
+	for _, idle := range gp.graphs {
+		n += len(idle)
+	}
+	return n
+}
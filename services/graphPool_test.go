@@ -0,0 +1,118 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package services
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// Builds a graph which adds and multiplies the streams, then links it to a new
+// round buffer
+func newPoolTestGraph(gc GraphGenerator, batchSize uint32) *Graph {
+	g := gc.NewGraph("PoolTest", &Stream1{})
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+	g.Build(batchSize, PanicHandler)
+	linkPoolTestGraph(g)
+	return g
+}
+
+// Links the graph to a new round buffer
+func linkPoolTestGraph(g *Graph) {
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+}
+
+// Runs a full batch through the graph and checks every slot of the output
+func runPoolTestGraph(t *testing.T, g *Graph) {
+	g.Run(context.Background())
+	go func() {
+		for i := uint32(0); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}()
+
+	stream := g.GetStream().(*Stream1)
+	received := uint32(0)
+	for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			expected := (stream.A[i] + stream.B[i]) * stream.D[i]
+			if stream.E[i] != expected {
+				t.Errorf("Unexpected result in slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, expected, stream.E[i])
+			}
+		}
+		received += chunk.Len()
+	}
+	if received != g.GetBatchSize() {
+		t.Errorf("Unexpected number of output slots."+
+			"\n\tExpected: %d\n\tReceived: %d", g.GetBatchSize(), received)
+	}
+}
+
+// Happy path: a graph returned to the pool runs a second batch correctly
+func TestGraphPool_Reuse(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 2, 1, 0)
+	pool := NewGraphPool(1)
+
+	g := newPoolTestGraph(gc, 64)
+	runPoolTestGraph(t, g)
+
+	if !pool.Put(g) || pool.Len() != 1 {
+		t.Fatalf("Graph was not added to the pool")
+	}
+	if pool.Get("PoolTest", 32) != nil || pool.Get("Other", 64) != nil {
+		t.Errorf("Pool returned a graph of the wrong name or batch size")
+	}
+
+	reused := pool.Get("PoolTest", 64)
+	if reused != g || pool.Len() != 0 {
+		t.Fatalf("Pool did not return the idle graph")
+	}
+	if !reused.IsBuilt() || reused.IsKilled() {
+		t.Errorf("Reused graph should be built and not killed")
+	}
+
+	linkPoolTestGraph(reused)
+	runPoolTestGraph(t, reused)
+}
+
+// Tests that Put drops graphs that are not built or exceed the pool size
+func TestGraphPool_Put_Drop(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 2, 1, 0)
+	pool := NewGraphPool(1)
+
+	if pool.Put(gc.NewGraph("PoolTest", &Stream1{})) {
+		t.Errorf("Pool accepted a graph which is not built")
+	}
+	if !pool.Put(newPoolTestGraph(gc, 64)) {
+		t.Errorf("Pool rejected a built graph")
+	}
+	if pool.Put(newPoolTestGraph(gc, 64)) {
+		t.Errorf("Pool accepted more graphs than its size")
+	}
+	if !pool.Put(newPoolTestGraph(gc, 128)) {
+		t.Errorf("Pool rejected a graph of another batch size")
+	}
+
+	var nilPool *GraphPool
+	if nilPool.Put(newPoolTestGraph(gc, 64)) || nilPool.Get("PoolTest", 64) != nil {
+		t.Errorf("A nil pool should hold no graphs")
+	}
+}
+
+// Error path: pools cannot have a negative size
+func TestNewGraphPool_Invalid(t *testing.T) {
+	assertPanic(t, func() { NewGraphPool(-1) })
+}
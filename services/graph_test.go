@@ -8,21 +8,25 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"math"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func newGraphAndGeneratorTestUtil() (*Graph, GraphGenerator) {
 	stream := &Stream1{}
 	name := "test123"
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph(name, stream)
 	return g, gc
 }
 
 func TestGraph_GetStream(t *testing.T) {
 	stream := &Stream1{}
-	gc := NewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
 	g := gc.NewGraph("test", stream)
 
 	if g.GetStream() != stream {
@@ -60,7 +64,7 @@ func TestGraph_First(t *testing.T) {
 	g.First(newModuleA)
 
 	// Check to see that it appropriately added
-	if g.firstModule != newModuleA {
+	if len(g.firstModules) != 1 || g.firstModules[0] != newModuleA {
 		t.Logf("Graph First is failing to add module as firstModule")
 		t.Fail()
 	}
@@ -70,7 +74,7 @@ func TestGraph_First(t *testing.T) {
 	g.First(newModuleB)
 
 	// Check to see that it appropriately added
-	if g.firstModule != newModuleB {
+	if len(g.firstModules) != 1 || g.firstModules[0] != newModuleB {
 		t.Logf("Graph First is failing to change module set as firstModule")
 		t.Fail()
 	}
@@ -85,7 +89,7 @@ func TestGraph_Last(t *testing.T) {
 	g.Last(newModuleA)
 
 	// Check to see that it appropriately added
-	if g.lastModule != newModuleA {
+	if len(g.lastModules) != 1 || g.lastModules[0] != newModuleA {
 		t.Logf("Graph First is failing to add module as firstModule")
 		t.Fail()
 	}
@@ -95,8 +99,136 @@ func TestGraph_Last(t *testing.T) {
 	g.Last(newModuleB)
 
 	// Check to see that it appropriately added
-	if g.lastModule != newModuleB {
+	if len(g.lastModules) != 1 || g.lastModules[0] != newModuleB {
 		t.Logf("Graph First is failing to change module set as firstModule")
 		t.Fail()
 	}
 }
+
+// Tests that cancelling the context passed to Run kills the graph, stopping
+// its dispatch goroutines and unblocking sends and reads
+func TestGraph_Run_Cancel(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+	g.Build(1000, PanicHandler)
+
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize()))))
+	g.Link(initDispatchGroup(), &roundBuf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Run(ctx)
+
+	// Send part of the batch so that the graph never finishes
+	for i := uint32(0); i < 100; i++ {
+		g.Send(NewChunk(i, i+1), nil)
+	}
+	cancel()
+
+	if !g.Kill(time.Second) {
+		t.Fatalf("Dispatch goroutines did not stop after cancellation")
+	}
+	if !g.IsKilled() {
+		t.Errorf("Graph should be killed after cancellation")
+	}
+
+	// Reads and sends return once the graph is killed
+	done := make(chan struct{})
+	go func() {
+		for _, ok := g.GetOutput(); ok; _, ok = g.GetOutput() {
+		}
+		for i := uint32(100); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Reads and sends blocked on a killed graph")
+	}
+}
+
+// Happy path: an unbuilt graph has nothing to kill
+func TestGraph_Kill_NotBuilt(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+	if !g.Kill(time.Millisecond) || g.IsKilled() {
+		t.Errorf("Killing an unbuilt graph should do nothing")
+	}
+}
+
+// Error path: Build returns a BuildError for a graph without a first module
+func TestGraph_Build_NoFirstModule(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+
+	err := g.Build(8, GCPanicHandler)
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || !errors.Is(err, ErrNoFirstModule) {
+		t.Errorf("Build returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrNoFirstModule, err)
+	}
+	if g.IsBuilt() {
+		t.Errorf("Graph should not be built after a failed Build")
+	}
+}
+
+// Error path: Build returns a BuildError for a batch size of zero
+func TestGraph_Build_InvalidBatchSize(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+	moduleA := ModuleA.DeepCopy()
+	g.First(moduleA)
+	g.Last(moduleA)
+
+	err := g.Build(0, GCPanicHandler)
+	if !errors.Is(err, ErrInvalidBatchSize) {
+		t.Errorf("Build returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrInvalidBatchSize, err)
+	}
+}
+
+// Error path: Build returns a BuildError naming the module when a module's
+// input size is below the minimum of the generator
+func TestGraph_Build_InvalidInputSize(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+	moduleA := ModuleA.DeepCopy()
+	moduleA.InputSize = 2
+	g.First(moduleA)
+	g.Last(moduleA)
+
+	err := g.Build(8, GCPanicHandler)
+	var buildErr *BuildError
+	if !errors.As(err, &buildErr) || !errors.Is(err, ErrInvalidInputSize) {
+		t.Fatalf("Build returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrInvalidInputSize, err)
+	}
+	if buildErr.Module != moduleA.Name || buildErr.BatchSize != 8 {
+		t.Errorf("BuildError has unexpected fields."+
+			"\n\tExpected: %s, %d\n\tReceived: %s, %d", moduleA.Name, 8,
+			buildErr.Module, buildErr.BatchSize)
+	}
+}
+
+// Error path: Build returns a BuildError when a module's start threshold is
+// out of range
+func TestGraph_Build_InvalidThreshold(t *testing.T) {
+	g, _ := newGraphAndGeneratorTestUtil()
+	moduleA := ModuleA.DeepCopy()
+	moduleA.StartThreshold = 1.5
+	g.First(moduleA)
+	g.Last(moduleA)
+
+	err := g.Build(8, GCPanicHandler)
+	if !errors.Is(err, ErrInvalidThreshold) {
+		t.Errorf("Build returned an unexpected error."+
+			"\n\tExpected: %v\n\tReceived: %v", ErrInvalidThreshold, err)
+	}
+}
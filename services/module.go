@@ -8,10 +8,11 @@
 package services
 
 import (
-	"fmt"
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/gpumathsgo/cryptops"
 	"math"
+	"time"
 )
 
 const (
@@ -40,6 +41,10 @@ type Module struct {
 	// Number of goroutines to execute the adapter and cryptops on
 	NumThreads uint8
 
+	// Time a thread waits for its next input before timing out. Defaults to
+	// the module timeout of the GraphGenerator if zero
+	Timeout time.Duration
+
 	/*Private*/
 	// Contains and controls the input channel
 	moduleInput
@@ -61,35 +66,50 @@ type Module struct {
 }
 
 //Checks inputs are correct and sets the inputSize if it is set to auto
-func (m *Module) checkParameters(minInputSize uint32, defaultNumThreads uint8) {
+func (m *Module) checkParameters(minInputSize uint32, defaultNumThreads uint8,
+	defaultTimeout time.Duration) error {
 	if m.NumThreads == AutoNumThreads {
 		m.NumThreads = defaultNumThreads
 	}
 
+	if m.Timeout == AutoTimeout {
+		m.Timeout = defaultTimeout
+	}
+
 	if m.InputSize == AutoInputSize {
 		m.InputSize = ((m.Cryptop.GetInputSize() + minInputSize - 1) / minInputSize) * minInputSize
 	}
 
 	if m.InputSize < minInputSize {
-		jww.FATAL.Panicf(fmt.Sprintf("Module %s cannot have an input size less"+
-			" than %v",
-			m.Name, minInputSize))
+		return errors.WithMessagef(ErrInvalidInputSize, "input size %d is "+
+			"less than the minimum of %d", m.InputSize, minInputSize)
+	}
+
+	if m.StartThreshold < 0 || m.StartThreshold > 1 {
+		return errors.WithMessagef(ErrInvalidThreshold, "start threshold "+
+			"was %v, must be between 0 and 1", m.StartThreshold)
 	}
+
+	return nil
 }
 
 //Builds assignments
-func (m *Module) buildAssignments(batchSize uint32) {
+func (m *Module) buildAssignments(batchSize uint32) error {
 
-	m.assignmentList.threshold = threshold(batchSize, m.StartThreshold)
+	var err error
+	m.assignmentList.threshold, err = threshold(batchSize, m.StartThreshold)
+	if err != nil {
+		return err
+	}
 
 	if m.InputSize == InputIsBatchSize {
 		m.InputSize = batchSize
 	}
 
 	if batchSize%m.InputSize != 0 {
-		jww.FATAL.Panicf("%v expanded batch size incorrect: "+
-			"module input size is not factor; BatchSize: %v, Module Input: %v ",
-			m.Name, batchSize, m.InputSize)
+		return errors.WithMessagef(ErrInvalidBatchSize, "expanded batch "+
+			"size %d is not a multiple of the module input size %d",
+			batchSize, m.InputSize)
 	}
 
 	numJobs := batchSize / m.InputSize
@@ -114,15 +134,17 @@ func (m *Module) buildAssignments(batchSize uint32) {
 	for j := uint32(0); j < numJobs; j++ {
 		m.assignmentList.assignments[j] = newAssignment(j * m.InputSize)
 	}
+
+	return nil
 }
 
 //Get the threshold number
-func threshold(batchSize uint32, thresh float32) uint32 {
+func threshold(batchSize uint32, thresh float32) (uint32, error) {
 	if thresh < 0 || thresh > 1 {
-		jww.FATAL.Panicf("output threshold was %v, "+
-			"must be between 0 and 1", thresh)
+		return 0, errors.WithMessagef(ErrInvalidThreshold, "threshold was "+
+			"%v, must be between 0 and 1", thresh)
 	}
-	return uint32(float64(thresh) * float64(batchSize))
+	return uint32(float64(thresh) * float64(batchSize)), nil
 }
 
 func (m Module) DeepCopy() *Module {
@@ -137,6 +159,7 @@ func (m Module) DeepCopy() *Module {
 		InputSize:      m.InputSize,
 		StartThreshold: m.StartThreshold,
 		Name:           m.Name,
+		Timeout:        m.Timeout,
 	}
 
 	mCopy.copy = true
@@ -22,7 +22,11 @@ func TestThreshold(t *testing.T) {
 
 func testThresholhelper(batchSize uint32, thresh float32, expected uint32,
 	t *testing.T) {
-	th := threshold(batchSize, thresh)
+	th, err := threshold(batchSize, thresh)
+	if err != nil {
+		t.Errorf("Thresholding: Unexpected error for batchsize %v at "+
+			"threshold %v: %+v", batchSize, thresh, err)
+	}
 
 	if th != expected {
 		t.Errorf("Thresholding: Incorrect for batchsize %v at "+
@@ -0,0 +1,254 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Contains the worker pool which runs the modules of a Graph when its
+// GraphGenerator is set to use one
+
+package services
+
+import (
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/server/internal/measure"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// workerPool runs every module of a Graph on a fixed number of workers. Each
+// worker takes the next ready chunk from the input of the most downstream
+// module which has one, so that the end of the Graph is drained before more
+// work is started at its beginning.
+type workerPool struct {
+	g *Graph
+	// Modules ordered from the most to the least downstream
+	modules []*Module
+	// Set to 1 once the input of the module at the same index is closed and
+	// drained
+	finished []uint32
+	// Time, in Unix nanoseconds, at which the module at the same index last
+	// received a chunk, or the Graph started running
+	progress []int64
+}
+
+// runWorkers runs the modules of the Graph on numWorkers workers shared by
+// every module, instead of on NumThreads goroutines per module
+func (g *Graph) runWorkers(numWorkers uint8) {
+	p := &workerPool{
+		g:        g,
+		modules:  g.prioritizedModules(),
+		finished: make([]uint32, len(g.modules)),
+		progress: make([]int64, len(g.modules)),
+	}
+	now := time.Now().UnixNano()
+	for i := range p.progress {
+		p.progress[i] = now
+	}
+
+	for w := uint8(0); w < numWorkers; w++ {
+		g.dispatchers.Add(1)
+		go func(workerID uint8) {
+			defer g.dispatchers.Done()
+			p.work(workerID)
+		}(w)
+	}
+}
+
+// prioritizedModules returns the modules of the Graph ordered by their
+// longest distance from a first module, most downstream first
+func (g *Graph) prioritizedModules() []*Module {
+	depth := make(map[uint64]int, len(g.modules))
+	var visit func(m *Module, d int)
+	visit = func(m *Module, d int) {
+		if current, ok := depth[m.id]; ok && current >= d {
+			return
+		}
+		depth[m.id] = d
+		for _, om := range m.outputModules {
+			// The output module is not run by the workers
+			if _, ok := g.modules[om.id]; ok {
+				visit(om, d+1)
+			}
+		}
+	}
+	for _, m := range g.firstModules {
+		visit(m, 0)
+	}
+
+	modules := make([]*Module, 0, len(g.modules))
+	for _, m := range g.modules {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if depth[modules[i].id] != depth[modules[j].id] {
+			return depth[modules[i].id] > depth[modules[j].id]
+		}
+		return modules[i].id < modules[j].id
+	})
+	return modules
+}
+
+// work runs chunks from the inputs of the modules until every module has
+// finished, or the Graph is killed or times out
+func (p *workerPool) work(workerID uint8) {
+	waitStart := time.Now()
+	for {
+		i, chunk, ok := p.next(workerID)
+		if !ok {
+			return
+		}
+
+		m := p.modules[i]
+		var keepLooping bool
+		keepLooping, waitStart = runChunk(p.g, m, chunk,
+			p.g.workerMetrics(m, workerID), waitStart)
+		if !keepLooping {
+			return
+		}
+	}
+}
+
+// next returns the index of the module and the chunk to run next, blocking
+// until a chunk is ready. Returns false once every module has finished, or
+// the Graph is killed or times out.
+func (p *workerPool) next(workerID uint8) (int, Chunk, bool) {
+	for {
+		select {
+		case <-p.g.killed:
+			return 0, Chunk{}, false
+		default:
+		}
+
+		// Take a ready chunk in priority order without blocking
+		numOpen := 0
+		for i, m := range p.modules {
+			if atomic.LoadUint32(&p.finished[i]) == 1 {
+				continue
+			}
+			numOpen++
+			select {
+			case chunk, ok := <-m.input:
+				if ok {
+					atomic.StoreInt64(&p.progress[i], time.Now().UnixNano())
+					return i, chunk, true
+				}
+				atomic.StoreUint32(&p.finished[i], 1)
+				numOpen--
+			default:
+			}
+		}
+		if numOpen == 0 {
+			return 0, Chunk{}, false
+		}
+
+		// Nothing is ready, so wait for any of the unfinished modules
+		i, chunk, status := p.wait(workerID)
+		switch status {
+		case waitReceived:
+			atomic.StoreInt64(&p.progress[i], time.Now().UnixNano())
+			return i, chunk, true
+		case waitClosed:
+			atomic.StoreUint32(&p.finished[i], 1)
+		case waitStopped:
+			return 0, Chunk{}, false
+		case waitExpired:
+		}
+	}
+}
+
+// Outcomes of workerPool.wait
+const (
+	waitReceived = iota
+	waitClosed
+	waitStopped
+	// The wait timed out but every module made progress in the meantime
+	waitExpired
+)
+
+// wait blocks until the input of an unfinished module receives a chunk or is
+// closed, or the Graph is killed. If a module receives nothing within its
+// timeout of its last chunk, a ModuleTimeoutError is reported for it. When
+// several have, the one which stalled first is reported, as the modules after
+// it are only starved of its output.
+func (p *workerPool) wait(workerID uint8) (int, Chunk, int) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(p.g.killed)},
+		{Dir: reflect.SelectRecv},
+	}
+	indexes := make([]int, 0, len(p.modules))
+	stalled := -1
+	var deadline time.Time
+	for i, m := range p.modules {
+		if atomic.LoadUint32(&p.finished[i]) == 1 {
+			continue
+		}
+		// Modules are ordered most downstream first, so upstream modules
+		// win ties
+		d := p.deadline(i)
+		if stalled == -1 || !d.After(deadline) {
+			stalled, deadline = i, d
+		}
+		cases = append(cases, reflect.SelectCase{
+			Dir: reflect.SelectRecv, Chan: reflect.ValueOf(m.input)})
+		indexes = append(indexes, i)
+	}
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	cases[1].Chan = reflect.ValueOf(timer.C)
+
+	chosen, value, ok := reflect.Select(cases)
+	switch chosen {
+	case 0:
+		jww.DEBUG.Printf("Graph %v killed worker %v", p.g.GetName(), workerID)
+		return 0, Chunk{}, waitStopped
+	case 1:
+		// Another worker may have received a chunk for the module
+		if time.Now().Before(p.deadline(stalled)) {
+			return 0, Chunk{}, waitExpired
+		}
+
+		m := p.modules[stalled]
+		err := &ModuleTimeoutError{
+			Graph:    p.g.GetName(),
+			Module:   m.Name,
+			ThreadID: m.id<<8 | uint64(workerID),
+			Timeout:  m.Timeout,
+		}
+		jww.WARN.Printf("Graph %v in module %v timed out worker %v",
+			p.g.GetName(), m.Name, workerID)
+		p.g.reportTimeout(err)
+		return 0, Chunk{}, waitStopped
+	}
+
+	i := indexes[chosen-2]
+	if !ok {
+		return i, Chunk{}, waitClosed
+	}
+	return i, value.Interface().(Chunk), waitReceived
+}
+
+// deadline returns the time by which the module at index i must receive its
+// next chunk
+func (p *workerPool) deadline(i int) time.Time {
+	return time.Unix(0, atomic.LoadInt64(&p.progress[i])).
+		Add(p.modules[i].Timeout)
+}
+
+// workerMetrics returns the timings of the worker for the module, creating
+// them the first time the worker runs the module
+func (g *Graph) workerMetrics(m *Module, workerID uint8) *measure.ModuleMetrics {
+	threadID := m.id<<8 | uint64(workerID)
+
+	g.Lock()
+	defer g.Unlock()
+	mm, ok := g.moduleMetrics[threadID]
+	if !ok {
+		mm = &measure.ModuleMetrics{Module: m.Name, Thread: workerID}
+		g.moduleMetrics[threadID] = mm
+	}
+	return mm
+}
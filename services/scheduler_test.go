@@ -0,0 +1,211 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package services
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Builds and runs the graph of TestGraph with the given number of workers and
+// sends the whole batch into it
+func runSchedulerTestGraph(batchSize uint32, numWorkers uint8) *Graph {
+	gc := MustNewGraphGenerator(4, uint8(runtime.NumCPU()), 1, 0)
+	gc.SetNumWorkers(numWorkers)
+
+	g := gc.NewGraph("test", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	moduleC := ModuleC.DeepCopy()
+	moduleD := ModuleD.DeepCopy()
+
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Connect(moduleB, moduleD)
+	g.Connect(moduleA, moduleC)
+	g.Connect(moduleC, moduleD)
+	g.Last(moduleD)
+
+	if err := g.Build(batchSize, PanicHandler); err != nil {
+		panic(err)
+	}
+
+	roundSize := uint32(math.Ceil(1.2 * float64(g.GetExpandedBatchSize())))
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(roundSize)
+
+	g.Link(initDispatchGroup(), &roundBuf)
+
+	g.Run(context.Background())
+
+	go func(g *Graph) {
+		for i := uint32(0); i < g.GetBatchSize(); i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}(g)
+
+	return g
+}
+
+// Tests that a graph run on a worker pool computes the same output as one run
+// with threads for each module, and that the timings are recorded per worker
+func TestGraph_WorkerPool(t *testing.T) {
+	batchSize := uint32(1000)
+	numWorkers := uint8(3)
+	g := runSchedulerTestGraph(batchSize, numWorkers)
+
+	stream := g.GetStream().(*Stream1)
+	received := uint32(0)
+	for chunk, ok := g.GetOutput(); ok; chunk, ok = g.GetOutput() {
+		for i := chunk.Begin(); i < chunk.End(); i++ {
+			E := (stream.A[i] + stream.B[i]) * stream.D[i]
+			H := int(math.Abs(float64(stream.F[i]*stream.G[i]))) % stream.Prime
+			if E-H != stream.I[i] {
+				t.Errorf("Streams not equal on slot %d."+
+					"\n\tExpected: %d\n\tReceived: %d", i, E-H, stream.I[i])
+			}
+		}
+		received += chunk.Len()
+	}
+
+	if received != batchSize {
+		t.Errorf("Unexpected number of slots output."+
+			"\n\tExpected: %d\n\tReceived: %d", batchSize, received)
+	}
+
+	if !g.Kill(time.Second) {
+		t.Errorf("Workers did not exit after the graph finished")
+	}
+
+	chunks := make(map[string]uint64)
+	for _, mm := range g.GetModuleMetrics() {
+		if mm.Thread >= numWorkers {
+			t.Errorf("Timings recorded for worker %d of module %s, only %d "+
+				"workers exist", mm.Thread, mm.Module, numWorkers)
+		}
+		chunks[mm.Module] += mm.Adapt.Count
+	}
+	for _, name := range []string{"ModuleA", "ModuleB", "ModuleC", "ModuleD"} {
+		if chunks[name] == 0 {
+			t.Errorf("No chunks recorded for module %s", name)
+		}
+	}
+}
+
+// Tests that modules are prioritised by their longest distance from the first
+// module, with the most downstream first
+func TestGraph_PrioritizedModules(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	g := gc.NewGraph("test", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleB := ModuleB.DeepCopy()
+	moduleC := ModuleC.DeepCopy()
+	moduleD := ModuleD.DeepCopy()
+
+	// D is reached from A directly and through B and C
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Connect(moduleB, moduleC)
+	g.Connect(moduleC, moduleD)
+	g.Connect(moduleA, moduleD)
+	g.Last(moduleD)
+
+	expected := []*Module{moduleD, moduleC, moduleB, moduleA}
+	received := g.prioritizedModules()
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("Unexpected module at priority %d."+
+				"\n\tExpected: %s\n\tReceived: %s", i, expected[i].Name,
+				received[i].Name)
+		}
+	}
+}
+
+// Tests that when the input of a graph run on workers stalls, a single
+// ModuleTimeoutError is reported for the module which stopped receiving input
+// first, not for the modules downstream of it
+func TestGraph_WorkerPool_Timeout(t *testing.T) {
+	gc := MustNewGraphGenerator(4, 1, 1, 0)
+	gc.SetNumWorkers(2)
+	g := gc.NewGraph("TimeoutTest", &Stream1{})
+
+	moduleA := ModuleA.DeepCopy()
+	moduleA.Timeout = 50 * time.Millisecond
+	moduleB := ModuleB.DeepCopy()
+	moduleB.Timeout = 50 * time.Millisecond
+
+	g.First(moduleA)
+	g.Connect(moduleA, moduleB)
+	g.Last(moduleB)
+
+	errs := make(chan error, 10)
+	err := g.Build(16, func(graph, module string, err error) {
+		errs <- err
+	})
+	if err != nil {
+		t.Fatalf("Build returned an error: %+v", err)
+	}
+	roundBuf := RoundBuffer{}
+	roundBuf.Build(g.GetExpandedBatchSize())
+	g.Link(initDispatchGroup(), &roundBuf)
+	g.Run(context.Background())
+
+	// Send part of the batch so that both modules make progress before the
+	// input stalls
+	go func() {
+		for i := uint32(0); i < g.GetBatchSize()/2; i++ {
+			g.Send(NewChunk(i, i+1), nil)
+		}
+	}()
+
+	select {
+	case err := <-errs:
+		timeoutErr, ok := err.(*ModuleTimeoutError)
+		if !ok {
+			t.Fatalf("Unexpected error type: %T", err)
+		}
+		if timeoutErr.Module != moduleA.Name {
+			t.Errorf("Unexpected module timed out."+
+				"\n\tExpected: %s\n\tReceived: %s", moduleA.Name,
+				timeoutErr.Module)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Worker did not time out")
+	}
+
+	if !g.Kill(time.Second) {
+		t.Errorf("Workers did not exit after timing out")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if len(errs) != 0 {
+		t.Errorf("Timeout was reported more than once: %v", <-errs)
+	}
+}
+
+// Runs the graph of TestGraph with NumThreads goroutines for each module
+func BenchmarkGraph_ModuleThreads(b *testing.B) {
+	benchmarkSchedulerGraph(b, 0)
+}
+
+// Runs the graph of TestGraph on a pool with a worker per CPU
+func BenchmarkGraph_WorkerPool(b *testing.B) {
+	benchmarkSchedulerGraph(b, uint8(runtime.NumCPU()))
+}
+
+func benchmarkSchedulerGraph(b *testing.B, numWorkers uint8) {
+	for n := 0; n < b.N; n++ {
+		g := runSchedulerTestGraph(10000, numWorkers)
+		for _, ok := g.GetOutput(); ok; _, ok = g.GetOutput() {
+		}
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	bolt "go.etcd.io/bbolt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -23,9 +25,49 @@ import (
 // DbTimeout determines maximum runtime (in seconds) of specific DB queries
 const DbTimeout = 1
 
-// TODO: Remove this once RequestClientKey is properly tested
 // Interface declaration for storage methods
 type database interface {
+	secretDatabase
+	roundDatabase
+	clientErrorDatabase
+	registrationDatabase
+}
+
+// Storage methods for node secrets and the node's ephemeral keypair
+type secretDatabase interface {
+	UpsertSecret(secret *StoredSecret) error
+	GetSecrets() ([]*StoredSecret, error)
+	DeleteSecret(keyId int) error
+
+	UpsertEphemeralKey(key *EphemeralKey) error
+	GetEphemeralKey() (*EphemeralKey, error)
+}
+
+// Storage methods for the history of rounds the node has participated in
+type roundDatabase interface {
+	UpsertRound(round *RoundRecord) error
+	GetRound(roundId id.Round) (*RoundRecord, error)
+	GetRounds(start, end time.Time) ([]*RoundRecord, error)
+	CountRounds(filter RoundFilter) (int64, error)
+
+	UpsertRoundPhases(phases []*RoundPhaseRecord) error
+	GetRoundPhases(roundId id.Round) ([]*RoundPhaseRecord, error)
+}
+
+// Storage methods for errors reported by clients during realtime
+type clientErrorDatabase interface {
+	InsertClientError(clientError *ClientErrorRecord) error
+	GetClientErrors(limit int) ([]*ClientErrorRecord, error)
+	DeleteClientErrors(ids []uint64) error
+
+	IncrementClientErrorCount(errType string) error
+	GetClientErrorCounts() ([]*ClientErrorCount, error)
+}
+
+// Storage methods for client registrations served by the node
+type registrationDatabase interface {
+	UpsertClientRegistration(registration *ClientRegistration) error
+	GetClientRegistration(userId *id.ID) (*ClientRegistration, error)
 }
 
 // DatabaseImpl Struct implementing the database Interface with an underlying DB
@@ -33,30 +75,166 @@ type DatabaseImpl struct {
 	db *gorm.DB // Stored database connection
 }
 
+// BoltImpl Struct implementing the database Interface with an underlying
+// embedded file database
+type BoltImpl struct {
+	db *bolt.DB // Stored database file
+}
+
 // MapImpl Struct implementing the database Interface with an underlying Map
 type MapImpl struct {
-	sync.Mutex
+	secrets           map[int]*StoredSecret
+	ephemeralKey      *EphemeralKey
+	rounds            map[id.Round]*RoundRecord
+	roundPhases       map[id.Round][]*RoundPhaseRecord
+	clientErrors      map[uint64]*ClientErrorRecord
+	lastClientErrorId uint64
+	clientErrorCounts map[string]uint64
+	registrations     map[id.ID]*ClientRegistration
+	sync.RWMutex
 }
 
+// StoredSecret is the persistent form of a NodeSecret, keyed by its key ID
+type StoredSecret struct {
+	KeyId     int       `gorm:"primaryKey;autoIncrement:false"`
+	Secret    []byte    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+	// Zero if the secret never expires
+	ValidUntil time.Time
+
+	// Key wrapping metadata. WrapAlgorithm is empty if Secret is stored in
+	// plaintext, otherwise Secret is encrypted under the key identified by
+	// WrapKeyId using Nonce
+	WrapAlgorithm string
+	WrapKeyId     []byte
+	Nonce         []byte
+}
+
+// EphemeralKey holds the node's ephemeral keypair used for client key
+// requests. Only a single row, with Id ephemeralKeyId, is ever stored
+type EphemeralKey struct {
+	Id         uint8  `gorm:"primaryKey;autoIncrement:false"`
+	PublicKey  []byte `gorm:"not null"`
+	PrivateKey []byte `gorm:"not null"`
+
+	// Key wrapping metadata of PrivateKey, as in StoredSecret
+	WrapAlgorithm string
+	WrapKeyId     []byte
+	Nonce         []byte
+}
+
+// RoundRecord holds the history of a round the node participated in
+type RoundRecord struct {
+	Id        uint64 `gorm:"primaryKey;autoIncrement:false"`
+	BatchSize uint32 `gorm:"not null"`
+	// Marshalled IDs of the nodes in the round, in topological order
+	Topology   []byte    `gorm:"not null"`
+	StartedAt  time.Time `gorm:"not null;index"`
+	FinishedAt time.Time
+	// Either RoundCompleted or RoundFailed
+	Outcome string `gorm:"index"`
+	// Phase the node was in when the round failed
+	FailedPhase string
+	// Empty if the round completed successfully
+	Error string
+}
+
+// Outcomes of a round recorded in RoundRecord.Outcome
+const (
+	RoundCompleted = "completed"
+	RoundFailed    = "failed"
+)
+
+// RoundPhaseRecord holds the timing of a single phase of a round
+type RoundPhaseRecord struct {
+	RoundId    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Phase      string `gorm:"primaryKey"`
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// RoundFilter selects the RoundRecords counted by CountRounds. Zero valued
+// fields match every round. For example, the number of rounds which failed
+// in realtime decrypt in the last week is counted by
+//
+//	RoundFilter{Start: time.Now().Add(-7 * 24 * time.Hour),
+//		Outcome: RoundFailed, FailedPhase: "RealDecrypt"}
+type RoundFilter struct {
+	// Matches rounds started within [Start, End)
+	Start time.Time
+	End   time.Time
+
+	Outcome     string
+	FailedPhase string
+}
+
+// Returns true if the RoundRecord is selected by the filter
+func (f RoundFilter) matches(round *RoundRecord) bool {
+	return (f.Start.IsZero() || !round.StartedAt.Before(f.Start)) &&
+		(f.End.IsZero() || round.StartedAt.Before(f.End)) &&
+		(f.Outcome == "" || round.Outcome == f.Outcome) &&
+		(f.FailedPhase == "" || round.FailedPhase == f.FailedPhase)
+}
+
+// ClientErrorRecord holds an error with a client's message in a round
+type ClientErrorRecord struct {
+	Id        uint64    `gorm:"primaryKey"`
+	RoundId   uint64    `gorm:"not null;index"`
+	ClientId  []byte    `gorm:"not null"`
+	Error     string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// ClientErrorCount holds the total number of client errors of a type reported
+// by the node
+type ClientErrorCount struct {
+	Type  string `gorm:"primaryKey"`
+	Count uint64 `gorm:"not null"`
+}
+
+// ClientRegistration records the node secret a client's key was derived
+// from when it last registered with the node
+type ClientRegistration struct {
+	UserId       []byte    `gorm:"primaryKey"`
+	KeyId        int       `gorm:"not null"`
+	RegisteredAt time.Time `gorm:"not null"`
+}
+
+// Id of the single EphemeralKey row
+const ephemeralKeyId = 1
+
 // Initialize the database interface with database backend
 // Returns a database interface, close function, and error
-func newDatabase(username, password, dbName, address, port string, devMode bool) (database, error) {
+func newDatabase(username, password, dbName, address, port, path string,
+	devMode bool) (database, error) {
 	var err error
 	var db *gorm.DB
 
 	// Connect to the database if the correct information is provided
 	if address != "" && port != "" {
-		// Create the database connection
-		connectString := fmt.Sprintf(
-			"host=%s port=%s user=%s dbname=%s sslmode=disable",
-			address, port, username, dbName)
-		// Handle empty database password
-		if len(password) > 0 {
-			connectString += fmt.Sprintf(" password=%s", password)
+		db, err = openDatabase(username, password, dbName, address, port)
+	}
+
+	// Return the file-backend interface if a database file is provided for a
+	// local test network which does not configure Postgres
+	if devMode && (address == "" || port == "") && path != "" {
+		boltImpl, err := newBoltImpl(path)
+		if err != nil {
+			return database(&BoltImpl{}), err
 		}
-		db, err = gorm.Open(postgres.Open(connectString), &gorm.Config{
-			Logger: logger.New(jww.TRACE, logger.Config{LogLevel: logger.Info}),
-		})
+
+		jww.INFO.Printf("File backend initialized successfully at %s!", path)
+		return database(boltImpl), nil
+	}
+
+	// A configured database which cannot be reached must not be silently
+	// replaced by the database file
+	if err != nil && path != "" {
+		return database(&DatabaseImpl{}), errors.WithMessage(err,
+			"Unable to initialize database backend")
+	}
+	if !devMode && path != "" {
+		jww.WARN.Printf("Ignoring database file %s outside of devMode", path)
 	}
 
 	// Return the map-backend interface
@@ -78,15 +256,58 @@ func newDatabase(username, password, dbName, address, port string, devMode bool)
 		}
 
 		defer jww.INFO.Println("Map backend initialized successfully!")
-		mapImpl := &MapImpl{}
+		mapImpl := newMapImpl()
 
 		return database(mapImpl), nil
 	}
 
+	// Bring the database schema up to date
+	_, err = migrate(db)
+	if err != nil {
+		// As when it cannot be reached, a database which cannot be migrated
+		// is replaced by the map backend in devMode, unless a database file
+		// was configured or the schema belongs to a newer version
+		if !devMode || path != "" || errors.Is(err, ErrSchemaTooNew) {
+			return database(&DatabaseImpl{}), errors.WithMessage(err,
+				"Unable to migrate database schema")
+		}
+
+		jww.WARN.Printf("Unable to migrate database schema, using the "+
+			"map backend: %+v", err)
+		return database(newMapImpl()), nil
+	}
+
+	// Build the interface, retrying calls which fail due to a brief outage
+	di := &DatabaseImpl{
+		db: db,
+	}
+	rd := newResilientDatabase(di, di.ping, defaultResilienceParams())
+
+	jww.INFO.Println("Database backend initialized successfully!")
+	return database(rd), nil
+}
+
+// Connects to the Postgres database and configures its connection pool
+func openDatabase(username, password, dbName, address, port string) (*gorm.DB, error) {
+	// Create the database connection
+	connectString := fmt.Sprintf(
+		"host=%s port=%s user=%s dbname=%s sslmode=disable",
+		address, port, username, dbName)
+	// Handle empty database password
+	if len(password) > 0 {
+		connectString += fmt.Sprintf(" password=%s", password)
+	}
+	db, err := gorm.Open(postgres.Open(connectString), &gorm.Config{
+		Logger: logger.New(jww.TRACE, logger.Config{LogLevel: logger.Info}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	// Get and configure the internal database ConnPool
 	sqlDb, err := db.DB()
 	if err != nil {
-		return database(&DatabaseImpl{}), errors.Errorf("Unable to configure database connection pool: %+v", err)
+		return nil, errors.Errorf("Unable to configure database connection pool: %+v", err)
 	}
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
 	sqlDb.SetMaxIdleConns(10)
@@ -97,21 +318,5 @@ func newDatabase(username, password, dbName, address, port string, devMode bool)
 	// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
 	sqlDb.SetConnMaxLifetime(12 * time.Hour)
 
-	// Initialize the database schema
-	// WARNING: Order is important. Do not change without database testing
-	models := []interface{}{}
-	for _, model := range models {
-		err = db.AutoMigrate(model)
-		if err != nil {
-			return database(&DatabaseImpl{}), err
-		}
-	}
-
-	// Build the interface
-	di := &DatabaseImpl{
-		db: db,
-	}
-
-	jww.INFO.Println("Database backend initialized successfully!")
-	return database(di), nil
+	return db, nil
 }
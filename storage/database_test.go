@@ -0,0 +1,509 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gitlab.com/xx_network/primitives/id"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Environment variable holding the DSN of the Postgres database used by the
+// Postgres tests, e.g. "host=127.0.0.1 port=5432 user=cmix dbname=cmix_test".
+// The tests are skipped if it is not set.
+const testDsnEnv = "CMIX_TEST_DSN"
+
+// Name of the production database created by configure_postgres.sh, which the
+// tests refuse to run against
+const productionDbName = "cmix_server"
+
+// Every database implementation must pass each of these tests. Each test is
+// given a freshly initialized, empty database
+var conformanceTests = []struct {
+	name string
+	test func(t *testing.T, db database)
+}{
+	{"Secrets", testConformanceSecrets},
+	{"EphemeralKey", testConformanceEphemeralKey},
+	{"Rounds", testConformanceRounds},
+	{"CountRounds", testConformanceCountRounds},
+	{"RoundPhases", testConformanceRoundPhases},
+	{"ClientErrors", testConformanceClientErrors},
+	{"ClientErrorCounts", testConformanceClientErrorCounts},
+	{"ClientRegistrations", testConformanceClientRegistrations},
+}
+
+// Runs the conformance tests against the map backend
+func TestMapImpl_Conformance(t *testing.T) {
+	runConformanceTests(t, func(t *testing.T) database {
+		return newMapImpl()
+	})
+}
+
+// Runs the conformance tests against the Postgres backend given by
+// CMIX_TEST_DSN, if set
+func TestDatabaseImpl_Conformance(t *testing.T) {
+	runConformanceTests(t, newTestDatabaseImpl)
+}
+
+// Runs the conformance tests against the file backend
+func TestBoltImpl_Conformance(t *testing.T) {
+	runConformanceTests(t, func(t *testing.T) database {
+		return newTestBoltImpl(t)
+	})
+}
+
+// Runs every conformance test against a new database from newDb
+func runConformanceTests(t *testing.T, newDb func(t *testing.T) database) {
+	for _, ct := range conformanceTests {
+		t.Run(ct.name, func(t *testing.T) {
+			ct.test(t, newDb(t))
+		})
+	}
+}
+
+// Connects to the Postgres database given by CMIX_TEST_DSN and migrates a new,
+// empty schema which is dropped when the test finishes. Skips the test if no
+// DSN is set.
+func newTestDatabaseImpl(t *testing.T) database {
+	dsn := os.Getenv(testDsnEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set, skipping Postgres tests", testDsnEnv)
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Could not connect to %s: %+v", testDsnEnv, err)
+	}
+	var dbName string
+	if err = admin.Raw("SELECT current_database()").Scan(&dbName).Error; err != nil {
+		t.Fatalf("Could not get the name of the test database: %+v", err)
+	}
+	if dbName == productionDbName {
+		t.Fatalf("Refusing to run tests against the %s database", dbName)
+	}
+
+	// Every test gets its own schema so no existing data is touched
+	schema := fmt.Sprintf("cmix_test_%d", time.Now().UnixNano())
+	if err = admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("Could not create test schema %s: %+v", schema, err)
+	}
+
+	separator := " "
+	if strings.Contains(dsn, "://") {
+		separator = "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+	}
+	db, err := gorm.Open(postgres.Open(dsn+separator+"search_path="+schema),
+		&gorm.Config{})
+	if err != nil {
+		t.Fatalf("Could not connect to test schema %s: %+v", schema, err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDb, err := db.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+		if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+			t.Errorf("Could not drop test schema %s: %+v", schema, err)
+		}
+		if sqlDb, err := admin.DB(); err == nil {
+			_ = sqlDb.Close()
+		}
+	})
+
+	if _, err = migrate(db); err != nil {
+		t.Fatalf("Could not migrate test schema %s: %+v", schema, err)
+	}
+
+	return &DatabaseImpl{db: db}
+}
+
+func testConformanceSecrets(t *testing.T, db database) {
+	secrets, err := db.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(secrets) != 0 {
+		t.Fatalf("Expected no secrets in new database, got %d", len(secrets))
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	for _, keyId := range []int{2, 0, 1} {
+		err = db.UpsertSecret(&StoredSecret{
+			KeyId:      keyId,
+			Secret:     []byte{byte(keyId)},
+			CreatedAt:  now,
+			ValidUntil: now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("UpsertSecret error: %+v", err)
+		}
+	}
+
+	// Overwrite an existing secret
+	err = db.UpsertSecret(&StoredSecret{
+		KeyId:     1,
+		Secret:    []byte("overwritten"),
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+
+	secrets, err = db.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(secrets) != 3 {
+		t.Fatalf("Expected 3 secrets, got %d", len(secrets))
+	}
+	for i, secret := range secrets {
+		if secret.KeyId != i {
+			t.Errorf("Secrets not ordered by key ID."+
+				"\n\tExpected: %d\n\tReceived: %d", i, secret.KeyId)
+		}
+	}
+	if !bytes.Equal(secrets[1].Secret, []byte("overwritten")) ||
+		!secrets[1].ValidUntil.IsZero() {
+		t.Errorf("Secret was not overwritten: %+v", secrets[1])
+	}
+	if !secrets[2].ValidUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected ValidUntil.\n\tExpected: %s\n\tReceived: %s",
+			now.Add(time.Hour), secrets[2].ValidUntil)
+	}
+
+	err = db.DeleteSecret(0)
+	if err != nil {
+		t.Fatalf("DeleteSecret error: %+v", err)
+	}
+	secrets, err = db.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(secrets) != 2 || secrets[0].KeyId != 1 {
+		t.Errorf("Secret was not deleted: %+v", secrets)
+	}
+}
+
+func testConformanceEphemeralKey(t *testing.T, db database) {
+	_, err := db.GetEphemeralKey()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Expected %v, received %v", gorm.ErrRecordNotFound, err)
+	}
+
+	for _, suffix := range []string{"1", "2"} {
+		err = db.UpsertEphemeralKey(&EphemeralKey{
+			PublicKey:     []byte("pub" + suffix),
+			PrivateKey:    []byte("priv" + suffix),
+			WrapAlgorithm: "alg" + suffix,
+			WrapKeyId:     []byte("keyId" + suffix),
+			Nonce:         []byte("nonce" + suffix),
+		})
+		if err != nil {
+			t.Fatalf("UpsertEphemeralKey error: %+v", err)
+		}
+	}
+
+	key, err := db.GetEphemeralKey()
+	if err != nil {
+		t.Fatalf("GetEphemeralKey error: %+v", err)
+	}
+	if !bytes.Equal(key.PublicKey, []byte("pub2")) ||
+		!bytes.Equal(key.PrivateKey, []byte("priv2")) ||
+		key.WrapAlgorithm != "alg2" || !bytes.Equal(key.WrapKeyId, []byte("keyId2")) ||
+		!bytes.Equal(key.Nonce, []byte("nonce2")) {
+		t.Errorf("Ephemeral key was not overwritten: %+v", key)
+	}
+}
+
+func testConformanceRounds(t *testing.T, db database) {
+	_, err := db.GetRound(1)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Expected %v, received %v", gorm.ErrRecordNotFound, err)
+	}
+
+	start := time.Now().Truncate(time.Microsecond)
+	for i := uint64(1); i <= 3; i++ {
+		err = db.UpsertRound(&RoundRecord{
+			Id:        i,
+			BatchSize: 32,
+			Topology:  id.NewIdFromUInt(i, id.Node, t).Marshal(),
+			StartedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("UpsertRound error: %+v", err)
+		}
+	}
+
+	// Finish round 2 with an error
+	finished := start.Add(3 * time.Minute)
+	err = db.UpsertRound(&RoundRecord{
+		Id:         2,
+		BatchSize:  32,
+		Topology:   id.NewIdFromUInt(2, id.Node, t).Marshal(),
+		StartedAt:  start.Add(2 * time.Minute),
+		FinishedAt: finished,
+		Error:      "round failed",
+	})
+	if err != nil {
+		t.Fatalf("UpsertRound error: %+v", err)
+	}
+
+	round, err := db.GetRound(2)
+	if err != nil {
+		t.Fatalf("GetRound error: %+v", err)
+	}
+	if round.Error != "round failed" || !round.FinishedAt.Equal(finished) ||
+		round.BatchSize != 32 ||
+		!bytes.Equal(round.Topology, id.NewIdFromUInt(2, id.Node, t).Marshal()) {
+		t.Errorf("Round was not overwritten: %+v", round)
+	}
+
+	rounds, err := db.GetRounds(start.Add(2*time.Minute), start.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("GetRounds error: %+v", err)
+	}
+	if len(rounds) != 1 || rounds[0].Id != 2 {
+		t.Errorf("GetRounds returned unexpected rounds: %+v", rounds)
+	}
+
+	rounds, err = db.GetRounds(start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetRounds error: %+v", err)
+	}
+	if len(rounds) != 3 {
+		t.Fatalf("Expected 3 rounds, got %d", len(rounds))
+	}
+	for i, r := range rounds {
+		if r.Id != uint64(i+1) {
+			t.Errorf("Rounds not ordered by ID.\n\tExpected: %d\n\tReceived: %d",
+				i+1, r.Id)
+		}
+	}
+}
+
+func testConformanceCountRounds(t *testing.T, db database) {
+	start := time.Now().Truncate(time.Microsecond)
+	rounds := []*RoundRecord{
+		{Id: 1, StartedAt: start, Outcome: RoundCompleted},
+		{Id: 2, StartedAt: start.Add(time.Hour), Outcome: RoundFailed,
+			FailedPhase: "RealDecrypt", Error: "decrypt failed"},
+		{Id: 3, StartedAt: start.Add(2 * time.Hour), Outcome: RoundFailed,
+			FailedPhase: "RealPermute", Error: "permute failed"},
+		{Id: 4, StartedAt: start.Add(3 * time.Hour), Outcome: RoundFailed,
+			FailedPhase: "RealDecrypt", Error: "decrypt failed"},
+	}
+	for _, r := range rounds {
+		r.Topology = id.NewIdFromUInt(r.Id, id.Node, t).Marshal()
+		if err := db.UpsertRound(r); err != nil {
+			t.Fatalf("UpsertRound error: %+v", err)
+		}
+	}
+
+	tests := []struct {
+		filter   RoundFilter
+		expected int64
+	}{
+		{RoundFilter{}, 4},
+		{RoundFilter{Outcome: RoundCompleted}, 1},
+		{RoundFilter{Outcome: RoundFailed}, 3},
+		{RoundFilter{Outcome: RoundFailed, FailedPhase: "RealDecrypt"}, 2},
+		{RoundFilter{Outcome: RoundFailed, FailedPhase: "RealDecrypt",
+			End: start.Add(3 * time.Hour)}, 1},
+		{RoundFilter{Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)}, 2},
+		{RoundFilter{FailedPhase: "PrecompShare"}, 0},
+	}
+	for i, tt := range tests {
+		count, err := db.CountRounds(tt.filter)
+		if err != nil {
+			t.Fatalf("CountRounds error: %+v", err)
+		}
+		if count != tt.expected {
+			t.Errorf("Unexpected count for filter %d (%+v)."+
+				"\n\tExpected: %d\n\tReceived: %d", i, tt.filter, tt.expected, count)
+		}
+	}
+}
+
+func testConformanceRoundPhases(t *testing.T, db database) {
+	phases, err := db.GetRoundPhases(1)
+	if err != nil {
+		t.Fatalf("GetRoundPhases error: %+v", err)
+	}
+	if len(phases) != 0 {
+		t.Fatalf("Expected no phases in new database, got %d", len(phases))
+	}
+
+	start := time.Now().Truncate(time.Microsecond)
+	err = db.UpsertRoundPhases([]*RoundPhaseRecord{
+		{RoundId: 1, Phase: "RealPermute", StartedAt: start.Add(time.Second),
+			FinishedAt: start.Add(2 * time.Second)},
+		{RoundId: 1, Phase: "RealDecrypt", StartedAt: start,
+			FinishedAt: start.Add(time.Second)},
+		{RoundId: 2, Phase: "RealDecrypt", StartedAt: start,
+			FinishedAt: start.Add(time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("UpsertRoundPhases error: %+v", err)
+	}
+
+	// Overwrite an existing phase
+	err = db.UpsertRoundPhases([]*RoundPhaseRecord{
+		{RoundId: 1, Phase: "RealPermute", StartedAt: start.Add(time.Second),
+			FinishedAt: start.Add(3 * time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("UpsertRoundPhases error: %+v", err)
+	}
+
+	phases, err = db.GetRoundPhases(1)
+	if err != nil {
+		t.Fatalf("GetRoundPhases error: %+v", err)
+	}
+	if len(phases) != 2 || phases[0].Phase != "RealDecrypt" ||
+		phases[1].Phase != "RealPermute" {
+		t.Fatalf("GetRoundPhases returned unexpected phases: %+v", phases)
+	}
+	if !phases[1].FinishedAt.Equal(start.Add(3 * time.Second)) {
+		t.Errorf("Phase was not overwritten: %+v", phases[1])
+	}
+}
+
+func testConformanceClientErrors(t *testing.T, db database) {
+	now := time.Now().Truncate(time.Microsecond)
+	clientId := id.NewIdFromString("client", id.User, t)
+	inserted := []*ClientErrorRecord{
+		{RoundId: 1, ClientId: clientId.Marshal(), Error: "first", CreatedAt: now},
+		{RoundId: 2, ClientId: clientId.Marshal(), Error: "other", CreatedAt: now},
+		{RoundId: 1, ClientId: clientId.Marshal(), Error: "second", CreatedAt: now},
+	}
+	ids := make(map[uint64]bool)
+	for _, ce := range inserted {
+		err := db.InsertClientError(ce)
+		if err != nil {
+			t.Fatalf("InsertClientError error: %+v", err)
+		}
+		if ce.Id == 0 || ids[ce.Id] {
+			t.Errorf("InsertClientError did not assign a unique ID: %d", ce.Id)
+		}
+		ids[ce.Id] = true
+	}
+
+	// Errors of every round are returned, oldest first
+	errs, err := db.GetClientErrors(0)
+	if err != nil {
+		t.Fatalf("GetClientErrors error: %+v", err)
+	}
+	if len(errs) != 3 || errs[0].Error != "first" ||
+		errs[1].Error != "other" || errs[2].Error != "second" {
+		t.Errorf("GetClientErrors returned unexpected errors: %+v", errs)
+	}
+	if !bytes.Equal(errs[0].ClientId, clientId.Marshal()) {
+		t.Errorf("Unexpected client ID.\n\tExpected: %v\n\tReceived: %v",
+			clientId.Marshal(), errs[0].ClientId)
+	}
+
+	errs, err = db.GetClientErrors(2)
+	if err != nil {
+		t.Fatalf("GetClientErrors error: %+v", err)
+	}
+	if len(errs) != 2 || errs[0].Error != "first" || errs[1].Error != "other" {
+		t.Errorf("GetClientErrors did not return the oldest errors: %+v", errs)
+	}
+
+	// Only the errors with the given IDs are deleted
+	err = db.DeleteClientErrors([]uint64{inserted[0].Id, inserted[2].Id})
+	if err != nil {
+		t.Fatalf("DeleteClientErrors error: %+v", err)
+	}
+	errs, err = db.GetClientErrors(0)
+	if err != nil {
+		t.Fatalf("GetClientErrors error: %+v", err)
+	}
+	if len(errs) != 1 || errs[0].Id != inserted[1].Id {
+		t.Errorf("Unexpected client errors after deletion: %+v", errs)
+	}
+}
+
+func testConformanceClientErrorCounts(t *testing.T, db database) {
+	counts, err := db.GetClientErrorCounts()
+	if err != nil {
+		t.Fatalf("GetClientErrorCounts error: %+v", err)
+	}
+	if len(counts) != 0 {
+		t.Fatalf("Expected no counts in new database, got %d", len(counts))
+	}
+
+	for _, errType := range []string{"SecretNotFound", "InvalidMAC", "InvalidMAC"} {
+		if err = db.IncrementClientErrorCount(errType); err != nil {
+			t.Fatalf("IncrementClientErrorCount error: %+v", err)
+		}
+	}
+
+	counts, err = db.GetClientErrorCounts()
+	if err != nil {
+		t.Fatalf("GetClientErrorCounts error: %+v", err)
+	}
+	expected := []*ClientErrorCount{
+		{Type: "InvalidMAC", Count: 2},
+		{Type: "SecretNotFound", Count: 1},
+	}
+	if len(counts) != len(expected) {
+		t.Fatalf("Unexpected counts: %+v", counts)
+	}
+	for i := range expected {
+		if *counts[i] != *expected[i] {
+			t.Errorf("Unexpected count.\n\tExpected: %+v\n\tReceived: %+v",
+				expected[i], counts[i])
+		}
+	}
+}
+
+func testConformanceClientRegistrations(t *testing.T, db database) {
+	userId := id.NewIdFromString("user", id.User, t)
+
+	_, err := db.GetClientRegistration(userId)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Expected %v, received %v", gorm.ErrRecordNotFound, err)
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	for keyId := 0; keyId < 2; keyId++ {
+		err = db.UpsertClientRegistration(&ClientRegistration{
+			UserId:       userId.Marshal(),
+			KeyId:        keyId,
+			RegisteredAt: now.Add(time.Duration(keyId) * time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("UpsertClientRegistration error: %+v", err)
+		}
+	}
+
+	registration, err := db.GetClientRegistration(userId)
+	if err != nil {
+		t.Fatalf("GetClientRegistration error: %+v", err)
+	}
+	if registration.KeyId != 1 || !registration.RegisteredAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Registration was not overwritten: %+v", registration)
+	}
+
+	_, err = db.GetClientRegistration(id.NewIdFromString("other", id.User, t))
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected %v, received %v", gorm.ErrRecordNotFound, err)
+	}
+}
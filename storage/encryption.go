@@ -0,0 +1,349 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles encryption of node secrets and the ephemeral private key at rest
+
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"gitlab.com/xx_network/primitives/utils"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+	"gorm.io/gorm"
+	"io"
+	"time"
+)
+
+// Wrapping algorithms recorded alongside each stored secret
+const (
+	// Secret is stored in plaintext. Used by databases written before
+	// secrets were encrypted and when no SecretWrapper is configured
+	wrapNone = ""
+	// Secret is encrypted with XChaCha20-Poly1305
+	wrapXChaCha20Poly1305 = "xchacha20poly1305"
+)
+
+// HKDF info strings separating the wrapping key from its identifier
+const (
+	wrapKeyInfo   = "xx network node secret wrapping key"
+	wrapKeyIdInfo = "xx network node secret wrapping key ID"
+)
+
+// Length of the identifier stored with each wrapped secret
+const wrapKeyIdLen = 16
+
+// Minimum length of the contents of a wrapping key file
+const minWrapKeyMaterialLen = 32
+
+// Error constants
+const (
+	WrongWrapKeyError         = "Node secret %d was encrypted with a different key; run `server db reencrypt` with the previous key"
+	UnknownWrapAlgorithmError = "Node secret %d was encrypted with unknown algorithm %q"
+
+	WrongEphemeralWrapKeyError         = "Ephemeral private key was encrypted with a different key; run `server db reencrypt` with the previous key"
+	UnknownEphemeralWrapAlgorithmError = "Ephemeral private key was encrypted with unknown algorithm %q"
+)
+
+// Additional data authenticated with the wrapped ephemeral private key. It is
+// longer than the additional data of node secrets, so neither ciphertext can
+// be substituted for the other.
+var ephemeralAdditionalData = []byte("xx network node ephemeral private key")
+
+// SecretWrapper encrypts node secrets before they are persisted using an
+// AEAD key derived from the node's RSA private key or a separate key file.
+type SecretWrapper struct {
+	aead cipher.AEAD
+	// Identifies the wrapping key so secrets wrapped under a different key
+	// can be detected
+	keyId []byte
+}
+
+// NewSecretWrapper derives a SecretWrapper from the given key material, which
+// must be at least 32 bytes of high entropy data.
+func NewSecretWrapper(keyMaterial []byte) (*SecretWrapper, error) {
+	if len(keyMaterial) < minWrapKeyMaterialLen {
+		return nil, errors.Errorf("Secret wrapping key material must be at "+
+			"least %d bytes, received %d", minWrapKeyMaterialLen, len(keyMaterial))
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, keyMaterial, nil,
+		[]byte(wrapKeyInfo)), key)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not derive secret wrapping key")
+	}
+
+	keyId := make([]byte, wrapKeyIdLen)
+	_, err = io.ReadFull(hkdf.New(sha256.New, keyMaterial, nil,
+		[]byte(wrapKeyIdInfo)), keyId)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not derive secret wrapping key ID")
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretWrapper{aead: aead, keyId: keyId}, nil
+}
+
+// NewSecretWrapperFromRSA derives a SecretWrapper from the node's RSA
+// private key.
+func NewSecretWrapperFromRSA(key *rsa.PrivateKey) (*SecretWrapper, error) {
+	if key == nil {
+		return nil, errors.New("Cannot derive secret wrapping key from nil RSA key")
+	}
+	return NewSecretWrapper(key.GetD().Bytes())
+}
+
+// NewSecretWrapperFromFile derives a SecretWrapper from the file at the
+// given path. If the file contains a PEM encoded RSA private key then the
+// wrapping key is derived from that key, otherwise the raw file contents are
+// used as key material.
+func NewSecretWrapperFromFile(path string) (*SecretWrapper, error) {
+	contents, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithMessagef(err,
+			"Could not read secret wrapping key file %s", path)
+	}
+
+	if key, err := rsa.LoadPrivateKeyFromPem(contents); err == nil {
+		return NewSecretWrapperFromRSA(key)
+	}
+
+	return NewSecretWrapper(bytes.TrimSpace(contents))
+}
+
+// Encrypts the given secret into the StoredSecret, recording the metadata
+// required to decrypt it. The key ID is authenticated so a ciphertext cannot
+// be moved to another key ID.
+func (sw *SecretWrapper) wrap(stored *StoredSecret, secret []byte) error {
+	ciphertext, nonce, err := sw.seal(secret, wrapAdditionalData(stored.KeyId))
+	if err != nil {
+		return err
+	}
+
+	stored.Secret = ciphertext
+	stored.Nonce = nonce
+	stored.WrapAlgorithm = wrapXChaCha20Poly1305
+	stored.WrapKeyId = sw.keyId
+	return nil
+}
+
+// Encrypts the given private key into the EphemeralKey, recording the
+// metadata required to decrypt it.
+func (sw *SecretWrapper) wrapEphemeral(key *EphemeralKey, privateKey []byte) error {
+	ciphertext, nonce, err := sw.seal(privateKey, ephemeralAdditionalData)
+	if err != nil {
+		return err
+	}
+
+	key.PrivateKey = ciphertext
+	key.Nonce = nonce
+	key.WrapAlgorithm = wrapXChaCha20Poly1305
+	key.WrapKeyId = sw.keyId
+	return nil
+}
+
+// Encrypts the plaintext under a new random nonce. Returns the ciphertext and
+// the nonce.
+func (sw *SecretWrapper) seal(plaintext, additionalData []byte) ([]byte, []byte, error) {
+	nonce := make([]byte, sw.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, errors.WithMessage(err, "Could not generate secret wrapping nonce")
+	}
+	return sw.aead.Seal(nil, nonce, plaintext, additionalData), nonce, nil
+}
+
+// Returns the plaintext of the StoredSecret. Secrets stored without wrapping
+// are returned as is.
+func (sw *SecretWrapper) unwrap(stored *StoredSecret) ([]byte, error) {
+	switch stored.WrapAlgorithm {
+	case wrapNone:
+		return stored.Secret, nil
+	case wrapXChaCha20Poly1305:
+	default:
+		return nil, errors.Errorf(UnknownWrapAlgorithmError, stored.KeyId,
+			stored.WrapAlgorithm)
+	}
+
+	if sw == nil || !bytes.Equal(sw.keyId, stored.WrapKeyId) {
+		return nil, errors.Errorf(WrongWrapKeyError, stored.KeyId)
+	}
+
+	secret, err := sw.aead.Open(nil, stored.Nonce, stored.Secret,
+		wrapAdditionalData(stored.KeyId))
+	if err != nil {
+		return nil, errors.WithMessagef(err,
+			"Could not decrypt node secret %d", stored.KeyId)
+	}
+	return secret, nil
+}
+
+// Returns the plaintext private key of the EphemeralKey. Keys stored without
+// wrapping are returned as is.
+func (sw *SecretWrapper) unwrapEphemeral(key *EphemeralKey) ([]byte, error) {
+	switch key.WrapAlgorithm {
+	case wrapNone:
+		return key.PrivateKey, nil
+	case wrapXChaCha20Poly1305:
+	default:
+		return nil, errors.Errorf(UnknownEphemeralWrapAlgorithmError,
+			key.WrapAlgorithm)
+	}
+
+	if sw == nil || !bytes.Equal(sw.keyId, key.WrapKeyId) {
+		return nil, errors.New(WrongEphemeralWrapKeyError)
+	}
+
+	privateKey, err := sw.aead.Open(nil, key.Nonce, key.PrivateKey,
+		ephemeralAdditionalData)
+	if err != nil {
+		return nil, errors.WithMessage(err,
+			"Could not decrypt ephemeral private key")
+	}
+	return privateKey, nil
+}
+
+// Returns true if the StoredSecret is wrapped with this SecretWrapper's key.
+// A nil SecretWrapper matches only unwrapped secrets.
+func (sw *SecretWrapper) matches(stored *StoredSecret) bool {
+	return sw.matchesWrap(stored.WrapAlgorithm, stored.WrapKeyId)
+}
+
+// Returns true if data wrapped with the given algorithm and key ID is wrapped
+// with this SecretWrapper's key. A nil SecretWrapper matches only unwrapped
+// data.
+func (sw *SecretWrapper) matchesWrap(algorithm string, keyId []byte) bool {
+	if sw == nil {
+		return algorithm == wrapNone
+	}
+	return algorithm == wrapXChaCha20Poly1305 && bytes.Equal(sw.keyId, keyId)
+}
+
+// Additional data authenticated with each wrapped secret
+func wrapAdditionalData(keyId int) []byte {
+	ad := make([]byte, 8)
+	binary.BigEndian.PutUint64(ad, uint64(keyId))
+	return ad
+}
+
+// ReencryptSecrets decrypts every stored node secret with oldWrapper and
+// encrypts it with newWrapper. Secrets stored in plaintext are encrypted and
+// secrets already wrapped with newWrapper are left alone. Either wrapper may
+// be nil, in which case secrets are read or written in plaintext. The
+// ephemeral private key is re-encrypted in the same way. Returns the number of
+// node secrets which were re-encrypted.
+func ReencryptSecrets(store *Storage, oldWrapper, newWrapper *SecretWrapper) (int, error) {
+	if err := reencryptEphemeralKey(store, oldWrapper, newWrapper); err != nil {
+		return 0, err
+	}
+
+	storedSecrets, err := store.GetSecrets()
+	if err != nil {
+		return 0, errors.WithMessage(err, "Could not load node secrets")
+	}
+
+	count := 0
+	for _, stored := range storedSecrets {
+		if newWrapper.matches(stored) {
+			continue
+		}
+
+		secret, err := oldWrapper.unwrap(stored)
+		if err != nil {
+			return count, err
+		}
+
+		reencrypted, err := newWrapper.newStoredSecret(stored.KeyId, secret,
+			stored.CreatedAt, stored.ValidUntil)
+		if err != nil {
+			return count, err
+		}
+
+		err = store.UpsertSecret(reencrypted)
+		if err != nil {
+			return count, errors.WithMessagef(err,
+				"Could not store node secret %d", stored.KeyId)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Decrypts the stored ephemeral private key with oldWrapper and encrypts it
+// with newWrapper. Does nothing if no ephemeral key is stored or it is already
+// wrapped with newWrapper.
+func reencryptEphemeralKey(store *Storage, oldWrapper, newWrapper *SecretWrapper) error {
+	stored, err := store.GetEphemeralKey()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return errors.WithMessage(err, "Could not load ephemeral keys")
+	}
+	if newWrapper.matchesWrap(stored.WrapAlgorithm, stored.WrapKeyId) {
+		return nil
+	}
+
+	privateKey, err := oldWrapper.unwrapEphemeral(stored)
+	if err != nil {
+		return err
+	}
+
+	reencrypted, err := newWrapper.newEphemeralKey(stored.PublicKey, privateKey)
+	if err != nil {
+		return err
+	}
+
+	err = store.UpsertEphemeralKey(reencrypted)
+	if err != nil {
+		return errors.WithMessage(err, "Could not store ephemeral keys")
+	}
+	return nil
+}
+
+// Builds the EphemeralKey for the given keypair, wrapping the private key if
+// the SecretWrapper is not nil.
+func (sw *SecretWrapper) newEphemeralKey(publicKey, privateKey []byte) (*EphemeralKey, error) {
+	key := &EphemeralKey{
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+	}
+	if sw != nil {
+		if err := sw.wrapEphemeral(key, privateKey); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// Builds the StoredSecret for the given secret, wrapping it if the
+// SecretWrapper is not nil.
+func (sw *SecretWrapper) newStoredSecret(keyId int, secret []byte, createdAt,
+	validUntil time.Time) (*StoredSecret, error) {
+	stored := &StoredSecret{
+		KeyId:      keyId,
+		Secret:     secret,
+		CreatedAt:  createdAt,
+		ValidUntil: validUntil,
+	}
+	if sw != nil {
+		if err := sw.wrap(stored, secret); err != nil {
+			return nil, err
+		}
+	}
+	return stored, nil
+}
@@ -0,0 +1,265 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/crypto/signature/rsa"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a SecretWrapper derived from random key material
+func newTestWrapper(t *testing.T) *SecretWrapper {
+	keyMaterial := make([]byte, 32)
+	if _, err := csprng.NewSystemRNG().Read(keyMaterial); err != nil {
+		t.Fatalf("Failed to generate key material: %+v", err)
+	}
+	sw, err := NewSecretWrapper(keyMaterial)
+	if err != nil {
+		t.Fatalf("NewSecretWrapper error: %+v", err)
+	}
+	return sw
+}
+
+// Happy path
+func TestSecretWrapper_WrapUnwrap(t *testing.T) {
+	sw := newTestWrapper(t)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	stored, err := sw.newStoredSecret(5, secret, time.Now(), time.Time{})
+	if err != nil {
+		t.Fatalf("newStoredSecret error: %+v", err)
+	}
+	if bytes.Contains(stored.Secret, secret) {
+		t.Errorf("Stored secret contains the plaintext")
+	}
+	if stored.WrapAlgorithm != wrapXChaCha20Poly1305 ||
+		!bytes.Equal(stored.WrapKeyId, sw.keyId) || len(stored.Nonce) == 0 {
+		t.Errorf("Stored secret has unexpected wrapping metadata: %+v", stored)
+	}
+
+	received, err := sw.unwrap(stored)
+	if err != nil {
+		t.Fatalf("unwrap error: %+v", err)
+	}
+	if !bytes.Equal(received, secret) {
+		t.Errorf("Unwrapped secret does not match."+
+			"\n\tExpected: %v\n\tReceived: %v", secret, received)
+	}
+}
+
+// Error path: secrets cannot be unwrapped with a different key or after being
+// moved to another key ID
+func TestSecretWrapper_Unwrap_Error(t *testing.T) {
+	sw := newTestWrapper(t)
+	stored, err := sw.newStoredSecret(5, []byte("secret"), time.Now(), time.Time{})
+	if err != nil {
+		t.Fatalf("newStoredSecret error: %+v", err)
+	}
+
+	_, err = newTestWrapper(t).unwrap(stored)
+	if err == nil || !strings.Contains(err.Error(), "different key") {
+		t.Errorf("Expected error unwrapping with a different key, received %v", err)
+	}
+
+	_, err = (*SecretWrapper)(nil).unwrap(stored)
+	if err == nil {
+		t.Errorf("Expected error unwrapping without a key")
+	}
+
+	stored.KeyId = 6
+	if _, err = sw.unwrap(stored); err == nil {
+		t.Errorf("Expected error unwrapping secret under another key ID")
+	}
+}
+
+// Tests that the same key material always derives the same wrapping key, and
+// that the RSA key file and raw key file forms are both accepted.
+func TestNewSecretWrapperFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(csprng.NewSystemRNG(), 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %+v", err)
+	}
+	rsaPath := filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(rsaPath, rsa.CreatePrivateKeyPem(rsaKey), 0600); err != nil {
+		t.Fatalf("Failed to write RSA key: %+v", err)
+	}
+
+	fromFile, err := NewSecretWrapperFromFile(rsaPath)
+	if err != nil {
+		t.Fatalf("NewSecretWrapperFromFile error: %+v", err)
+	}
+	fromKey, err := NewSecretWrapperFromRSA(rsaKey)
+	if err != nil {
+		t.Fatalf("NewSecretWrapperFromRSA error: %+v", err)
+	}
+	if !bytes.Equal(fromFile.keyId, fromKey.keyId) {
+		t.Errorf("RSA key file and RSA key derived different wrapping keys")
+	}
+
+	rawPath := filepath.Join(dir, "secrets.key")
+	err = os.WriteFile(rawPath, []byte("an operator chosen wrapping key file\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write key file: %+v", err)
+	}
+	raw, err := NewSecretWrapperFromFile(rawPath)
+	if err != nil {
+		t.Fatalf("NewSecretWrapperFromFile error: %+v", err)
+	}
+	if bytes.Equal(raw.keyId, fromKey.keyId) {
+		t.Errorf("Different key files derived the same wrapping key")
+	}
+
+	shortPath := filepath.Join(dir, "short.key")
+	if err = os.WriteFile(shortPath, []byte("short"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %+v", err)
+	}
+	if _, err = NewSecretWrapperFromFile(shortPath); err == nil {
+		t.Errorf("Expected error for short key file")
+	}
+}
+
+// Happy path: a manager with a wrapping key encrypts secrets at rest,
+// encrypts legacy plaintext secrets on load, and ReencryptSecrets moves
+// secrets to a new wrapping key.
+func TestLoadNodeSecretManager_Encrypted(t *testing.T) {
+	store, err := NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("NewStorage error: %+v", err)
+	}
+
+	// Store a legacy plaintext secret
+	plain, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	legacy := []byte("legacy")
+	if err = plain.UpsertSecret(0, legacy); err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+
+	oldWrapper := newTestWrapper(t)
+	nsm, err := LoadNodeSecretManager(store, oldWrapper)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	rotated, err := nsm.RotateSecret(csprng.NewSystemRNG(), time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSecret error: %+v", err)
+	}
+	expected, err := nsm.GetSecret(rotated)
+	if err != nil {
+		t.Fatalf("GetSecret error: %+v", err)
+	}
+
+	stored, err := store.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	for _, s := range stored {
+		if !oldWrapper.matches(s) {
+			t.Errorf("Secret %d is not encrypted at rest: %+v", s.KeyId, s)
+		}
+	}
+
+	// The manager cannot load without the wrapping key
+	newWrapper := newTestWrapper(t)
+	if _, err = LoadNodeSecretManager(store, newWrapper); err == nil {
+		t.Fatalf("Expected error loading with a different wrapping key")
+	}
+
+	count, err := ReencryptSecrets(store, oldWrapper, newWrapper)
+	if err != nil {
+		t.Fatalf("ReencryptSecrets error: %+v", err)
+	}
+	if count != 2 {
+		t.Errorf("Unexpected number of re-encrypted secrets."+
+			"\n\tExpected: %d\n\tReceived: %d", 2, count)
+	}
+
+	loaded, err := LoadNodeSecretManager(store, newWrapper)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	received, err := loaded.GetSecret(rotated)
+	if err != nil {
+		t.Fatalf("GetSecret error: %+v", err)
+	}
+	if received != expected {
+		t.Errorf("Re-encrypted secret does not match."+
+			"\n\tExpected: %v\n\tReceived: %v", expected, received)
+	}
+	received, err = loaded.GetSecret(0)
+	if err != nil {
+		t.Fatalf("GetSecret error: %+v", err)
+	}
+	if !bytes.HasPrefix(received.Bytes(), legacy) {
+		t.Errorf("Legacy secret does not match after re-encryption: %v", received)
+	}
+}
+
+// Happy path: the ephemeral private key is encrypted at rest, a legacy
+// plaintext key is encrypted on load, and ReencryptSecrets moves it to a new
+// wrapping key.
+func TestLoadNodeSecretManager_EncryptedEphemeral(t *testing.T) {
+	store, err := NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("NewStorage error: %+v", err)
+	}
+
+	// Store a legacy plaintext key
+	plain, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	priv, pub := ecdh.ECDHNIKE.NewKeypair(csprng.NewSystemRNG())
+	if err = plain.UpsertEphemerals(pub, priv); err != nil {
+		t.Fatalf("UpsertEphemerals error: %+v", err)
+	}
+
+	oldWrapper := newTestWrapper(t)
+	if _, err = LoadNodeSecretManager(store, oldWrapper); err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	stored, err := store.GetEphemeralKey()
+	if err != nil {
+		t.Fatalf("GetEphemeralKey error: %+v", err)
+	}
+	if !oldWrapper.matchesWrap(stored.WrapAlgorithm, stored.WrapKeyId) ||
+		bytes.Equal(stored.PrivateKey, priv.Bytes()) {
+		t.Errorf("Ephemeral private key is not encrypted at rest: %+v", stored)
+	}
+
+	// The manager cannot load without the wrapping key
+	newWrapper := newTestWrapper(t)
+	if _, err = LoadNodeSecretManager(store, newWrapper); err == nil {
+		t.Fatalf("Expected error loading with a different wrapping key")
+	}
+
+	if _, err = ReencryptSecrets(store, oldWrapper, newWrapper); err != nil {
+		t.Fatalf("ReencryptSecrets error: %+v", err)
+	}
+
+	loaded, err := LoadNodeSecretManager(store, newWrapper)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+	_, received := loaded.GetEphemeralEd()
+	if !bytes.Equal(received.Bytes(), priv.Bytes()) {
+		t.Errorf("Re-encrypted ephemeral private key does not match."+
+			"\n\tExpected: %v\n\tReceived: %v", priv.Bytes(), received.Bytes())
+	}
+}
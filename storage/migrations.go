@@ -0,0 +1,330 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles versioned migrations of the database schema
+
+package storage
+
+import (
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gorm.io/gorm"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when the database schema was created by a newer
+// version of the server than the one running
+var ErrSchemaTooNew = errors.New("database schema is newer than this server supports")
+
+// SchemaVersion records a migration that has been applied to the database
+type SchemaVersion struct {
+	Version     uint      `gorm:"primaryKey;autoIncrement:false"`
+	Description string    `gorm:"not null"`
+	AppliedAt   time.Time `gorm:"not null"`
+}
+
+// TableName overrides the default pluralized table name
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// A single numbered up-migration of the database schema
+type migration struct {
+	version     uint
+	description string
+	up          func(tx *gorm.DB) error
+}
+
+// All schema migrations, in the order they are applied. Versions must start
+// at 1 and increase by one. Never modify or reorder an existing migration;
+// add a new one to the end of the list instead. Migrations must not use the
+// live models, which change over time; each migrates snapshots of the models
+// as they were at its version, so it always produces the same schema.
+var migrations = []migration{
+	{1, "Create node secret, round, client error and registration tables",
+		func(tx *gorm.DB) error {
+			// WARNING: Order is important. Do not change without database testing
+			return tx.AutoMigrate(&storedSecretV1{}, &ephemeralKeyV1{},
+				&roundRecordV1{}, &clientErrorRecordV1{}, &clientRegistrationV1{})
+		}},
+	{2, "Add key wrapping metadata to node secrets",
+		func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&storedSecretV2{})
+		}},
+	{3, "Add round outcomes and phase timings",
+		func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&roundRecordV3{}, &roundPhaseRecordV3{})
+		}},
+	{4, "Add client error counts",
+		func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&clientErrorCountV4{})
+		}},
+	{5, "Add key wrapping metadata to the ephemeral key",
+		func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&ephemeralKeyV5{})
+		}},
+}
+
+// Snapshots of the models used by the migrations. The suffix is the version
+// of the migration which introduced the snapshot. Never modify a snapshot once
+// its migration is released.
+
+type storedSecretV1 struct {
+	KeyId      int       `gorm:"primaryKey;autoIncrement:false"`
+	Secret     []byte    `gorm:"not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+	ValidUntil time.Time
+}
+
+func (storedSecretV1) TableName() string { return "stored_secrets" }
+
+type ephemeralKeyV1 struct {
+	Id         uint8  `gorm:"primaryKey;autoIncrement:false"`
+	PublicKey  []byte `gorm:"not null"`
+	PrivateKey []byte `gorm:"not null"`
+}
+
+func (ephemeralKeyV1) TableName() string { return "ephemeral_keys" }
+
+type roundRecordV1 struct {
+	Id         uint64    `gorm:"primaryKey;autoIncrement:false"`
+	BatchSize  uint32    `gorm:"not null"`
+	Topology   []byte    `gorm:"not null"`
+	StartedAt  time.Time `gorm:"not null;index"`
+	FinishedAt time.Time
+	Error      string
+}
+
+func (roundRecordV1) TableName() string { return "round_records" }
+
+type clientErrorRecordV1 struct {
+	Id        uint64    `gorm:"primaryKey"`
+	RoundId   uint64    `gorm:"not null;index"`
+	ClientId  []byte    `gorm:"not null"`
+	Error     string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+func (clientErrorRecordV1) TableName() string { return "client_error_records" }
+
+type clientRegistrationV1 struct {
+	UserId       []byte    `gorm:"primaryKey"`
+	KeyId        int       `gorm:"not null"`
+	RegisteredAt time.Time `gorm:"not null"`
+}
+
+func (clientRegistrationV1) TableName() string { return "client_registrations" }
+
+type storedSecretV2 struct {
+	KeyId         int       `gorm:"primaryKey;autoIncrement:false"`
+	Secret        []byte    `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"not null"`
+	ValidUntil    time.Time
+	WrapAlgorithm string
+	WrapKeyId     []byte
+	Nonce         []byte
+}
+
+func (storedSecretV2) TableName() string { return "stored_secrets" }
+
+type roundRecordV3 struct {
+	Id          uint64    `gorm:"primaryKey;autoIncrement:false"`
+	BatchSize   uint32    `gorm:"not null"`
+	Topology    []byte    `gorm:"not null"`
+	StartedAt   time.Time `gorm:"not null;index"`
+	FinishedAt  time.Time
+	Outcome     string `gorm:"index"`
+	FailedPhase string
+	Error       string
+}
+
+func (roundRecordV3) TableName() string { return "round_records" }
+
+type roundPhaseRecordV3 struct {
+	RoundId    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Phase      string `gorm:"primaryKey"`
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+func (roundPhaseRecordV3) TableName() string { return "round_phase_records" }
+
+type clientErrorCountV4 struct {
+	Type  string `gorm:"primaryKey"`
+	Count uint64 `gorm:"not null"`
+}
+
+func (clientErrorCountV4) TableName() string { return "client_error_counts" }
+
+type ephemeralKeyV5 struct {
+	Id            uint8  `gorm:"primaryKey;autoIncrement:false"`
+	PublicKey     []byte `gorm:"not null"`
+	PrivateKey    []byte `gorm:"not null"`
+	WrapAlgorithm string
+	WrapKeyId     []byte
+	Nonce         []byte
+}
+
+func (ephemeralKeyV5) TableName() string { return "ephemeral_keys" }
+
+// MigrationStatus describes a schema migration and whether it has been
+// applied to the database
+type MigrationStatus struct {
+	Version     uint
+	Description string
+	Applied     bool
+	// Zero if the migration has not been applied
+	AppliedAt time.Time
+}
+
+// LatestSchemaVersion returns the schema version this server expects
+func LatestSchemaVersion() uint {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// Returns the migrations that must be applied to bring a database at the
+// given version up to date. Returns ErrSchemaTooNew if the database is at a
+// later version than this server knows about.
+func pendingMigrations(current uint) ([]migration, error) {
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return nil, errors.Wrapf(ErrSchemaTooNew,
+			"database is at version %d, latest known version is %d",
+			current, latest)
+	}
+	return migrations[current:], nil
+}
+
+// Schema allows the schema of a database to be inspected and migrated
+// independently of running the server
+type Schema struct {
+	db *gorm.DB
+}
+
+// OpenSchema connects to the database without applying any migrations
+func OpenSchema(username, password, dbName, address, port string) (*Schema, error) {
+	if address == "" || port == "" {
+		return nil, errors.New("Database backend connection information not provided")
+	}
+	db, err := openDatabase(username, password, dbName, address, port)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{db: db}, nil
+}
+
+// Version returns the version of the database schema,
+// or 0 if no migrations have been applied
+func (s *Schema) Version() (uint, error) {
+	return schemaVersion(s.db)
+}
+
+// Status returns every migration known to this server
+// along with whether it has been applied
+func (s *Schema) Status() ([]MigrationStatus, error) {
+	exists := s.db.Migrator().HasTable(&SchemaVersion{})
+	var applied []*SchemaVersion
+	if exists {
+		err := s.db.Order("version asc").Find(&applied).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	appliedAt := make(map[uint]time.Time, len(applied))
+	for _, v := range applied {
+		appliedAt[v.Version] = v.AppliedAt
+	}
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		at, ok := appliedAt[m.version]
+		status[i] = MigrationStatus{
+			Version:     m.version,
+			Description: m.description,
+			Applied:     ok,
+			AppliedAt:   at,
+		}
+	}
+	return status, nil
+}
+
+// Migrate applies all pending migrations and returns those that were applied
+func (s *Schema) Migrate() ([]MigrationStatus, error) {
+	return migrate(s.db)
+}
+
+// Close closes the connection to the database
+func (s *Schema) Close() error {
+	sqlDb, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDb.Close()
+}
+
+// Returns the highest applied migration version,
+// or 0 if no migrations have been applied
+func schemaVersion(db *gorm.DB) (uint, error) {
+	if !db.Migrator().HasTable(&SchemaVersion{}) {
+		return 0, nil
+	}
+	var version uint
+	err := db.Model(&SchemaVersion{}).
+		Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Applies all pending migrations to the database, each in its own
+// transaction. Returns the migrations that were applied.
+func migrate(db *gorm.DB) ([]MigrationStatus, error) {
+	err := db.AutoMigrate(&SchemaVersion{})
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to create schema version table")
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return nil, errors.WithMessage(err, "Failed to get schema version")
+	}
+
+	pending, err := pendingMigrations(current)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]MigrationStatus, 0, len(pending))
+	for _, m := range pending {
+		jww.INFO.Printf("Applying schema migration %d: %s", m.version, m.description)
+		record := &SchemaVersion{
+			Version:     m.version,
+			Description: m.description,
+			AppliedAt:   time.Now(),
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(record).Error
+		})
+		if err != nil {
+			return applied, errors.WithMessagef(err,
+				"Failed to apply schema migration %d", m.version)
+		}
+		applied = append(applied, MigrationStatus{
+			Version:     record.Version,
+			Description: record.Description,
+			Applied:     true,
+			AppliedAt:   record.AppliedAt,
+		})
+	}
+
+	return applied, nil
+}
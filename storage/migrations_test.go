@@ -0,0 +1,178 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"errors"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Tests that migration versions start at 1 and increase by one.
+func TestMigrations_Versions(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != uint(i+1) {
+			t.Errorf("Migration %d has unexpected version."+
+				"\n\tExpected: %d\n\tReceived: %d", i, i+1, m.version)
+		}
+		if m.description == "" || m.up == nil {
+			t.Errorf("Migration %d is incomplete: %+v", m.version, m)
+		}
+	}
+
+	if LatestSchemaVersion() != uint(len(migrations)) {
+		t.Errorf("Unexpected latest schema version."+
+			"\n\tExpected: %d\n\tReceived: %d",
+			len(migrations), LatestSchemaVersion())
+	}
+}
+
+// Tests that the latest migration snapshot of every model produces the same
+// table as the live model, so a change to a model without a new migration is
+// caught.
+func TestMigrations_SnapshotsMatchModels(t *testing.T) {
+	latest := []struct {
+		model, snapshot interface{}
+	}{
+		{&StoredSecret{}, &storedSecretV2{}},
+		{&EphemeralKey{}, &ephemeralKeyV5{}},
+		{&RoundRecord{}, &roundRecordV3{}},
+		{&RoundPhaseRecord{}, &roundPhaseRecordV3{}},
+		{&ClientErrorRecord{}, &clientErrorRecordV1{}},
+		{&ClientErrorCount{}, &clientErrorCountV4{}},
+		{&ClientRegistration{}, &clientRegistrationV1{}},
+	}
+
+	for _, l := range latest {
+		model, snapshot := parseTable(t, l.model), parseTable(t, l.snapshot)
+		if !reflect.DeepEqual(model, snapshot) {
+			t.Errorf("Model %T does not match its migration snapshot %T."+
+				"\n\tExpected: %+v\n\tReceived: %+v",
+				l.model, l.snapshot, model, snapshot)
+		}
+	}
+}
+
+// Columns and indexes of a table, as created by AutoMigrate
+type parsedTable struct {
+	Name    string
+	Columns []parsedColumn
+	Indexes []string
+}
+
+type parsedColumn struct {
+	Name       string
+	DataType   schema.DataType
+	PrimaryKey bool
+	NotNull    bool
+	Increment  bool
+}
+
+// Parses the table AutoMigrate creates for the model
+func parseTable(t *testing.T, model interface{}) parsedTable {
+	s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatalf("Failed to parse %T: %+v", model, err)
+	}
+	table := parsedTable{Name: s.Table}
+	for _, f := range s.Fields {
+		table.Columns = append(table.Columns, parsedColumn{
+			Name:       f.DBName,
+			DataType:   f.DataType,
+			PrimaryKey: f.PrimaryKey,
+			NotNull:    f.NotNull,
+			Increment:  f.AutoIncrement,
+		})
+	}
+	for _, idx := range s.ParseIndexes() {
+		table.Indexes = append(table.Indexes, idx.Name)
+	}
+	sort.Strings(table.Indexes)
+	return table
+}
+
+// Happy path
+func TestPendingMigrations(t *testing.T) {
+	latest := LatestSchemaVersion()
+
+	pending, err := pendingMigrations(0)
+	if err != nil {
+		t.Fatalf("pendingMigrations error: %+v", err)
+	}
+	if len(pending) != len(migrations) || pending[0].version != 1 {
+		t.Errorf("Expected all migrations for an empty database, got %d",
+			len(pending))
+	}
+
+	pending, err = pendingMigrations(latest)
+	if err != nil {
+		t.Fatalf("pendingMigrations error: %+v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Expected no pending migrations, got %d", len(pending))
+	}
+}
+
+// Error path: the database is newer than the server
+func TestPendingMigrations_TooNew(t *testing.T) {
+	_, err := pendingMigrations(LatestSchemaVersion() + 1)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected %v, received %v", ErrSchemaTooNew, err)
+	}
+}
+
+// Tests migrating the Postgres database given by CMIX_TEST_DSN, if set.
+func TestSchema_Migrate(t *testing.T) {
+	di := newTestDatabaseImpl(t).(*DatabaseImpl)
+	schema := &Schema{db: di.db}
+
+	// The database was migrated when it was opened
+	applied, err := schema.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate error: %+v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("Expected no migrations to be applied, got %+v", applied)
+	}
+
+	version, err := schema.Version()
+	if err != nil {
+		t.Fatalf("Version error: %+v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("Unexpected schema version.\n\tExpected: %d\n\tReceived: %d",
+			LatestSchemaVersion(), version)
+	}
+
+	status, err := schema.Status()
+	if err != nil {
+		t.Fatalf("Status error: %+v", err)
+	}
+	for _, m := range status {
+		if !m.Applied || m.AppliedAt.IsZero() {
+			t.Errorf("Migration %d was not applied: %+v", m.Version, m)
+		}
+	}
+
+	// Simulate a database migrated by a newer server
+	newer := &SchemaVersion{Version: LatestSchemaVersion() + 1,
+		Description: "newer", AppliedAt: time.Now()}
+	if err = di.db.Create(newer).Error; err != nil {
+		t.Fatalf("Failed to insert schema version: %+v", err)
+	}
+	defer di.db.Delete(newer)
+
+	_, err = schema.Migrate()
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Expected %v, received %v", ErrSchemaTooNew, err)
+	}
+}
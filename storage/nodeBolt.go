@@ -0,0 +1,347 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles the embedded file backend for node storage
+
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"gitlab.com/xx_network/primitives/id"
+	bolt "go.etcd.io/bbolt"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// Buckets of the file backend, one for each table of the Postgres backend
+var (
+	secretsBucket           = []byte("secrets")
+	ephemeralKeyBucket      = []byte("ephemeral_keys")
+	roundsBucket            = []byte("round_records")
+	roundPhasesBucket       = []byte("round_phase_records")
+	clientErrorsBucket      = []byte("client_error_records")
+	clientErrorCountsBucket = []byte("client_error_counts")
+	registrationsBucket     = []byte("client_registrations")
+)
+
+// Opens the file at path, creating it if it does not exist, and initializes
+// the BoltImpl stored in it
+func newBoltImpl(path string) (*BoltImpl, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: DbTimeout * time.Second})
+	if err != nil {
+		return nil, errors.Errorf("Unable to open database file %s: %+v",
+			path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{secretsBucket, ephemeralKeyBucket,
+			roundsBucket, roundPhasesBucket, clientErrorsBucket,
+			clientErrorCountsBucket, registrationsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Errorf("Unable to initialize database file %s: %+v",
+			path, err)
+	}
+
+	return &BoltImpl{db: db}, nil
+}
+
+// Close releases the database file so that it may be opened again
+func (b *BoltImpl) Close() error {
+	return b.db.Close()
+}
+
+// Encodes an integer key so that keys sort in numerical order
+func boltKey(i uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, i)
+	return key
+}
+
+// Stores the JSON encoding of value under key in the bucket
+func boltPut(tx *bolt.Tx, bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucket).Put(key, data)
+}
+
+// Decodes the value stored under key in the bucket into value
+// Or returns gorm.ErrRecordNotFound if the key does not exist
+func boltGet(tx *bolt.Tx, bucket, key []byte, value interface{}) error {
+	data := tx.Bucket(bucket).Get(key)
+	if data == nil {
+		return gorm.ErrRecordNotFound
+	}
+	return json.Unmarshal(data, value)
+}
+
+// Calls fn with each value in the bucket whose key starts with prefix, in
+// key order
+func boltScan(tx *bolt.Tx, bucket, prefix []byte, fn func(k, v []byte) error) error {
+	c := tx.Bucket(bucket).Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inserts the given StoredSecret into the file, overwriting the
+// existing secret if one with the same KeyId is present
+func (b *BoltImpl) UpsertSecret(secret *StoredSecret) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, secretsBucket, boltKey(uint64(secret.KeyId)), secret)
+	})
+}
+
+// Returns all StoredSecrets in the file, ordered by KeyId
+func (b *BoltImpl) GetSecrets() ([]*StoredSecret, error) {
+	results := make([]*StoredSecret, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx, secretsBucket, nil, func(_, v []byte) error {
+			secret := &StoredSecret{}
+			results = append(results, secret)
+			return json.Unmarshal(v, secret)
+		})
+	})
+	return results, err
+}
+
+// Deletes the StoredSecret with the given keyId from the file
+func (b *BoltImpl) DeleteSecret(keyId int) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(secretsBucket).Delete(boltKey(uint64(keyId)))
+	})
+}
+
+// Inserts the given EphemeralKey into the file, replacing any
+// previously stored keypair
+func (b *BoltImpl) UpsertEphemeralKey(key *EphemeralKey) error {
+	key.Id = ephemeralKeyId
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, ephemeralKeyBucket, boltKey(ephemeralKeyId), key)
+	})
+}
+
+// Returns the EphemeralKey from the file
+// Or gorm.ErrRecordNotFound if none has been stored
+func (b *BoltImpl) GetEphemeralKey() (*EphemeralKey, error) {
+	key := &EphemeralKey{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, ephemeralKeyBucket, boltKey(ephemeralKeyId), key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Inserts the given RoundRecord into the file, overwriting the
+// existing record if one with the same Id is present
+func (b *BoltImpl) UpsertRound(round *RoundRecord) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, roundsBucket, boltKey(round.Id), round)
+	})
+}
+
+// Returns the RoundRecord with the given roundId from the file
+// Or gorm.ErrRecordNotFound if it does not exist
+func (b *BoltImpl) GetRound(roundId id.Round) (*RoundRecord, error) {
+	round := &RoundRecord{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, roundsBucket, boltKey(uint64(roundId)), round)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return round, nil
+}
+
+// Returns all RoundRecords selected by the filter, ordered by Id
+func (b *BoltImpl) filterRounds(filter RoundFilter) ([]*RoundRecord, error) {
+	results := make([]*RoundRecord, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx, roundsBucket, nil, func(_, v []byte) error {
+			round := &RoundRecord{}
+			if err := json.Unmarshal(v, round); err != nil {
+				return err
+			}
+			if filter.matches(round) {
+				results = append(results, round)
+			}
+			return nil
+		})
+	})
+	return results, err
+}
+
+// Returns all RoundRecords started within [start, end), ordered by Id
+func (b *BoltImpl) GetRounds(start, end time.Time) ([]*RoundRecord, error) {
+	return b.filterRounds(RoundFilter{Start: start, End: end})
+}
+
+// Returns the number of RoundRecords selected by the filter
+func (b *BoltImpl) CountRounds(filter RoundFilter) (int64, error) {
+	rounds, err := b.filterRounds(filter)
+	return int64(len(rounds)), err
+}
+
+// Inserts the given RoundPhaseRecords into the file, overwriting any
+// existing record for the same round and phase
+func (b *BoltImpl) UpsertRoundPhases(phases []*RoundPhaseRecord) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, phase := range phases {
+			key := append(boltKey(phase.RoundId), phase.Phase...)
+			if err := boltPut(tx, roundPhasesBucket, key, phase); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Returns all RoundPhaseRecords for the given round, ordered by StartedAt
+func (b *BoltImpl) GetRoundPhases(roundId id.Round) ([]*RoundPhaseRecord, error) {
+	results := make([]*RoundPhaseRecord, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx, roundPhasesBucket, boltKey(uint64(roundId)),
+			func(_, v []byte) error {
+				phase := &RoundPhaseRecord{}
+				results = append(results, phase)
+				return json.Unmarshal(v, phase)
+			})
+	})
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].StartedAt.Before(results[j].StartedAt)
+	})
+	return results, err
+}
+
+// Inserts the given ClientErrorRecord into the file, assigning it a new Id
+func (b *BoltImpl) InsertClientError(clientError *ClientErrorRecord) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		nextId, err := tx.Bucket(clientErrorsBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		clientError.Id = nextId
+		key := append(boltKey(clientError.RoundId), boltKey(clientError.Id)...)
+		return boltPut(tx, clientErrorsBucket, key, clientError)
+	})
+}
+
+// Returns the oldest ClientErrorRecords of every round, ordered by Id. At
+// most limit records are returned, or all of them if limit is zero.
+func (b *BoltImpl) GetClientErrors(limit int) ([]*ClientErrorRecord, error) {
+	results := make([]*ClientErrorRecord, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx, clientErrorsBucket, nil,
+			func(_, v []byte) error {
+				clientError := &ClientErrorRecord{}
+				results = append(results, clientError)
+				return json.Unmarshal(v, clientError)
+			})
+	})
+	// Records are keyed by round first
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Id < results[j].Id
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, err
+}
+
+// Deletes the ClientErrorRecords with the given Ids from the file
+func (b *BoltImpl) DeleteClientErrors(ids []uint64) error {
+	deleted := make(map[string]bool, len(ids))
+	for _, errId := range ids {
+		deleted[string(boltKey(errId))] = true
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		keys := make([][]byte, 0)
+		err := boltScan(tx, clientErrorsBucket, nil,
+			func(k, _ []byte) error {
+				// Keys end with the Id of the record
+				if deleted[string(k[len(k)-8:])] {
+					keys = append(keys, k)
+				}
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err = tx.Bucket(clientErrorsBucket).Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Increments the count of client errors of the given type
+func (b *BoltImpl) IncrementClientErrorCount(errType string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		count := &ClientErrorCount{}
+		err := boltGet(tx, clientErrorCountsBucket, []byte(errType), count)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		count.Type = errType
+		count.Count++
+		return boltPut(tx, clientErrorCountsBucket, []byte(errType), count)
+	})
+}
+
+// Returns the count of client errors for every type, ordered by Type
+func (b *BoltImpl) GetClientErrorCounts() ([]*ClientErrorCount, error) {
+	results := make([]*ClientErrorCount, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltScan(tx, clientErrorCountsBucket, nil, func(_, v []byte) error {
+			count := &ClientErrorCount{}
+			results = append(results, count)
+			return json.Unmarshal(v, count)
+		})
+	})
+	return results, err
+}
+
+// Inserts the given ClientRegistration into the file, overwriting the
+// existing registration for the same user if one is present
+func (b *BoltImpl) UpsertClientRegistration(registration *ClientRegistration) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return boltPut(tx, registrationsBucket, registration.UserId, registration)
+	})
+}
+
+// Returns the ClientRegistration for the given user from the file
+// Or gorm.ErrRecordNotFound if it does not exist
+func (b *BoltImpl) GetClientRegistration(userId *id.ID) (*ClientRegistration, error) {
+	registration := &ClientRegistration{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return boltGet(tx, registrationsBucket, userId.Marshal(), registration)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return registration, nil
+}
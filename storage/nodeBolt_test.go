@@ -0,0 +1,132 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"gitlab.com/xx_network/primitives/id"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Opens a BoltImpl in a new file which is closed when the test ends
+func newTestBoltImpl(t *testing.T) *BoltImpl {
+	b, err := newBoltImpl(filepath.Join(t.TempDir(), "node.db"))
+	if err != nil {
+		t.Fatalf("Failed to open file backend: %+v", err)
+	}
+	t.Cleanup(func() {
+		if err := b.Close(); err != nil {
+			t.Errorf("Failed to close file backend: %+v", err)
+		}
+	})
+	return b
+}
+
+// Happy path: data stored in the file is available after it is reopened
+func TestBoltImpl_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.db")
+	b, err := newBoltImpl(path)
+	if err != nil {
+		t.Fatalf("Failed to open file backend: %+v", err)
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	err = b.UpsertSecret(&StoredSecret{KeyId: 3, Secret: []byte("secret"),
+		CreatedAt: now})
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+	err = b.InsertClientError(&ClientErrorRecord{RoundId: 7, Error: "first"})
+	if err != nil {
+		t.Fatalf("InsertClientError error: %+v", err)
+	}
+
+	if err = b.Close(); err != nil {
+		t.Fatalf("Failed to close file backend: %+v", err)
+	}
+	b, err = newBoltImpl(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file backend: %+v", err)
+	}
+	defer func() { _ = b.Close() }()
+
+	secrets, err := b.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(secrets) != 1 || !bytes.Equal(secrets[0].Secret, []byte("secret")) ||
+		!secrets[0].CreatedAt.Equal(now) {
+		t.Errorf("Secret was not persisted: %+v", secrets)
+	}
+
+	// Client error IDs continue from those assigned before reopening
+	second := &ClientErrorRecord{RoundId: 7, Error: "second"}
+	if err = b.InsertClientError(second); err != nil {
+		t.Fatalf("InsertClientError error: %+v", err)
+	}
+	errs, err := b.GetClientErrors(7)
+	if err != nil {
+		t.Fatalf("GetClientErrors error: %+v", err)
+	}
+	if len(errs) != 2 || errs[0].Id >= errs[1].Id {
+		t.Errorf("Unexpected client errors after reopening: %+v", errs)
+	}
+}
+
+// Tests that newDatabase selects the file backend in devMode when a path is
+// given and Postgres is not configured
+func TestNewDatabase_Path(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.db")
+	db, err := newDatabase("", "", "", "", "", path, true)
+	if err != nil {
+		t.Fatalf("newDatabase error: %+v", err)
+	}
+	b, ok := db.(*BoltImpl)
+	if !ok {
+		t.Fatalf("Unexpected backend.\n\tExpected: %T\n\tReceived: %T",
+			&BoltImpl{}, db)
+	}
+	defer func() { _ = b.Close() }()
+
+	roundId := id.Round(4)
+	err = b.UpsertRound(&RoundRecord{Id: uint64(roundId)})
+	if err != nil {
+		t.Fatalf("UpsertRound error: %+v", err)
+	}
+	if _, err = b.GetRound(roundId); err != nil {
+		t.Errorf("GetRound error: %+v", err)
+	}
+}
+
+// Error path: a configured Postgres database which cannot be reached is an
+// error rather than a reason to use the database file
+func TestNewDatabase_Path_PostgresError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.db")
+	_, err := newDatabase("cmix", "", "cmix_server", "127.0.0.1", "1", path,
+		true)
+	if err == nil {
+		t.Errorf("Expected error when Postgres cannot be reached")
+	}
+	if _, statErr := os.Stat(path); !os.IsNotExist(statErr) {
+		t.Errorf("Database file should not be created: %v", statErr)
+	}
+}
+
+// Error path: the database file is only used in devMode
+func TestNewDatabase_Path_NotDevMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.db")
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic without a database outside of devMode")
+		}
+	}()
+	_, _ = newDatabase("", "", "", "", "", path, false)
+}
@@ -13,12 +13,241 @@ import (
 	"context"
 	"errors"
 	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
 )
 
-// Helper for forcing panics in the event of a CDE, otherwise acts as a pass-through
+// Helper for logging a CDE, otherwise acts as a pass-through. Timed out calls
+// are retried by the resilientDatabase wrapping the DatabaseImpl
 func catchCde(err error) error {
 	if errors.Is(err, context.DeadlineExceeded) {
-		jww.FATAL.Panicf("Database call timed out: %+v", err.Error())
+		jww.WARN.Printf("Database call timed out: %+v", err.Error())
 	}
 	return err
 }
+
+// Tests the connection to the database
+func (d *DatabaseImpl) ping() error {
+	sqlDb, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err = sqlDb.PingContext(ctx)
+	cancel()
+	return catchCde(err)
+}
+
+// Inserts the given StoredSecret into the database, overwriting the
+// existing secret if one with the same KeyId is present
+func (d *DatabaseImpl) UpsertSecret(secret *StoredSecret) error {
+	jww.TRACE.Printf("Attempting to upsert node secret %d into DB", secret.KeyId)
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "created_at",
+			"valid_until", "wrap_algorithm", "wrap_key_id", "nonce"}),
+	}).Create(secret).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns all StoredSecrets in the database, ordered by KeyId
+func (d *DatabaseImpl) GetSecrets() ([]*StoredSecret, error) {
+	var results []*StoredSecret
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Order("key_id asc").Find(&results).Error
+	cancel()
+	return results, catchCde(err)
+}
+
+// Deletes the StoredSecret with the given keyId from the database
+func (d *DatabaseImpl) DeleteSecret(keyId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Where("key_id = ?", keyId).
+		Delete(&StoredSecret{}).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Inserts the given EphemeralKey into the database, replacing any
+// previously stored keypair
+func (d *DatabaseImpl) UpsertEphemeralKey(key *EphemeralKey) error {
+	jww.TRACE.Printf("Attempting to upsert ephemeral key into DB")
+	key.Id = ephemeralKeyId
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"public_key", "private_key",
+			"wrap_algorithm", "wrap_key_id", "nonce"}),
+	}).Create(key).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns the EphemeralKey from the database
+// Or gorm.ErrRecordNotFound if none has been stored
+func (d *DatabaseImpl) GetEphemeralKey() (*EphemeralKey, error) {
+	result := &EphemeralKey{}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Take(result, "id = ?", ephemeralKeyId).Error
+	cancel()
+	return result, catchCde(err)
+}
+
+// Inserts the given RoundRecord into the database, overwriting the
+// existing record if one with the same Id is present
+func (d *DatabaseImpl) UpsertRound(round *RoundRecord) error {
+	jww.TRACE.Printf("Attempting to upsert round %d into DB", round.Id)
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(round).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns the RoundRecord with the given roundId from the database
+// Or gorm.ErrRecordNotFound if it does not exist
+func (d *DatabaseImpl) GetRound(roundId id.Round) (*RoundRecord, error) {
+	result := &RoundRecord{}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Take(result, "id = ?", uint64(roundId)).Error
+	cancel()
+	return result, catchCde(err)
+}
+
+// Returns all RoundRecords started within [start, end), ordered by Id
+func (d *DatabaseImpl) GetRounds(start, end time.Time) ([]*RoundRecord, error) {
+	var results []*RoundRecord
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Where("started_at >= ? AND started_at < ?",
+		start, end).Order("id asc").Find(&results).Error
+	cancel()
+	return results, catchCde(err)
+}
+
+// Returns the number of RoundRecords selected by the filter
+func (d *DatabaseImpl) CountRounds(filter RoundFilter) (int64, error) {
+	var count int64
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	query := d.db.WithContext(ctx).Model(&RoundRecord{})
+	if !filter.Start.IsZero() {
+		query = query.Where("started_at >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query = query.Where("started_at < ?", filter.End)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.FailedPhase != "" {
+		query = query.Where("failed_phase = ?", filter.FailedPhase)
+	}
+	err := query.Count(&count).Error
+	cancel()
+	return count, catchCde(err)
+}
+
+// Inserts the given RoundPhaseRecords into the database, overwriting any
+// existing record for the same round and phase
+func (d *DatabaseImpl) UpsertRoundPhases(phases []*RoundPhaseRecord) error {
+	if len(phases) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(&phases).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns all RoundPhaseRecords for the given round, ordered by StartedAt
+func (d *DatabaseImpl) GetRoundPhases(roundId id.Round) ([]*RoundPhaseRecord, error) {
+	var results []*RoundPhaseRecord
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Where("round_id = ?", uint64(roundId)).
+		Order("started_at asc").Find(&results).Error
+	cancel()
+	return results, catchCde(err)
+}
+
+// Inserts the given ClientErrorRecord into the database, assigning it a new Id
+func (d *DatabaseImpl) InsertClientError(clientError *ClientErrorRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Create(clientError).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns the oldest ClientErrorRecords of every round, ordered by Id. At
+// most limit records are returned, or all of them if limit is zero.
+func (d *DatabaseImpl) GetClientErrors(limit int) ([]*ClientErrorRecord, error) {
+	var results []*ClientErrorRecord
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	query := d.db.WithContext(ctx).Order("id asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&results).Error
+	cancel()
+	return results, catchCde(err)
+}
+
+// Deletes the ClientErrorRecords with the given Ids from the database
+func (d *DatabaseImpl) DeleteClientErrors(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Where("id IN ?", ids).
+		Delete(&ClientErrorRecord{}).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Increments the count of client errors of the given type
+func (d *DatabaseImpl) IncrementClientErrorCount(errType string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count": gorm.Expr("client_error_counts.count + ?", 1),
+		}),
+	}).Create(&ClientErrorCount{Type: errType, Count: 1}).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns the count of client errors for every type, ordered by Type
+func (d *DatabaseImpl) GetClientErrorCounts() ([]*ClientErrorCount, error) {
+	var results []*ClientErrorCount
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Order("type asc").Find(&results).Error
+	cancel()
+	return results, catchCde(err)
+}
+
+// Inserts the given ClientRegistration into the database, overwriting the
+// existing registration for the same user if one is present
+func (d *DatabaseImpl) UpsertClientRegistration(registration *ClientRegistration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Clauses(clause.OnConflict{
+		UpdateAll: true,
+	}).Create(registration).Error
+	cancel()
+	return catchCde(err)
+}
+
+// Returns the ClientRegistration for the given user from the database
+// Or gorm.ErrRecordNotFound if it does not exist
+func (d *DatabaseImpl) GetClientRegistration(userId *id.ID) (*ClientRegistration, error) {
+	result := &ClientRegistration{}
+	ctx, cancel := context.WithTimeout(context.Background(), DbTimeout*time.Second)
+	err := d.db.WithContext(ctx).Take(result, "user_id = ?", userId.Marshal()).Error
+	cancel()
+	return result, catchCde(err)
+}
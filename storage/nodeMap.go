@@ -8,3 +8,262 @@
 // Handles the Map backend for node storage
 
 package storage
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+// Initializes an empty MapImpl
+func newMapImpl() *MapImpl {
+	return &MapImpl{
+		secrets:           make(map[int]*StoredSecret),
+		rounds:            make(map[id.Round]*RoundRecord),
+		roundPhases:       make(map[id.Round][]*RoundPhaseRecord),
+		clientErrors:      make(map[uint64]*ClientErrorRecord),
+		clientErrorCounts: make(map[string]uint64),
+		registrations:     make(map[id.ID]*ClientRegistration),
+	}
+}
+
+// Inserts the given StoredSecret into the map, overwriting the
+// existing secret if one with the same KeyId is present
+func (m *MapImpl) UpsertSecret(secret *StoredSecret) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.secrets[secret.KeyId] = secret
+	return nil
+}
+
+// Returns all StoredSecrets in the map, ordered by KeyId
+func (m *MapImpl) GetSecrets() ([]*StoredSecret, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	results := make([]*StoredSecret, 0, len(m.secrets))
+	for _, secret := range m.secrets {
+		results = append(results, secret)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].KeyId < results[j].KeyId
+	})
+	return results, nil
+}
+
+// Deletes the StoredSecret with the given keyId from the map
+func (m *MapImpl) DeleteSecret(keyId int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.secrets, keyId)
+	return nil
+}
+
+// Inserts the given EphemeralKey into the map, replacing any
+// previously stored keypair
+func (m *MapImpl) UpsertEphemeralKey(key *EphemeralKey) error {
+	m.Lock()
+	defer m.Unlock()
+
+	key.Id = ephemeralKeyId
+	m.ephemeralKey = key
+	return nil
+}
+
+// Returns the EphemeralKey from the map
+// Or gorm.ErrRecordNotFound if none has been stored
+func (m *MapImpl) GetEphemeralKey() (*EphemeralKey, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if m.ephemeralKey == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return m.ephemeralKey, nil
+}
+
+// Inserts the given RoundRecord into the map, overwriting the
+// existing record if one with the same Id is present
+func (m *MapImpl) UpsertRound(round *RoundRecord) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.rounds[id.Round(round.Id)] = round
+	return nil
+}
+
+// Returns the RoundRecord with the given roundId from the map
+// Or gorm.ErrRecordNotFound if it does not exist
+func (m *MapImpl) GetRound(roundId id.Round) (*RoundRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	round, ok := m.rounds[roundId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return round, nil
+}
+
+// Returns all RoundRecords started within [start, end), ordered by Id
+func (m *MapImpl) GetRounds(start, end time.Time) ([]*RoundRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	results := make([]*RoundRecord, 0)
+	for _, round := range m.rounds {
+		if !round.StartedAt.Before(start) && round.StartedAt.Before(end) {
+			results = append(results, round)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Id < results[j].Id
+	})
+	return results, nil
+}
+
+// Returns the number of RoundRecords selected by the filter
+func (m *MapImpl) CountRounds(filter RoundFilter) (int64, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	count := int64(0)
+	for _, round := range m.rounds {
+		if filter.matches(round) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Inserts the given RoundPhaseRecords into the map, overwriting any
+// existing record for the same round and phase
+func (m *MapImpl) UpsertRoundPhases(phases []*RoundPhaseRecord) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, phase := range phases {
+		roundId := id.Round(phase.RoundId)
+		existing := m.roundPhases[roundId]
+		replaced := false
+		for i, e := range existing {
+			if e.Phase == phase.Phase {
+				existing[i] = phase
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.roundPhases[roundId] = append(existing, phase)
+		}
+	}
+	return nil
+}
+
+// Returns all RoundPhaseRecords for the given round, ordered by StartedAt
+func (m *MapImpl) GetRoundPhases(roundId id.Round) ([]*RoundPhaseRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	results := make([]*RoundPhaseRecord, len(m.roundPhases[roundId]))
+	copy(results, m.roundPhases[roundId])
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].StartedAt.Before(results[j].StartedAt)
+	})
+	return results, nil
+}
+
+// Inserts the given ClientErrorRecord into the map, assigning it a new Id
+func (m *MapImpl) InsertClientError(clientError *ClientErrorRecord) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.lastClientErrorId++
+	clientError.Id = m.lastClientErrorId
+	m.clientErrors[clientError.Id] = clientError
+	return nil
+}
+
+// Returns the oldest ClientErrorRecords of every round, ordered by Id. At
+// most limit records are returned, or all of them if limit is zero.
+func (m *MapImpl) GetClientErrors(limit int) ([]*ClientErrorRecord, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	results := make([]*ClientErrorRecord, 0, len(m.clientErrors))
+	for _, clientError := range m.clientErrors {
+		results = append(results, clientError)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Id < results[j].Id
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// Deletes the ClientErrorRecords with the given Ids from the map
+func (m *MapImpl) DeleteClientErrors(ids []uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, errId := range ids {
+		delete(m.clientErrors, errId)
+	}
+	return nil
+}
+
+// Increments the count of client errors of the given type
+func (m *MapImpl) IncrementClientErrorCount(errType string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.clientErrorCounts[errType]++
+	return nil
+}
+
+// Returns the count of client errors for every type, ordered by Type
+func (m *MapImpl) GetClientErrorCounts() ([]*ClientErrorCount, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	results := make([]*ClientErrorCount, 0, len(m.clientErrorCounts))
+	for errType, count := range m.clientErrorCounts {
+		results = append(results, &ClientErrorCount{Type: errType, Count: count})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Type < results[j].Type
+	})
+	return results, nil
+}
+
+// Inserts the given ClientRegistration into the map, overwriting the
+// existing registration for the same user if one is present
+func (m *MapImpl) UpsertClientRegistration(registration *ClientRegistration) error {
+	userId, err := id.Unmarshal(registration.UserId)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	m.registrations[*userId] = registration
+	return nil
+}
+
+// Returns the ClientRegistration for the given user from the map
+// Or gorm.ErrRecordNotFound if it does not exist
+func (m *MapImpl) GetClientRegistration(userId *id.ID) (*ClientRegistration, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	registration, ok := m.registrations[*userId]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return registration, nil
+}
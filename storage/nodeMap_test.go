@@ -6,3 +6,106 @@
 ////////////////////////////////////////////////////////////////////////////////
 
 package storage
+
+import (
+	"bytes"
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+)
+
+// Happy path
+func TestMapImpl_UpsertSecret(t *testing.T) {
+	m := newMapImpl()
+
+	err := m.UpsertSecret(&StoredSecret{KeyId: 5, Secret: []byte("first")})
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+	err = m.UpsertSecret(&StoredSecret{KeyId: 5, Secret: []byte("second")})
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+
+	if len(m.secrets) != 1 {
+		t.Fatalf("Expected 1 secret in map, got %d", len(m.secrets))
+	}
+	if !bytes.Equal(m.secrets[5].Secret, []byte("second")) {
+		t.Errorf("UpsertSecret did not overwrite existing secret."+
+			"\n\tExpected: %s\n\tReceived: %s", "second", m.secrets[5].Secret)
+	}
+}
+
+// Happy path
+func TestMapImpl_GetSecrets(t *testing.T) {
+	m := newMapImpl()
+
+	for _, keyId := range []int{3, 1, 2} {
+		err := m.UpsertSecret(&StoredSecret{KeyId: keyId, Secret: []byte{byte(keyId)}})
+		if err != nil {
+			t.Fatalf("UpsertSecret error: %+v", err)
+		}
+	}
+
+	secrets, err := m.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(secrets) != 3 {
+		t.Fatalf("Expected 3 secrets, got %d", len(secrets))
+	}
+	for i, secret := range secrets {
+		if secret.KeyId != i+1 {
+			t.Errorf("Secrets not ordered by key ID."+
+				"\n\tExpected: %d\n\tReceived: %d", i+1, secret.KeyId)
+		}
+	}
+}
+
+// Happy path
+func TestMapImpl_DeleteSecret(t *testing.T) {
+	m := newMapImpl()
+
+	err := m.UpsertSecret(&StoredSecret{KeyId: 0, Secret: []byte("test")})
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+	err = m.DeleteSecret(0)
+	if err != nil {
+		t.Fatalf("DeleteSecret error: %+v", err)
+	}
+	if len(m.secrets) != 0 {
+		t.Errorf("Secret was not deleted from map")
+	}
+}
+
+// Happy path
+func TestMapImpl_UpsertEphemeralKey(t *testing.T) {
+	m := newMapImpl()
+
+	key := &EphemeralKey{PublicKey: []byte("pub"), PrivateKey: []byte("priv")}
+	err := m.UpsertEphemeralKey(key)
+	if err != nil {
+		t.Fatalf("UpsertEphemeralKey error: %+v", err)
+	}
+
+	received, err := m.GetEphemeralKey()
+	if err != nil {
+		t.Fatalf("GetEphemeralKey error: %+v", err)
+	}
+	if !bytes.Equal(received.PublicKey, key.PublicKey) ||
+		!bytes.Equal(received.PrivateKey, key.PrivateKey) {
+		t.Errorf("Received unexpected ephemeral key."+
+			"\n\tExpected: %+v\n\tReceived: %+v", key, received)
+	}
+}
+
+// Error path: No ephemeral key has been stored
+func TestMapImpl_GetEphemeralKey_NoKey(t *testing.T) {
+	m := newMapImpl()
+
+	_, err := m.GetEphemeralKey()
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Expected %v, received %v", gorm.ErrRecordNotFound, err)
+	}
+}
@@ -9,11 +9,19 @@ package storage
 
 import (
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
 	"gitlab.com/elixxir/crypto/cyclic"
 	"gitlab.com/xx_network/primitives/id"
+	"gitlab.com/xx_network/primitives/utils"
+	"gopkg.in/yaml.v2"
+	"io"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -34,9 +42,28 @@ type PrecanStore struct {
 // the boolean selects if it is the entire store, or just
 // the dummy gateway identity
 func NewPrecanStore(allPrecanned bool, grp *cyclic.Group) *PrecanStore {
-	store := make(map[id.ID][]byte, numDemoUsers)
+	ps := newDummyPrecanStore(numDemoUsers, grp)
+
+	if allPrecanned {
+		jww.INFO.Printf("Adding dummy users")
+
+		// Deterministically create named users for demo
+		for i := 1; i < numDemoUsers; i++ {
+			h := sha256.New()
+			h.Reset()
+			h.Write([]byte(strconv.Itoa(4000 + i)))
+			usrID := PrecannedUserId(uint64(i))
+			ps.store[*usrID] = grp.NewIntFromBytes(h.Sum(nil)).Bytes()
+		}
+	}
+
+	return ps
+}
+
+// Builds a PrecanStore containing only the dummy gateway identity
+func newDummyPrecanStore(size int, grp *cyclic.Group) *PrecanStore {
 	ps := &PrecanStore{
-		store: store,
+		store: make(map[id.ID][]byte, size),
 		mux:   sync.Mutex{},
 	}
 
@@ -47,22 +74,129 @@ func NewPrecanStore(allPrecanned bool, grp *cyclic.Group) *PrecanStore {
 	dummyKey := grp.NewIntFromBytes(dummyId.Marshal()[:]).Bytes()
 	ps.store[*dummyId] = dummyKey
 
-	if allPrecanned {
-		jww.INFO.Printf("Adding dummy users")
+	return ps
+}
 
-		// Deterministically create named users for demo
-		for i := 1; i < numDemoUsers; i++ {
-			h := sha256.New()
-			h.Reset()
-			h.Write([]byte(strconv.Itoa(4000 + i)))
-			usrID := new(id.ID)
-			binary.BigEndian.PutUint64(usrID[:], uint64(i))
-			usrID.SetType(id.User)
-			ps.store[*usrID] = grp.NewIntFromBytes(h.Sum(nil)).Bytes()
+// PrecannedUser is a single entry of a precanned users file. Both fields are
+// base64 encoded; the ID is the marshalled 33 byte user ID.
+type PrecannedUser struct {
+	Id  string `json:"id" yaml:"id"`
+	Key string `json:"key" yaml:"key"`
+}
+
+// PrecannedUsersFile is the contents of a precanned users file
+type PrecannedUsersFile struct {
+	Users []PrecannedUser `json:"users" yaml:"users"`
+}
+
+// LoadPrecanStore builds a PrecanStore from the precanned users file at path
+// in place of the hardcoded users created by NewPrecanStore. Files ending in
+// .yaml or .yml are parsed as YAML, all others as JSON. The dummy gateway
+// identity is always included.
+func LoadPrecanStore(path string, grp *cyclic.Group) (*PrecanStore, error) {
+	data, err := utils.ReadFile(path)
+	if err != nil {
+		return nil, errors.Errorf("Failed to read precanned users file %s: %+v",
+			path, err)
+	}
+
+	file := &PrecannedUsersFile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, file)
+	default:
+		err = json.Unmarshal(data, file)
+	}
+	if err != nil {
+		return nil, errors.Errorf("Failed to parse precanned users file %s: %+v",
+			path, err)
+	}
+
+	ps := newDummyPrecanStore(len(file.Users)+1, grp)
+	for i, user := range file.Users {
+		usrID, key, err := user.decode(grp)
+		if err != nil {
+			return nil, errors.WithMessagef(err,
+				"Invalid user %d in precanned users file %s", i, path)
+		}
+		if _, exists := ps.store[*usrID]; exists {
+			return nil, errors.Errorf("Duplicate user %s in precanned "+
+				"users file %s", usrID, path)
 		}
+		ps.store[*usrID] = key
 	}
 
-	return ps
+	jww.INFO.Printf("Loaded %d precanned users from %s", len(file.Users), path)
+	return ps, nil
+}
+
+// PrecannedUserId returns the precanned user ID with the given index, laid
+// out in the same way as the hardcoded users of NewPrecanStore
+func PrecannedUserId(index uint64) *id.ID {
+	usrID := new(id.ID)
+	binary.BigEndian.PutUint64(usrID[:], index)
+	usrID.SetType(id.User)
+	return usrID
+}
+
+// GeneratePrecannedUsers creates count precanned users with sequential IDs
+// starting at index start and random 32 byte keys read from rng
+func GeneratePrecannedUsers(start uint64, count int,
+	rng io.Reader) (*PrecannedUsersFile, error) {
+	file := &PrecannedUsersFile{Users: make([]PrecannedUser, count)}
+	for i := range file.Users {
+		key := make([]byte, 32)
+		for isZero(key) {
+			if _, err := io.ReadFull(rng, key); err != nil {
+				return nil, errors.Errorf("Failed to generate key for "+
+					"precanned user %d: %+v", start+uint64(i), err)
+			}
+		}
+		file.Users[i] = PrecannedUser{
+			Id:  base64.StdEncoding.EncodeToString(PrecannedUserId(start + uint64(i)).Marshal()),
+			Key: base64.StdEncoding.EncodeToString(key),
+		}
+	}
+	return file, nil
+}
+
+// Returns true if every byte of b is zero
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Decodes the user ID and key, checking that the ID is a user ID and the key
+// is an element of the group
+func (u PrecannedUser) decode(grp *cyclic.Group) (*id.ID, []byte, error) {
+	idBytes, err := base64.StdEncoding.DecodeString(u.Id)
+	if err != nil {
+		return nil, nil, errors.Errorf("Failed to decode ID %q: %+v", u.Id, err)
+	}
+	usrID, err := id.Unmarshal(idBytes)
+	if err != nil {
+		return nil, nil, errors.Errorf("Failed to unmarshal ID %q: %+v", u.Id, err)
+	}
+	if usrID.GetType() != id.User {
+		return nil, nil, errors.Errorf("ID %s has type %s, expected %s",
+			usrID, usrID.GetType(), id.User)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(u.Key)
+	if err != nil {
+		return nil, nil, errors.Errorf("Failed to decode key for %s: %+v",
+			usrID, err)
+	}
+	if len(key) == 0 || !grp.BytesInside(key) {
+		return nil, nil, errors.Errorf("Key for %s is not in the cMix group",
+			usrID)
+	}
+
+	return usrID, grp.NewIntFromBytes(key).Bytes(), nil
 }
 
 // Get retrieves the precanned key associated with userID if it exists.
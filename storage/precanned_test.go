@@ -0,0 +1,133 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"gitlab.com/elixxir/crypto/cyclic"
+	"gitlab.com/xx_network/crypto/large"
+	"gitlab.com/xx_network/primitives/id"
+	"gopkg.in/yaml.v2"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Returns a small cyclic group for testing precanned users
+func newPrecanTestGroup() *cyclic.Group {
+	return cyclic.NewGroup(large.NewIntFromString("FFFFFFFFFFFFFFFFC90FDAA22168C234"+
+		"C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519"+
+		"B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A63A"+
+		"3620FFFFFFFFFFFFFFFF", 16), large.NewInt(2))
+}
+
+// Writes the precanned users file to a temporary file with the given name
+func writeTestPrecanFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write precanned users file: %+v", err)
+	}
+	return path
+}
+
+// Happy path: generated users are loaded from both JSON and YAML files
+func TestLoadPrecanStore(t *testing.T) {
+	grp := newPrecanTestGroup()
+	file, err := GeneratePrecannedUsers(5, 3, rand.New(rand.NewSource(42)))
+	if err != nil {
+		t.Fatalf("GeneratePrecannedUsers error: %+v", err)
+	}
+
+	jsonData, err := json.Marshal(file)
+	if err != nil {
+		t.Fatalf("Failed to marshal JSON: %+v", err)
+	}
+	yamlData, err := yaml.Marshal(file)
+	if err != nil {
+		t.Fatalf("Failed to marshal YAML: %+v", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"precanned.json": jsonData, "precanned.yaml": yamlData} {
+		ps, err := LoadPrecanStore(writeTestPrecanFile(t, name, data), grp)
+		if err != nil {
+			t.Fatalf("LoadPrecanStore error for %s: %+v", name, err)
+		}
+
+		if _, ok := ps.Get(&id.DummyUser); !ok {
+			t.Errorf("Dummy gateway user missing from %s", name)
+		}
+		for i, user := range file.Users {
+			expectedKey, _ := base64.StdEncoding.DecodeString(user.Key)
+			key, ok := ps.Get(PrecannedUserId(5 + uint64(i)))
+			if !ok {
+				t.Errorf("User %d missing from %s", 5+i, name)
+			} else if !bytes.Equal(grp.NewIntFromBytes(expectedKey).Bytes(), key) {
+				t.Errorf("Unexpected key for user %d from %s."+
+					"\n\tExpected: %v\n\tReceived: %v", 5+i, name, expectedKey, key)
+			}
+		}
+
+		// Hardcoded users outside the file are not present
+		if _, ok := ps.Get(PrecannedUserId(1)); ok {
+			t.Errorf("Hardcoded user 1 should not be loaded from %s", name)
+		}
+	}
+}
+
+// Error path: invalid users files are rejected
+func TestLoadPrecanStore_Invalid(t *testing.T) {
+	grp := newPrecanTestGroup()
+	userId := base64.StdEncoding.EncodeToString(PrecannedUserId(1).Marshal())
+	nodeId := base64.StdEncoding.EncodeToString(
+		id.NewIdFromUInt(1, id.Node, t).Marshal())
+	key := base64.StdEncoding.EncodeToString([]byte{1, 2, 3})
+	zeroKey := base64.StdEncoding.EncodeToString([]byte{0})
+
+	tests := map[string][]PrecannedUser{
+		"bad ID encoding": {{Id: "!", Key: key}},
+		"short ID":        {{Id: key, Key: key}},
+		"node ID":         {{Id: nodeId, Key: key}},
+		"missing key":     {{Id: userId}},
+		"zero key":        {{Id: userId, Key: zeroKey}},
+		"duplicate":       {{Id: userId, Key: key}, {Id: userId, Key: key}},
+	}
+
+	for name, users := range tests {
+		data, _ := json.Marshal(PrecannedUsersFile{Users: users})
+		_, err := LoadPrecanStore(writeTestPrecanFile(t, "users.json", data), grp)
+		if err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	_, err := LoadPrecanStore(filepath.Join(t.TempDir(), "missing.json"), grp)
+	if err == nil {
+		t.Errorf("Expected an error for a missing file")
+	}
+
+	_, err = LoadPrecanStore(writeTestPrecanFile(t, "users.yaml",
+		[]byte("users:\n  - id: a\n    unknown: b\n")), grp)
+	if err == nil {
+		t.Errorf("Expected an error for an unknown YAML field")
+	}
+}
+
+// Tests that PrecannedUserId matches the IDs of the hardcoded users
+func TestPrecannedUserId(t *testing.T) {
+	grp := newPrecanTestGroup()
+	ps := NewPrecanStore(true, grp)
+	for _, i := range []uint64{1, 42, uint64(numDemoUsers - 1)} {
+		if _, ok := ps.Get(PrecannedUserId(i)); !ok {
+			t.Errorf("Hardcoded user %d not found", i)
+		}
+	}
+}
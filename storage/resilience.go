@@ -0,0 +1,340 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Handles retrying failed database calls and tracking database health
+
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/xx_network/primitives/id"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDatabaseUnavailable is returned without contacting the database while
+// the circuit breaker is open after repeated failures
+var ErrDatabaseUnavailable = errors.New("database is unavailable")
+
+// Parameters for retrying database calls and for the circuit breaker
+type resilienceParams struct {
+	// Number of attempts made for each call before its error is returned
+	MaxAttempts int
+	// Delay before the first retry, doubled after each subsequent retry
+	RetryDelay time.Duration
+	// Number of consecutive failed attempts which opens the circuit breaker
+	FailureThreshold int
+	// Time the circuit breaker stays open before the database is tried again
+	OpenTimeout time.Duration
+}
+
+// Returns the resilience parameters used for the Postgres backend
+func defaultResilienceParams() resilienceParams {
+	return resilienceParams{
+		MaxAttempts:      3,
+		RetryDelay:       100 * time.Millisecond,
+		FailureThreshold: 5,
+		OpenTimeout:      10 * time.Second,
+	}
+}
+
+// resilientDatabase wraps a database, retrying calls which fail due to
+// timeouts or connection errors. After FailureThreshold consecutive failures
+// the circuit breaker opens and calls fail with ErrDatabaseUnavailable until
+// OpenTimeout elapses, after which a single call is let through to test the
+// database.
+type resilientDatabase struct {
+	db     database
+	ping   func() error // Tests the database connection when probing health
+	params resilienceParams
+
+	failures int       // Consecutive failed attempts
+	openedAt time.Time // Zero if the circuit breaker is closed
+	probing  bool      // True while a call is testing an open breaker
+	lastErr  error     // Error of the most recent failed attempt
+	mux      sync.Mutex
+}
+
+// Wraps db in a resilientDatabase
+func newResilientDatabase(db database, ping func() error,
+	params resilienceParams) *resilientDatabase {
+	return &resilientDatabase{
+		db:     db,
+		ping:   ping,
+		params: params,
+	}
+}
+
+// Returns true if the error is due to the database being unreachable or
+// too slow to respond, rather than due to the call itself. Gorm does not wrap
+// the original error when a transaction fails to roll back after a timeout,
+// so timeouts are also matched by their message.
+func isTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		strings.Contains(err.Error(), context.DeadlineExceeded.Error()) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr)
+}
+
+// Returns an error if the circuit breaker is open, otherwise reserves the
+// right to make an attempt
+func (r *resilientDatabase) allow() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.openedAt.IsZero() {
+		return nil
+	}
+	if r.probing || time.Since(r.openedAt) < r.params.OpenTimeout {
+		return errors.WithMessagef(ErrDatabaseUnavailable,
+			"%d consecutive failures, last error: %v", r.failures, r.lastErr)
+	}
+
+	// Let this attempt through to test whether the database has recovered
+	r.probing = true
+	return nil
+}
+
+// Records the outcome of an attempt, opening or closing the circuit breaker
+func (r *resilientDatabase) record(failed bool, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if !failed {
+		if !r.openedAt.IsZero() {
+			jww.INFO.Printf("Database has recovered after %d failures",
+				r.failures)
+		}
+		r.failures = 0
+		r.openedAt = time.Time{}
+		r.probing = false
+		r.lastErr = nil
+		return
+	}
+
+	r.failures++
+	r.lastErr = err
+	if r.probing || (r.openedAt.IsZero() && r.failures >= r.params.FailureThreshold) {
+		if r.openedAt.IsZero() {
+			jww.ERROR.Printf("Database is unavailable after %d failures: %+v",
+				r.failures, err)
+		}
+		r.openedAt = time.Now()
+		r.probing = false
+	}
+}
+
+// Calls fn, retrying it with backoff while it fails with a transient error
+func (r *resilientDatabase) do(name string, fn func() error) error {
+	delay := r.params.RetryDelay
+	for attempt := 1; ; attempt++ {
+		if err := r.allow(); err != nil {
+			return errors.WithMessagef(err, "Failed to %s", name)
+		}
+
+		err := fn()
+		failed := isTransient(err)
+		r.record(failed, err)
+		if !failed {
+			return err
+		}
+		if attempt >= r.params.MaxAttempts {
+			return errors.WithMessagef(err, "Failed to %s after %d attempts",
+				name, attempt)
+		}
+
+		jww.WARN.Printf("Failed to %s on attempt %d of %d, retrying in %s: %+v",
+			name, attempt, r.params.MaxAttempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Returns nil if the database is accepting calls, otherwise an error
+// describing why it is not. If the circuit breaker is ready to be tested, the
+// database is pinged first.
+func (r *resilientDatabase) health() error {
+	if r.allow() == nil {
+		r.mux.Lock()
+		probing := r.probing
+		r.mux.Unlock()
+		if !probing {
+			return nil
+		}
+
+		err := r.ping()
+		r.record(err != nil, err)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.openedAt.IsZero() {
+		return nil
+	}
+	return errors.WithMessagef(ErrDatabaseUnavailable,
+		"%d consecutive failures, last error: %v", r.failures, r.lastErr)
+}
+
+// Inserts the given StoredSecret into the database, overwriting the
+// existing secret if one with the same KeyId is present
+func (r *resilientDatabase) UpsertSecret(secret *StoredSecret) error {
+	return r.do("upsert node secret", func() error {
+		return r.db.UpsertSecret(secret)
+	})
+}
+
+// Returns all StoredSecrets in the database, ordered by KeyId
+func (r *resilientDatabase) GetSecrets() (results []*StoredSecret, err error) {
+	err = r.do("get node secrets", func() error {
+		results, err = r.db.GetSecrets()
+		return err
+	})
+	return results, err
+}
+
+// Deletes the StoredSecret with the given keyId from the database
+func (r *resilientDatabase) DeleteSecret(keyId int) error {
+	return r.do("delete node secret", func() error {
+		return r.db.DeleteSecret(keyId)
+	})
+}
+
+// Inserts the given EphemeralKey into the database, replacing any
+// previously stored keypair
+func (r *resilientDatabase) UpsertEphemeralKey(key *EphemeralKey) error {
+	return r.do("upsert ephemeral key", func() error {
+		return r.db.UpsertEphemeralKey(key)
+	})
+}
+
+// Returns the EphemeralKey from the database
+func (r *resilientDatabase) GetEphemeralKey() (key *EphemeralKey, err error) {
+	err = r.do("get ephemeral key", func() error {
+		key, err = r.db.GetEphemeralKey()
+		return err
+	})
+	return key, err
+}
+
+// Inserts the given RoundRecord into the database, overwriting the
+// existing record if one with the same Id is present
+func (r *resilientDatabase) UpsertRound(round *RoundRecord) error {
+	return r.do("upsert round", func() error {
+		return r.db.UpsertRound(round)
+	})
+}
+
+// Returns the RoundRecord with the given roundId from the database
+func (r *resilientDatabase) GetRound(roundId id.Round) (round *RoundRecord, err error) {
+	err = r.do("get round", func() error {
+		round, err = r.db.GetRound(roundId)
+		return err
+	})
+	return round, err
+}
+
+// Returns all RoundRecords started within [start, end), ordered by Id
+func (r *resilientDatabase) GetRounds(start, end time.Time) (rounds []*RoundRecord, err error) {
+	err = r.do("get rounds", func() error {
+		rounds, err = r.db.GetRounds(start, end)
+		return err
+	})
+	return rounds, err
+}
+
+// Returns the number of RoundRecords selected by the filter
+func (r *resilientDatabase) CountRounds(filter RoundFilter) (count int64, err error) {
+	err = r.do("count rounds", func() error {
+		count, err = r.db.CountRounds(filter)
+		return err
+	})
+	return count, err
+}
+
+// Inserts the given RoundPhaseRecords into the database, overwriting any
+// existing record for the same round and phase
+func (r *resilientDatabase) UpsertRoundPhases(phases []*RoundPhaseRecord) error {
+	return r.do("upsert round phases", func() error {
+		return r.db.UpsertRoundPhases(phases)
+	})
+}
+
+// Returns all RoundPhaseRecords for the given round, ordered by StartedAt
+func (r *resilientDatabase) GetRoundPhases(roundId id.Round) (phases []*RoundPhaseRecord, err error) {
+	err = r.do("get round phases", func() error {
+		phases, err = r.db.GetRoundPhases(roundId)
+		return err
+	})
+	return phases, err
+}
+
+// Inserts the given ClientErrorRecord into the database
+func (r *resilientDatabase) InsertClientError(clientError *ClientErrorRecord) error {
+	return r.do("insert client error", func() error {
+		return r.db.InsertClientError(clientError)
+	})
+}
+
+// Returns the oldest ClientErrorRecords of every round, ordered by Id
+func (r *resilientDatabase) GetClientErrors(limit int) (errs []*ClientErrorRecord, err error) {
+	err = r.do("get client errors", func() error {
+		errs, err = r.db.GetClientErrors(limit)
+		return err
+	})
+	return errs, err
+}
+
+// Deletes the ClientErrorRecords with the given Ids from the database
+func (r *resilientDatabase) DeleteClientErrors(ids []uint64) error {
+	return r.do("delete client errors", func() error {
+		return r.db.DeleteClientErrors(ids)
+	})
+}
+
+// Increments the count of client errors of the given type
+func (r *resilientDatabase) IncrementClientErrorCount(errType string) error {
+	return r.do("increment client error count", func() error {
+		return r.db.IncrementClientErrorCount(errType)
+	})
+}
+
+// Returns the count of client errors for every type, ordered by Type
+func (r *resilientDatabase) GetClientErrorCounts() (counts []*ClientErrorCount, err error) {
+	err = r.do("get client error counts", func() error {
+		counts, err = r.db.GetClientErrorCounts()
+		return err
+	})
+	return counts, err
+}
+
+// Inserts the given ClientRegistration into the database, overwriting the
+// existing registration for the same user if one is present
+func (r *resilientDatabase) UpsertClientRegistration(registration *ClientRegistration) error {
+	return r.do("upsert client registration", func() error {
+		return r.db.UpsertClientRegistration(registration)
+	})
+}
+
+// Returns the ClientRegistration for the given user from the database
+func (r *resilientDatabase) GetClientRegistration(userId *id.ID) (registration *ClientRegistration, err error) {
+	err = r.do("get client registration", func() error {
+		registration, err = r.db.GetClientRegistration(userId)
+		return err
+	})
+	return registration, err
+}
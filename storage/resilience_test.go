@@ -0,0 +1,283 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2022 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database/sql driver standing in for Postgres. Queries
+// return no rows, unless the driver is set to fail them to simulate an outage
+type fakeDriver struct {
+	down     bool  // Fail every query with err
+	failNext int   // Fail this many of the next queries with err
+	err      error // Error returned by failed queries
+	block    bool  // Block queries until their context expires
+	queries  int   // Number of queries received
+	mux      sync.Mutex
+}
+
+// Returns the error the next query fails with, if any
+func (d *fakeDriver) query(ctx context.Context) error {
+	d.mux.Lock()
+	d.queries++
+	block := d.block
+	var err error
+	if d.down {
+		err = d.err
+	} else if d.failNext > 0 {
+		d.failNext--
+		err = d.err
+	}
+	d.mux.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+// Sets whether every query fails with err
+func (d *fakeDriver) setDown(down bool, err error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.down = down
+	d.err = err
+}
+
+// Returns the number of queries received
+func (d *fakeDriver) getQueries() int {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.queries
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDriver) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+func (d *fakeDriver) Driver() driver.Driver { return d }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+func (c *fakeConn) Ping(ctx context.Context) error {
+	return c.d.query(ctx)
+}
+func (c *fakeConn) QueryContext(ctx context.Context, _ string,
+	_ []driver.NamedValue) (driver.Rows, error) {
+	if err := c.d.query(ctx); err != nil {
+		return nil, err
+	}
+	return fakeRows{}, nil
+}
+func (c *fakeConn) ExecContext(ctx context.Context, _ string,
+	_ []driver.NamedValue) (driver.Result, error) {
+	if err := c.d.query(ctx); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// Resilience parameters which keep the tests fast
+var testResilienceParams = resilienceParams{
+	MaxAttempts:      3,
+	RetryDelay:       time.Millisecond,
+	FailureThreshold: 5,
+	OpenTimeout:      50 * time.Millisecond,
+}
+
+// Creates a resilientDatabase wrapping a DatabaseImpl backed by a fakeDriver
+func newFakeResilientDatabase(t *testing.T,
+	params resilienceParams) (*resilientDatabase, *fakeDriver) {
+	d := &fakeDriver{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(d)}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Failed to open fake database: %+v", err)
+	}
+	di := &DatabaseImpl{db: db}
+	return newResilientDatabase(di, di.ping, params), d
+}
+
+// Happy path: calls which time out are retried until they succeed
+func TestResilientDatabase_Retry(t *testing.T) {
+	rd, d := newFakeResilientDatabase(t, testResilienceParams)
+	d.failNext, d.err = 2, context.DeadlineExceeded
+	start := d.getQueries()
+
+	_, err := rd.GetRound(1)
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("Unexpected error.\n\tExpected: %v\n\tReceived: %+v",
+			gorm.ErrRecordNotFound, err)
+	}
+	if queries := d.getQueries() - start; queries != 3 {
+		t.Errorf("Unexpected number of queries."+
+			"\n\tExpected: %d\n\tReceived: %d", 3, queries)
+	}
+	if err = rd.health(); err != nil {
+		t.Errorf("Database should be healthy after recovering: %+v", err)
+	}
+}
+
+// Error path: the error is returned once every attempt has failed
+func TestResilientDatabase_RetriesExhausted(t *testing.T) {
+	rd, d := newFakeResilientDatabase(t, testResilienceParams)
+	d.setDown(true, context.DeadlineExceeded)
+	start := d.getQueries()
+
+	err := rd.UpsertRound(&RoundRecord{Id: 1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error.\n\tExpected: %v\n\tReceived: %+v",
+			context.DeadlineExceeded, err)
+	}
+	if queries := d.getQueries() - start; queries != testResilienceParams.MaxAttempts {
+		t.Errorf("Unexpected number of queries."+
+			"\n\tExpected: %d\n\tReceived: %d",
+			testResilienceParams.MaxAttempts, queries)
+	}
+
+	// Fewer failures than the threshold do not open the circuit breaker
+	if err = rd.health(); err != nil {
+		t.Errorf("Database should be healthy below the failure threshold: %+v", err)
+	}
+}
+
+// Error path: errors caused by the call itself are not retried
+func TestResilientDatabase_NotTransient(t *testing.T) {
+	rd, d := newFakeResilientDatabase(t, testResilienceParams)
+	d.setDown(true, errors.New("syntax error"))
+	start := d.getQueries()
+
+	for i := 0; i < testResilienceParams.FailureThreshold; i++ {
+		if err := rd.DeleteSecret(1); err == nil {
+			t.Fatalf("Expected an error from the fake driver")
+		}
+	}
+	if queries := d.getQueries() - start; queries != testResilienceParams.FailureThreshold {
+		t.Errorf("Unexpected number of queries."+
+			"\n\tExpected: %d\n\tReceived: %d",
+			testResilienceParams.FailureThreshold, queries)
+	}
+	if err := rd.health(); err != nil {
+		t.Errorf("Database should be healthy: %+v", err)
+	}
+}
+
+// Tests that the circuit breaker opens after repeated failures, fails calls
+// without contacting the database while open, and closes once the database
+// responds to a ping
+func TestResilientDatabase_CircuitBreaker(t *testing.T) {
+	rd, d := newFakeResilientDatabase(t, testResilienceParams)
+	d.setDown(true, context.DeadlineExceeded)
+
+	for i := 0; i < 2; i++ {
+		_, _ = rd.GetSecrets()
+	}
+	err := rd.health()
+	if !errors.Is(err, ErrDatabaseUnavailable) {
+		t.Fatalf("Unexpected health.\n\tExpected: %v\n\tReceived: %+v",
+			ErrDatabaseUnavailable, err)
+	}
+
+	// Calls fail fast while the breaker is open
+	start := d.getQueries()
+	_, err = rd.GetClientErrors(0)
+	if !errors.Is(err, ErrDatabaseUnavailable) {
+		t.Errorf("Unexpected error.\n\tExpected: %v\n\tReceived: %+v",
+			ErrDatabaseUnavailable, err)
+	}
+	if queries := d.getQueries() - start; queries != 0 {
+		t.Errorf("No queries should be made while the breaker is open."+
+			"\n\tReceived: %d", queries)
+	}
+
+	// A failed probe keeps the breaker open
+	time.Sleep(testResilienceParams.OpenTimeout)
+	if err = rd.health(); !errors.Is(err, ErrDatabaseUnavailable) {
+		t.Errorf("Database should remain unhealthy after a failed ping: %+v", err)
+	}
+	if queries := d.getQueries() - start; queries != 1 {
+		t.Errorf("Expected a single ping to probe the database."+
+			"\n\tReceived: %d", queries)
+	}
+
+	// The breaker closes once the database recovers
+	d.setDown(false, nil)
+	time.Sleep(testResilienceParams.OpenTimeout)
+	if err = rd.health(); err != nil {
+		t.Fatalf("Database should be healthy after recovering: %+v", err)
+	}
+	if err = rd.UpsertSecret(&StoredSecret{KeyId: 1}); err != nil {
+		t.Errorf("UpsertSecret error after recovering: %+v", err)
+	}
+}
+
+// Tests that a call which exceeds DbTimeout returns an error rather than
+// panicking
+func TestResilientDatabase_Timeout(t *testing.T) {
+	params := testResilienceParams
+	params.MaxAttempts = 1
+	rd, d := newFakeResilientDatabase(t, params)
+	d.mux.Lock()
+	d.block = true
+	d.mux.Unlock()
+
+	err := rd.InsertClientError(&ClientErrorRecord{RoundId: 1})
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("Unexpected error.\n\tExpected: %v\n\tReceived: %+v",
+			context.DeadlineExceeded, err)
+	}
+}
+
+// Tests that Storage reports the health of a Postgres backend, and that the
+// other backends are always healthy
+func TestStorage_Health(t *testing.T) {
+	rd, d := newFakeResilientDatabase(t, testResilienceParams)
+	d.setDown(true, context.DeadlineExceeded)
+	s := &Storage{rd}
+	for i := 0; i < 2; i++ {
+		_, _ = s.GetEphemeralKey()
+	}
+	if err := s.Health(); !errors.Is(err, ErrDatabaseUnavailable) {
+		t.Errorf("Unexpected health.\n\tExpected: %v\n\tReceived: %+v",
+			ErrDatabaseUnavailable, err)
+	}
+
+	s = &Storage{newMapImpl()}
+	if err := s.Health(); err != nil {
+		t.Errorf("Map backend should always be healthy: %+v", err)
+	}
+}
@@ -10,8 +10,16 @@ package storage
 import (
 	"encoding/base64"
 	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+	"gitlab.com/elixxir/crypto/fastRNG"
 	"gitlab.com/elixxir/crypto/nike"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+	"gitlab.com/xx_network/primitives/id"
+	"gorm.io/gorm"
+	"io"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Error constants
@@ -19,6 +27,7 @@ const (
 	BadSecretSizeError  = "Secret exceeds secret size"
 	ManagerFullError    = "Manager is full"
 	NoSecretExistsError = "No secret exists for key ID %d"
+	NoActiveSecretError = "No valid node secret exists"
 )
 
 // Secret manager constants
@@ -29,6 +38,10 @@ const (
 	// MaxNodeSecrets is the maximum amount of node secrets that will be stored in
 	// RAM.
 	MaxNodeSecrets = 256
+
+	// MaxClientKeyIds is the maximum number of clients whose secret key ID is
+	// kept in RAM. Clients which are forgotten are looked up in storage again.
+	MaxClientKeyIds = 1 << 18
 )
 
 // Secret represents the data within a NodeSecret. This is defined as a
@@ -39,20 +52,42 @@ type Secret [SecretSize]byte
 // client registration (io/registration.go), and realtime keygen (graphs/keygen.go).
 type NodeSecret struct {
 	Secret Secret
-	// todo: create a way to clear out old secrets and rotate them with new ones
-	//TimeCreated time.Time  // Left as a stub
+	KeyId  int
+	// Time after which the secret is no longer accepted. A zero value denotes
+	// a secret which never expires
+	ValidUntil time.Time
+}
+
+// SecretRotationParams defines the schedule on which a NodeSecretManager
+// creates new secrets and retires old ones.
+type SecretRotationParams struct {
+	// Time between the creation of new secrets
+	RotationPeriod time.Duration
+	// Time a secret remains valid after its creation. This should be greater
+	// than RotationPeriod so that a window of older secrets stays valid for
+	// clients which registered with them
+	ValidityPeriod time.Duration
 }
 
 // NodeSecretManager will manage and rotate node secrets for client
 // registration.
-// fixme: this is only partially implemented, will need to have
-//
-//	rotating secrets
 type NodeSecretManager struct {
 	secrets         map[int]*NodeSecret
+	nextKeyId       int
 	mux             sync.Mutex
 	ephemeralEdPriv nike.PrivateKey
 	ephemeralEdPub  nike.PublicKey
+
+	// Key ID of the secret each client's key was derived from, so that
+	// keygen does not need to try every valid secret
+	clientKeyIds map[id.ID]int
+
+	// Persistent storage backing the manager. If nil, secrets are only
+	// kept in RAM
+	store *Storage
+	// Encrypts secrets before they are persisted. If nil, secrets are
+	// persisted in plaintext
+	wrapper *SecretWrapper
 }
 
 // NewNodeSecretManager is the constructor for a NodeSecretManager. This will
@@ -60,16 +95,111 @@ type NodeSecretManager struct {
 // of MaxNodeSecrets.
 func NewNodeSecretManager() *NodeSecretManager {
 	return &NodeSecretManager{
-		secrets: make(map[int]*NodeSecret, MaxNodeSecrets),
+		secrets:      make(map[int]*NodeSecret, MaxNodeSecrets),
+		clientKeyIds: make(map[id.ID]int),
+	}
+}
+
+// LoadNodeSecretManager constructs a NodeSecretManager backed by the given
+// Storage. Any secrets and ephemeral keys previously persisted are loaded
+// into the manager, and all future upserts and deletions are written through
+// to the Storage. Secrets and the ephemeral private key are encrypted at rest
+// with the given SecretWrapper; any previously stored in plaintext are
+// encrypted when loaded.
+func LoadNodeSecretManager(store *Storage, wrapper *SecretWrapper) (*NodeSecretManager, error) {
+	nsm := NewNodeSecretManager()
+	nsm.wrapper = wrapper
+
+	storedSecrets, err := store.GetSecrets()
+	if err != nil {
+		return nil, errors.WithMessage(err, "Could not load node secrets")
+	}
+	for _, stored := range storedSecrets {
+		data, err := wrapper.unwrap(stored)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > SecretSize {
+			return nil, errors.Errorf("Could not load node secret %d: %s",
+				stored.KeyId, BadSecretSizeError)
+		}
+		secret := Secret{}
+		copy(secret[:], data)
+		nsm.secrets[stored.KeyId] = &NodeSecret{
+			Secret:     secret,
+			KeyId:      stored.KeyId,
+			ValidUntil: stored.ValidUntil,
+		}
+		if stored.KeyId >= nsm.nextKeyId {
+			nsm.nextKeyId = stored.KeyId + 1
+		}
+	}
+
+	// Encrypt secrets and the ephemeral private key stored before a wrapping
+	// key was configured
+	if wrapper != nil {
+		count, err := ReencryptSecrets(store, nil, wrapper)
+		if err != nil {
+			return nil, errors.WithMessage(err, "Could not encrypt plaintext node secrets")
+		}
+		if count > 0 {
+			jww.INFO.Printf("Encrypted %d plaintext node secrets", count)
+		}
 	}
+
+	ephemeral, err := store.GetEphemeralKey()
+	if err == nil {
+		nsm.ephemeralEdPub, err = ecdh.ECDHNIKE.UnmarshalBinaryPublicKey(
+			ephemeral.PublicKey)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				"Could not unmarshal stored ephemeral public key")
+		}
+		privateKey, err := wrapper.unwrapEphemeral(ephemeral)
+		if err != nil {
+			return nil, err
+		}
+		nsm.ephemeralEdPriv, err = ecdh.ECDHNIKE.UnmarshalBinaryPrivateKey(
+			privateKey)
+		if err != nil {
+			return nil, errors.WithMessage(err,
+				"Could not unmarshal stored ephemeral private key")
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.WithMessage(err, "Could not load ephemeral keys")
+	}
+
+	nsm.store = store
+	return nsm, nil
 }
 
-func (nsm *NodeSecretManager) UpsertEphemerals(pub nike.PublicKey, priv nike.PrivateKey) {
+// UpsertEphemerals sets the node's ephemeral keypair, overwriting the
+// existing keypair if one exists.
+func (nsm *NodeSecretManager) UpsertEphemerals(pub nike.PublicKey, priv nike.PrivateKey) error {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	if nsm.store != nil {
+		stored, err := nsm.wrapper.newEphemeralKey(pub.Bytes(), priv.Bytes())
+		if err != nil {
+			return err
+		}
+		err = nsm.store.UpsertEphemeralKey(stored)
+		if err != nil {
+			return errors.WithMessage(err, "Could not store ephemeral keys")
+		}
+	}
+
 	nsm.ephemeralEdPriv = priv
 	nsm.ephemeralEdPub = pub
+	return nil
 }
 
+// GetEphemeralEd returns the node's ephemeral keypair. Both keys are nil if
+// no keypair has been set.
 func (nsm *NodeSecretManager) GetEphemeralEd() (nike.PublicKey, nike.PrivateKey) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
 	return nsm.ephemeralEdPub, nsm.ephemeralEdPriv
 }
 
@@ -87,10 +217,18 @@ func (nsm *NodeSecretManager) GetSecret(keyId int) (Secret, error) {
 }
 
 // UpsertSecret inserts a node secret into the NodeSecretManager.
-// It will overwrite the existing secret if one exists.
+// It will overwrite the existing secret if one exists. Secrets inserted this
+// way never expire.
 func (nsm *NodeSecretManager) UpsertSecret(keyId int, data []byte) error {
 	nsm.mux.Lock()
 	defer nsm.mux.Unlock()
+	return nsm.upsertSecret(keyId, data, time.Time{})
+}
+
+// upsertSecret inserts a node secret which is valid until the given time.
+// The caller must hold the lock.
+func (nsm *NodeSecretManager) upsertSecret(keyId int, data []byte,
+	validUntil time.Time) error {
 	if len(nsm.secrets) == MaxNodeSecrets {
 		return errors.Errorf(ManagerFullError)
 	}
@@ -103,14 +241,221 @@ func (nsm *NodeSecretManager) UpsertSecret(keyId int, data []byte) error {
 	secret := Secret{}
 	copy(secret[:], data)
 
+	// Persist secret before making it available
+	if nsm.store != nil {
+		stored, err := nsm.wrapper.newStoredSecret(keyId, secret.Bytes(),
+			time.Now(), validUntil)
+		if err != nil {
+			return err
+		}
+		err = nsm.store.UpsertSecret(stored)
+		if err != nil {
+			return errors.WithMessagef(err, "Could not store node secret %d", keyId)
+		}
+	}
+
 	// Place secret in map
 	nsm.secrets[keyId] = &NodeSecret{
-		Secret: secret,
+		Secret:     secret,
+		KeyId:      keyId,
+		ValidUntil: validUntil,
+	}
+	if keyId >= nsm.nextKeyId {
+		nsm.nextKeyId = keyId + 1
 	}
 
 	return nil
 }
 
+// GetActiveSecret returns the newest valid NodeSecret. This is the secret
+// handed out to clients requesting a key.
+func (nsm *NodeSecretManager) GetActiveSecret() (*NodeSecret, error) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	now := time.Now()
+	var active *NodeSecret
+	for _, ns := range nsm.secrets {
+		if ns.isValid(now) && (active == nil || ns.KeyId > active.KeyId) {
+			active = ns
+		}
+	}
+	if active == nil {
+		return nil, errors.New(NoActiveSecretError)
+	}
+
+	return active, nil
+}
+
+// GetValidSecrets returns every NodeSecret which has not yet expired, ordered
+// from newest to oldest.
+func (nsm *NodeSecretManager) GetValidSecrets() []*NodeSecret {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	now := time.Now()
+	valid := make([]*NodeSecret, 0, len(nsm.secrets))
+	for _, ns := range nsm.secrets {
+		if ns.isValid(now) {
+			valid = append(valid, ns)
+		}
+	}
+	sort.Slice(valid, func(i, j int) bool {
+		return valid[i].KeyId > valid[j].KeyId
+	})
+
+	return valid
+}
+
+// SetClientKeyId records that the client's key was derived from the secret
+// with the given key ID. An arbitrary client is forgotten if MaxClientKeyIds
+// clients are already recorded.
+func (nsm *NodeSecretManager) SetClientKeyId(userId *id.ID, keyId int) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+	if _, ok := nsm.clientKeyIds[*userId]; !ok &&
+		len(nsm.clientKeyIds) >= MaxClientKeyIds {
+		for forgotten := range nsm.clientKeyIds {
+			delete(nsm.clientKeyIds, forgotten)
+			break
+		}
+	}
+	nsm.clientKeyIds[*userId] = keyId
+}
+
+// GetClientSecret returns the secret the client's key was derived from, as
+// recorded when the client registered. Returns false if the secret is not
+// known or is no longer valid.
+func (nsm *NodeSecretManager) GetClientSecret(userId *id.ID) (*NodeSecret, bool) {
+	ns, known, ok := nsm.getKnownClientSecret(userId)
+	if known {
+		return ns, ok
+	}
+
+	// Registrations from before a restart are only in storage
+	nsm.mux.Lock()
+	store := nsm.store
+	nsm.mux.Unlock()
+	if store == nil {
+		return nil, false
+	}
+	registration, err := store.GetClientRegistration(userId)
+	if err != nil {
+		return nil, false
+	}
+	nsm.SetClientKeyId(userId, registration.KeyId)
+
+	ns, _, ok = nsm.getKnownClientSecret(userId)
+	return ns, ok
+}
+
+// GetKnownClientSecret returns the secret the client's key was derived from if
+// it is recorded in RAM, without looking up the client's registration in
+// storage. Returns false if the secret is not known or is no longer valid.
+func (nsm *NodeSecretManager) GetKnownClientSecret(userId *id.ID) (*NodeSecret, bool) {
+	ns, _, ok := nsm.getKnownClientSecret(userId)
+	return ns, ok
+}
+
+// getKnownClientSecret returns the valid secret recorded in RAM for the
+// client. known is false if no key ID is recorded for the client.
+func (nsm *NodeSecretManager) getKnownClientSecret(userId *id.ID) (
+	ns *NodeSecret, known, ok bool) {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+	keyId, known := nsm.clientKeyIds[*userId]
+	if !known {
+		return nil, false, false
+	}
+	ns, ok = nsm.secrets[keyId]
+	if !ok || !ns.isValid(time.Now()) {
+		return nil, true, false
+	}
+	return ns, true, true
+}
+
+// RotateSecret creates a new secret from the given source of randomness
+// which is valid for the given duration. Secrets which have expired are
+// purged. Returns the key ID of the new secret.
+func (nsm *NodeSecretManager) RotateSecret(rng io.Reader,
+	validity time.Duration) (int, error) {
+	data := make([]byte, SecretSize)
+	if _, err := io.ReadFull(rng, data); err != nil {
+		return 0, errors.WithMessage(err, "Could not generate node secret")
+	}
+
+	// Purge expired secrets first so that they do not fill the manager
+	nsm.ClearOldSecrets()
+
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	keyId := nsm.nextKeyId
+	err := nsm.upsertSecret(keyId, data, time.Now().Add(validity))
+	if err != nil {
+		return 0, err
+	}
+
+	return keyId, nil
+}
+
+// StartRotation starts a thread which creates a new secret every
+// RotationPeriod and purges secrets once they expire. A secret is created
+// immediately if the manager does not hold a valid one. Sending on or closing
+// the returned channel stops the thread.
+func (nsm *NodeSecretManager) StartRotation(params SecretRotationParams,
+	rngGen *fastRNG.StreamGenerator) (chan struct{}, error) {
+	if params.RotationPeriod <= 0 {
+		return nil, errors.Errorf("Invalid secret rotation period: %s",
+			params.RotationPeriod)
+	}
+	if params.ValidityPeriod < params.RotationPeriod {
+		return nil, errors.Errorf("Secret validity period %s must be at "+
+			"least the rotation period %s", params.ValidityPeriod,
+			params.RotationPeriod)
+	}
+
+	rotate := func() {
+		stream := rngGen.GetStream()
+		keyId, err := nsm.RotateSecret(stream, params.ValidityPeriod)
+		stream.Close()
+		if err != nil {
+			jww.ERROR.Printf("Failed to rotate node secret: %+v", err)
+			return
+		}
+		jww.INFO.Printf("Rotated node secret, new key ID %d", keyId)
+	}
+
+	// Wait out the remainder of the current secret's rotation period rather
+	// than rotating on every restart
+	firstRotation := time.Duration(0)
+	if active, err := nsm.GetActiveSecret(); err == nil && !active.ValidUntil.IsZero() {
+		created := active.ValidUntil.Add(-params.ValidityPeriod)
+		firstRotation = time.Until(created.Add(params.RotationPeriod))
+	}
+	if firstRotation <= 0 {
+		rotate()
+		firstRotation = params.RotationPeriod
+	}
+
+	kill := make(chan struct{}, 1)
+	go func() {
+		timer := time.NewTimer(firstRotation)
+		defer timer.Stop()
+		for {
+			select {
+			case <-kill:
+				return
+			case <-timer.C:
+				rotate()
+				timer.Reset(params.RotationPeriod)
+			}
+		}
+	}()
+
+	return kill, nil
+}
+
 // getNodeSecret returns the entire NodeSecret object from the map.
 // This function is meant to be called by the manager in its management thread.
 func (nsm *NodeSecretManager) getNodeSecret(keyId int) (*NodeSecret, error) {
@@ -135,18 +480,52 @@ func (nsm *NodeSecretManager) delete(keyId int) error {
 		return errors.Errorf(NoSecretExistsError, keyId)
 	}
 
+	if nsm.store != nil {
+		err := nsm.store.DeleteSecret(keyId)
+		if err != nil {
+			return errors.WithMessagef(err, "Could not delete node secret %d", keyId)
+		}
+	}
+
 	delete(nsm.secrets, keyId)
 
 	return nil
 }
 
-// fixme: some mechanism is needed to clear out old secrets once
-//  introducing new ones to avoid a memory leak issue in
-//  NodeSecretManager's map. This function is left here as a stub to be
-//  implemented once a design is complete.
-//func (nsm *NodeSecretManager) ClearOldSecrets() {
-//	// todo: implement me
-//}
+// ClearOldSecrets removes all secrets whose validity has expired from the
+// manager and its storage.
+func (nsm *NodeSecretManager) ClearOldSecrets() {
+	nsm.mux.Lock()
+	defer nsm.mux.Unlock()
+
+	now := time.Now()
+	for keyId, ns := range nsm.secrets {
+		if ns.isValid(now) {
+			continue
+		}
+		if nsm.store != nil {
+			if err := nsm.store.DeleteSecret(keyId); err != nil {
+				jww.WARN.Printf("Failed to delete expired node secret %d: %+v",
+					keyId, err)
+				continue
+			}
+		}
+		delete(nsm.secrets, keyId)
+		jww.DEBUG.Printf("Cleared expired node secret %d", keyId)
+	}
+
+	// Forget which clients used the secrets cleared
+	for userId, keyId := range nsm.clientKeyIds {
+		if _, ok := nsm.secrets[keyId]; !ok {
+			delete(nsm.clientKeyIds, userId)
+		}
+	}
+}
+
+// isValid returns true if the secret has not expired at the given time.
+func (ns *NodeSecret) isValid(now time.Time) bool {
+	return ns.ValidUntil.IsZero() || now.Before(ns.ValidUntil)
+}
 
 // Bytes returns the NodeSecret as a byte slice.
 func (s Secret) Bytes() []byte {
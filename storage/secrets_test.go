@@ -9,10 +9,16 @@ package storage
 
 import (
 	"bytes"
+	"encoding/binary"
+	"gitlab.com/elixxir/crypto/fastRNG"
+	"gitlab.com/elixxir/crypto/nike/ecdh"
+	"gitlab.com/xx_network/crypto/csprng"
+	"gitlab.com/xx_network/primitives/id"
 	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // Unit test
@@ -27,8 +33,9 @@ func TestNewNodeSecretManager(t *testing.T) {
 
 	// Initialize an expected node secret initialization
 	expected := &NodeSecretManager{
-		secrets: make(map[int]*NodeSecret, MaxNodeSecrets),
-		mux:     sync.Mutex{},
+		secrets:      make(map[int]*NodeSecret, MaxNodeSecrets),
+		clientKeyIds: make(map[id.ID]int),
+		mux:          sync.Mutex{},
 	}
 
 	// Check that expected initialization state matches constructor
@@ -301,3 +308,288 @@ func TestNodeSecretManager_getNodeSecret_NonExistingEntry(t *testing.T) {
 	}
 
 }
+
+// Happy path: secrets and ephemeral keys written through a manager are
+// loaded by a new manager backed by the same storage
+func TestLoadNodeSecretManager(t *testing.T) {
+	store, err := NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("NewStorage error: %+v", err)
+	}
+
+	testManager, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+
+	// A fresh store should produce an empty manager
+	if pub, priv := testManager.GetEphemeralEd(); pub != nil || priv != nil {
+		t.Fatalf("Manager loaded from empty storage should not have ephemeral keys")
+	}
+
+	secret := []byte("test1234")
+	err = testManager.UpsertSecret(0, secret)
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+	err = testManager.UpsertSecret(1, []byte("toDelete"))
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+	err = testManager.delete(1)
+	if err != nil {
+		t.Fatalf("delete error: %+v", err)
+	}
+
+	priv, pub := ecdh.ECDHNIKE.NewKeypair(csprng.NewSystemRNG())
+	err = testManager.UpsertEphemerals(pub, priv)
+	if err != nil {
+		t.Fatalf("UpsertEphemerals error: %+v", err)
+	}
+
+	// Load a second manager from the same storage
+	loaded, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+
+	received, err := loaded.GetSecret(0)
+	if err != nil {
+		t.Fatalf("GetSecret error: %+v", err)
+	}
+	expected := make([]byte, SecretSize)
+	copy(expected, secret)
+	if !bytes.Equal(received.Bytes(), expected) {
+		t.Errorf("Loaded manager has unexpected secret."+
+			"\n\tExpected: %v\n\tReceived: %v", expected, received.Bytes())
+	}
+
+	if _, err = loaded.GetSecret(1); err == nil {
+		t.Errorf("Deleted secret should not be loaded")
+	}
+
+	loadedPub, loadedPriv := loaded.GetEphemeralEd()
+	if loadedPub == nil || !bytes.Equal(loadedPub.Bytes(), pub.Bytes()) ||
+		!bytes.Equal(loadedPriv.Bytes(), priv.Bytes()) {
+		t.Errorf("Loaded manager has unexpected ephemeral keys")
+	}
+}
+
+// Happy path: RotateSecret creates a new active secret while the previous
+// secret remains valid
+func TestNodeSecretManager_RotateSecret(t *testing.T) {
+	testManager := NewNodeSecretManager()
+
+	err := testManager.UpsertSecret(0, []byte("legacy"))
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+
+	keyId, err := testManager.RotateSecret(csprng.NewSystemRNG(), time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSecret error: %+v", err)
+	}
+	if keyId != 1 {
+		t.Errorf("Unexpected key ID for rotated secret."+
+			"\n\tExpected: %d\n\tReceived: %d", 1, keyId)
+	}
+
+	active, err := testManager.GetActiveSecret()
+	if err != nil {
+		t.Fatalf("GetActiveSecret error: %+v", err)
+	}
+	if active.KeyId != keyId {
+		t.Errorf("Rotated secret is not active."+
+			"\n\tExpected: %d\n\tReceived: %d", keyId, active.KeyId)
+	}
+	if time.Until(active.ValidUntil) <= 0 || time.Until(active.ValidUntil) > time.Hour {
+		t.Errorf("Rotated secret has unexpected expiry %s", active.ValidUntil)
+	}
+
+	valid := testManager.GetValidSecrets()
+	if len(valid) != 2 || valid[0].KeyId != 1 || valid[1].KeyId != 0 {
+		t.Errorf("GetValidSecrets should return secrets newest first: %+v", valid)
+	}
+}
+
+// Happy path: expired secrets are excluded and purged
+func TestNodeSecretManager_ClearOldSecrets(t *testing.T) {
+	store, err := NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("NewStorage error: %+v", err)
+	}
+	testManager, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+
+	err = testManager.upsertSecret(0, []byte("expired"), time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("upsertSecret error: %+v", err)
+	}
+	keyId, err := testManager.RotateSecret(csprng.NewSystemRNG(), time.Hour)
+	if err != nil {
+		t.Fatalf("RotateSecret error: %+v", err)
+	}
+
+	// RotateSecret clears expired secrets from both RAM and storage
+	if _, err = testManager.GetSecret(0); err == nil {
+		t.Errorf("Expired secret was not cleared from the manager")
+	}
+	stored, err := store.GetSecrets()
+	if err != nil {
+		t.Fatalf("GetSecrets error: %+v", err)
+	}
+	if len(stored) != 1 || stored[0].KeyId != keyId {
+		t.Errorf("Expired secret was not cleared from storage: %+v", stored)
+	}
+}
+
+// Happy path: the secret a client registered with is found by its key ID,
+// either as recorded or from storage, until the secret expires
+func TestNodeSecretManager_GetClientSecret(t *testing.T) {
+	store, err := NewStorage("", "", "", "", "", "", true)
+	if err != nil {
+		t.Fatalf("NewStorage error: %+v", err)
+	}
+	testManager, err := LoadNodeSecretManager(store, nil)
+	if err != nil {
+		t.Fatalf("LoadNodeSecretManager error: %+v", err)
+	}
+
+	err = testManager.upsertSecret(0, []byte("expiring"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("upsertSecret error: %+v", err)
+	}
+	err = testManager.UpsertSecret(1, []byte("test1234"))
+	if err != nil {
+		t.Fatalf("UpsertSecret error: %+v", err)
+	}
+
+	recorded := id.NewIdFromString("recorded", id.User, t)
+	testManager.SetClientKeyId(recorded, 1)
+	if ns, ok := testManager.GetClientSecret(recorded); !ok || ns.KeyId != 1 {
+		t.Errorf("Recorded secret of client not found: %+v", ns)
+	}
+
+	stored := id.NewIdFromString("stored", id.User, t)
+	err = store.UpsertClientRegistration(&ClientRegistration{
+		UserId: stored.Marshal(),
+		KeyId:  0,
+	})
+	if err != nil {
+		t.Fatalf("UpsertClientRegistration error: %+v", err)
+	}
+	if _, ok := testManager.GetKnownClientSecret(stored); ok {
+		t.Errorf("Known secret returned for a client only in storage")
+	}
+	if ns, ok := testManager.GetClientSecret(stored); !ok || ns.KeyId != 0 {
+		t.Errorf("Stored secret of client not found: %+v", ns)
+	}
+
+	unknown := id.NewIdFromString("unknown", id.User, t)
+	if _, ok := testManager.GetClientSecret(unknown); ok {
+		t.Errorf("Secret found for a client which never registered")
+	}
+
+	// Once its secret expires and is cleared the client is forgotten
+	testManager.secrets[0].ValidUntil = time.Now().Add(-time.Second)
+	if _, ok := testManager.GetClientSecret(stored); ok {
+		t.Errorf("Expired secret of client was returned")
+	}
+	testManager.ClearOldSecrets()
+	if _, ok := testManager.clientKeyIds[*stored]; ok {
+		t.Errorf("Client of cleared secret was not forgotten")
+	}
+}
+
+// Tests that no more than MaxClientKeyIds clients are recorded, and that
+// recording a known client again does not forget another
+func TestNodeSecretManager_SetClientKeyId_Max(t *testing.T) {
+	testManager := NewNodeSecretManager()
+	for i := 0; i < MaxClientKeyIds; i++ {
+		userId := id.ID{}
+		binary.BigEndian.PutUint32(userId[:], uint32(i))
+		testManager.SetClientKeyId(&userId, 1)
+	}
+
+	first := id.ID{}
+	testManager.SetClientKeyId(&first, 2)
+	if len(testManager.clientKeyIds) != MaxClientKeyIds {
+		t.Errorf("Recording a known client changed the number recorded."+
+			"\n\tExpected: %d\n\tReceived: %d", MaxClientKeyIds,
+			len(testManager.clientKeyIds))
+	}
+
+	testManager.SetClientKeyId(id.NewIdFromString("new", id.User, t), 1)
+	if len(testManager.clientKeyIds) != MaxClientKeyIds {
+		t.Errorf("Unexpected number of recorded clients."+
+			"\n\tExpected: %d\n\tReceived: %d", MaxClientKeyIds,
+			len(testManager.clientKeyIds))
+	}
+}
+
+// Error path: no valid secret exists
+func TestNodeSecretManager_GetActiveSecret_NoSecret(t *testing.T) {
+	testManager := NewNodeSecretManager()
+
+	err := testManager.upsertSecret(0, []byte("expired"), time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("upsertSecret error: %+v", err)
+	}
+
+	_, err = testManager.GetActiveSecret()
+	if err == nil || err.Error() != NoActiveSecretError {
+		t.Errorf("Expected error %q, received %v", NoActiveSecretError, err)
+	}
+}
+
+// Happy path: StartRotation creates a secret immediately and keeps rotating
+func TestNodeSecretManager_StartRotation(t *testing.T) {
+	testManager := NewNodeSecretManager()
+	rngGen := fastRNG.NewStreamGenerator(1, 1, csprng.NewSystemRNG)
+
+	params := SecretRotationParams{
+		RotationPeriod: 50 * time.Millisecond,
+		ValidityPeriod: time.Hour,
+	}
+	kill, err := testManager.StartRotation(params, rngGen)
+	if err != nil {
+		t.Fatalf("StartRotation error: %+v", err)
+	}
+	defer close(kill)
+
+	first, err := testManager.GetActiveSecret()
+	if err != nil {
+		t.Fatalf("StartRotation did not create an initial secret: %+v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	latest, err := testManager.GetActiveSecret()
+	if err != nil {
+		t.Fatalf("GetActiveSecret error: %+v", err)
+	}
+	if latest.KeyId <= first.KeyId {
+		t.Errorf("Secret was not rotated: key ID %d did not advance from %d",
+			latest.KeyId, first.KeyId)
+	}
+	if len(testManager.GetValidSecrets()) < 2 {
+		t.Errorf("Previous secrets should remain valid after rotation")
+	}
+}
+
+// Error path: validity period shorter than the rotation period
+func TestNodeSecretManager_StartRotation_BadParams(t *testing.T) {
+	testManager := NewNodeSecretManager()
+	rngGen := fastRNG.NewStreamGenerator(1, 1, csprng.NewSystemRNG)
+
+	_, err := testManager.StartRotation(SecretRotationParams{
+		RotationPeriod: time.Hour,
+		ValidityPeriod: time.Minute,
+	}, rngGen)
+	if err == nil {
+		t.Errorf("StartRotation should fail when secrets expire before " +
+			"they are rotated")
+	}
+}
@@ -17,9 +17,22 @@ type Storage struct {
 }
 
 // NewStorage Create a new Storage object wrapping a database interface
+// Postgres is used if its address and port are given. Otherwise, in devMode,
+// the database file at path is used if given, or else an in-memory map
 // Returns a Storage object, close function, and error
-func NewStorage(username, password, dbName, address, port string, devMode bool) (*Storage, error) {
-	db, err := newDatabase(username, password, dbName, address, port, devMode)
+func NewStorage(username, password, dbName, address, port, path string,
+	devMode bool) (*Storage, error) {
+	db, err := newDatabase(username, password, dbName, address, port, path, devMode)
 	storage := &Storage{db}
 	return storage, err
 }
+
+// Health returns nil if the database is accepting calls, otherwise an error
+// describing why it is unavailable. Only the Postgres backend can become
+// unavailable.
+func (s *Storage) Health() error {
+	if rd, ok := s.database.(*resilientDatabase); ok {
+		return rd.health()
+	}
+	return nil
+}
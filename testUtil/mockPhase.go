@@ -98,6 +98,8 @@ func (mp *MockPhase) AttemptToQueue(queue chan<- phase.Phase) bool {
 }
 func (mp *MockPhase) IsQueued() bool                      { return true }
 func (*MockPhase) UpdateFinalStates()                     { return }
+func (*MockPhase) StopRecording()                         { return }
+func (*MockPhase) Detach()                                { return }
 func (*MockPhase) GetTransmissionHandler() phase.Transmit { return nil }
 func (*MockPhase) GetTimeout() time.Duration              { return 0 }
 func (*MockPhase) Cmp(phase.Phase) bool                   { return false }
@@ -110,7 +112,7 @@ func InitMockPhase(t *testing.T) *MockPhase {
 	if t == nil {
 		panic(errors.New("ERROR: must pass in testing.T object"))
 	}
-	gc := services.NewGraphGenerator(1, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
+	gc := services.MustNewGraphGenerator(1, uint8(runtime.NumCPU()), services.AutoOutputSize, 0)
 	g := gc.NewGraph("MockGraph", &MockStream{})
 	var mockModule services.Module
 	mockModule.Adapt = func(stream services.Stream,